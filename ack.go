@@ -0,0 +1,97 @@
+package bearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// logsResponse is the acknowledgment of the records of a report by Bearer's
+// API. An empty response acknowledges all of them.
+type logsResponse struct {
+	Rejected []rejectedRecord `json:"rejected"`
+}
+
+// rejectedRecord is a record of a report rejected by Bearer's API, e.g.
+// because it's invalid.
+type rejectedRecord struct {
+	// Index is the position of the record in the report.
+	Index int `json:"index"`
+	// UUID is the UUID of the record, preferred to Index if set.
+	UUID    string `json:"uuid,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Retryable is set if the record may be accepted if sent again.
+	Retryable bool `json:"retryable,omitempty"`
+
+	record ReportLog
+}
+
+// partialError is the error of reports of which some records, but not
+// necessarily all, were rejected.
+type partialError struct {
+	rejected []rejectedRecord
+}
+
+func (e *partialError) Error() string {
+	first := e.rejected[0]
+	return fmt.Sprintf("%d records rejected, e.g. %s: %s", len(e.rejected), first.Code, first.Message)
+}
+
+// retryable returns the rejected records which may be accepted if sent again.
+func (e *partialError) retryable() []ReportLog {
+	var records []ReportLog
+	for _, rejected := range e.rejected {
+		if rejected.Retryable {
+			records = append(records, rejected.record)
+		}
+	}
+	return records
+}
+
+// permanent returns the rejections of the records which won't be accepted.
+func (e *partialError) permanent() []rejectedRecord {
+	var rejected []rejectedRecord
+	for _, r := range e.rejected {
+		if !r.Retryable {
+			rejected = append(rejected, r)
+		}
+	}
+	return rejected
+}
+
+// acknowledge parses the response to the report of records, and returns a
+// partialError if some of them were rejected.
+func acknowledge(body io.Reader, records []ReportLog) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var resp logsResponse
+	if err := json.Unmarshal(data, &resp); err != nil || len(resp.Rejected) == 0 {
+		return nil
+	}
+	byUUID := make(map[string]int, len(records))
+	for i, record := range records {
+		if record.UUID != "" {
+			byUUID[record.UUID] = i
+		}
+	}
+	partial := &partialError{}
+	for _, rejected := range resp.Rejected {
+		i, ok := byUUID[rejected.UUID]
+		if !ok {
+			i = rejected.Index
+		}
+		if i < 0 || i >= len(records) {
+			continue
+		}
+		rejected.record = records[i]
+		partial.rejected = append(partial.rejected, rejected)
+	}
+	if len(partial.rejected) == 0 {
+		return nil
+	}
+	return partial
+}
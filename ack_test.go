@@ -0,0 +1,88 @@
+package bearer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Bearer/bearer-go/fakebearer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_PartialFailure(t *testing.T) {
+	records := func() []ReportLog {
+		var records []ReportLog
+		for i := 0; i < 4; i++ {
+			records = append(records, ReportLog{Type: "REQUEST_END", Path: fmt.Sprintf("/%d", i), UUID: newUUID(), SchemaVersion: recordSchemaVersion})
+		}
+		return records
+	}
+
+	t.Run("at most once", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		fake.Validate = func(record fakebearer.Record) error {
+			if record.Path == "/1" {
+				return errors.New("invalid path")
+			}
+			return nil
+		}
+		agent := &Agent{SecretKey: "sk_test", Transport: fake}
+		defer agent.Close()
+
+		err := agent.sendRecords(records())
+		var partial *partialError
+		require.True(t, errors.As(err, &partial))
+		require.Len(t, partial.rejected, 1)
+		assert.Equal(t, "/1", partial.rejected[0].record.Path)
+		assert.Equal(t, "INVALID_RECORD", partial.rejected[0].Code)
+		assert.Len(t, fake.Records(), 3)
+		stats := agent.Stats()
+		assert.Equal(t, 3, stats.RecordsSent)
+		assert.Equal(t, 1, stats.RecordsDropped)
+	})
+
+	t.Run("at least once", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		attempts := map[string]int{}
+		fake.Validate = func(record fakebearer.Record) error {
+			attempts[record.Path]++
+			switch {
+			case record.Path == "/1":
+				return errors.New("invalid path")
+			case record.Path == "/2" && attempts[record.Path] == 1:
+				return fmt.Errorf("overloaded: %w", fakebearer.ErrRetry)
+			}
+			return nil
+		}
+		agent := &Agent{SecretKey: "sk_test", Transport: fake, Delivery: DeliveryAtLeastOnce}
+		defer agent.Close()
+
+		err := agent.sendRecords(records())
+		require.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "1 records rejected"), err.Error())
+		assert.Len(t, fake.Batches(), 2)
+		assert.Len(t, fake.Batches()[1].Logs, 1, "only the retryable record is sent again")
+		assert.Equal(t, 1, attempts["/1"])
+		assert.Len(t, fake.Records(), 3)
+		stats := agent.Stats()
+		assert.Equal(t, 3, stats.RecordsSent)
+		assert.Equal(t, 1, stats.RecordsDropped)
+	})
+}
+
+func TestAcknowledge(t *testing.T) {
+	records := []ReportLog{{UUID: "a"}, {UUID: "b"}, {}}
+	assert.NoError(t, acknowledge(strings.NewReader(""), records))
+	assert.NoError(t, acknowledge(strings.NewReader(`{}`), records))
+	assert.NoError(t, acknowledge(strings.NewReader(`{"rejected":[{"index":7}]}`), records), "unknown records are ignored")
+
+	err := acknowledge(strings.NewReader(`{"rejected":[{"index":0,"uuid":"b","code":"TOO_LARGE"},{"index":2,"retryable":true}]}`), records)
+	var partial *partialError
+	require.True(t, errors.As(err, &partial))
+	assert.Equal(t, "b", partial.rejected[0].record.UUID, "UUIDs are preferred to indexes")
+	assert.Equal(t, []ReportLog{{}}, partial.retryable())
+	assert.Len(t, partial.permanent(), 1)
+	assert.True(t, retryable(err))
+}
@@ -3,16 +3,21 @@ package bearer
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -29,6 +34,24 @@ type Agent struct {
 	// Required
 	SecretKey string
 
+	// If set, the name and version of the application in records, so that
+	// the traffic of several services sharing an account can be told apart.
+	// If empty, the path and version of the application's main module are
+	// used, from its build information. See ServiceEnricher.
+	ServiceName    string
+	ServiceVersion string
+
+	// If set, the enrichers adding information to records, in order, before
+	// they are sanitized. If nil, records are stamped by KubernetesEnricher,
+	// CloudEnricher and ServiceEnricher with ServiceName and ServiceVersion;
+	// an empty slice disables enrichment.
+	Enrichers []Enricher
+
+	// If set, the Bearer region to which records are sent, and where they
+	// are stored, e.g. RegionEU for data residency.
+	// If empty, the region of SecretKey is used, by default RegionUS.
+	Region Region
+
 	// If set, the RoundTripper interface actually used to make requests
 	// If nil, an equivalent of http.DefaultTransport is used
 	Transport http.RoundTripper
@@ -44,10 +67,400 @@ type Agent struct {
 	// If empty, will use 5s as default.
 	RefreshConfigEvery time.Duration
 
+	// If true, records are given an ID, and the records of outgoing requests
+	// performed while handling an inbound request reference the inbound request's
+	// record as parent, letting the dependency graph of each transaction be
+	// reconstructed. See InboundContext.
+	CallGraph bool
+
+	// Hosts to which a W3C Trace Context "traceparent" header is propagated
+	// when the request's context carries a trace (see Correlation) and the
+	// request has no such header yet. "*" matches every host.
+	PropagateTraceparent []string
+
+	// The handling of the requests to loopback and link-local destinations,
+	// which may bypass the agent. If unset, DefaultLocalTraffic is used.
+	LocalTraffic LocalTraffic
+
+	// If set, the local hosts, with an optional port, to which requests are
+	// instrumented even with LocalTrafficSkip, e.g. "localhost:9200".
+	LocalExceptions []string
+
+	// If set, the logical names of the APIs served by hosts, e.g. "stripe"
+	// for "api.stripe.com" and "*.stripe.com", so that records and Stats
+	// group requests by provider. Hostnames prevail over wildcard patterns.
+	// The names of the config's APINames apply to the other hosts.
+	APINames map[string]string
+
+	// If set, the hosts, and their subdomains, of the company's own
+	// services, classified as HostInternal like private IP addresses and
+	// cluster DNS names, e.g. "example.com".
+	InternalHosts []string
+
+	// If set, only the requests to hosts of these classes are captured,
+	// e.g. HostExternal to monitor third-party APIs only.
+	CaptureClasses []HostClass
+
+	// If set, the config's blocking rules apply to the requests to hosts of
+	// these classes only. ShouldBlock applies to every request.
+	BlockClasses []HostClass
+
+	// If true, blocking rules are evaluated but not enforced: requests which
+	// would have been blocked are performed, and their records are flagged.
+	BlockDryRun bool
+
+	// If set, called for every request allowed by the config's blocking rules
+	// to implement custom egress policies. Requests for which it returns an
+	// error are blocked like by the config's rules, and the error is returned
+	// to the caller; it should wrap ErrBlockedRequest.
+	ShouldBlock func(req *http.Request, config *Config) error
+
+	// Expectations on the responses of third-party APIs. Responses violating
+	// them are flagged in their records, and passed to OnViolation if set.
+	Assertions  []Assertion
+	OnViolation func(Violation)
+
+	// Validators of the requests to each host, and of their responses.
+	// Validation failures are flagged in the records like assertion violations.
+	Validators map[string]Validator
+
+	// If true, the JSON shape of the responses of each endpoint is tracked,
+	// and a drift record is reported whenever a new shape appears.
+	DetectSchemaDrift bool
+
+	// If true, the requests following the next page links of previous
+	// responses, i.e. Link headers or next page tokens of JSON bodies, are
+	// annotated with their sequence and page, showing the operations which
+	// fan out into many paged calls.
+	DetectPagination bool
+
+	// If set, the identical outgoing requests, i.e. with the same method,
+	// host, path, query and body, performed DuplicateCallThreshold times or
+	// more while handling an inbound request (see InboundContext) are
+	// flagged in their records, exposing caching opportunities.
+	DuplicateCallThreshold int
+
+	// If set, the bursts of NPlusOneThreshold requests or more differing
+	// only by an identifier of their path, e.g. "/users/42", performed while
+	// handling an inbound request with less than NPlusOneWindow, 1 second by
+	// default, between them, are reported as DIAGNOSTIC records with their
+	// count and path template once the inbound request is reported: they are
+	// typical of N+1 queries against an API.
+	NPlusOneThreshold int
+	NPlusOneWindow    time.Duration
+
+	// If set, the requests matching a rule are also sent to the rule's base
+	// URL in the background, and the differences between the responses are
+	// reported.
+	Shadows []ShadowRule
+
+	// If set, OnShadowDiff is called with the differences between the
+	// responses to shadowed requests and to their shadows.
+	OnShadowDiff func(ShadowDiff)
+
+	// If set, the compliance of the requests with each SLO is computed over
+	// its rolling window, and exposed by Stats.
+	SLOs []SLO
+
+	// If set, a summary record of the compliance of each SLO is reported regularly.
+	SLOSummaryEvery time.Duration
+
+	// If set, a summary record of the volume of the data exchanged with each
+	// host, as exposed by Stats, is reported regularly.
+	VolumeSummaryEvery time.Duration
+
+	// If set, the requests are charged to the quotas they match, whose usage
+	// is exposed by Stats. Requests exceeding a blocking quota fail with
+	// ErrQuotaExceeded, unless BlockDryRun is set.
+	Quotas []Quota
+
+	// If set, OnQuotaWarning is called when the usage of a quota reaches its
+	// WarnAt fraction or its limit, once per period.
+	OnQuotaWarning func(QuotaStatus)
+
+	// If set, requests to the hosts which answered 429 or 503 with a
+	// Retry-After header are delayed or fail with ErrRetryAfter until the
+	// hosts' window passes, according to the first matching rule.
+	RetryAfter []RetryAfterRule
+
+	// If set, requests rejected with a 401 status by the hosts of
+	// TokenRefresh are retried once with a refreshed credential.
+	TokenRefresh *TokenRefresh
+
+	// If set, the requests to each host are signed by its signer before
+	// being sent.
+	Signers map[string]Signer
+
+	// If set, the requests to each host are performed by a dedicated
+	// connection pool using its TLS configuration, e.g. for mutual TLS
+	// (see LoadClientTLSConfig). The pools are based on Transport if it is an
+	// *http.Transport, and on a default one otherwise.
+	TLSConfigs map[string]*tls.Config
+
+	// If set, the requests to a backend of a failover which fail to connect,
+	// or are answered with one of its statuses, are retried against its next
+	// backend. Records name the base URL of the backend which served them.
+	Failovers []Failover
+
+	// If set, the requests to each host connect to its address, as "ip",
+	// "ip:port" or "host:port", instead of resolving the host, e.g. for
+	// split-horizon DNS. The TLS server name and Host header are unchanged.
+	// Records name the address connected to.
+	HostAddresses map[string]string
+
+	// If set, the requests to each host connect with its dialer, e.g. to a
+	// Unix domain socket (see UnixSocketDialer) or through a SOCKS5 proxy.
+	Dialers map[string]DialFunc
+
+	// If set, the requests to hosts resolving to private, loopback or
+	// link-local addresses, such as the metadata services of clouds, fail
+	// with ErrPrivateAddress, e.g. to protect the requests to URLs supplied
+	// by users from server-side request forgery. Addresses are checked once
+	// resolved, by the dialers of the agent's transports, which connect to
+	// the addresses checked: the transports given to Wrap aren't guarded.
+	// The hosts of the requests sent through a proxy are resolved and
+	// checked before the proxy is dialed.
+	SSRFGuard bool
+	// SSRFAllowlist are the hosts, IP addresses and CIDR networks reachable
+	// despite SSRFGuard, e.g. "users.svc" or "10.1.0.0/16".
+	SSRFAllowlist []string
+
+	// If true, records carry metadata only: the method, host, path with its
+	// identifiers templated, status and timing of requests. Bodies, headers,
+	// queries and error messages are never sent, whatever the other options
+	// and the remote configuration, and schema drift isn't detected.
+	PrivacyMode bool
+
+	// The values of the headers, query parameters and body fields matching
+	// the keys of SanitizeRules are redacted by the first rule matching
+	// them, e.g. hashed or dropped, instead of being masked. The keys which
+	// are sensitive by default remain masked unless a rule matches them.
+	SanitizeRules []SanitizeRule
+
+	// The matches of Scrubbers in the bodies of records are replaced, before
+	// the ones of the scrubbers of the remote configuration.
+	Scrubbers []Scrubber
+
+	// If set, likely secrets, e.g. API keys, are looked for in the bodies of
+	// records, by their entropy, and reported as security findings.
+	SecretScan SecretScan
+
+	// The requests to external hosts over cleartext HTTP are flagged as
+	// insecure in records, and performed, upgraded to HTTPS or blocked
+	// according to the policy of their host in CleartextPolicies, or else
+	// CleartextPolicy.
+	CleartextPolicy   CleartextPolicy
+	CleartextPolicies map[string]CleartextPolicy
+
+	// TLSPolicy is the minimum security of the TLS connections of requests,
+	// unless the remote configuration has one. Enforced policies make the
+	// handshakes of the transports managed by the agent fail.
+	TLSPolicy *TLSPolicy
+
+	// The TLS connections to the hosts of CertificatePins fail unless one
+	// of the certificates of the host has one of their SPKI pins: the
+	// base64-encoded SHA-256 digests of their subject public key info, with
+	// an optional "sha256/" prefix. Mismatches are reported as security
+	// findings.
+	CertificatePins map[string][]string
+
+	// If set, the weak TLS versions, cleartext HTTP calls to external hosts
+	// and expiring certificates of requests are reported as security
+	// findings, once per host.
+	SecurityFindings bool
+
+	// SecurityCallbacks are called with the security findings of the agent,
+	// which are also reported in SECURITY_FINDING records of their own, sent
+	// without waiting for batches nor being sampled.
+	SecurityCallbacks []func(SecurityFinding)
+
+	// The headers of inbound requests which may fingerprint their users,
+	// e.g. User-Agent or cookies, are left out of records unless captured
+	// by InboundHeaders.
+	InboundHeaders InboundHeaders
+
+	// Records hold the names of the cookies of Cookie and Set-Cookie
+	// headers, but the values of the cookies named in CookieValues only.
+	CookieValues []string
+
+	// Verifiers of the signatures of the webhook deliveries of each provider
+	// received by WebhookHandler, e.g. a StripeWebhookVerifier for "stripe".
+	// The deliveries failing verification are rejected with a 401 status,
+	// without being handled, if RejectInvalidWebhooks is set.
+	WebhookVerifiers      map[string]WebhookVerifier
+	RejectInvalidWebhooks bool
+
+	// If set, the bodies captured in records are encrypted, once
+	// sanitized, with a data key per record which is sent encrypted by
+	// BodyEncryption, so that Bearer stores ciphertext only.
+	BodyEncryption KeyWrapper
+
+	// If set, the captured text bodies whose Content-Type has a charset
+	// other than UTF-8, US-ASCII, ISO-8859-1 and UTF-16, which are decoded
+	// natively, are decoded to UTF-8 by CharsetDecoder, e.g. one of
+	// charsetbearer. Bodies of unknown charsets are reported as is.
+	CharsetDecoder CharsetDecoder
+
+	// If set, the bodies captured in records which aren't valid UTF-8, e.g.
+	// binary data sent with a text content type, are base64-encoded instead
+	// of having their invalid bytes replaced by U+FFFD.
+	Base64Bodies bool
+
+	// If true, records report the first value of each header only, as a
+	// string, instead of all of its values.
+	LegacyHeaders bool
+
+	// If true, requests canceled by the application, through their context,
+	// are left out of SLOs instead of counting as failures.
+	IgnoreCanceled bool
+
+	// If set, bodies larger than MaxBodySize bytes aren't captured in
+	// records, which report their size and SHA-256 digest instead. Large
+	// response bodies, and the ones of unknown length, are digested while
+	// the application reads them, and their records are reported once the
+	// bodies are read or closed.
+	MaxBodySize int
+
+	// If set, records encoded in JSON larger than MaxRecordSize bytes are
+	// trimmed before being sent: their bodies are truncated, then their
+	// headers and query parameters removed, until they fit. Records which
+	// don't fit anyway are dropped.
+	MaxRecordSize int
+
+	// If true, the bodies captured several times in a batch of records,
+	// e.g. identical error pages, are sent once and referenced by digest.
+	DeduplicateBodies bool
+
+	// If set, records are sent to Bearer with this encoding instead of
+	// JSON, e.g. EncodingMsgPack for high volumes. The agent falls back to
+	// JSON if Bearer's API doesn't support the encoding.
+	ReportEncoding ReportEncoding
+
+	// If true, records are sent to Bearer by the goroutine which performed
+	// the request, before its response (or its body, when digested) is
+	// returned, instead of in the background, and aren't batched. Requests
+	// are then slower, but reported at most once each even on platforms
+	// which freeze background goroutines between invocations.
+	SyncReporting bool
+
+	// If set, names the endpoint template of the requests whose context
+	// doesn't carry one (see WithEndpoint), e.g. from the operation name
+	// sent by a client SDK in a header, instead of leaving them grouped by
+	// path. Requests for which it returns "" are left unnamed.
+	EndpointNamer func(req *http.Request) string
+
+	// If set, the records of the requests matching a rule, outgoing or
+	// inbound, are sampled according to the first one (see SamplingRule).
+	Sampling []SamplingRule
+
+	// If set, records are written to ReportWriter, e.g. a file, as one JSON
+	// object per line, and sent to Bearer only if SecretKey is set too.
+	// cmd/bearer-report summarizes such files.
+	ReportWriter io.Writer
+
+	// If set, OnRecord is called with every record sent, once prepared, e.g.
+	// to log it with slogbearer.
+	OnRecord func(ReportLog)
+
+	// If set, records are sent in batches of up to BatchSize records, and
+	// within BatchMaxAge of being reported however few they are, instead of
+	// one request per record. If only one is set, the other defaults to 100
+	// records or 5s. Flush sends the current batch right away.
+	BatchSize   int
+	BatchMaxAge time.Duration
+
+	// If set, records are sent with this guarantee (see Delivery) instead of
+	// at most once. Each record has a UUID, with which retries are
+	// deduplicated by Bearer.
+	Delivery Delivery
+
+	// If set, the records rejected permanently by Bearer, e.g. because they
+	// are too large or invalid, are written to DeadLetterWriter, e.g. a file,
+	// with the reason of their rejection (see DeadLetter) as one JSON object
+	// per line, instead of being only counted as dropped.
+	DeadLetterWriter io.Writer
+
+	// If set, a heartbeat record describing the agent's state, e.g. its
+	// uptime and the number of records sent, is reported regularly from the
+	// first request on, even without traffic.
+	HeartbeatEvery time.Duration
+
+	// If set, each of ProbeHosts is probed every ProbeEvery (see Probe) from
+	// the first request on, so that the availability of providers is
+	// reported even while the application doesn't call them.
+	ProbeHosts []string
+	ProbeEvery time.Duration
+
+	// If set, the agent performs these checks regularly from the first
+	// request on, and reports their results as SYNTHETIC_CHECK records,
+	// monitoring the availability and latency of dependencies.
+	SyntheticChecks []SyntheticCheck
+
+	// If set, AlertCallbacks are called in the background with the alerts
+	// raised when requests fail, are slower than AlertLatency if set, or
+	// when probes and synthetic checks fail. The alerts of a kind for a host
+	// are raised once per AlertCooldown, 5 minutes by default, so that a
+	// flapping provider doesn't flood them.
+	AlertCallbacks []func(Alert)
+	AlertLatency   time.Duration
+	AlertCooldown  time.Duration
+
+	// If set, the responses exceeding the first of ResponseSizeLimits
+	// matching their request, e.g. a list endpoint which stopped paginating,
+	// are reported as LARGE_RESPONSE records and raise AlertLargeResponse
+	// alerts. Bodies are measured as the application reads them.
+	ResponseSizeLimits []ResponseSizeLimit
+
+	// If set, the metrics of every request are passed to MetricsSinks, e.g.
+	// statsdbearer's, to be exported to a monitoring system. The sinks
+	// implementing VolumeSink receive the volume of requests too.
+	MetricsSinks []MetricsSink
+
+	// If set, the detail of the records is reduced, from full to headers
+	// only, then to metadata only, while the 99th percentile of the latency
+	// added by the agent to requests exceeds OverheadBudget, e.g. 1ms. It is
+	// restored once the overhead drops below half of the budget.
+	OverheadBudget time.Duration
+
+	// If set, the agent keeps its last AuditLogSize policy decisions, e.g.
+	// blocked requests or sanitized records, which AuditLog returns.
+	AuditLogSize int
+
+	// If set, the agent's policy decisions are written to AuditWriter too,
+	// e.g. a file, as one JSON object per line.
+	AuditWriter io.Writer
+
 	// local vars
-	configCache   *Config
-	configMutex   sync.RWMutex
-	configUpdates int
+	configCache    *Config
+	configMutex    sync.RWMutex
+	configUpdates  int
+	drift          driftDetector
+	pagination     paginationTracker
+	slos           sloTracker
+	quotas         quotaTracker
+	rateLimits     rateLimitTracker
+	tokens         tokenRefresher
+	hostTransports hostTransports
+	panics         int32
+	records        recordCounters
+	deprecation    sync.Once
+	auditLog       auditLog
+	paused         int32
+	overhead       overheadTracker
+	background     workers
+	batch          recordBatch
+	enrichers      enrichers
+	apis           apiTracker
+	inventory      inventory
+	alerts         alertTracker
+	reportWriter   sync.Mutex
+	deadLetters    sync.Mutex
+	urlCredentials sync.Map
+	scrubbers      scrubbers
+	findings       findingTracker
+	volumes        volumeTracker
+	// encodingRejected is set once Bearer's API rejected ReportEncoding.
+	encodingRejected int32
 }
 
 // Init configures the default http.DefaultTransport with sane default values
@@ -70,40 +483,268 @@ var (
 
 // RoundTrip implements the http.RoundTripper interface
 func (a *Agent) RoundTrip(req *http.Request) (*http.Response, error) {
-	for _, domain := range a.config().BlockedDomains {
-		if domain == req.URL.Hostname() {
-			return nil, ErrBlockedDomain
+	return a.roundTrip(req, nil)
+}
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as
+// an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Wrap returns an http.RoundTripper applying the agent's policies and reporting
+// on top of next, instead of the configured Transport.
+// It is useful for clients which do not use net/http to perform their requests.
+func (a *Agent) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return a.roundTrip(req, next)
+	})
+}
+
+// roundTrip performs req with transport, or with the agent's transport for
+// req's host if transport is nil.
+// Panics of the agent's code never prevent req from completing.
+func (a *Agent) roundTrip(req *http.Request, transport http.RoundTripper) (resp *http.Response, err error) {
+	skipped := a.Enabled() && a.skipsLocal(req)
+	if skipped {
+		if err := a.checkLocalBlocked(req); err != nil {
+			return nil, err
 		}
 	}
+	if !a.Enabled() || skipped {
+		if transport == nil {
+			transport = a.hostTransport(req)
+		}
+		return transport.RoundTrip(req)
+	}
+	state := &roundTripState{}
+	defer a.recoverRoundTrip(req, transport, state, &resp, &err)
+	begin := time.Now()
+	resp, err = a.doRoundTrip(req, transport, state)
+	a.observeOverhead(time.Since(begin) - state.transportTime - state.waited)
+	return resp, err
+}
+
+func (a *Agent) doRoundTrip(req *http.Request, transport http.RoundTripper, state *roundTripState) (*http.Response, error) {
+	config := a.config()
+	req = a.nameEndpoint(req)
+
+	wouldBlock := false
+	if dryRun, err := a.checkBlocked(config, req); err != nil {
+		if !dryRun && !a.BlockDryRun {
+			a.audit(AuditBlocked, req, err.Error())
+			return nil, err
+		}
+		wouldBlock = true
+		a.audit(AuditWouldBlock, req, err.Error())
+		a.logger().Info("request would be blocked", zap.String("url", redactedURL(req.URL)), zap.Error(err))
+	}
+
+	req, upgraded, err := a.applyCleartextPolicy(req)
+	if err != nil {
+		a.audit(AuditBlocked, req, err.Error())
+		return nil, err
+	}
+
+	waitStart := time.Now()
+	err = a.awaitRetryAfter(req, waitStart)
+	state.waited += time.Since(waitStart)
+	if err != nil {
+		a.audit(AuditBlocked, req, err.Error())
+		return nil, err
+	}
+
+	if err := a.consumeQuotas(config, req, time.Now()); err != nil {
+		if !a.BlockDryRun {
+			a.audit(AuditBlocked, req, err.Error())
+			return nil, err
+		}
+		wouldBlock = true
+		a.audit(AuditWouldBlock, req, err.Error())
+		a.logger().Info("request would be blocked", zap.String("url", redactedURL(req.URL)), zap.Error(err))
+	}
+
+	req, mutations := mutate(config, req)
+	if upgraded {
+		mutations = append([]string{"upgrade to HTTPS"}, mutations...)
+	}
+	if len(mutations) > 0 {
+		a.audit(AuditMutated, req, strings.Join(mutations, ", "))
+	}
+	req = a.propagateTraceparent(req)
+	capture := a.captures(config, req)
+
+	shadow := a.shadowRule(req)
+	failover, backend := a.failover(req)
 
 	var reqReader io.ReadCloser
-	if req.Body != nil && a.isAvailable() {
+	var reqBody []byte
+	signer := a.signer(req)
+	level := a.captureLevel()
+	var callBody []byte
+	if req.Body != nil && ((capture && level == captureFull) || shadow != nil || failover != nil || signer != nil || a.TokenRefresh.applies(req)) {
 		buf, err := ioutil.ReadAll(req.Body)
 		if err != nil {
 			a.logger().Error("read request body", zap.Error(err))
 			return nil, err
 		}
+		reqBody = buf
+		if !state.consumed {
+			state.consumed, state.body = true, buf
+		}
 		reqReader = ioutil.NopCloser(bytes.NewBuffer(buf))
 		req.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
+		callBody = reqBody
+	} else if req.Body != nil && a.tracksCalls(req) {
+		var err error
+		if callBody, err = a.peekRequestBody(req); err != nil {
+			a.logger().Error("read request body", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	if signer != nil {
+		var err error
+		if req, err = sign(signer, req, reqBody); err != nil {
+			a.logger().Error("sign request", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	duplicates := a.countCall(req, callBody, state)
+
+	next, addressOverride := transport, ""
+	if next == nil {
+		next = a.hostTransport(req)
+		addressOverride, _ = lookupHostString(a.HostAddresses, req.URL)
 	}
 
+	req, sent := a.countRequest(req)
 	start := time.Now()
-	resp, roundtripError := a.transport().RoundTrip(req)
-	end := time.Now()
-
-	if a.isAvailable() {
-		record := newRecord(req, resp, start, end, reqReader, a.logger(), roundtripError)
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					a.logger().Error("panic", zap.Any("r", r))
-					// FIXME: log an internal error
-				}
-			}()
-			if err := a.logRecords([]reportLog{record}); err != nil {
-				a.logger().Warn("log record", zap.Error(err))
+	state.inTransport, state.consumed = true, true
+	resp, roundtripError := next.RoundTrip(req)
+	state.inTransport = false
+	state.sent, state.resp, state.err = true, resp, roundtripError
+	// the duration is measured on the monotonic clock, immune to wall clock changes
+	end := start.Add(time.Since(start))
+	state.transportTime += end.Sub(start)
+	tlsViolation, err := a.checkTLSPolicy(config, resp)
+	if err != nil {
+		resp.Body.Close()
+		a.audit(AuditBlocked, req, err.Error())
+		resp, roundtripError = nil, err
+		state.resp, state.err = resp, roundtripError
+	}
+	if errors.Is(roundtripError, ErrPrivateAddress) {
+		a.audit(AuditBlocked, req, roundtripError.Error())
+	}
+	if err := a.checkPins(req, resp); err != nil {
+		resp.Body.Close()
+		resp, roundtripError = nil, err
+		state.resp, state.err = resp, roundtripError
+	}
+
+	a.observeSLOs(req, start, end, resp, roundtripError)
+	api := a.APIName(req.URL)
+	a.observeBurst(req, api, start)
+	a.countResponse(req, api, sent, resp)
+	a.limitResponseSize(req, api, resp)
+	a.observeAPI(api, resp, roundtripError)
+	a.observeInventory(req, api, end, resp, roundtripError)
+	a.observeAlerts(req, end.Sub(start), resp, roundtripError)
+	a.observeMetrics(req, api, end.Sub(start), resp, roundtripError)
+	a.observeSecurity(req, resp, roundtripError)
+	rateLimit := a.observeRateLimit(req, resp, end)
+	a.observeRetryAfter(req, resp, rateLimit)
+
+	if shadow != nil && roundtripError == nil {
+		a.shadow(shadow, transport, req, reqBody, resp)
+	}
+
+	if capture || len(a.Assertions) > 0 || len(a.Validators) > 0 {
+		recordResp, digest := a.digestResponseBody(resp, roundtripError)
+		recordReqReader := reqReader
+		if a.oversized(int64(len(reqBody))) {
+			recordReqReader = nil
+		}
+		if level > captureFull {
+			// bodies aren't captured to reduce the agent's overhead
+			recordResp, digest, recordReqReader = withoutBody(recordResp), nil, nil
+		}
+		record := newRecord(req, recordResp, start, end, recordReqReader, roundtripError)
+		record.Insecure = a.isCleartext(req)
+		record.TLSViolation = tlsViolation
+		a.warnURLCredentials(req)
+		a.digestRequestBody(&record, reqBody)
+		record.WouldBlock = wouldBlock
+		record.Mutations = mutations
+		record.RateLimit = newRateLimitRecord(rateLimit)
+		record.AddressOverride = addressOverride
+		record.HostClass = a.hostClass(req.URL)
+		record.API = api
+		record.Duplicates = duplicates
+		if failover != nil {
+			record.Failover = failover.Name
+			record.Backend = failover.BaseURLs[backend]
+		}
+		if a.CallGraph {
+			record.ID = newRecordID()
+			record.ParentID = parentRecordFromContext(req.Context())
+		}
+		// captured reports whether the response body is in the record, if
+		// it is parseable
+		complete := func(record ReportLog, captured bool) {
+			if a.DetectPagination {
+				record.Pagination = a.paginate(req, reqBody, resp, &record)
 			}
-		}()
+			a.checkAssertions(req, &record, captured, end.Sub(start), roundtripError)
+			a.validate(req, resp, &record)
+			if !capture {
+				return
+			}
+			if level == captureMetadata {
+				record = record.metadataOnly()
+			}
+			if !a.sampledOut(req, &record) {
+				a.report(req.Context(), record)
+			}
+			if a.DetectSchemaDrift && !a.PrivacyMode {
+				a.detectSchemaDrift(record)
+			}
+		}
+		if digest != nil {
+			// the record is complete once the application read the body
+			digest.onDone(func(size int64, body []byte, sum string) {
+				defer a.recoverPanic()
+				if body != nil && isParseableContentType.MatchString(record.ResponseContentType()) {
+					record.ResponseBody = string(body)
+				} else if sum != "" {
+					record.ResponseBodySize, record.ResponseBodySHA256 = int(size), sum
+				}
+				complete(record, body != nil)
+			})
+		} else {
+			complete(record, level <= captureFull)
+		}
+	}
+
+	refreshStart := time.Now()
+	retry := a.tokenRefreshRetry(req, reqBody, resp, start)
+	state.waited += time.Since(refreshStart)
+	if retry != nil {
+		resp.Body.Close()
+		state.sent = false
+		return a.doRoundTrip(retry, transport, state)
+	}
+	if retry := a.failoverRetry(failover, backend, req, reqBody, resp, roundtripError); retry != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		state.sent = false
+		return a.doRoundTrip(retry, transport, state)
 	}
 
 	// here we can handle retry/circuit-breaking policies, i.e.:
@@ -116,57 +757,163 @@ func (a *Agent) RoundTrip(req *http.Request) (*http.Response, error) {
 	return resp, roundtripError
 }
 
-func newRecord(req *http.Request, resp *http.Response, start, end time.Time, reqReader io.ReadCloser, logger *zap.Logger, roundtripError error) reportLog {
-	record := reportLog{
+// report sanitizes and sends record to Bearer in the background, or before
+// returning with SyncReporting, unless the agent is closed.
+func (a *Agent) report(ctx context.Context, record ReportLog) {
+	// the caller may still read the maps that sanitizing modifies
+	record.RequestHeaders = goHeadersToBearerHeaders(record.RequestHeaders)
+	record.ResponseHeaders = goHeadersToBearerHeaders(record.ResponseHeaders)
+	record.Query = url.Values(goHeadersToBearerHeaders(http.Header(record.Query)))
+	if a.SyncReporting {
+		if a.closed() {
+			a.records.add(1, errClosed)
+			return
+		}
+		a.prepareAndSend(ctx, record)
+		return
+	}
+	a.startPending()
+	started := a.goWorker(func() {
+		defer a.donePending()
+		a.prepareAndSend(ctx, record)
+	})
+	if !started {
+		a.donePending()
+		a.records.add(1, errClosed)
+	}
+}
+
+// prepareAndSend applies the privacy option, enrichers, sanitizing and
+// encryption to record, and sends it.
+func (a *Agent) prepareAndSend(ctx context.Context, record ReportLog) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.recovered(r, record.Type == recordTypeAgentHealth)
+		}
+	}()
+	if a.PrivacyMode {
+		record = record.metadataOnly()
+	}
+	record.SchemaVersion = recordSchemaVersion
+	if record.UUID == "" {
+		record.UUID = newUUID()
+	}
+	a.enrich(ctx, &record)
+	a.decodeBodies(&record)
+	filtered := record.filteredValues()
+	record.maskCookies(a.CookieValues)
+	redacted, err := record.sanitize(a.SanitizeRules)
+	if err != nil {
+		a.logger().Warn("sanitize record", zap.Error(err))
+	}
+	a.scrub(a.config(), &record)
+	a.scanSecrets(&record)
+	a.auditSanitized(&record, record.filteredValues()-filtered+redacted)
+	if a.BodyEncryption != nil {
+		if err := record.encryptBodies(a.BodyEncryption); err != nil {
+			// never send bodies in clear
+			a.logger().Warn("encrypt record bodies", zap.Error(err))
+			record.RequestBody, record.ResponseBody = "", ""
+		}
+	}
+	record.encodeInvalidBodies(a.Base64Bodies)
+	if a.MaxRecordSize > 0 && !record.trim(a.MaxRecordSize) {
+		a.logger().Warn("record too large", zap.String("type", record.Type), zap.Int("maxRecordSize", a.MaxRecordSize))
+		a.records.add(1, errRecordTooLarge)
+		return
+	}
+	a.send(record)
+}
+
+// newRecord returns the record of a request. Records must be sanitized before being sent.
+func newRecord(req *http.Request, resp *http.Response, start, end time.Time, reqReader io.ReadCloser, roundtripError error) ReportLog {
+	record := ReportLog{
 		Protocol:  req.URL.Scheme,
 		Path:      req.URL.Path,
-		Hostname:  req.URL.Hostname(),
+		Hostname:  urlHostname(req.URL),
 		Method:    req.Method,
 		StartedAt: int(start.UnixNano() / 1000000),
 		EndedAt:   int(end.UnixNano() / 1000000),
-		Type:      "REQUEST_END",
-		URL:       req.URL.String(),
+		Duration:  durationMillis(start, end),
+		Type:      recordTypeRequestEnd,
+		URL:       withoutUserinfo(normalizeURL(req.URL)).String(),
+		Attempt:   AttemptFromContext(req.Context()),
+		Probe:     isProbe(req.Context()),
+		Endpoint:  EndpointFromContext(req.Context()),
+	}
+	record.Port, _ = strconv.Atoi(urlPort(req.URL))
+	if query := req.URL.Query(); len(query) > 0 {
+		record.Query = query
+	}
+	correlation := CorrelationFromContext(req.Context())
+	if correlation.IsZero() {
+		correlation = CorrelationFromHeader(req.Header)
+	}
+	record.TraceID = correlation.TraceID
+	record.RequestID = correlation.RequestID
+	if roundtripError != nil {
+		record.ErrorCategory = classifyError(roundtripError)
+		record.ErrorMessage = errorMessage(roundtripError)
+		// the duration is then the time elapsed until cancellation
+		record.Canceled = callerCanceled(req, roundtripError)
 	}
 	if resp != nil {
 		record.StatusCode = resp.StatusCode
 		record.RequestHeaders = goHeadersToBearerHeaders(req.Header)
 		record.ResponseHeaders = goHeadersToBearerHeaders(resp.Header)
 	}
-	if roundtripError == nil && resp.Body != nil && isParseableContentType.MatchString(record.RequestContentType()) {
+	if roundtripError == nil && resp.Body != nil && isParseableContentType.MatchString(record.ResponseContentType()) {
 		buf, _ := ioutil.ReadAll(resp.Body)
 		respReader := ioutil.NopCloser(bytes.NewBuffer(buf))
 		resp.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
 		respBody, _ := ioutil.ReadAll(respReader)
 		record.ResponseBody = string(respBody)
 	}
-	if reqReader != nil && isParseableContentType.MatchString(record.ResponseContentType()) {
+	if reqReader != nil && isParseableContentType.MatchString(record.RequestContentType()) {
 		reqBody, _ := ioutil.ReadAll(reqReader)
 		record.RequestBody = string(reqBody)
 	}
-	if err := record.sanitize(); err != nil {
-		logger.Warn("sanitize record", zap.Error(err))
-	}
 	return record
 }
 
+// durationMillis returns the duration between start and end in milliseconds.
+// If both times were read from the clock, e.g. with time.Now, the duration is
+// measured on the monotonic clock. Negative durations, which may only happen
+// for times without monotonic reading, are reported as zero.
+func durationMillis(start, end time.Time) float64 {
+	duration := end.Sub(start)
+	if duration < 0 {
+		return 0
+	}
+	return float64(duration) / float64(time.Millisecond)
+}
+
 func (a *Agent) isAvailable() bool {
-	return a.SecretKey != ""
+	return a.SecretKey != "" || a.ReportWriter != nil
 }
 
 // Config fetches and returns a fresh Bearer configuration for your current token
-func (a Agent) Config() (*Config, error) {
-	req, err := http.NewRequest("GET", "https://config.bearer.sh/config", nil)
+func (a *Agent) Config() (*Config, error) {
+	configURL, err := a.endpoint("config", "/config")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", configURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create config request: %w", err)
 	}
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Authorization", a.SecretKey)
+	setAgentHeaders(req)
 
 	ret, err := a.transport().RoundTrip(req)
 	if err != nil {
 		return nil, err
 	}
 	defer ret.Body.Close()
+	if err := a.checkVersion(ret); err != nil {
+		return nil, err
+	}
 
 	// parse body
 	body, err := ioutil.ReadAll(ret.Body)
@@ -177,31 +924,35 @@ func (a Agent) Config() (*Config, error) {
 	if err := json.Unmarshal(body, &config); err != nil {
 		return nil, err
 	}
+	a.compileRejectRules(&config)
+	a.compileScrubbers(config.Scrubbers)
+	if config.Timezone != "" {
+		// resolve the timezone once, instead of on every request
+		config.location, err = time.LoadLocation(config.Timezone)
+		if err != nil {
+			a.logger().Warn("load config timezone", zap.String("timezone", config.Timezone), zap.Error(err))
+			config.location = time.UTC
+		}
+	}
 
 	return &config, nil
 }
 
-// Flush flushes any buffered log entries. Applications should take care to call Flush before exiting.
-func (a Agent) Flush() error {
-	// FIXME: this function is just a placeholder before we switch to a new async mechanism
-	return nil
-}
-
-func (a Agent) context() context.Context {
+func (a *Agent) context() context.Context {
 	if a.Context != nil {
 		return a.Context
 	}
 	return context.Background()
 }
 
-func (a Agent) logger() *zap.Logger {
+func (a *Agent) logger() *zap.Logger {
 	if a.Logger != nil {
 		return a.Logger
 	}
 	return zap.NewNop()
 }
 
-func (a Agent) transport() http.RoundTripper {
+func (a *Agent) transport() http.RoundTripper {
 	if a.Transport != nil {
 		return a.Transport
 	}
@@ -212,22 +963,28 @@ func (a *Agent) config() *Config {
 	a.configMutex.Lock()
 	defer a.configMutex.Unlock()
 	if a.configCache == nil {
-		var err error
+		if a.SecretKey == "" {
+			return &Config{}
+		}
 		a.configUpdates++
-		a.configCache, err = a.Config()
+		config, err := a.Config()
 		if err != nil {
 			a.logger().Warn("fetch bearer config", zap.Error(err))
-			return nil
+			return &Config{}
 		}
+		a.configCache = config
+		a.startHeartbeats()
+		a.startProbes()
+		a.startSyntheticChecks()
 
 		// start a goroutine to refresh config regularly
 		duration := a.RefreshConfigEvery
 		if duration <= 0 {
 			duration = 5 * time.Second
 		}
-		go func() {
-			for {
-				time.Sleep(duration)
+		a.goWorker(func() {
+			defer a.recoverPanic()
+			for a.sleep(duration) {
 				newConfig, err := a.Config()
 				if err != nil {
 					a.logger().Warn("fetch bearer config", zap.Error(err))
@@ -238,13 +995,13 @@ func (a *Agent) config() *Config {
 					a.configMutex.Unlock()
 				}
 			}
-		}()
+		})
 	}
 
 	return a.configCache
 }
 
-func (a Agent) logRecords(records []reportLog) error {
+func (a *Agent) logRecords(records []ReportLog) error {
 	if len(records) < 1 {
 		return nil
 	}
@@ -261,34 +1018,75 @@ func (a Agent) logRecords(records []reportLog) error {
 			LogLevel string `json:"log_level"`
 			// FIXME: Config
 		} `json:"agent"`
-		Logs []reportLog `json:"logs"`
+		Logs interface{} `json:"logs"`
+		// Bodies are the bodies referenced by the records, by digest.
+		Bodies map[string]string `json:"bodies,omitempty"`
+	}
+	input := logsRequest{SecretKey: a.SecretKey}
+	sent := records
+	if a.DeduplicateBodies {
+		records, input.Bodies = deduplicateBodies(records)
+	}
+	input.Logs = records
+	if a.LegacyHeaders {
+		type legacyRecord struct {
+			ReportLog
+			RequestHeaders  map[string]string `json:"requestHeaders"`
+			ResponseHeaders map[string]string `json:"responseHeaders"`
+		}
+		logs := make([]legacyRecord, len(records))
+		for i, record := range records {
+			logs[i] = legacyRecord{
+				ReportLog:       record,
+				RequestHeaders:  legacyHeaders(record.RequestHeaders),
+				ResponseHeaders: legacyHeaders(record.ResponseHeaders),
+			}
+			logs[i].SchemaVersion = legacySchemaVersion
+		}
+		input.Logs = logs
 	}
-	input := logsRequest{SecretKey: a.SecretKey, Logs: records}
 	input.Runtime.Type = "go"
 	input.Runtime.Version = runtime.Version()
-	input.Agent.Type = "bearer-go"
+	input.Agent.Type = agentName
 	input.Agent.Version = version
 	input.Agent.LogLevel = "ALL"
 
-	inputJSON, err := json.Marshal(input)
+	encoding := a.reportEncoding()
+	inputBody, err := encodeReport(input, encoding)
 	if err != nil {
 		return err
 	}
-	reqBody := ioutil.NopCloser(strings.NewReader(string(inputJSON)))
-	req, err := http.NewRequest("POST", "https://agent.bearer.sh/logs", reqBody)
+	reqBody := ioutil.NopCloser(bytes.NewReader(inputBody))
+	logsURL, err := a.endpoint("agent", "/logs")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", logsURL, reqBody)
 	if err != nil {
 		return fmt.Errorf("create logs request: %w", err)
 	}
 	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Content-Type", string(encoding))
+	req.Header.Add("Idempotency-Key", idempotencyKey(records))
+	setAgentHeaders(req)
 	ret, err := a.transport().RoundTrip(req)
 	if err != nil {
 		return fmt.Errorf("perform logs request: %w", err)
 	}
 	defer ret.Body.Close()
+	if err := a.checkVersion(ret); err != nil {
+		return err
+	}
 	switch ret.StatusCode {
 	case 200:
-		return nil
+		return acknowledge(ret.Body, sent)
+	case http.StatusUnsupportedMediaType:
+		if encoding == EncodingJSON {
+			return statusError(ret.StatusCode)
+		}
+		a.logger().Warn("report encoding rejected, falling back to JSON", zap.String("encoding", string(encoding)))
+		atomic.StoreInt32(&a.encodingRejected, 1)
+		return a.logRecords(sent)
 	default:
 		/*
 			body, err := ioutil.ReadAll(ret.Body)
@@ -304,7 +1102,7 @@ func (a Agent) logRecords(records []reportLog) error {
 			}
 		*/
 
-		return fmt.Errorf("unsupported status code: %d", ret.StatusCode)
+		return statusError(ret.StatusCode)
 	}
 }
 
@@ -1,14 +1,19 @@
 package bearer
 
 import (
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/Bearer/bearer-go/fakebearer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -58,7 +63,7 @@ func TestAgent_config(t *testing.T) {
 }
 
 func TestAgent_logRecords(t *testing.T) {
-	records := []reportLog{
+	records := []ReportLog{
 		{
 			Protocol:        "https",
 			Path:            "/sample",
@@ -69,9 +74,9 @@ func TestAgent_logRecords(t *testing.T) {
 			Type:            "REQUEST_END",
 			StatusCode:      200,
 			URL:             "http://api.example.com/sample",
-			RequestHeaders:  map[string]string{"Accept": "application/json"},
+			RequestHeaders:  map[string][]string{"Accept": {"application/json"}},
 			RequestBody:     `{"body":"data"}`,
-			ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+			ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
 			ResponseBody:    `{"ok":true}`,
 			// instrumentation: ,
 		},
@@ -142,6 +147,17 @@ func TestRoundTrip(t *testing.T) {
 		assert.Nil(t, resp)
 	})
 
+	t.Run("blocked-domain/dry-run", func(t *testing.T) {
+		fake := newFakeBearer(`{"blockedDomains":["127.0.0.1"]}`)
+		client := &http.Client{
+			Transport: &Agent{SecretKey: "sk_test", Transport: fake, BlockDryRun: true},
+		}
+		resp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		assert.Equal(t, resp.StatusCode, 200)
+		assert.True(t, fake.next(t).WouldBlock)
+	})
+
 	sk := os.Getenv("BEARER_TOKEN")
 	if sk == "" {
 		t.Skip()
@@ -179,3 +195,194 @@ func TestIsParseableContentType(t *testing.T) {
 		})
 	}
 }
+
+func TestNewRecord(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://api.example.com/sample", nil)
+	require.NoError(t, err)
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+	now := time.Now()
+
+	t.Run("attempt", func(t *testing.T) {
+		record := newRecord(req, resp, now, now, nil, nil)
+		assert.Equal(t, 0, record.Attempt)
+
+		record = newRecord(req.WithContext(WithAttempt(req.Context(), 2)), resp, now, now, nil, nil)
+		assert.Equal(t, 2, record.Attempt)
+	})
+
+	t.Run("bodies", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "https://api.example.com/sample", nil)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/plain")
+		resp := &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"ok":true}`)),
+		}
+		record := newRecord(req, resp, now, now, ioutil.NopCloser(strings.NewReader("hello")), nil)
+		assert.Equal(t, "hello", record.RequestBody)
+		assert.Equal(t, `{"ok":true}`, record.ResponseBody)
+
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp.Header.Set("Content-Type", "image/png")
+		resp.Body = ioutil.NopCloser(strings.NewReader("PNG"))
+		record = newRecord(req, resp, now, now, ioutil.NopCloser(strings.NewReader("hello")), nil)
+		assert.Equal(t, "", record.RequestBody)
+		assert.Equal(t, "", record.ResponseBody)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "https://API.example.com/users?page=2&page=3&q=blah", nil)
+		require.NoError(t, err)
+		record := newRecord(req, resp, now, now, nil, nil)
+		assert.Equal(t, "https", record.Protocol)
+		assert.Equal(t, "api.example.com", record.Hostname)
+		assert.Equal(t, 443, record.Port)
+		assert.Equal(t, "/users", record.Path)
+		assert.Equal(t, url.Values{"page": {"2", "3"}, "q": {"blah"}}, record.Query)
+		assert.Equal(t, "https://api.example.com/users?page=2&page=3&q=blah", record.URL)
+
+		req, err = http.NewRequest("GET", "http://localhost:8080/", nil)
+		require.NoError(t, err)
+		record = newRecord(req, resp, now, now, nil, nil)
+		assert.Equal(t, 8080, record.Port)
+		assert.Nil(t, record.Query)
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		resp := &http.Response{StatusCode: 200, Header: http.Header{"Set-Cookie": {"a=1", "b=2"}}}
+		record := newRecord(req, resp, now, now, nil, nil)
+		assert.Equal(t, []string{"a=1", "b=2"}, record.ResponseHeaders["Set-Cookie"])
+
+		record.ResponseHeaders["Set-Cookie"][0] = "[FILTERED]"
+		assert.Equal(t, "a=1", resp.Header.Get("Set-Cookie"), "records hold a copy of the headers")
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		start := time.Now()
+		record := newRecord(req, resp, start, start.Add(1500*time.Microsecond), nil, nil)
+		assert.Equal(t, 1.5, record.Duration)
+
+		// without monotonic readings, wall clock changes may invert times
+		wall := time.Unix(1584190800, 0)
+		record = newRecord(req, resp, wall, wall.Add(-time.Second), nil, nil)
+		assert.Equal(t, 0.0, record.Duration)
+		assert.Equal(t, record.StartedAt-1000, record.EndedAt)
+	})
+
+	t.Run("endpoint", func(t *testing.T) {
+		record := newRecord(req, resp, now, now, nil, nil)
+		assert.Equal(t, "", record.Endpoint)
+
+		record = newRecord(req.WithContext(WithEndpoint(req.Context(), "GET /sample")), resp, now, now, nil, nil)
+		assert.Equal(t, "GET /sample", record.Endpoint)
+	})
+}
+
+// fakeBearer is a fakebearer.Server used as Agent.Transport in tests, whose
+// records are read in order by next.
+type fakeBearer struct {
+	*fakebearer.Server
+	seen int
+}
+
+func newFakeBearer(config string) *fakeBearer {
+	return &fakeBearer{Server: fakebearer.New(config)}
+}
+
+// next returns the next reported record, or fails after a timeout.
+func (f *fakeBearer) next(t *testing.T) ReportLog {
+	t.Helper()
+	records, err := f.WaitRecords(f.seen+1, time.Second)
+	require.NoError(t, err, "no record reported")
+	data, err := json.Marshal(records[f.seen])
+	require.NoError(t, err)
+	f.seen++
+	var record ReportLog
+	require.NoError(t, json.Unmarshal(data, &record))
+	return record
+}
+
+func TestAgent_LegacyHeaders(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		var body []byte
+		agent := &Agent{SecretKey: "sk_test", LegacyHeaders: legacy, Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			body, _ = ioutil.ReadAll(req.Body)
+			return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})}
+		record := ReportLog{SchemaVersion: recordSchemaVersion, ResponseHeaders: map[string][]string{"Vary": {"Accept", "Origin"}}}
+		require.NoError(t, agent.logRecords([]ReportLog{record}))
+
+		var input struct {
+			Logs []map[string]interface{} `json:"logs"`
+		}
+		require.NoError(t, json.Unmarshal(body, &input))
+		require.Len(t, input.Logs, 1)
+		if legacy {
+			assert.Equal(t, map[string]interface{}{"Vary": "Accept"}, input.Logs[0]["responseHeaders"])
+			assert.Equal(t, float64(legacySchemaVersion), input.Logs[0]["schemaVersion"])
+		} else {
+			assert.Equal(t, map[string]interface{}{"Vary": []interface{}{"Accept", "Origin"}}, input.Logs[0]["responseHeaders"])
+			assert.Equal(t, float64(recordSchemaVersion), input.Logs[0]["schemaVersion"])
+		}
+		assert.Equal(t, nil, input.Logs[0]["requestHeaders"])
+	}
+}
+
+func TestAgent_SyncReporting(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, BatchSize: 10, RefreshConfigEvery: time.Hour}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Len(t, fake.Records(), 1, "the record is sent before the response is returned, unbatched")
+	assert.Equal(t, recordTypeRequestEnd, fake.Records()[0].Type)
+
+	require.NoError(t, agent.Close())
+	resp, err = client.Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Len(t, fake.Records(), 1, "closed agents don't report")
+	assert.Equal(t, 1, agent.Stats().RecordsDropped)
+}
+
+func TestAgent_EndpointNamer(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, EndpointNamer: func(req *http.Request) string {
+		return req.Header.Get("X-Operation")
+	}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	do := func(req *http.Request) string {
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		records := fake.Records()
+		return records[len(records)-1].Endpoint
+	}
+
+	req, _ := http.NewRequest("GET", api.URL+"/v1/charges/ch_1", nil)
+	req.Header.Set("X-Operation", "RetrieveCharge")
+	assert.Equal(t, "RetrieveCharge", do(req))
+	assert.Equal(t, "GET /charges/{id}", do(req.WithContext(WithEndpoint(req.Context(), "GET /charges/{id}"))), "the context's endpoint prevails")
+	req.Header.Del("X-Operation")
+	assert.Equal(t, "", do(req))
+}
+
+func TestAgent_Config_timezone(t *testing.T) {
+	agent := &Agent{SecretKey: "sk_test", Transport: newFakeBearer(`{"timezone":"Mars/Olympus_Mons"}`)}
+	config, err := agent.Config()
+	require.NoError(t, err)
+	assert.Same(t, time.UTC, config.location, "unknown timezones are resolved once, to UTC")
+
+	agent = &Agent{SecretKey: "sk_test", Transport: newFakeBearer(`{"timezone":"Europe/Paris"}`)}
+	config, err = agent.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Paris", config.Location().String())
+}
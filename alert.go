@@ -0,0 +1,145 @@
+package bearer
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultAlertCooldown is the minimum interval between the alerts of a kind
+// for a host if AlertCooldown isn't set.
+const defaultAlertCooldown = 5 * time.Minute
+
+// maxAlertHosts bounds the number of kinds and hosts whose last alerts are
+// tracked.
+const maxAlertHosts = 1000
+
+// AlertKind is the kind of problem reported by an alert.
+type AlertKind string
+
+// Kinds of alerts.
+const (
+	// AlertError is raised when a request fails with a transport error or a
+	// 5xx status.
+	AlertError AlertKind = "error"
+	// AlertLatency is raised when a request is slower than AlertLatency.
+	AlertLatency AlertKind = "latency"
+	// AlertProbeFailure is raised when a probe or a synthetic check fails.
+	AlertProbeFailure AlertKind = "probe_failure"
+	// AlertLargeResponse is raised when a response exceeds its
+	// ResponseSizeLimit.
+	AlertLargeResponse AlertKind = "large_response"
+)
+
+// Alert describes a problem detected by the agent.
+type Alert struct {
+	Kind AlertKind
+	// Host is the canonical host of the request, with its port unless it's
+	// the default one of its scheme.
+	Host string
+	// Message describes the problem, e.g. the error of a failed request.
+	Message string
+	Time    time.Time
+	// Suppressed is the number of alerts of the same kind for the same host
+	// which weren't raised during the cooldown preceding this one.
+	Suppressed int
+}
+
+// String returns a one-line description of the alert, e.g. for notifiers.
+func (a Alert) String() string {
+	s := fmt.Sprintf("%s on %s: %s", a.Kind, a.Host, a.Message)
+	if a.Suppressed > 0 {
+		s += fmt.Sprintf(" (%d similar alerts suppressed)", a.Suppressed)
+	}
+	return s
+}
+
+// alertTracker deduplicates the alerts raised during their cooldown.
+type alertTracker struct {
+	mutex sync.Mutex
+	last  map[alertKey]*alertState
+}
+
+type alertKey struct {
+	kind AlertKind
+	host string
+}
+
+type alertState struct {
+	raised     time.Time
+	suppressed int
+}
+
+func (a *Agent) alertCooldown() time.Duration {
+	if a.AlertCooldown > 0 {
+		return a.AlertCooldown
+	}
+	return defaultAlertCooldown
+}
+
+// alert raises alert, unless an alert of the same kind for the same host was
+// raised during the cooldown.
+func (a *Agent) alert(alert Alert) {
+	if len(a.AlertCallbacks) == 0 {
+		return
+	}
+	t := &a.alerts
+	t.mutex.Lock()
+	if t.last == nil {
+		t.last = make(map[alertKey]*alertState)
+	}
+	key := alertKey{alert.Kind, alert.Host}
+	state := t.last[key]
+	if state != nil && alert.Time.Sub(state.raised) < a.alertCooldown() {
+		state.suppressed++
+		t.mutex.Unlock()
+		return
+	}
+	if state != nil {
+		alert.Suppressed = state.suppressed
+	} else if len(t.last) >= maxAlertHosts {
+		t.evict(alert.Time.Add(-a.alertCooldown()))
+	}
+	// alerts aren't deduplicated while too many are in their cooldown
+	if state != nil || len(t.last) < maxAlertHosts {
+		t.last[key] = &alertState{raised: alert.Time}
+	}
+	t.mutex.Unlock()
+
+	a.goWorker(func() {
+		defer a.recoverPanic()
+		for _, callback := range a.AlertCallbacks {
+			callback(alert)
+		}
+	})
+}
+
+// evict forgets the alerts raised before since, whose cooldown is over.
+func (t *alertTracker) evict(since time.Time) {
+	for key, state := range t.last {
+		if state.raised.Before(since) {
+			delete(t.last, key)
+		}
+	}
+}
+
+// observeAlerts raises the alerts of a request which took duration, and
+// completed with resp or failed with err.
+func (a *Agent) observeAlerts(req *http.Request, duration time.Duration, resp *http.Response, err error) {
+	if len(a.AlertCallbacks) == 0 || isProbe(req.Context()) || callerCanceled(req, err) {
+		return
+	}
+	now := time.Now()
+	host := canonicalHost(req.URL)
+	path := sensitiveValues.ReplaceAllString(req.URL.Path, defaultSensitivePlaceholder)
+	switch {
+	case err != nil:
+		a.alert(Alert{Kind: AlertError, Host: host, Message: errorMessage(err), Time: now})
+	case resp.StatusCode >= 500:
+		a.alert(Alert{Kind: AlertError, Host: host, Message: fmt.Sprintf("%s %s: status %d", req.Method, path, resp.StatusCode), Time: now})
+	}
+	if a.AlertLatency > 0 && duration > a.AlertLatency {
+		a.alert(Alert{Kind: AlertLatency, Host: host, Message: fmt.Sprintf("%s %s took %s", req.Method, path, duration), Time: now})
+	}
+}
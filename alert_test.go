@@ -0,0 +1,133 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// alertRecorder collects the alerts raised by an agent.
+type alertRecorder struct {
+	mutex  sync.Mutex
+	alerts []Alert
+}
+
+func (r *alertRecorder) add(alert Alert) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.alerts = append(r.alerts, alert)
+}
+
+func (r *alertRecorder) get() []Alert {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Alert(nil), r.alerts...)
+}
+
+func TestAgent_alert(t *testing.T) {
+	var recorder alertRecorder
+	agent := &Agent{AlertCallbacks: []func(Alert){recorder.add}, AlertCooldown: time.Minute}
+	defer agent.Close()
+	now := time.Now()
+
+	agent.alert(Alert{Kind: AlertError, Host: "api.example.com", Time: now})
+	agent.alert(Alert{Kind: AlertError, Host: "api.example.com", Time: now.Add(time.Second)})
+	agent.alert(Alert{Kind: AlertError, Host: "api.example.com", Time: now.Add(2 * time.Second)})
+	agent.alert(Alert{Kind: AlertLatency, Host: "api.example.com", Time: now.Add(2 * time.Second)})
+	agent.alert(Alert{Kind: AlertError, Host: "other.example.com", Time: now.Add(2 * time.Second)})
+	agent.alert(Alert{Kind: AlertError, Host: "api.example.com", Time: now.Add(time.Minute)})
+	agent.Close()
+
+	alerts := recorder.get()
+	require.Len(t, alerts, 4)
+	var suppressed []int
+	for _, alert := range alerts {
+		if alert.Kind == AlertError && alert.Host == "api.example.com" {
+			suppressed = append(suppressed, alert.Suppressed)
+		}
+	}
+	assert.ElementsMatch(t, []int{0, 2}, suppressed, "alerts during the cooldown are counted")
+}
+
+func TestAgent_alert_bounded(t *testing.T) {
+	var recorder alertRecorder
+	agent := &Agent{AlertCallbacks: []func(Alert){recorder.add}, AlertCooldown: time.Minute}
+	defer agent.Close()
+	now := time.Now()
+
+	agent.alert(Alert{Kind: AlertError, Host: "api.example.com", Time: now})
+	for i := 0; i < maxAlertHosts+10; i++ {
+		agent.alert(Alert{Kind: AlertError, Host: "host" + strconv.Itoa(i) + ".example.com", Time: now.Add(2 * time.Minute)})
+	}
+	agent.alerts.mutex.Lock()
+	assert.Len(t, agent.alerts.last, maxAlertHosts, "expired alerts are evicted")
+	_, tracked := agent.alerts.last[alertKey{AlertError, "api.example.com"}]
+	agent.alerts.mutex.Unlock()
+	assert.False(t, tracked)
+}
+
+func TestAgent_observeAlerts_canonicalHost(t *testing.T) {
+	var recorder alertRecorder
+	agent := &Agent{AlertCallbacks: []func(Alert){recorder.add}}
+	for _, rawurl := range []string{"https://api.example.com/v1", "https://API.example.com:443/v1", "https://api.example.com./v1"} {
+		req, _ := http.NewRequest(http.MethodGet, rawurl, nil)
+		agent.observeAlerts(req, time.Second, nil, errors.New("connection refused"))
+	}
+	agent.Close()
+	alerts := recorder.get()
+	require.Len(t, alerts, 1, "alerts are deduplicated by canonical host")
+	assert.Equal(t, "api.example.com", alerts[0].Host)
+}
+
+func TestAgent_AlertCallbacks(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer api.Close()
+
+	var recorder alertRecorder
+	agent := &Agent{AlertCallbacks: []func(Alert){recorder.add}, AlertLatency: 10 * time.Millisecond, Transport: http.DefaultTransport}
+	client := &http.Client{Transport: agent}
+	resp, err := client.Get(api.URL + "/users/12345")
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = client.Get(api.URL + "/slow")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Error(t, agent.Probe(context.Background(), api.URL))
+	agent.runCheck(context.Background(), SyntheticCheck{Name: "api", URL: api.URL})
+	agent.Close()
+
+	alerts := recorder.get()
+	require.Len(t, alerts, 3, "errors of a host are deduplicated, probe failures too")
+	kinds := map[AlertKind]Alert{}
+	for _, alert := range alerts {
+		kinds[alert.Kind] = alert
+	}
+	assert.Equal(t, "GET /users/12345: status 502", kinds[AlertError].Message)
+	assert.Equal(t, strings.TrimPrefix(api.URL, "http://"), kinds[AlertLatency].Host)
+	assert.Contains(t, kinds[AlertProbeFailure].Message, "status 502")
+}
+
+func TestAgent_observeAlerts_canceled(t *testing.T) {
+	var recorder alertRecorder
+	agent := &Agent{AlertCallbacks: []func(Alert){recorder.add}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.com", nil)
+	agent.observeAlerts(req.WithContext(ctx), time.Second, nil, errors.New("context canceled"))
+	agent.Close()
+	assert.Empty(t, recorder.get())
+}
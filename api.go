@@ -0,0 +1,96 @@
+package bearer
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// APIStatus is the usage of an API, as named by Agent.APINames or the
+// config's, since the agent started.
+type APIStatus struct {
+	Name     string
+	Requests int
+	// Failures are the requests which failed, or were answered with a 5xx status.
+	Failures int
+}
+
+// apiTracker counts the requests to each named API.
+type apiTracker struct {
+	mutex    sync.Mutex
+	statuses map[string]*APIStatus
+}
+
+// APIName returns the logical name of the API served by the host of u, e.g.
+// "stripe" for api.stripe.com, according to Agent.APINames then to the
+// config's, or "" if unnamed.
+func (a *Agent) APIName(u *url.URL) string {
+	if name := apiName(a.APINames, u); name != "" {
+		return name
+	}
+	return apiName(a.config().APINames, u)
+}
+
+// apiName returns the name of the host of u in names, which are keyed by
+// hostname or by a wildcard pattern matching hostnames, such as
+// "*.stripe.com". Hostnames prevail over patterns, and longer patterns over
+// shorter ones.
+func apiName(names map[string]string, u *url.URL) string {
+	if len(names) == 0 {
+		return ""
+	}
+	hostname := urlHostname(u)
+	if name, ok := names[hostname]; ok {
+		return name
+	}
+	best, name := "", ""
+	for pattern, n := range names {
+		if !strings.Contains(pattern, "*") || len(pattern) < len(best) {
+			continue
+		}
+		if matchWildcard(strings.ToLower(pattern), hostname) && (len(pattern) > len(best) || pattern < best) {
+			best, name = pattern, n
+		}
+	}
+	return name
+}
+
+// observeAPI counts a request to a named API.
+func (a *Agent) observeAPI(api string, resp *http.Response, err error) {
+	if api == "" {
+		return
+	}
+	t := &a.apis
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.statuses == nil {
+		t.statuses = map[string]*APIStatus{}
+	}
+	status := t.statuses[api]
+	if status == nil {
+		status = &APIStatus{Name: api}
+		t.statuses[api] = status
+	}
+	status.Requests++
+	if err != nil || resp == nil || resp.StatusCode >= 500 {
+		status.Failures++
+	}
+}
+
+// apiStatuses returns the usage of the named APIs, by name.
+func (a *Agent) apiStatuses() []APIStatus {
+	t := &a.apis
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.statuses) == 0 {
+		return nil
+	}
+	statuses := make([]APIStatus, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
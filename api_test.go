@@ -0,0 +1,59 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIName(t *testing.T) {
+	names := map[string]string{
+		"api.stripe.com":     "stripe",
+		"*.stripe.com":       "stripe",
+		"*.sendgrid.net":     "sendgrid",
+		"*.eu.sendgrid.net":  "sendgrid-eu",
+		"hooks.sendgrid.net": "sendgrid-hooks",
+	}
+	tests := map[string]string{
+		"https://api.stripe.com/v1/charges": "stripe",
+		"https://files.stripe.com/":         "stripe",
+		"https://API.Stripe.com:443/":       "stripe",
+		"https://api.sendgrid.net/":         "sendgrid",
+		"https://api.eu.sendgrid.net/":      "sendgrid-eu",
+		"https://hooks.sendgrid.net/":       "sendgrid-hooks",
+		"https://stripe.com/":               "",
+		"https://example.com/":              "",
+	}
+	for rawURL, expected := range tests {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, apiName(names, u), rawURL)
+	}
+}
+
+func TestAgent_APINames(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/error" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer api.Close()
+	fake := newFakeBearer(`{"apiNames":{"127.0.0.1":"config-name","localhost":"local"}}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, APINames: map[string]string{"127.0.0.1": "payments"}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for _, path := range []string{"/ok", "/error"} {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, "payments", fake.Records()[0].API, "the agent's names prevail")
+	assert.Equal(t, []APIStatus{{Name: "payments", Requests: 2, Failures: 1}}, agent.Stats().APIs)
+
+	u, _ := url.Parse("http://localhost/")
+	assert.Equal(t, "local", agent.APIName(u))
+}
@@ -0,0 +1,145 @@
+package bearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Assertion declares expectations on the responses to the requests matching
+// all of its non-empty conditions. Conditions are the same as BlockRule's.
+// Responses violating an assertion are flagged in their records.
+type Assertion struct {
+	Host   string
+	Method string
+	Path   string
+
+	// Statuses are the expected status codes; any status is expected if empty.
+	Statuses []int
+	// JSONFields are the fields expected in JSON response bodies, as
+	// dot-separated paths, e.g. "data.id".
+	JSONFields []string
+	// MaxLatency is the maximum expected duration of the requests; unbounded if zero.
+	MaxLatency time.Duration
+}
+
+// Violation describes a response which didn't meet the expectations of an Assertion.
+type Violation struct {
+	Assertion  Assertion
+	Request    *http.Request
+	StatusCode int
+	Duration   time.Duration
+	// Reasons describe the unmet expectations.
+	Reasons []string
+	// Err is the error returned by the transport, if any.
+	Err error
+}
+
+// Validator validates requests and their responses, e.g. against an API specification.
+type Validator interface {
+	// Validate returns the reasons why req or resp is invalid, if any.
+	// The bodies of req and resp are consumed: reqBody and respBody hold
+	// their content if it was captured, and are empty otherwise.
+	Validate(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) []string
+}
+
+// check returns the reasons why a response violates a, if any. JSONFields
+// aren't checked unless the response body was captured.
+func (a Assertion) check(record *ReportLog, captured bool, duration time.Duration, err error) []string {
+	var reasons []string
+	if err != nil {
+		return []string{fmt.Sprintf("request failed: %v", err)}
+	}
+	if len(a.Statuses) > 0 {
+		expected := false
+		for _, status := range a.Statuses {
+			if status == record.StatusCode {
+				expected = true
+				break
+			}
+		}
+		if !expected {
+			reasons = append(reasons, fmt.Sprintf("unexpected status %d", record.StatusCode))
+		}
+	}
+	if a.MaxLatency > 0 && duration > a.MaxLatency {
+		reasons = append(reasons, fmt.Sprintf("latency %s above %s", duration, a.MaxLatency))
+	}
+	if len(a.JSONFields) > 0 && captured {
+		var body interface{}
+		if strings.Contains(record.ResponseContentType(), "json") && json.Unmarshal([]byte(record.ResponseBody), &body) == nil {
+			for _, field := range a.JSONFields {
+				if !hasJSONField(body, field) {
+					reasons = append(reasons, fmt.Sprintf("missing field %q", field))
+				}
+			}
+		} else {
+			reasons = append(reasons, "response is not JSON")
+		}
+	}
+	return reasons
+}
+
+// checkAssertions flags record with the violations of the agent's assertions
+// matching req, and calls OnViolation for each of them. Captured reports
+// whether the response body is in record.
+func (a *Agent) checkAssertions(req *http.Request, record *ReportLog, captured bool, duration time.Duration, err error) {
+	for _, assertion := range a.Assertions {
+		if !matchRequest(req, assertion.Host, assertion.Method, assertion.Path) {
+			continue
+		}
+		reasons := assertion.check(record, captured, duration, err)
+		if len(reasons) == 0 {
+			continue
+		}
+		record.Violations = append(record.Violations, reasons...)
+		if a.OnViolation != nil {
+			a.OnViolation(Violation{
+				Assertion:  assertion,
+				Request:    req,
+				StatusCode: record.StatusCode,
+				Duration:   duration,
+				Reasons:    reasons,
+				Err:        err,
+			})
+		}
+	}
+}
+
+// hasJSONField reports whether the dot-separated path exists in value.
+func hasJSONField(value interface{}, path string) bool {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// validate flags record with the failures of the validator of req's host, if any.
+func (a *Agent) validate(req *http.Request, resp *http.Response, record *ReportLog) {
+	if len(a.Validators) == 0 || resp == nil {
+		return
+	}
+	var validator Validator
+	for _, key := range hostKeys(req.URL) {
+		if v, ok := a.Validators[key]; ok {
+			validator = v
+			break
+		}
+	}
+	if validator == nil {
+		return
+	}
+	reasons := validator.Validate(req, []byte(record.RequestBody), resp, []byte(record.ResponseBody))
+	for _, reason := range reasons {
+		// reasons may quote captured values
+		record.Violations = append(record.Violations, sensitiveValues.ReplaceAllString(reason, defaultSensitivePlaceholder))
+	}
+}
@@ -0,0 +1,130 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Assertions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/users/42":
+			w.Write([]byte(`{"data":{"id":42,"name":"blah"}}`))
+		case "/slow":
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	var violations []Violation
+	agent := &Agent{
+		Assertions: []Assertion{
+			{Path: "/users/*", Statuses: []int{200}, JSONFields: []string{"data.id", "data.name"}},
+			{Path: "/slow", MaxLatency: 10 * time.Millisecond},
+		},
+		OnViolation: func(v Violation) { violations = append(violations, v) },
+	}
+	client := &http.Client{Transport: agent}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"/users/42", nil},
+		{"/users/43", []string{"unexpected status 404", `missing field "data.id"`, `missing field "data.name"`}},
+		{"/slow", []string{"latency"}},
+		{"/other", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			violations = nil
+			resp, err := client.Get(ts.URL + test.path)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			if test.expected == nil {
+				assert.Empty(t, violations)
+				return
+			}
+			require.Len(t, violations, 1)
+			require.Len(t, violations[0].Reasons, len(test.expected))
+			for idx, reason := range test.expected {
+				assert.Contains(t, violations[0].Reasons[idx], reason)
+			}
+			assert.Equal(t, test.path, violations[0].Request.URL.Path)
+		})
+	}
+}
+
+func TestHasJSONField(t *testing.T) {
+	body := map[string]interface{}{"a": map[string]interface{}{"b": nil}, "c": 42}
+	assert.True(t, hasJSONField(body, "a"))
+	assert.True(t, hasJSONField(body, "a.b"))
+	assert.True(t, hasJSONField(body, "c"))
+	assert.False(t, hasJSONField(body, "c.d"))
+	assert.False(t, hasJSONField(body, "a.c"))
+	assert.False(t, hasJSONField([]interface{}{}, "a"))
+}
+
+type validatorFunc func(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) []string
+
+func (f validatorFunc) Validate(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) []string {
+	return f(req, reqBody, resp, respBody)
+}
+
+func TestAgent_validate(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://api.example.com/users/42", nil)
+	require.NoError(t, err)
+	resp := &http.Response{StatusCode: 200}
+	record := ReportLog{ResponseBody: `{"email":"contact@example.com"}`}
+	agent := &Agent{
+		Validators: map[string]Validator{
+			"api.example.com": validatorFunc(func(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) []string {
+				assert.Equal(t, `{"email":"contact@example.com"}`, string(respBody))
+				return []string{`invalid email "contact@example.com"`}
+			}),
+		},
+	}
+
+	agent.validate(req, resp, &record)
+	assert.Equal(t, []string{`invalid email "[FILTERED].com"`}, record.Violations)
+
+	other, err := http.NewRequest("GET", "https://other.example.com/users/42", nil)
+	require.NoError(t, err)
+	record = ReportLog{}
+	agent.validate(other, resp, &record)
+	assert.Empty(t, record.Violations)
+}
+
+func TestAgent_Assertions_digestedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"id":42,"name":"` + strings.Repeat("x", 100) + `"}}`))
+	}))
+	defer ts.Close()
+
+	var violations []Violation
+	agent := &Agent{
+		MaxBodySize: 50,
+		Assertions:  []Assertion{{JSONFields: []string{"data.id"}}},
+		OnViolation: func(v Violation) { violations = append(violations, v) },
+	}
+	resp, err := (&http.Client{Transport: agent}).Get(ts.URL)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, violations, "bodies which aren't captured aren't checked")
+}
@@ -0,0 +1,133 @@
+package bearer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AuditDecision is the kind of a policy decision made by the agent.
+type AuditDecision string
+
+// Policy decisions.
+const (
+	// AuditBlocked is the decision to fail a request, e.g. because of a
+	// blocking rule, a quota or a Retry-After window.
+	AuditBlocked AuditDecision = "blocked"
+	// AuditWouldBlock is the decision to let through a request which would
+	// have been blocked in dry run.
+	AuditWouldBlock AuditDecision = "would_block"
+	// AuditMutated is the decision to modify a request with mutation rules.
+	AuditMutated AuditDecision = "mutated"
+	// AuditSanitized is the decision to filter values of a record.
+	AuditSanitized AuditDecision = "sanitized"
+	// AuditSampledOut is the decision to leave out the record of a request
+	// with sampling rules.
+	AuditSampledOut AuditDecision = "sampled_out"
+	// AuditRejected is the decision not to capture a request matching a
+	// reject rule of the config.
+	AuditRejected AuditDecision = "rejected"
+)
+
+// AuditEntry describes a policy decision made by the agent.
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	Decision AuditDecision `json:"decision"`
+	Method   string        `json:"method,omitempty"`
+	Host     string        `json:"host,omitempty"`
+	// Path is sanitized like the paths of records.
+	Path string `json:"path,omitempty"`
+	// Reason explains the decision, e.g. the error returned by a blocked
+	// request or the mutations applied.
+	Reason string `json:"reason,omitempty"`
+	// Count is the number of values filtered by sanitized decisions.
+	Count int `json:"count,omitempty"`
+}
+
+// auditLog is the ring buffer of the agent's latest policy decisions.
+type auditLog struct {
+	mutex   sync.Mutex
+	entries []AuditEntry
+	next    int
+}
+
+// AuditLog returns the latest policy decisions of the agent, the oldest first.
+func (a *Agent) AuditLog() []AuditEntry {
+	a.auditLog.mutex.Lock()
+	defer a.auditLog.mutex.Unlock()
+	entries := a.auditLog.entries
+	ret := make([]AuditEntry, 0, len(entries))
+	return append(append(ret, entries[a.auditLog.next:]...), entries[:a.auditLog.next]...)
+}
+
+// audit records a policy decision about req, if audits are enabled.
+func (a *Agent) audit(decision AuditDecision, req *http.Request, reason string) {
+	if a.AuditLogSize <= 0 && a.AuditWriter == nil {
+		return
+	}
+	entry := AuditEntry{Time: time.Now(), Decision: decision, Reason: reason}
+	if req != nil {
+		entry.Method = req.Method
+		entry.Host = req.URL.Host
+		entry.Path = sensitiveValues.ReplaceAllString(req.URL.Path, defaultSensitivePlaceholder)
+	}
+	entry.Reason = sensitiveValues.ReplaceAllString(entry.Reason, defaultSensitivePlaceholder)
+	a.addAuditEntry(entry)
+}
+
+// auditSanitized records the number of values filtered in record.
+func (a *Agent) auditSanitized(record *ReportLog, count int) {
+	if count == 0 || (a.AuditLogSize <= 0 && a.AuditWriter == nil) {
+		return
+	}
+	a.addAuditEntry(AuditEntry{
+		Time:     time.Now(),
+		Decision: AuditSanitized,
+		Method:   record.Method,
+		Host:     record.Hostname,
+		Path:     record.Path,
+		Reason:   record.Type,
+		Count:    count,
+	})
+}
+
+func (a *Agent) addAuditEntry(entry AuditEntry) {
+	a.auditLog.mutex.Lock()
+	defer a.auditLog.mutex.Unlock()
+	if a.AuditLogSize > 0 {
+		if len(a.auditLog.entries) < a.AuditLogSize {
+			a.auditLog.entries = append(a.auditLog.entries, entry)
+		} else {
+			a.auditLog.entries[a.auditLog.next] = entry
+			a.auditLog.next = (a.auditLog.next + 1) % len(a.auditLog.entries)
+		}
+	}
+	if a.AuditWriter != nil {
+		// one JSON object per line; the lock keeps lines whole
+		line, _ := json.Marshal(entry)
+		if _, err := a.AuditWriter.Write(append(line, '\n')); err != nil {
+			a.logger().Warn("write audit entry", zap.Error(err))
+		}
+	}
+}
+
+// filteredValues returns the number of values of r replaced by the
+// placeholder of sanitized values.
+func (r *ReportLog) filteredValues() int {
+	count := strings.Count(r.URL, defaultSensitivePlaceholder) +
+		strings.Count(r.ErrorMessage, defaultSensitivePlaceholder) +
+		strings.Count(r.RequestBody, defaultSensitivePlaceholder) +
+		strings.Count(r.ResponseBody, defaultSensitivePlaceholder)
+	for _, headers := range []map[string][]string{r.RequestHeaders, r.ResponseHeaders} {
+		for _, values := range headers {
+			for _, value := range values {
+				count += strings.Count(value, defaultSensitivePlaceholder)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,69 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_AuditLog(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+
+	var file bytes.Buffer
+	fake := newFakeBearer(`{"blockedDomains":["blocked.example.com"]}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, AuditLogSize: 10, AuditWriter: &file}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	_, err := client.Get("http://blocked.example.com/users/jane@example.com")
+	assert.True(t, errors.Is(err, ErrBlockedDomain))
+	req, _ := http.NewRequest("GET", api.URL, nil)
+	req.Header.Set("Authorization", "secret")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	fake.next(t)
+
+	var entries []AuditEntry
+	require.Eventually(t, func() bool {
+		entries = agent.AuditLog()
+		return len(entries) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, AuditBlocked, entries[0].Decision)
+	assert.Equal(t, "GET", entries[0].Method)
+	assert.Equal(t, "blocked.example.com", entries[0].Host)
+	assert.NotContains(t, entries[0].Path, "jane", "paths are sanitized")
+	assert.Equal(t, ErrBlockedDomain.Error(), entries[0].Reason)
+	assert.Equal(t, AuditSanitized, entries[1].Decision)
+	assert.Equal(t, 1, entries[1].Count)
+
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	require.Len(t, lines, 2)
+	var entry AuditEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, AuditBlocked, entry.Decision)
+}
+
+func TestAgent_AuditLog_ring(t *testing.T) {
+	agent := &Agent{AuditLogSize: 2}
+	assert.Empty(t, agent.AuditLog())
+	for _, reason := range []string{"a", "b", "c"} {
+		agent.audit(AuditBlocked, nil, reason)
+	}
+	entries := agent.AuditLog()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "b", entries[0].Reason)
+	assert.Equal(t, "c", entries[1].Reason)
+
+	disabled := &Agent{}
+	disabled.audit(AuditBlocked, nil, "a")
+	assert.Empty(t, disabled.AuditLog())
+}
@@ -0,0 +1,47 @@
+// Package awsbearer reports AWS API calls performed with github.com/aws/aws-sdk-go-v2 to Bearer.
+//
+// Calls are grouped by service and operation (for instance "S3.PutObject")
+// instead of by their raw, signed URLs:
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	awsbearer.Install(agent, &cfg)
+//	client := s3.NewFromConfig(cfg)
+package awsbearer
+
+import (
+	"net/http"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// Install configures cfg so that clients created from it send their requests through agent.
+// The HTTP client already configured on cfg, if any, is kept and used by the agent.
+func Install(agent *bearer.Agent, cfg *aws.Config) {
+	cfg.HTTPClient = NewHTTPClient(agent, cfg.HTTPClient)
+}
+
+// NewHTTPClient returns an aws.HTTPClient performing requests with client
+// through agent. If client is nil, the SDK's default HTTP client is used.
+func NewHTTPClient(agent *bearer.Agent, client aws.HTTPClient) aws.HTTPClient {
+	if client == nil {
+		client = awshttp.NewBuildableClient()
+	}
+	transport := agent.Wrap(bearer.RoundTripperFunc(client.Do))
+	return httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+		if service != "" && operation != "" {
+			req = req.WithContext(bearer.WithEndpoint(ctx, service+"."+operation))
+		}
+		return transport.RoundTrip(req)
+	})
+}
+
+type httpClientFunc func(*http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
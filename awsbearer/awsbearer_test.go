@@ -0,0 +1,50 @@
+package awsbearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	var endpoint string
+	base := httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		endpoint = bearer.EndpointFromContext(req.Context())
+		return http.DefaultClient.Do(req)
+	})
+	cfg := aws.Config{HTTPClient: base}
+	Install(&bearer.Agent{}, &cfg)
+
+	t.Run("operation", func(t *testing.T) {
+		req, err := http.NewRequest("POST", ts.URL, nil)
+		require.NoError(t, err)
+		ctx := awsmiddleware.SetServiceID(req.Context(), "DynamoDB")
+		ctx = awsmiddleware.SetOperationName(ctx, "GetItem")
+
+		resp, err := cfg.HTTPClient.Do(req.WithContext(ctx))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "DynamoDB.GetItem", endpoint)
+	})
+
+	t.Run("no-operation", func(t *testing.T) {
+		req, err := http.NewRequest("GET", ts.URL, nil)
+		require.NoError(t, err)
+
+		resp, err := cfg.HTTPClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, "", endpoint)
+	})
+}
@@ -0,0 +1,171 @@
+package bearer
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultBatchSize is the maximum number of records of a batch if only
+	// BatchMaxAge is set.
+	defaultBatchSize = 100
+	// defaultBatchMaxAge is the maximum age of the records of a batch if
+	// only BatchSize is set.
+	defaultBatchMaxAge = 5 * time.Second
+)
+
+// recordBatch holds the records waiting to be sent, and counts those being
+// prepared.
+type recordBatch struct {
+	mutex   sync.Mutex
+	records []ReportLog
+	// generation is incremented whenever the batch is taken, so that the
+	// flusher of a batch sent because it was full leaves the next one alone.
+	generation int
+	pending    int
+	idle       *sync.Cond
+}
+
+// batching reports whether records are sent in batches.
+func (a *Agent) batching() bool {
+	return a.BatchSize > 0 || a.BatchMaxAge > 0
+}
+
+func (a *Agent) batchSize() int {
+	if a.BatchSize > 0 {
+		return a.BatchSize
+	}
+	return defaultBatchSize
+}
+
+func (a *Agent) batchMaxAge() time.Duration {
+	if a.BatchMaxAge > 0 {
+		return a.BatchMaxAge
+	}
+	return defaultBatchMaxAge
+}
+
+// startPending counts a record being prepared, until donePending.
+func (a *Agent) startPending() {
+	b := &a.batch
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.pending++
+}
+
+func (a *Agent) donePending() {
+	b := &a.batch
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.pending--
+	if b.idle != nil {
+		b.idle.Broadcast()
+	}
+}
+
+// send sends a prepared record, right away or with the next batch. A batch
+// is sent once it holds BatchSize records, or once its first record is
+// BatchMaxAge old, whichever comes first.
+func (a *Agent) send(record ReportLog) {
+	// security findings are shipped on their own, without waiting for batches
+	if !a.batching() || a.SyncReporting || record.Type == recordTypeSecurityFinding {
+		a.sendRecords([]ReportLog{record})
+		return
+	}
+	b := &a.batch
+	b.mutex.Lock()
+	b.records = append(b.records, record)
+	var full []ReportLog
+	if len(b.records) >= a.batchSize() {
+		full = b.take()
+	} else if len(b.records) == 1 {
+		generation := b.generation
+		started := a.goWorker(func() {
+			defer a.recoverPanic()
+			// the batch is sent early if the agent is closed
+			a.sleep(a.batchMaxAge())
+			b.mutex.Lock()
+			var records []ReportLog
+			if b.generation == generation {
+				records = b.take()
+			}
+			b.mutex.Unlock()
+			a.sendRecords(records)
+		})
+		if !started {
+			full = b.take()
+		}
+	}
+	b.mutex.Unlock()
+	a.sendRecords(full)
+}
+
+// take returns the records of the batch, and starts a new one. The lock of
+// the batch must be held.
+func (b *recordBatch) take() []ReportLog {
+	records := b.records
+	b.records = nil
+	b.generation++
+	return records
+}
+
+// sendRecords sends records to Bearer, ReportWriter and OnRecord, and counts
+// them.
+func (a *Agent) sendRecords(records []ReportLog) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if a.OnRecord != nil {
+		for _, record := range records {
+			a.OnRecord(record)
+		}
+	}
+	var err error
+	if a.ReportWriter != nil {
+		err = a.writeRecords(records)
+	}
+	if a.SecretKey != "" {
+		if logErr := a.deliver(records); logErr != nil {
+			err = logErr
+			a.writeDeadLetters(records, logErr)
+		}
+	}
+	a.records.add(len(records), err)
+	if err != nil {
+		a.logger().Warn("log records", zap.Int("records", len(records)), zap.Error(err))
+	}
+	return err
+}
+
+// Flush sends the records reported so far, waiting for those still being
+// prepared and sending the current batch without waiting for BatchMaxAge.
+// Applications should take care to call Flush before exiting.
+func (a *Agent) Flush() error {
+	b := &a.batch
+	b.mutex.Lock()
+	if b.idle == nil {
+		b.idle = sync.NewCond(&b.mutex)
+	}
+	for b.pending > 0 {
+		b.idle.Wait()
+	}
+	records := b.take()
+	b.mutex.Unlock()
+	return a.sendRecords(records)
+}
+
+// writeRecords writes records to ReportWriter, one per line.
+func (a *Agent) writeRecords(records []ReportLog) error {
+	a.reportWriter.Lock()
+	defer a.reportWriter.Unlock()
+	encoder := json.NewEncoder(a.ReportWriter)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
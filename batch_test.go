@@ -0,0 +1,118 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Batching(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	get := func(t *testing.T, client *http.Client) {
+		resp, err := client.Get(api.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	t.Run("size", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		agent := &Agent{SecretKey: "sk_test", Transport: fake, BatchSize: 3, BatchMaxAge: time.Hour}
+		defer agent.Close()
+		client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+		for i := 0; i < 4; i++ {
+			get(t, client)
+		}
+		_, err := fake.WaitRecords(3, time.Second)
+		require.NoError(t, err)
+		require.Len(t, fake.Batches(), 1)
+		assert.Len(t, fake.Batches()[0].Logs, 3)
+
+		require.NoError(t, agent.Flush())
+		require.Len(t, fake.Batches(), 2, "the last record is flushed")
+		assert.Len(t, fake.Batches()[1].Logs, 1)
+		assert.Equal(t, 4, agent.Stats().RecordsSent)
+	})
+
+	t.Run("age", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		agent := &Agent{SecretKey: "sk_test", Transport: fake, BatchMaxAge: 50 * time.Millisecond}
+		defer agent.Close()
+		client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+		start := time.Now()
+		get(t, client)
+		get(t, client)
+		records, err := fake.WaitRecords(2, time.Second)
+		require.NoError(t, err)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.Len(t, records, 2)
+		assert.Len(t, fake.Batches(), 1)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		agent := &Agent{SecretKey: "sk_test", Transport: fake, RefreshConfigEvery: time.Hour, BatchSize: 10, BatchMaxAge: time.Hour}
+		client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+		get(t, client)
+		require.NoError(t, agent.Close())
+		assert.Len(t, fake.Records(), 1, "the batch is sent on close")
+	})
+}
+
+func TestAgent_Flush(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	defer agent.Close()
+	for i := 0; i < 5; i++ {
+		agent.reportHeartbeat(time.Now(), time.Now())
+	}
+	require.NoError(t, agent.Flush())
+	assert.Len(t, fake.Records(), 5, "records being sent are waited for")
+}
+
+func TestAgent_ReportWriter(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	var out bytes.Buffer
+	agent := &Agent{ReportWriter: &out, SyncReporting: true}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(api.URL + "/users")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2, "records are written without a secret key")
+	var record ReportLog
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "/users", record.Path)
+	assert.Equal(t, 2, agent.Stats().RecordsSent)
+}
+
+func TestAgent_OnRecord(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	var records []ReportLog
+	agent := &Agent{ReportWriter: ioutil.Discard, SyncReporting: true, OnRecord: func(record ReportLog) {
+		records = append(records, record)
+	}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	resp, err := client.Get(api.URL + "/users?token=secret")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Len(t, records, 1)
+	assert.Equal(t, "/users", records[0].Path)
+	assert.NotEmpty(t, records[0].UUID, "records are prepared")
+}
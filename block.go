@@ -0,0 +1,213 @@
+package bearer
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlockRule blocks the requests matching all of its non-empty conditions.
+type BlockRule struct {
+	// Host is the host of blocked requests, with an optional port (see matchHost).
+	Host string `json:"host,omitempty"`
+	// Method is the HTTP method of blocked requests, case-insensitive.
+	Method string `json:"method,omitempty"`
+	// Path is a pattern matching the path of blocked requests, where "*"
+	// matches any sequence of characters, including slashes.
+	// For instance "/admin/*" matches "/admin/users/42".
+	Path string `json:"path,omitempty"`
+
+	// DryRun makes the rule evaluated but not enforced: matching requests
+	// proceed normally and their records are flagged as "wouldBlock".
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Windows restrict the rule to periods of time, evaluated in the config's
+	// timezone. The rule applies at any time if empty.
+	Windows []TimeWindow `json:"windows,omitempty"`
+}
+
+// Matches reports whether req, performed at now, is blocked by r.
+// A rule without any request condition matches no request.
+func (r BlockRule) Matches(req *http.Request, now time.Time) bool {
+	if r.Host == "" && r.Method == "" && r.Path == "" {
+		return false
+	}
+	return inWindows(r.Windows, now) && matchRequest(req, r.Host, r.Method, r.Path)
+}
+
+// inWindows reports whether now is within one of windows, or windows is
+// empty.
+func inWindows(windows []TimeWindow, now time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRequest reports whether req matches the non-empty conditions among
+// host, method and path, where path is a wildcard pattern matched against
+// the cleaned path of req, so that "//admin/x" or "/x/../admin/x" can't
+// bypass a rule on "/admin/*".
+func matchRequest(req *http.Request, host, method, path string) bool {
+	if host != "" && !matchHost(host, req.URL) {
+		return false
+	}
+	if method != "" && !strings.EqualFold(method, req.Method) {
+		return false
+	}
+	if path != "" && !matchWildcard(path, cleanPath(req.URL.Path)) {
+		return false
+	}
+	return true
+}
+
+// cleanPath returns the shortest path equivalent to p (see path.Clean),
+// keeping its trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return p
+	}
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// TimeWindow is a period of time recurring every day or on some days of the week.
+type TimeWindow struct {
+	// Days are the days of the week on which the window starts, as their
+	// English names or three-letter abbreviations, case-insensitive
+	// (e.g. "Monday" or "sat"). The window starts every day if empty.
+	Days []string `json:"days,omitempty"`
+	// Start and End are the times of day, formatted as "15:04", at which the
+	// window starts (inclusive) and ends (exclusive). A window ending earlier
+	// than it starts spans midnight.
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Contains reports whether t is within w, in t's location.
+// A window with invalid times contains nothing.
+func (w TimeWindow) Contains(t time.Time) bool {
+	start, ok := parseTimeOfDay(w.Start)
+	if !ok {
+		return false
+	}
+	end, ok := parseTimeOfDay(w.End)
+	if !ok {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return w.startsOn(t.Weekday()) && minute >= start && minute < end
+	}
+	// spanning midnight
+	yesterday := (t.Weekday() + 6) % 7
+	return w.startsOn(t.Weekday()) && minute >= start || w.startsOn(yesterday) && minute < end
+}
+
+func (w TimeWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	name := strings.ToLower(day.String())
+	for _, d := range w.Days {
+		d = strings.ToLower(d)
+		if d == name || d == name[:3] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeOfDay returns the number of minutes since midnight of a "15:04" time.
+func parseTimeOfDay(value string) (int, bool) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, false
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || hours == 24 && minutes > 0 {
+		return 0, false
+	}
+	return hours*60 + minutes, true
+}
+
+// checkBlocked returns an error if req is blocked by config or ShouldBlock,
+// and whether the error comes from dry-run rules only.
+func (a *Agent) checkBlocked(config *Config, req *http.Request) (dryRun bool, err error) {
+	if a.classIn(req, a.BlockClasses) {
+		dryRun, err = checkBlocked(config, req, time.Now())
+	}
+	if err != nil && !dryRun {
+		return false, err
+	}
+	if a.ShouldBlock != nil {
+		if customErr := a.ShouldBlock(req, config); customErr != nil {
+			return false, customErr
+		}
+	}
+	return dryRun, err
+}
+
+// checkBlocked returns an error if req, performed at now, is blocked by config,
+// and whether the error comes from dry-run rules only, and thus shouldn't be enforced.
+func checkBlocked(config *Config, req *http.Request, now time.Time) (dryRun bool, err error) {
+	for _, domain := range config.BlockedDomains {
+		if matchHost(domain, req.URL) {
+			return false, ErrBlockedDomain
+		}
+	}
+	now = now.In(config.Location())
+	for _, rule := range config.BlockRules {
+		if !rule.Matches(req, now) {
+			continue
+		}
+		if !rule.DryRun {
+			return false, ErrBlockedRequest
+		}
+		dryRun, err = true, ErrBlockedRequest
+	}
+	return dryRun, err
+}
+
+// matchWildcard reports whether s matches pattern, where "*" matches any
+// sequence of characters.
+func matchWildcard(pattern, s string) bool {
+	// greedy matching with backtracking on the last star only, which is
+	// enough as a star matches any sequence
+	p, i := 0, 0
+	star, match := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, i
+			p++
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star >= 0:
+			p = star + 1
+			match++
+			i = match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,176 @@
+package bearer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBlocked(t *testing.T) {
+	config := &Config{
+		BlockedDomains: []string{"blocked.example.com", "bücher.example"},
+		BlockRules: []BlockRule{
+			{Host: "api.example.com", Method: "DELETE", Path: "/admin/*"},
+			{Method: "PUT", Path: "/*/readonly"},
+			{},
+			{Host: "api.example.com", Path: "/beta/*", DryRun: true},
+			{Host: "api.example.com", Method: "POST", Path: "/beta/*"},
+		},
+	}
+	tests := []struct {
+		method   string
+		url      string
+		expected error
+		dryRun   bool
+	}{
+		{"GET", "https://blocked.example.com/", ErrBlockedDomain, false},
+		{"GET", "https://BLOCKED.Example.com./", ErrBlockedDomain, false},
+		{"GET", "https://xn--bcher-kva.example/", ErrBlockedDomain, false},
+		{"GET", "https://BÜCHER.example/", ErrBlockedDomain, false},
+		{"DELETE", "https://API.example.com/admin/users", ErrBlockedRequest, false},
+		{"GET", "https://api.example.com/admin/users", nil, false},
+		{"DELETE", "https://api.example.com/admin/users", ErrBlockedRequest, false},
+		{"delete", "https://api.example.com/admin/users/42", ErrBlockedRequest, false},
+		{"DELETE", "https://api.example.com/admin", nil, false},
+		{"DELETE", "https://api.example.com//admin/users", ErrBlockedRequest, false},
+		{"DELETE", "https://api.example.com/x/../admin/users", ErrBlockedRequest, false},
+		{"DELETE", "https://api.example.com/admin/./users/", ErrBlockedRequest, false},
+		{"DELETE", "https://api.example.com/admin/../users", nil, false},
+		{"DELETE", "https://other.example.com/admin/users", nil, false},
+		{"PUT", "https://other.example.com/users/readonly", ErrBlockedRequest, false},
+		{"PUT", "https://other.example.com/users/readonly/42", nil, false},
+		{"GET", "https://api.example.com/beta/users", ErrBlockedRequest, true},
+		{"POST", "https://api.example.com/beta/users", ErrBlockedRequest, false},
+	}
+	for _, test := range tests {
+		t.Run(test.method+" "+test.url, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, nil)
+			require.NoError(t, err)
+			dryRun, err := checkBlocked(config, req, time.Now())
+			assert.Equal(t, test.expected, err)
+			assert.Equal(t, test.dryRun, dryRun)
+		})
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		input    string
+		expected bool
+	}{
+		{"", "", true},
+		{"", "/", false},
+		{"*", "", true},
+		{"*", "/blah/blih", true},
+		{"/blah", "/blah", true},
+		{"/blah", "/blah/", false},
+		{"/blah/*", "/blah/", true},
+		{"/blah/*", "/blah/blih/bloh", true},
+		{"/blah/*", "/blih/blah", false},
+		{"/*/blih", "/blah/bloh/blih", true},
+		{"/*/blih/*", "/blah/blih/blih/bluh", true},
+		{"/*a*b", "/xaxbxb", true},
+		{"/*a*b", "/xaxbxc", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, matchWildcard(test.pattern, test.input), "%q ~ %q", test.pattern, test.input)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	for p, expected := range map[string]string{
+		"":               "",
+		"/":              "/",
+		"//admin/x":      "/admin/x",
+		"/x/../admin/x":  "/admin/x",
+		"/admin/x/":      "/admin/x/",
+		"/admin//x//":    "/admin/x/",
+		"admin/x":        "/admin/x",
+		"/../../etc/pwd": "/etc/pwd",
+	} {
+		assert.Equal(t, expected, cleanPath(p), p)
+	}
+}
+
+func TestCheckBlocked_windows(t *testing.T) {
+	config := &Config{
+		Timezone: "America/New_York",
+		BlockRules: []BlockRule{
+			{Host: "sandbox.example.com", Windows: []TimeWindow{{Start: "18:00", End: "09:00"}, {Days: []string{"sat", "Sunday"}, Start: "00:00", End: "24:00"}}},
+		},
+	}
+	req, err := http.NewRequest("GET", "https://sandbox.example.com/", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		now      string
+		expected error
+	}{
+		{"2020-03-04T14:00:00Z", nil},               // wednesday 09:00 in New York
+		{"2020-03-04T13:59:00Z", ErrBlockedRequest}, // wednesday 08:59 in New York
+		{"2020-03-04T23:00:00Z", ErrBlockedRequest}, // wednesday 18:00 in New York
+		{"2020-03-04T22:59:00Z", nil},               // wednesday 17:59 in New York
+		{"2020-03-07T19:00:00Z", ErrBlockedRequest}, // saturday 14:00 in New York
+		{"2020-03-09T15:00:00Z", nil},               // monday 11:00 in New York
+	}
+	for _, test := range tests {
+		now, err := time.Parse(time.RFC3339, test.now)
+		require.NoError(t, err)
+		_, err = checkBlocked(config, req, now)
+		assert.Equal(t, test.expected, err, test.now)
+	}
+}
+
+func TestTimeWindow_Contains(t *testing.T) {
+	monday := time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		window   TimeWindow
+		at       time.Time
+		expected bool
+	}{
+		{TimeWindow{Start: "09:00", End: "18:00"}, monday.Add(9 * time.Hour), true},
+		{TimeWindow{Start: "09:00", End: "18:00"}, monday.Add(18 * time.Hour), false},
+		{TimeWindow{Days: []string{"mon"}, Start: "09:00", End: "18:00"}, monday.Add(10 * time.Hour), true},
+		{TimeWindow{Days: []string{"tue"}, Start: "09:00", End: "18:00"}, monday.Add(10 * time.Hour), false},
+		{TimeWindow{Days: []string{"sun"}, Start: "22:00", End: "02:00"}, monday.Add(time.Hour), true},
+		{TimeWindow{Days: []string{"mon"}, Start: "22:00", End: "02:00"}, monday.Add(time.Hour), false},
+		{TimeWindow{Days: []string{"mon"}, Start: "22:00", End: "02:00"}, monday.Add(23 * time.Hour), true},
+		{TimeWindow{Start: "00:00", End: "24:00"}, monday.Add(23*time.Hour + 59*time.Minute), true},
+		{TimeWindow{Start: "9h", End: "18:00"}, monday.Add(10 * time.Hour), false},
+		{TimeWindow{Start: "09:00", End: "25:00"}, monday.Add(10 * time.Hour), false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.window.Contains(test.at), "%+v at %s", test.window, test.at)
+	}
+}
+
+func TestAgent_ShouldBlock(t *testing.T) {
+	errNotAllowed := fmt.Errorf("not in allow-list: %w", ErrBlockedRequest)
+	config := &Config{BlockRules: []BlockRule{{Host: "beta.example.com", DryRun: true}}}
+	agent := &Agent{
+		ShouldBlock: func(req *http.Request, config *Config) error {
+			if req.URL.Hostname() != "api.example.com" {
+				return errNotAllowed
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequest("GET", "https://api.example.com/", nil)
+	require.NoError(t, err)
+	dryRun, err := agent.checkBlocked(config, req)
+	assert.False(t, dryRun)
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest("GET", "https://beta.example.com/", nil)
+	require.NoError(t, err)
+	dryRun, err = agent.checkBlocked(config, req)
+	assert.False(t, dryRun)
+	assert.True(t, errors.Is(err, ErrBlockedRequest))
+	assert.Equal(t, errNotAllowed, err)
+}
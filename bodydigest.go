@@ -0,0 +1,170 @@
+package bearer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// oversized reports whether a body of size bytes exceeds MaxBodySize.
+func (a *Agent) oversized(size int64) bool {
+	return a.MaxBodySize > 0 && size > int64(a.MaxBodySize)
+}
+
+// bodyDigest returns the hex-encoded SHA-256 digest of body.
+func bodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// digestRequestBody sets the size and digest of the request body in record
+// if it exceeds MaxBodySize, in which case the body must not be captured.
+func (a *Agent) digestRequestBody(record *ReportLog, body []byte) {
+	if a.oversized(int64(len(body))) {
+		record.RequestBodySize = len(body)
+		record.RequestBodySHA256 = bodyDigest(body)
+	}
+}
+
+// maxInboundBody bounds the bodies held in memory if MaxBodySize isn't set,
+// e.g. the bodies of inbound requests.
+const maxInboundBody = 1 << 20
+
+// boundedBody holds the beginning of a body, up to limit bytes, and the size
+// and SHA-256 digest of the whole body.
+type boundedBody struct {
+	limit int
+	buf   bytes.Buffer
+	size  int64
+	hash  hash.Hash
+}
+
+// newBoundedBody returns a body holding up to MaxBodySize bytes, or else
+// maxInboundBody.
+func (a *Agent) newBoundedBody() *boundedBody {
+	return &boundedBody{limit: a.bodyLimit(), hash: sha256.New()}
+}
+
+// bodyLimit returns the maximum size of the bodies held in memory:
+// MaxBodySize, or else maxInboundBody.
+func (a *Agent) bodyLimit() int {
+	if a.MaxBodySize > 0 {
+		return a.MaxBodySize
+	}
+	return maxInboundBody
+}
+
+// readBoundedBody returns the body of r, nil if r is nil.
+func (a *Agent) readBoundedBody(r io.Reader) *boundedBody {
+	if r == nil {
+		return nil
+	}
+	b := a.newBoundedBody()
+	io.Copy(b, r)
+	return b
+}
+
+func (b *boundedBody) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	b.hash.Write(p)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// inboundBody returns the reader of b from which the record of an inbound
+// request is built, nil if b is nil or exceeds its limit, in which case its
+// size and digest are returned for the record.
+func inboundBody(b *boundedBody) (io.ReadCloser, int, string) {
+	if b == nil {
+		return nil, 0, ""
+	}
+	if b.size > int64(b.buf.Len()) {
+		return nil, int(b.size), hex.EncodeToString(b.hash.Sum(nil))
+	}
+	return ioutil.NopCloser(bytes.NewReader(b.buf.Bytes())), 0, ""
+}
+
+// digestResponseBody returns the response from which the record of a request
+// is built. If the body of resp may exceed MaxBodySize, i.e. its length is
+// unknown or too large, it is replaced by a digestingBody holding its
+// beginning and computing its size and digest while the application reads
+// it, and the returned response has no body so that it isn't captured.
+func (a *Agent) digestResponseBody(resp *http.Response, err error) (*http.Response, *digestingBody) {
+	if a.MaxBodySize <= 0 || err != nil || resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, nil
+	}
+	if resp.ContentLength >= 0 && !a.oversized(resp.ContentLength) {
+		return resp, nil
+	}
+	limit := a.MaxBodySize
+	if resp.ContentLength >= 0 {
+		// the body is too large: there is no need to hold it
+		limit = 0
+	}
+	digest := &digestingBody{ReadCloser: resp.Body, body: &boundedBody{limit: limit, hash: sha256.New()}}
+	resp.Body = digest
+	recordResp := *resp
+	recordResp.Body = nil
+	return &recordResp, digest
+}
+
+// digestingBody holds the beginning of a response body, and computes its
+// size and SHA-256 digest, as it is read.
+type digestingBody struct {
+	io.ReadCloser
+	body *boundedBody
+
+	once sync.Once
+	done func(size int64, body []byte, digest string)
+}
+
+func (d *digestingBody) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	d.body.Write(p[:n])
+	if err == io.EOF {
+		d.finish(true)
+	}
+	return n, err
+}
+
+func (d *digestingBody) Close() error {
+	err := d.ReadCloser.Close()
+	d.finish(false)
+	return err
+}
+
+// onDone sets the function called once the body is read entirely, or
+// closed. Bodies read entirely are passed if they don't exceed MaxBodySize,
+// their digest otherwise. Neither is passed if the body was closed before its
+// end.
+func (d *digestingBody) onDone(done func(size int64, body []byte, digest string)) {
+	d.done = done
+}
+
+func (d *digestingBody) finish(complete bool) {
+	d.once.Do(func() {
+		if d.done == nil {
+			return
+		}
+		switch {
+		case !complete:
+			d.done(d.body.size, nil, "")
+		case d.body.size > int64(d.body.buf.Len()):
+			d.done(d.body.size, nil, hex.EncodeToString(d.body.hash.Sum(nil)))
+		default:
+			// empty bodies are passed too
+			d.done(d.body.size, append([]byte{}, d.body.buf.Bytes()...), "")
+		}
+	})
+}
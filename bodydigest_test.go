@@ -0,0 +1,138 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAgent_MaxBodySize(t *testing.T) {
+	small, large := `{"id":1}`, `{"items":["`+strings.Repeat("x", 100)+`"]}`
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/large" {
+			// stream the body, with an unknown length
+			w.Write([]byte(large[:10]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(large[10:]))
+			return
+		}
+		w.Write([]byte(small))
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		reqBody  string
+		readBody string // the body read by the application, if any
+		want     ReportLog
+	}{
+		{name: "small", path: "/small", reqBody: small, readBody: small, want: ReportLog{RequestBody: small, ResponseBody: small}},
+		{name: "large", path: "/large", reqBody: large, readBody: large, want: ReportLog{
+			RequestBodySize: len(large), RequestBodySHA256: sha256Hex(large),
+			ResponseBodySize: len(large), ResponseBodySHA256: sha256Hex(large),
+		}},
+		{name: "closed early", path: "/large", reqBody: small, want: ReportLog{RequestBody: small}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeBearer(`{}`)
+			agent := &Agent{SecretKey: "sk_test", Transport: fake, MaxBodySize: 50}
+			client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+			resp, err := client.Post(api.URL+test.path, "application/json", strings.NewReader(test.reqBody))
+			require.NoError(t, err)
+			if test.readBody != "" {
+				body, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, test.readBody, string(body))
+			}
+			resp.Body.Close()
+
+			record := fake.next(t)
+			assert.Equal(t, test.want.RequestBody, record.RequestBody)
+			assert.Equal(t, test.want.ResponseBody, record.ResponseBody)
+			assert.Equal(t, test.want.RequestBodySize, record.RequestBodySize)
+			assert.Equal(t, test.want.RequestBodySHA256, record.RequestBodySHA256)
+			assert.Equal(t, test.want.ResponseBodySize, record.ResponseBodySize)
+			assert.Equal(t, test.want.ResponseBodySHA256, record.ResponseBodySHA256)
+		})
+	}
+}
+
+func TestMiddleware_MaxBodySize(t *testing.T) {
+	large := `{"items":["` + strings.Repeat("x", 100) + `"]}`
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, MaxBodySize: 50}
+	handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body[:10])
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(large))
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, large[:10], string(body))
+
+	record := fake.next(t)
+	assert.Empty(t, record.RequestBody)
+	assert.Equal(t, len(large), record.RequestBodySize)
+	assert.Equal(t, sha256Hex(large), record.RequestBodySHA256)
+	assert.Equal(t, large[:10], record.ResponseBody)
+	assert.Zero(t, record.ResponseBodySize)
+}
+
+func TestAgent_MaxBodySize_streamed(t *testing.T) {
+	release := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer api.Close()
+	defer close(release)
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, MaxBodySize: 50}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	done := make(chan *http.Response)
+	go func() {
+		resp, err := client.Get(api.URL)
+		assert.NoError(t, err)
+		done <- resp
+	}()
+	var resp *http.Response
+	select {
+	case resp = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the response is returned before its body is received")
+	}
+	release <- struct{}{}
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, `{"id":1}`, string(body))
+
+	record := fake.next(t)
+	assert.Equal(t, `{"id":1}`, record.ResponseBody, "bodies of unknown length are captured once read")
+	assert.Zero(t, record.ResponseBodySize)
+}
@@ -0,0 +1,93 @@
+package bearer
+
+import (
+	"encoding/binary"
+	"mime"
+	"strings"
+	"unicode/utf16"
+)
+
+// CharsetDecoder decodes text bodies to UTF-8.
+type CharsetDecoder interface {
+	// DecodeCharset returns body, encoded in charset, decoded to UTF-8, or
+	// false if charset isn't supported. The charset is lowercase, e.g.
+	// "shift_jis" or "windows-1252".
+	DecodeCharset(charset string, body []byte) (string, bool)
+}
+
+// CharsetDecoderFunc is an adapter allowing the use of ordinary functions as
+// CharsetDecoder.
+type CharsetDecoderFunc func(charset string, body []byte) (string, bool)
+
+// DecodeCharset calls f(charset, body).
+func (f CharsetDecoderFunc) DecodeCharset(charset string, body []byte) (string, bool) {
+	return f(charset, body)
+}
+
+// decodeBodies decodes the bodies of the record to UTF-8, according to the
+// charset of their content type.
+func (a *Agent) decodeBodies(r *ReportLog) {
+	r.RequestBody = a.decodeBody(r.RequestContentType(), r.RequestBody)
+	r.ResponseBody = a.decodeBody(r.ResponseContentType(), r.ResponseBody)
+}
+
+// decodeBody returns body decoded to UTF-8 according to the charset of
+// contentType, or as is if the charset is unknown.
+func (a *Agent) decodeBody(contentType, body string) string {
+	if body == "" || contentType == "" {
+		return body
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return body
+	}
+	charset := strings.ToLower(strings.TrimSpace(params["charset"]))
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return body
+	case "iso-8859-1", "iso8859-1", "latin1", "l1":
+		return decodeLatin1(body)
+	case "utf-16", "utf-16be", "utf-16le":
+		return decodeUTF16(charset, body)
+	}
+	if a.CharsetDecoder != nil {
+		if decoded, ok := a.CharsetDecoder.DecodeCharset(charset, []byte(body)); ok {
+			return decoded
+		}
+	}
+	return body
+}
+
+// decodeLatin1 decodes body, encoded in ISO-8859-1, whose bytes are the
+// first 256 code points.
+func decodeLatin1(body string) string {
+	var b strings.Builder
+	b.Grow(len(body))
+	for i := 0; i < len(body); i++ {
+		b.WriteRune(rune(body[i]))
+	}
+	return b.String()
+}
+
+// decodeUTF16 decodes body, encoded in UTF-16, big endian unless charset is
+// utf-16le or body starts with a little endian byte order mark.
+func decodeUTF16(charset string, body string) string {
+	data := []byte(body)
+	var order binary.ByteOrder = binary.BigEndian
+	if charset == "utf-16le" {
+		order = binary.LittleEndian
+	}
+	if charset == "utf-16" && len(data) >= 2 {
+		switch {
+		case data[0] == 0xff && data[1] == 0xfe:
+			order, data = binary.LittleEndian, data[2:]
+		case data[0] == 0xfe && data[1] == 0xff:
+			data = data[2:]
+		}
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,26 @@
+package bearer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgent_decodeBody(t *testing.T) {
+	agent := &Agent{}
+	assert.Equal(t, "héllo", agent.decodeBody("text/plain; charset=ISO-8859-1", "h\xe9llo"))
+	assert.Equal(t, "héllo", agent.decodeBody("text/plain; charset=utf-8", "héllo"))
+	assert.Equal(t, "h\xe9llo", agent.decodeBody("text/plain", "h\xe9llo"), "the charset defaults to UTF-8")
+	assert.Equal(t, "hé", agent.decodeBody("text/plain; charset=utf-16", "\xff\xfeh\x00\xe9\x00"))
+	assert.Equal(t, "hé", agent.decodeBody("text/plain; charset=UTF-16BE", "\x00h\x00\xe9"))
+	assert.Equal(t, "\x82\xa0", agent.decodeBody("text/plain; charset=Shift_JIS", "\x82\xa0"), "unknown charsets are left as is")
+
+	agent.CharsetDecoder = CharsetDecoderFunc(func(charset string, body []byte) (string, bool) {
+		if charset != "shift_jis" {
+			return "", false
+		}
+		return "あ", true
+	})
+	assert.Equal(t, "あ", agent.decodeBody("text/plain; charset=Shift_JIS", "\x82\xa0"))
+	assert.Equal(t, "\x82\xa0", agent.decodeBody("text/plain; charset=koi8-r", "\x82\xa0"))
+}
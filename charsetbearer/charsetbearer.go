@@ -0,0 +1,28 @@
+// Package charsetbearer decodes the text bodies captured by the agent from
+// the charsets of the WHATWG Encoding Standard, e.g. Shift_JIS, EUC-KR or
+// windows-1252, using golang.org/x/text:
+//
+//	agent.CharsetDecoder = charsetbearer.Decoder{}
+package charsetbearer
+
+import (
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Decoder decodes bodies from the charsets known to golang.org/x/text by
+// their WHATWG names or labels. It implements bearer.CharsetDecoder.
+type Decoder struct{}
+
+// DecodeCharset returns body, encoded in charset, decoded to UTF-8, or false
+// if charset is unknown or body can't be decoded.
+func (Decoder) DecodeCharset(charset string, body []byte) (string, bool) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return "", false
+	}
+	decoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
@@ -0,0 +1,46 @@
+package charsetbearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder(t *testing.T) {
+	decoded, ok := Decoder{}.DecodeCharset("shift_jis", []byte("\x82\xa0"))
+	require.True(t, ok)
+	assert.Equal(t, "あ", decoded)
+
+	decoded, ok = Decoder{}.DecodeCharset("windows-1252", []byte("\x80"))
+	require.True(t, ok)
+	assert.Equal(t, "€", decoded)
+
+	_, ok = Decoder{}.DecodeCharset("unknown", []byte("a"))
+	assert.False(t, ok)
+}
+
+func TestDecoder_Agent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=EUC-KR")
+		w.Write([]byte("\xc7\xd1"))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	agent := &bearer.Agent{ReportWriter: &buf, SyncReporting: true, CharsetDecoder: Decoder{}}
+	resp, err := (&http.Client{Transport: agent}).Get(ts.URL)
+	require.NoError(t, err)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var record bearer.ReportLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "한", record.ResponseBody)
+}
@@ -0,0 +1,28 @@
+module github.com/Bearer/bearer-go/charsetbearer
+
+go 1.24
+
+require (
+	github.com/Bearer/bearer-go v0.0.0-00010101000000-000000000000
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/text v0.14.0
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.5.0 // indirect
+	go.uber.org/multierr v1.3.0 // indirect
+	go.uber.org/tools v0.0.0-20190618225709-2cfd321de3ee // indirect
+	go.uber.org/zap v1.13.0 // indirect
+	golang.org/x/lint v0.0.0-20190930215403-16217165b5de // indirect
+	golang.org/x/mod v0.8.0 // indirect
+	golang.org/x/net v0.6.0 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/tools v0.6.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+	honnef.co/go/tools v0.0.1-2019.2.3 // indirect
+)
+
+replace github.com/Bearer/bearer-go => ../
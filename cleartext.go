@@ -0,0 +1,60 @@
+package bearer
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CleartextPolicy is the handling of the requests to external hosts over
+// cleartext HTTP, whose records are flagged as insecure.
+type CleartextPolicy int
+
+const (
+	// CleartextAllow performs cleartext requests as they are.
+	CleartextAllow CleartextPolicy = iota
+	// CleartextUpgrade performs cleartext requests over HTTPS instead.
+	CleartextUpgrade
+	// CleartextBlock fails cleartext requests with ErrCleartextHTTP.
+	CleartextBlock
+)
+
+// isCleartext reports whether req is sent to an external host over
+// cleartext HTTP.
+func (a *Agent) isCleartext(req *http.Request) bool {
+	return req.URL.Scheme == "http" && a.hostClass(req.URL) == HostExternal
+}
+
+// cleartextPolicy returns the policy of the host of req, from
+// CleartextPolicies or else CleartextPolicy.
+func (a *Agent) cleartextPolicy(req *http.Request) CleartextPolicy {
+	for _, key := range hostKeys(req.URL) {
+		if policy, ok := a.CleartextPolicies[key]; ok {
+			return policy
+		}
+	}
+	return a.CleartextPolicy
+}
+
+// applyCleartextPolicy returns req upgraded to HTTPS, and true, if it is a
+// cleartext request to upgrade, or ErrCleartextHTTP if it is to block.
+func (a *Agent) applyCleartextPolicy(req *http.Request) (*http.Request, bool, error) {
+	if !a.isCleartext(req) {
+		return req, false, nil
+	}
+	switch a.cleartextPolicy(req) {
+	case CleartextUpgrade:
+		upgraded := req.Clone(req.Context())
+		upgraded.URL.Scheme = "https"
+		if hostname := upgraded.URL.Hostname(); upgraded.URL.Port() == "80" {
+			// the default port of HTTP becomes the one of HTTPS
+			upgraded.URL.Host = hostname
+			if strings.Contains(hostname, ":") {
+				upgraded.URL.Host = "[" + hostname + "]"
+			}
+		}
+		return upgraded, true, nil
+	case CleartextBlock:
+		return req, false, ErrCleartextHTTP
+	}
+	return req, false, nil
+}
@@ -0,0 +1,49 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_CleartextPolicy(t *testing.T) {
+	var urls []string
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		urls = append(urls, req.URL.String())
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+	var out bytes.Buffer
+	agent := &Agent{ReportWriter: &out, SyncReporting: true, CleartextPolicies: map[string]CleartextPolicy{
+		"upgraded.example.com": CleartextUpgrade,
+		"blocked.example.com":  CleartextBlock,
+	}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(transport)}
+
+	for _, u := range []string{"http://api.example.com/users", "http://upgraded.example.com:80/users", "http://users.svc/users"} {
+		resp, err := client.Get(u)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	_, err := client.Get("http://blocked.example.com/users")
+	assert.True(t, errors.Is(err, ErrCleartextHTTP))
+
+	assert.Equal(t, []string{"http://api.example.com/users", "https://upgraded.example.com/users", "http://users.svc/users"}, urls)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	var records [3]ReportLog
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &records[i]))
+	}
+	assert.True(t, records[0].Insecure, "cleartext requests to external hosts are insecure")
+	assert.False(t, records[1].Insecure)
+	assert.Equal(t, []string{"upgrade to HTTPS"}, records[1].Mutations)
+	assert.False(t, records[2].Insecure, "internal hosts may be called over HTTP")
+}
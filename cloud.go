@@ -0,0 +1,39 @@
+package bearer
+
+// cloudEnvironment identifies the serverless service running the
+// application in records.
+type cloudEnvironment struct {
+	Provider string `json:"provider"`
+	Region   string `json:"region,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// newCloudEnvironment returns the serverless service running the
+// application according to the environment variables set by its platform,
+// or nil.
+func newCloudEnvironment(getenv func(string) string) *cloudEnvironment {
+	switch {
+	case getenv("AWS_LAMBDA_FUNCTION_NAME") != "":
+		return &cloudEnvironment{
+			Provider: "aws-lambda",
+			Region:   getenv("AWS_REGION"),
+			Service:  getenv("AWS_LAMBDA_FUNCTION_NAME"),
+			Revision: getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+		}
+	case getenv("FUNCTION_TARGET") != "" && getenv("K_SERVICE") != "":
+		return &cloudEnvironment{
+			Provider: "gcp-cloud-functions",
+			Service:  getenv("K_SERVICE"),
+			Revision: getenv("K_REVISION"),
+		}
+	case getenv("K_SERVICE") != "":
+		return &cloudEnvironment{
+			Provider: "gcp-cloud-run",
+			Service:  getenv("K_SERVICE"),
+			Revision: getenv("K_REVISION"),
+		}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,282 @@
+// Command bearer-replay replays the requests of the records written by
+// agents to their ReportWriter, as newline-delimited JSON, against a target
+// base URL, e.g. to load-test a provider's sandbox or to validate a
+// migration:
+//
+//	bearer-replay -target https://sandbox.example.com -rate 10 records.ndjson
+//
+// Requests are replayed in order with their method, path, query, headers
+// and captured body. Headers and query values which were sanitized aren't
+// replayed; credentials for the target can be set with -H instead. Requests
+// whose body wasn't captured as sent, i.e. was encrypted, deduplicated,
+// digested or trimmed, are skipped.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Bearer/bearer-go/fakebearer"
+)
+
+const (
+	// maxLineSize bounds the size of records, which may capture large bodies.
+	maxLineSize = 64 << 20
+	// filtered is the placeholder of the values sanitized by agents.
+	filtered = "[FILTERED]"
+)
+
+// errBodyUnavailable is the error of the records whose request body can't be
+// replayed.
+var errBodyUnavailable = errors.New("request body unavailable")
+
+// skippedHeaders are the headers set by the client of the target.
+var skippedHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Connection": true, "Keep-Alive": true,
+	"Transfer-Encoding": true, "Te": true, "Trailer": true, "Upgrade": true,
+	"Proxy-Authorization": true, "Accept-Encoding": true,
+}
+
+// options are the options of a replay.
+type options struct {
+	target *url.URL
+	// rate is the maximum number of requests per second, unbounded if zero.
+	rate    float64
+	headers http.Header
+	client  *http.Client
+}
+
+// result is the outcome of a replay.
+type result struct {
+	Requests int
+	Failures int
+	// Skipped is the number of records whose request couldn't be replayed.
+	Skipped  int
+	Statuses map[int]int
+}
+
+// readRecords returns the request records read from r.
+func readRecords(r io.Reader, host string) ([]fakebearer.Record, error) {
+	var records []fakebearer.Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record, err := fakebearer.DecodeRecord(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if record.Type == "REQUEST_END" && (host == "" || record.Hostname == host) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// newRequest returns the replay of the request of record against target.
+func newRequest(ctx context.Context, record fakebearer.Record, opts options) (*http.Request, error) {
+	u := *opts.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + record.Path
+	query := url.Values{}
+	for name, values := range record.Query {
+		for _, value := range values {
+			if !strings.Contains(value, filtered) {
+				query.Add(name, value)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+	body, err := requestBody(record)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(record.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range record.RequestHeaders {
+		name = http.CanonicalHeaderKey(name)
+		if skippedHeaders[name] {
+			continue
+		}
+		for _, value := range values {
+			if !strings.Contains(value, filtered) {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+	for name, values := range opts.headers {
+		req.Header[name] = values
+	}
+	return req.WithContext(ctx), nil
+}
+
+// requestBody returns the request body of record, nil if it has none, and
+// errBodyUnavailable if it wasn't captured as sent.
+func requestBody(record fakebearer.Record) (io.Reader, error) {
+	switch {
+	case record.Encryption != nil && record.RequestBody != "":
+		return nil, fmt.Errorf("%w: encrypted", errBodyUnavailable)
+	case record.RequestBodyRef != "":
+		return nil, fmt.Errorf("%w: deduplicated", errBodyUnavailable)
+	case record.RequestBodySHA256 != "":
+		return nil, fmt.Errorf("%w: too large", errBodyUnavailable)
+	}
+	for _, part := range record.Trimmed {
+		if part == "requestBody" {
+			return nil, fmt.Errorf("%w: trimmed", errBodyUnavailable)
+		}
+	}
+	if record.RequestBody == "" {
+		return nil, nil
+	}
+	if record.RequestBodyEncoding == "base64" {
+		body, err := base64.StdEncoding.DecodeString(record.RequestBody)
+		if err != nil {
+			return nil, fmt.Errorf("decode request body: %w", err)
+		}
+		return bytes.NewReader(body), nil
+	}
+	return strings.NewReader(record.RequestBody), nil
+}
+
+// replay replays records in order, at most at opts.rate requests per second.
+func replay(ctx context.Context, records []fakebearer.Record, opts options, log io.Writer) (result, error) {
+	res := result{Statuses: map[int]int{}}
+	var tick <-chan time.Time
+	if opts.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for i, record := range records {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return res, ctx.Err()
+			}
+		}
+		req, err := newRequest(ctx, record, opts)
+		if errors.Is(err, errBodyUnavailable) {
+			res.Skipped++
+			fmt.Fprintf(log, "%s %s: skipped, %v\n", record.Method, record.Path, err)
+			continue
+		}
+		if err != nil {
+			return res, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		res.Requests++
+		start := time.Now()
+		resp, err := opts.client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return res, ctx.Err()
+			}
+			res.Failures++
+			fmt.Fprintf(log, "%s %s: %v\n", req.Method, req.URL, err)
+			continue
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		res.Statuses[resp.StatusCode]++
+		fmt.Fprintf(log, "%s %s: %d (%s, recorded %d)\n", req.Method, req.URL, resp.StatusCode, time.Since(start).Round(time.Millisecond), record.StatusCode)
+	}
+	return res, nil
+}
+
+// headerFlags are the headers set with -H.
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return errors.New(`headers must be formatted as "Name: value"`)
+	}
+	http.Header(h).Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	return nil
+}
+
+func main() {
+	target := flag.String("target", "", "base URL against which requests are replayed (required)")
+	rate := flag.Float64("rate", 0, "maximum number of requests per second, unbounded if 0")
+	host := flag.String("host", "", "replay the records of this hostname only")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of each request")
+	headers := headerFlags{}
+	flag.Var(headers, "H", `header set on every request, as "Name: value" (repeatable)`)
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: bearer-replay -target URL [options] [file.ndjson...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	targetURL, err := url.Parse(*target)
+	if *target == "" || err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var records []fakebearer.Record
+	readers := map[string]io.Reader{}
+	names := flag.Args()
+	if len(names) == 0 {
+		names, readers["stdin"] = []string{"stdin"}, os.Stdin
+	}
+	for _, name := range names {
+		r := readers[name]
+		if r == nil {
+			file, err := os.Open(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "bearer-replay:", err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			r = file
+		}
+		fileRecords, err := readRecords(r, *host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bearer-replay: %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		records = append(records, fileRecords...)
+	}
+
+	opts := options{
+		target:  targetURL,
+		rate:    *rate,
+		headers: http.Header(headers),
+		client:  &http.Client{Timeout: *timeout},
+	}
+	res, err := replay(context.Background(), records, opts, os.Stdout)
+	statuses := make([]int, 0, len(res.Statuses))
+	for status := range res.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	fmt.Printf("%d requests, %d failures, %d skipped\n", res.Requests, res.Failures, res.Skipped)
+	for _, status := range statuses {
+		fmt.Printf("  %d: %d\n", status, res.Statuses[status])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bearer-replay:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	var received []*http.Request
+	var bodies []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		received = append(received, req)
+		bodies = append(bodies, string(body))
+		if req.URL.Path == "/sandbox/v1/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer target.Close()
+
+	input := strings.Join([]string{
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"POST","path":"/v1/charges","query":{"expand":["customer"]},"requestHeaders":{"Content-Type":["application/x-www-form-urlencoded"],"Authorization":["[FILTERED]"],"Content-Length":["9"]},"requestBody":"amount=42","statusCode":200}`,
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"GET","path":"/v1/missing","statusCode":404}`,
+		`{"type":"REQUEST_END","hostname":"api.sendgrid.com","method":"GET","path":"/v3/mail","statusCode":200}`,
+		`{"type":"AGENT_HEARTBEAT"}`,
+	}, "\n")
+	records, err := readRecords(strings.NewReader(input), "api.stripe.com")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	targetURL, _ := url.Parse(target.URL + "/sandbox/")
+	opts := options{
+		target:  targetURL,
+		rate:    20,
+		headers: http.Header{"Authorization": {"Bearer sk_sandbox"}},
+		client:  http.DefaultClient,
+	}
+	start := time.Now()
+	res, err := replay(context.Background(), records, opts, ioutil.Discard)
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond, "the rate is bounded")
+	assert.Equal(t, result{Requests: 2, Statuses: map[int]int{200: 1, 404: 1}}, res)
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "POST", received[0].Method)
+	assert.Equal(t, "/sandbox/v1/charges", received[0].URL.Path)
+	assert.Equal(t, "expand=customer", received[0].URL.RawQuery)
+	assert.Equal(t, "Bearer sk_sandbox", received[0].Header.Get("Authorization"), "sanitized headers are replaced")
+	assert.Equal(t, "application/x-www-form-urlencoded", received[0].Header.Get("Content-Type"))
+	assert.Equal(t, "amount=42", bodies[0])
+}
+
+func TestReplay_bodies(t *testing.T) {
+	var queries, bodies []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		queries = append(queries, req.URL.RawQuery)
+		bodies = append(bodies, string(body))
+	}))
+	defer target.Close()
+
+	input := strings.Join([]string{
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"POST","path":"/v1/files","query":{"key":["[FILTERED]"],"purpose":["dispute"]},"requestBody":"AP8=","requestBodyEncoding":"base64","statusCode":200}`,
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"POST","path":"/v1/charges","requestBody":"","requestBodyRef":"0f1e","statusCode":200}`,
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"POST","path":"/v1/charges","requestBody":"c2VjcmV0","encryption":{"algorithm":"AES-256-GCM"},"statusCode":200}`,
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"POST","path":"/v1/charges","requestBody":"","requestBodySha256":"9f86","statusCode":200}`,
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","method":"POST","path":"/v1/charges","requestBody":"","trimmed":["requestBody"],"statusCode":200}`,
+	}, "\n")
+	records, err := readRecords(strings.NewReader(input), "api.stripe.com")
+	require.NoError(t, err)
+
+	targetURL, _ := url.Parse(target.URL)
+	var log strings.Builder
+	res, err := replay(context.Background(), records, options{target: targetURL, client: http.DefaultClient}, &log)
+	require.NoError(t, err)
+	assert.Equal(t, result{Requests: 1, Skipped: 4, Statuses: map[int]int{200: 1}}, res)
+	assert.Equal(t, []string{"purpose=dispute"}, queries, "sanitized query values aren't replayed")
+	assert.Equal(t, []string{"\x00\xff"}, bodies, "base64 bodies are decoded")
+	assert.Equal(t, 4, strings.Count(log.String(), "skipped"))
+}
+
+func TestHeaderFlags(t *testing.T) {
+	headers := headerFlags{}
+	require.NoError(t, headers.Set("Authorization: Bearer sk_test"))
+	assert.Equal(t, "Bearer sk_test", http.Header(headers).Get("Authorization"))
+	assert.Error(t, headers.Set("invalid"))
+}
@@ -0,0 +1,145 @@
+// Command bearer-report summarizes the records written by agents to their
+// ReportWriter, as newline-delimited JSON, per provider: the number of
+// calls, their error rate, and their median and 95th percentile latencies.
+//
+//	bearer-report records.ndjson [more.ndjson...]
+//
+// Records are read from the standard input if no file is given. Providers are
+// the API names of the records (see Agent.APINames), or their hostnames.
+// Records written by older agents are migrated to the latest format.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/Bearer/bearer-go/fakebearer"
+)
+
+// maxLineSize bounds the size of records, which may capture large bodies.
+const maxLineSize = 64 << 20
+
+// summary is the summary of the calls to a provider.
+type summary struct {
+	Provider  string
+	Calls     int
+	Errors    int
+	durations []float64
+}
+
+// ErrorRate returns the fraction of the calls which failed or were answered
+// with a 5xx status.
+func (s *summary) ErrorRate() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Calls)
+}
+
+// Percentile returns the p-th percentile of the latencies, in milliseconds.
+func (s *summary) Percentile(p float64) float64 {
+	if len(s.durations) == 0 {
+		return 0
+	}
+	sort.Float64s(s.durations)
+	// nearest rank
+	rank := int(p/100*float64(len(s.durations))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return s.durations[rank]
+}
+
+// summarize adds the request records read from r to summaries, by provider.
+func summarize(r io.Reader, summaries map[string]*summary) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record, err := fakebearer.DecodeRecord(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if record.Type != "REQUEST_END" {
+			continue
+		}
+		provider := record.API
+		if provider == "" {
+			provider = record.Hostname
+		}
+		s := summaries[provider]
+		if s == nil {
+			s = &summary{Provider: provider}
+			summaries[provider] = s
+		}
+		s.Calls++
+		if record.ErrorCategory != "" || record.StatusCode >= 500 {
+			s.Errors++
+		}
+		s.durations = append(s.durations, record.Duration)
+	}
+	return scanner.Err()
+}
+
+// printSummaries writes summaries to w as a table, by decreasing number of calls.
+func printSummaries(w io.Writer, summaries map[string]*summary) error {
+	sorted := make([]*summary, 0, len(summaries))
+	for _, s := range summaries {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Calls != sorted[j].Calls {
+			return sorted[i].Calls > sorted[j].Calls
+		}
+		return sorted[i].Provider < sorted[j].Provider
+	})
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "PROVIDER\tCALLS\tERRORS\tP50 (ms)\tP95 (ms)\t")
+	for _, s := range sorted {
+		fmt.Fprintf(table, "%s\t%d\t%.1f%%\t%.1f\t%.1f\t\n", s.Provider, s.Calls, 100*s.ErrorRate(), s.Percentile(50), s.Percentile(95))
+	}
+	return table.Flush()
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: bearer-report [file.ndjson...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	summaries := map[string]*summary{}
+	if flag.NArg() == 0 {
+		if err := summarize(os.Stdin, summaries); err != nil {
+			fmt.Fprintln(os.Stderr, "bearer-report: stdin:", err)
+			os.Exit(1)
+		}
+	}
+	for _, name := range flag.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bearer-report:", err)
+			os.Exit(1)
+		}
+		err = summarize(file, summaries)
+		file.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bearer-report: %s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+	if err := printSummaries(os.Stdout, summaries); err != nil {
+		fmt.Fprintln(os.Stderr, "bearer-report:", err)
+		os.Exit(1)
+	}
+}
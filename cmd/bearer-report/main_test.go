@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	input := strings.Join([]string{
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","api":"stripe","statusCode":200,"duration":10}`,
+		`{"type":"REQUEST_END","hostname":"files.stripe.com","api":"stripe","statusCode":502,"duration":30}`,
+		`{"type":"REQUEST_END","hostname":"api.stripe.com","api":"stripe","errorCategory":"TIMEOUT","duration":1000}`,
+		`{"type":"REQUEST_END","hostname":"api.sendgrid.com","statusCode":202,"duration":20}`,
+		``,
+		`{"type":"AGENT_HEARTBEAT","heartbeat":{"uptime":1000}}`,
+	}, "\n")
+	summaries := map[string]*summary{}
+	require.NoError(t, summarize(strings.NewReader(input), summaries))
+	require.Len(t, summaries, 2)
+
+	stripe := summaries["stripe"]
+	assert.Equal(t, 3, stripe.Calls)
+	assert.Equal(t, 2, stripe.Errors)
+	assert.Equal(t, 30.0, stripe.Percentile(50))
+	assert.Equal(t, 1000.0, stripe.Percentile(95))
+	assert.Equal(t, 1, summaries["api.sendgrid.com"].Calls, "unnamed providers are grouped by hostname")
+
+	var out bytes.Buffer
+	require.NoError(t, printSummaries(&out, summaries))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "PROVIDER")
+	assert.Equal(t, []string{"stripe", "3", "66.7%", "30.0", "1000.0"}, strings.Fields(lines[1]))
+
+	err := summarize(strings.NewReader("{"), summaries)
+	assert.EqualError(t, err, "line 1: unexpected end of JSON input")
+}
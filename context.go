@@ -0,0 +1,71 @@
+package bearer
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey int
+
+const (
+	attemptKey contextKey = iota
+	endpointKey
+	correlationKey
+	parentRecordKey
+	tokenRefreshedKey
+	webhookKey
+	probeKey
+	callsKey
+)
+
+// WithAttempt returns a copy of ctx carrying the attempt number of a request.
+// Clients performing retries should set it before each attempt so that every
+// attempt is reported distinctly.
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey, attempt)
+}
+
+// AttemptFromContext returns the attempt number stored in ctx, or 0 if unset.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey).(int)
+	return attempt
+}
+
+// WithEndpoint returns a copy of ctx carrying the endpoint template of a request,
+// i.e. a name identifying the operation performed regardless of its parameters
+// (for instance "DynamoDB.GetItem" or "GET /users/{id}").
+// Requests performed with this context are grouped by endpoint template
+// instead of by raw URL.
+func WithEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, endpointKey, endpoint)
+}
+
+// EndpointFromContext returns the endpoint template stored in ctx, or "" if unset.
+func EndpointFromContext(ctx context.Context) string {
+	endpoint, _ := ctx.Value(endpointKey).(string)
+	return endpoint
+}
+
+// nameEndpoint returns req with the endpoint template named by EndpointNamer,
+// unless its context already carries one.
+func (a *Agent) nameEndpoint(req *http.Request) *http.Request {
+	if a.EndpointNamer == nil || EndpointFromContext(req.Context()) != "" {
+		return req
+	}
+	endpoint := a.EndpointNamer(req)
+	if endpoint == "" {
+		return req
+	}
+	return req.WithContext(WithEndpoint(req.Context(), endpoint))
+}
+
+// withParentRecord returns a copy of ctx whose outgoing requests are reported
+// as children of the record identified by id.
+func withParentRecord(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, parentRecordKey, id)
+}
+
+func parentRecordFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(parentRecordKey).(string)
+	return id
+}
@@ -0,0 +1,77 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Bearer/bearer-go/fakebearer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fillValue sets every field of v to a value which isn't omitted by JSON.
+func fillValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("value")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int:
+		v.SetInt(42)
+	case reflect.Float64:
+		v.SetFloat(4.2)
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillValue(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillValue(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		value := reflect.New(v.Type().Elem()).Elem()
+		fillValue(value)
+		v.SetMapIndex(reflect.ValueOf("key"), value)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				fillValue(v.Field(i))
+			}
+		}
+	}
+}
+
+func TestContract_Record(t *testing.T) {
+	var record ReportLog
+	fillValue(reflect.ValueOf(&record).Elem())
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	var contract fakebearer.Record
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	require.NoError(t, decoder.Decode(&contract), "every field is part of the contract")
+	contractData, err := json.Marshal(contract)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(contractData), "every field has the same type")
+}
+
+func TestContract_Report(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		fake := newFakeBearer(`{}`)
+		agent := &Agent{SecretKey: "sk_test", LegacyHeaders: legacy, DeduplicateBodies: true, Transport: fake}
+		var record ReportLog
+		fillValue(reflect.ValueOf(&record).Elem())
+		record.SchemaVersion = recordSchemaVersion
+		record.ResponseBody = string(bytes.Repeat([]byte("a"), minDeduplicatedBody))
+		require.NoError(t, agent.logRecords([]ReportLog{record, record}))
+
+		batches := fake.Batches()
+		require.Len(t, batches, 1)
+		assert.Equal(t, "sk_test", batches[0].SecretKey)
+		require.Len(t, batches[0].Logs, 2)
+		assert.Equal(t, []string{"value"}, batches[0].Logs[0].RequestHeaders["key"])
+		assert.Equal(t, record.ResponseBody, batches[0].Bodies[batches[0].Logs[1].ResponseBodyRef])
+	}
+}
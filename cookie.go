@@ -0,0 +1,49 @@
+package bearer
+
+import (
+	"net/http"
+	"strings"
+)
+
+// maskCookies masks the values of the cookies of the Cookie and Set-Cookie
+// headers of r, but for the cookies named in allowed, so that records tell
+// which cookies were sent and set without leaking sessions. The attributes
+// of Set-Cookie headers are kept.
+func (r *ReportLog) maskCookies(allowed []string) {
+	for name, values := range r.RequestHeaders {
+		if http.CanonicalHeaderKey(name) == "Cookie" {
+			for idx, value := range values {
+				pairs := strings.Split(value, ";")
+				for i, pair := range pairs {
+					pairs[i] = maskCookie(pair, allowed)
+				}
+				values[idx] = strings.Join(pairs, ";")
+			}
+		}
+	}
+	for name, values := range r.ResponseHeaders {
+		if http.CanonicalHeaderKey(name) == "Set-Cookie" {
+			for idx, value := range values {
+				// the attributes following the first pair aren't sensitive
+				pairs := strings.SplitN(value, ";", 2)
+				pairs[0] = maskCookie(pairs[0], allowed)
+				values[idx] = strings.Join(pairs, ";")
+			}
+		}
+	}
+}
+
+// maskCookie masks the value of the "name=value" pair, unless name is allowed.
+func maskCookie(pair string, allowed []string) string {
+	i := strings.Index(pair, "=")
+	if i < 0 {
+		return pair
+	}
+	name := strings.TrimSpace(pair[:i])
+	for _, a := range allowed {
+		if a == name {
+			return pair
+		}
+	}
+	return pair[:i+1] + defaultSensitivePlaceholder
+}
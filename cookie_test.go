@@ -0,0 +1,45 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportLog_maskCookies(t *testing.T) {
+	record := ReportLog{
+		RequestHeaders:  map[string][]string{"cookie": {"session=abc123; theme=dark; flag"}},
+		ResponseHeaders: map[string][]string{"Set-Cookie": {"session=def456; Path=/; HttpOnly", "theme=light; Max-Age=60"}},
+	}
+
+	record.maskCookies([]string{"theme"})
+
+	assert.Equal(t, []string{"session=[FILTERED]; theme=dark; flag"}, record.RequestHeaders["cookie"])
+	assert.Equal(t, []string{"session=[FILTERED]; Path=/; HttpOnly", "theme=light; Max-Age=60"}, record.ResponseHeaders["Set-Cookie"])
+}
+
+func TestAgent_CookieValues(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "def456"})
+	}))
+	defer api.Close()
+	var out bytes.Buffer
+	agent := &Agent{ReportWriter: &out, SyncReporting: true, CookieValues: []string{"locale"}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	req, _ := http.NewRequest("GET", api.URL, nil)
+	req.Header.Set("Cookie", "session=abc123; locale=fr")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	var record ReportLog
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, []string{"session=[FILTERED]; locale=fr"}, record.RequestHeaders["Cookie"])
+	assert.Equal(t, []string{"session=[FILTERED]"}, record.ResponseHeaders["Set-Cookie"])
+}
@@ -0,0 +1,140 @@
+package bearer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Correlation identifies the inbound request which caused outgoing requests,
+// allowing to stitch them together.
+type Correlation struct {
+	// TraceID is the trace ID of a W3C Trace Context "traceparent" header.
+	TraceID string
+	// SpanID is the parent span ID of a W3C Trace Context "traceparent" header.
+	SpanID string
+	// TraceFlags are the trace flags of a W3C Trace Context "traceparent" header.
+	TraceFlags string
+	// RequestID is the value of a "X-Request-ID" or "X-Correlation-ID" header.
+	RequestID string
+}
+
+// IsZero reports whether c holds no identifier.
+func (c Correlation) IsZero() bool {
+	return c == Correlation{}
+}
+
+// CorrelationFromHeader extracts the correlation identifiers of a request from its headers.
+func CorrelationFromHeader(header http.Header) Correlation {
+	var c Correlation
+	c.TraceID, c.SpanID, c.TraceFlags = parseTraceparent(header.Get("Traceparent"))
+	c.RequestID = header.Get("X-Request-Id")
+	if c.RequestID == "" {
+		c.RequestID = header.Get("X-Correlation-Id")
+	}
+	return c
+}
+
+// WithCorrelation returns a copy of ctx carrying c. Records of the requests
+// performed with the returned context are stamped with c's identifiers.
+// Agent.Middleware does it for every inbound request.
+func WithCorrelation(ctx context.Context, c Correlation) context.Context {
+	return context.WithValue(ctx, correlationKey, c)
+}
+
+// CorrelationFromContext returns the Correlation stored in ctx, if any.
+func CorrelationFromContext(ctx context.Context) Correlation {
+	c, _ := ctx.Value(correlationKey).(Correlation)
+	return c
+}
+
+// InboundContext returns a copy of ctx to be used for handling an inbound
+// request with the given headers. It carries the request's correlation
+// identifiers and, if CallGraph is enabled, the ID of the inbound request's
+// record, so that outgoing requests performed with it are related to the
+// inbound request, and with DuplicateCallThreshold or NPlusOneThreshold the
+// counts of its outgoing requests.
+// Agent.Middleware does it for every request; other servers should call it
+// before handling a request and report the request with a context derived
+// from the returned one.
+func (a *Agent) InboundContext(ctx context.Context, header http.Header) context.Context {
+	if correlation := CorrelationFromHeader(header); !correlation.IsZero() {
+		ctx = WithCorrelation(ctx, correlation)
+	}
+	if a.CallGraph {
+		ctx = withParentRecord(ctx, newRecordID())
+	}
+	if a.DuplicateCallThreshold > 0 || a.NPlusOneThreshold > 0 {
+		ctx = withCallTracker(ctx)
+	}
+	return ctx
+}
+
+// propagateTraceparent returns req with a "traceparent" header continuing
+// the trace of its context, if configured for req's host.
+func (a *Agent) propagateTraceparent(req *http.Request) *http.Request {
+	if len(a.PropagateTraceparent) == 0 || req.Header.Get("Traceparent") != "" {
+		return req
+	}
+	correlation := CorrelationFromContext(req.Context())
+	if correlation.TraceID == "" {
+		return req
+	}
+	for _, host := range a.PropagateTraceparent {
+		if host == "*" || matchHost(host, req.URL) {
+			flags := correlation.TraceFlags
+			if flags == "" {
+				flags = "00"
+			}
+			// a RoundTripper must not modify the request it is given
+			req = req.Clone(req.Context())
+			req.Header.Set("Traceparent", "00-"+correlation.TraceID+"-"+randomHex(8)+"-"+flags)
+			return req
+		}
+	}
+	return req
+}
+
+// newRecordID returns a random record ID.
+func newRecordID() string {
+	return randomHex(16)
+}
+
+// randomHex returns the hexadecimal representation of n random bytes.
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// parseTraceparent extracts IDs from a "traceparent" header as defined
+// by https://www.w3.org/TR/trace-context/#traceparent-header.
+func parseTraceparent(value string) (traceID, spanID, flags string) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", ""
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if version == "00" && len(parts) != 4 {
+		return "", "", ""
+	}
+	if !isHex(version) || len(traceID) != 32 || !isHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		len(spanID) != 16 || !isHex(spanID) || spanID == strings.Repeat("0", 16) ||
+		len(flags) != 2 || !isHex(flags) {
+		return "", "", ""
+	}
+	return traceID, spanID, flags
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
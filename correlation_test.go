@@ -0,0 +1,132 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationFromHeader(t *testing.T) {
+	tests := []struct {
+		header   http.Header
+		expected Correlation
+	}{
+		{http.Header{}, Correlation{}},
+		{http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}, Correlation{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", TraceFlags: "01"}},
+		{http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-blah"}}, Correlation{}},
+		{http.Header{"Traceparent": {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-blah"}}, Correlation{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", TraceFlags: "01"}},
+		{http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}}, Correlation{}},
+		{http.Header{"Traceparent": {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}}, Correlation{}},
+		{http.Header{"Traceparent": {"blah"}}, Correlation{}},
+		{http.Header{"X-Request-Id": {"42"}}, Correlation{RequestID: "42"}},
+		{http.Header{"X-Correlation-Id": {"42"}}, Correlation{RequestID: "42"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, CorrelationFromHeader(test.header), test.header)
+	}
+}
+
+func TestMiddleware_correlation(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("200 OK"))
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	client := &http.Client{Transport: agent}
+	ts := httptest.NewServer(agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		outgoing, err := http.NewRequest("GET", api.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(outgoing.WithContext(req.Context()))
+		require.NoError(t, err)
+		resp.Body.Close()
+	})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Request-Id", "42")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	for _, record := range []ReportLog{fake.next(t), fake.next(t)} {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record.TraceID, record.Type)
+		assert.Equal(t, "42", record.RequestID, record.Type)
+	}
+}
+
+func TestMiddleware_callGraph(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("200 OK"))
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, CallGraph: true}
+	client := &http.Client{Transport: agent}
+	ts := httptest.NewServer(agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		outgoing, err := http.NewRequest("GET", api.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(outgoing.WithContext(req.Context()))
+		require.NoError(t, err)
+		resp.Body.Close()
+	})))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	outgoing, inbound := fake.next(t), fake.next(t)
+	if outgoing.Type == recordTypeInboundRequestEnd {
+		outgoing, inbound = inbound, outgoing
+	}
+	assert.NotEmpty(t, inbound.ID)
+	assert.Empty(t, inbound.ParentID)
+	assert.NotEmpty(t, outgoing.ID)
+	assert.NotEqual(t, inbound.ID, outgoing.ID)
+	assert.Equal(t, inbound.ID, outgoing.ParentID)
+}
+
+func TestAgent_propagateTraceparent(t *testing.T) {
+	traced := CorrelationFromHeader(http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+	agent := &Agent{PropagateTraceparent: []string{"api.example.com"}}
+
+	tests := []struct {
+		url         string
+		correlation Correlation
+		header      string
+		expected    string
+	}{
+		{"https://api.example.com/sample", traced, "", "00-4bf92f3577b34da6a3ce929d0e0e4736-"},
+		{"https://api.example.com/sample", Correlation{RequestID: "42"}, "", ""},
+		{"https://api.example.com/sample", traced, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		{"https://other.example.com/sample", traced, "", ""},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		require.NoError(t, err)
+		if test.header != "" {
+			req.Header.Set("Traceparent", test.header)
+		}
+		req = req.WithContext(WithCorrelation(req.Context(), test.correlation))
+
+		got := agent.propagateTraceparent(req).Header.Get("Traceparent")
+		assert.Equal(t, test.header, req.Header.Get("Traceparent"))
+		if test.expected == "" {
+			assert.Empty(t, got)
+			continue
+		}
+		assert.True(t, strings.HasPrefix(got, test.expected), got)
+		_, spanID, flags := parseTraceparent(got)
+		assert.Len(t, spanID, 16)
+		assert.Equal(t, "01", flags)
+	}
+}
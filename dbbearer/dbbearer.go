@@ -0,0 +1,127 @@
+// Package dbbearer reports calls to HTTP-based data stores (Elasticsearch,
+// ClickHouse, InfluxDB) to Bearer, grouped by operation instead of by raw path.
+//
+// The clients and database/sql drivers of these data stores all perform their
+// requests with an http.Client, and generally accept a custom one or a custom
+// http.RoundTripper as an option. Pass them a transport returned by Wrap:
+//
+//	transport := dbbearer.Wrap(agent, http.DefaultTransport, dbbearer.Elasticsearch)
+//	client, err := elasticsearch.NewClient(elasticsearch.Config{Transport: transport})
+//
+// For ClickHouse's database/sql driver using the HTTP protocol, set the
+// transport through the driver's options the same way with dbbearer.ClickHouse.
+package dbbearer
+
+import (
+	"net/http"
+	"strings"
+
+	bearer "github.com/Bearer/bearer-go"
+)
+
+// Classifier returns the endpoint template of a request, or "" if the
+// request is not a well-known operation.
+type Classifier func(req *http.Request) string
+
+// Wrap returns an http.RoundTripper sending requests through next via agent,
+// with their endpoint template set by classify. Requests whose context
+// already carries an endpoint template are left untouched.
+func Wrap(agent *bearer.Agent, next http.RoundTripper, classify Classifier) http.RoundTripper {
+	transport := agent.Wrap(next)
+	return bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if bearer.EndpointFromContext(req.Context()) == "" {
+			if endpoint := classify(req); endpoint != "" {
+				req = req.WithContext(bearer.WithEndpoint(req.Context(), endpoint))
+			}
+		}
+		return transport.RoundTrip(req)
+	})
+}
+
+// elasticsearchIDs are the APIs whose next path segment is a document ID.
+var elasticsearchIDs = map[string]bool{
+	"_doc":         true,
+	"_create":      true,
+	"_update":      true,
+	"_source":      true,
+	"_explain":     true,
+	"_termvectors": true,
+}
+
+// Elasticsearch classifies requests to Elasticsearch and OpenSearch APIs,
+// e.g. "POST /{index}/_search", "PUT /{index}/_doc/{id}" or "POST /_bulk".
+func Elasticsearch(req *http.Request) string {
+	segments := splitPath(req.URL.Path)
+	api := ""
+	for idx, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, "_"):
+			api = segment
+		case api == "":
+			segments[idx] = "{index}"
+		case elasticsearchIDs[api]:
+			segments[idx] = "{id}"
+		case api == "_cat" || api == "_cluster" || api == "_nodes" || api == "_snapshot":
+			// sub-API names, e.g. /_cat/indices or /_cluster/health
+			if idx > 0 && segments[idx-1] == api {
+				continue
+			}
+			segments[idx] = "{name}"
+		default:
+			segments[idx] = "{name}"
+		}
+	}
+	return req.Method + " /" + strings.Join(segments, "/")
+}
+
+// ClickHouse classifies requests to ClickHouse's HTTP interface by statement
+// kind, e.g. "POST / SELECT" or "POST / INSERT". Queries sent in the request
+// body are classified as "POST / QUERY", as the body is not inspected.
+func ClickHouse(req *http.Request) string {
+	switch req.URL.Path {
+	case "", "/":
+		return req.Method + " / " + statement(req.URL.Query().Get("query"), "QUERY")
+	case "/ping", "/replicas_status", "/play":
+		return req.Method + " " + req.URL.Path
+	default:
+		return ""
+	}
+}
+
+// InfluxDB classifies requests to InfluxDB 1.x and 2.x APIs,
+// e.g. "POST /api/v2/write" or "GET /query SELECT".
+func InfluxDB(req *http.Request) string {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	switch path {
+	case "/query":
+		return req.Method + " /query " + statement(req.URL.Query().Get("q"), "QUERY")
+	case "/write", "/ping", "/health", "/api/v2/write", "/api/v2/query", "/api/v2/delete":
+		return req.Method + " " + path
+	}
+	if strings.HasPrefix(path, "/api/v2/") {
+		// resources management, e.g. /api/v2/buckets/{id}
+		segments := splitPath(path)
+		for idx := 3; idx < len(segments); idx++ {
+			segments[idx] = "{id}"
+		}
+		return req.Method + " /" + strings.Join(segments, "/")
+	}
+	return ""
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+// statement returns the upper-cased first keyword of query, or fallback if empty.
+func statement(query, fallback string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return fallback
+	}
+	return strings.ToUpper(fields[0])
+}
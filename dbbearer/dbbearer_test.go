@@ -0,0 +1,70 @@
+package dbbearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifiers(t *testing.T) {
+	tests := []struct {
+		classifier Classifier
+		method     string
+		url        string
+		expected   string
+	}{
+		{Elasticsearch, "POST", "http://localhost:9200/_bulk", "POST /_bulk"},
+		{Elasticsearch, "GET", "http://localhost:9200/logs-2020.01.01/_search?q=blah", "GET /{index}/_search"},
+		{Elasticsearch, "PUT", "http://localhost:9200/users/_doc/42", "PUT /{index}/_doc/{id}"},
+		{Elasticsearch, "GET", "http://localhost:9200/_cluster/health", "GET /_cluster/health"},
+		{Elasticsearch, "GET", "http://localhost:9200/_cat/indices/users", "GET /_cat/indices/{name}"},
+		{Elasticsearch, "PUT", "http://localhost:9200/users", "PUT /{index}"},
+		{Elasticsearch, "GET", "http://localhost:9200/", "GET /"},
+		{ClickHouse, "POST", "http://localhost:8123/?query=select+1", "POST / SELECT"},
+		{ClickHouse, "POST", "http://localhost:8123/?query=INSERT%20INTO%20t%20VALUES", "POST / INSERT"},
+		{ClickHouse, "POST", "http://localhost:8123/", "POST / QUERY"},
+		{ClickHouse, "GET", "http://localhost:8123/ping", "GET /ping"},
+		{ClickHouse, "GET", "http://localhost:8123/blah", ""},
+		{InfluxDB, "POST", "http://localhost:8086/api/v2/write?bucket=b", "POST /api/v2/write"},
+		{InfluxDB, "GET", "http://localhost:8086/query?q=SELECT+*+FROM+cpu", "GET /query SELECT"},
+		{InfluxDB, "GET", "http://localhost:8086/api/v2/buckets/0123", "GET /api/v2/buckets/{id}"},
+		{InfluxDB, "GET", "http://localhost:8086/blah", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, nil)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, test.classifier(req))
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	var endpoint string
+	next := bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		endpoint = bearer.EndpointFromContext(req.Context())
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := &http.Client{Transport: Wrap(&bearer.Agent{}, next, Elasticsearch)}
+
+	resp, err := client.Get(ts.URL + "/users/_search")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "GET /{index}/_search", endpoint)
+
+	req, err := http.NewRequest("GET", ts.URL+"/users/_search", nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req.WithContext(bearer.WithEndpoint(req.Context(), "search users")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "search users", endpoint)
+}
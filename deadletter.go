@@ -0,0 +1,68 @@
+package bearer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DeadLetter is a record rejected permanently by Bearer, as written to
+// Agent.DeadLetterWriter.
+type DeadLetter struct {
+	Time time.Time `json:"time"`
+	// Status is the status of the response rejecting the whole report, if
+	// any, and Code the code of the rejection of the record alone.
+	Status int       `json:"status,omitempty"`
+	Code   string    `json:"code,omitempty"`
+	Reason string    `json:"reason"`
+	Record ReportLog `json:"record"`
+}
+
+// deadLetters returns the records rejected permanently by the report of
+// records failing with err: those rejected individually and not retryable,
+// or all of them if the report was rejected with a client error other than
+// 429.
+func deadLetters(records []ReportLog, err error) []DeadLetter {
+	now := time.Now()
+	var partial *partialError
+	if errors.As(err, &partial) {
+		var letters []DeadLetter
+		for _, rejected := range partial.permanent() {
+			letters = append(letters, DeadLetter{Time: now, Code: rejected.Code, Reason: rejected.Message, Record: rejected.record})
+		}
+		return letters
+	}
+	var status statusError
+	if !errors.As(err, &status) || status < 400 || status >= 500 || status == http.StatusTooManyRequests {
+		return nil
+	}
+	letters := make([]DeadLetter, len(records))
+	for i, record := range records {
+		letters[i] = DeadLetter{Time: now, Status: int(status), Reason: err.Error(), Record: record}
+	}
+	return letters
+}
+
+// writeDeadLetters writes the records rejected permanently by the report of
+// records failing with err to DeadLetterWriter, if set.
+func (a *Agent) writeDeadLetters(records []ReportLog, err error) {
+	if a.DeadLetterWriter == nil {
+		return
+	}
+	letters := deadLetters(records, err)
+	if len(letters) == 0 {
+		return
+	}
+	a.deadLetters.Lock()
+	defer a.deadLetters.Unlock()
+	encoder := json.NewEncoder(a.DeadLetterWriter)
+	for _, letter := range letters {
+		if err := encoder.Encode(letter); err != nil {
+			a.logger().Warn("write dead letter", zap.Error(err))
+			return
+		}
+	}
+}
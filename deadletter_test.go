@@ -0,0 +1,69 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Bearer/bearer-go/fakebearer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_DeadLetterWriter(t *testing.T) {
+	decode := func(t *testing.T, buf *bytes.Buffer) []DeadLetter {
+		var letters []DeadLetter
+		decoder := json.NewDecoder(buf)
+		for decoder.More() {
+			var letter DeadLetter
+			require.NoError(t, decoder.Decode(&letter))
+			letters = append(letters, letter)
+		}
+		return letters
+	}
+	records := []ReportLog{{Type: "REQUEST_END", Path: "/a", UUID: "a", SchemaVersion: recordSchemaVersion}, {Type: "REQUEST_END", Path: "/b", UUID: "b", SchemaVersion: recordSchemaVersion}}
+
+	t.Run("rejected records", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		fake.Validate = func(record fakebearer.Record) error {
+			if record.Path == "/b" {
+				return errors.New("too large")
+			}
+			return nil
+		}
+		var buf bytes.Buffer
+		agent := &Agent{SecretKey: "sk_test", Transport: fake, DeadLetterWriter: &buf}
+		defer agent.Close()
+		agent.sendRecords(records)
+
+		letters := decode(t, &buf)
+		require.Len(t, letters, 1)
+		assert.Equal(t, "INVALID_RECORD", letters[0].Code)
+		assert.Equal(t, "too large", letters[0].Reason)
+		assert.Equal(t, "/b", letters[0].Record.Path)
+		assert.False(t, letters[0].Time.IsZero())
+	})
+
+	t.Run("rejected report", func(t *testing.T) {
+		status := http.StatusRequestEntityTooLarge
+		var buf bytes.Buffer
+		agent := &Agent{SecretKey: "sk_test", DeadLetterWriter: &buf, Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})}
+		defer agent.Close()
+		agent.sendRecords(records)
+
+		letters := decode(t, &buf)
+		require.Len(t, letters, 2)
+		assert.Equal(t, 413, letters[1].Status)
+		assert.Equal(t, "b", letters[1].Record.UUID)
+
+		status = http.StatusServiceUnavailable
+		agent.sendRecords(records)
+		assert.Empty(t, decode(t, &buf), "server errors are transient")
+	})
+}
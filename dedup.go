@@ -0,0 +1,43 @@
+package bearer
+
+// minDeduplicatedBody is the size from which bodies are deduplicated: the
+// references to smaller ones would be about as large as the bodies.
+const minDeduplicatedBody = 128
+
+// deduplicateBodies returns a copy of records in which the bodies captured
+// more than once are replaced by references to their digest, and the bodies
+// referenced, by digest.
+func deduplicateBodies(records []ReportLog) ([]ReportLog, map[string]string) {
+	counts := map[string]int{}
+	for _, record := range records {
+		for _, body := range []string{record.RequestBody, record.ResponseBody} {
+			if len(body) >= minDeduplicatedBody {
+				counts[body]++
+			}
+		}
+	}
+	var bodies map[string]string
+	ref := func(body string) string {
+		if counts[body] < 2 {
+			return ""
+		}
+		digest := bodyDigest([]byte(body))
+		if bodies == nil {
+			bodies = map[string]string{}
+		}
+		bodies[digest] = body
+		return digest
+	}
+
+	ret := make([]ReportLog, len(records))
+	for i, record := range records {
+		if digest := ref(record.RequestBody); digest != "" {
+			record.RequestBody, record.RequestBodyRef = "", digest
+		}
+		if digest := ref(record.ResponseBody); digest != "" {
+			record.ResponseBody, record.ResponseBodyRef = "", digest
+		}
+		ret[i] = record
+	}
+	return ret, bodies
+}
@@ -0,0 +1,50 @@
+package bearer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicateBodies(t *testing.T) {
+	page := "<html>" + strings.Repeat("error ", 30) + "</html>"
+	records := []ReportLog{
+		{RequestBody: "{}", ResponseBody: page},
+		{RequestBody: "{}", ResponseBody: page},
+		{ResponseBody: page + "!"},
+	}
+	got, bodies := deduplicateBodies(records)
+	digest := bodyDigest([]byte(page))
+	assert.Equal(t, map[string]string{digest: page}, bodies)
+	assert.Equal(t, []ReportLog{
+		{RequestBody: "{}", ResponseBodyRef: digest},
+		{RequestBody: "{}", ResponseBodyRef: digest},
+		{ResponseBody: page + "!"},
+	}, got)
+	assert.Equal(t, page, records[0].ResponseBody, "records are left unchanged")
+
+	_, bodies = deduplicateBodies(records[2:])
+	assert.Nil(t, bodies)
+}
+
+func TestAgent_DeduplicateBodies(t *testing.T) {
+	var input struct {
+		Logs   []ReportLog       `json:"logs"`
+		Bodies map[string]string `json:"bodies"`
+	}
+	agent := &Agent{SecretKey: "sk_test", DeduplicateBodies: true, Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&input))
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{}`))}, nil
+	})}
+	body := strings.Repeat("x", minDeduplicatedBody)
+	require.NoError(t, agent.logRecords([]ReportLog{{ResponseBody: body}, {ResponseBody: body}}))
+	require.Len(t, input.Logs, 2)
+	digest := input.Logs[0].ResponseBodyRef
+	assert.Equal(t, digest, input.Logs[1].ResponseBodyRef)
+	assert.Equal(t, map[string]string{digest: body}, input.Bodies)
+}
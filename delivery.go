@@ -0,0 +1,116 @@
+package bearer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Delivery is the guarantee with which records are sent to Bearer.
+type Delivery int
+
+const (
+	// DeliveryAtMostOnce sends records once: those whose request fails are
+	// dropped.
+	DeliveryAtMostOnce Delivery = iota
+	// DeliveryAtLeastOnce retries the requests sending records which fail
+	// with a network error, a 429 or a 5xx status, with an exponential
+	// backoff, until they succeed, deliveryAttempts are made or the agent is
+	// closed. Records are sent idempotently so that Bearer counts them once.
+	DeliveryAtLeastOnce
+)
+
+const (
+	// deliveryAttempts is the number of attempts to send records at least once.
+	deliveryAttempts = 5
+	// deliveryBackoff is the delay before the first retry, doubled after each.
+	deliveryBackoff = 200 * time.Millisecond
+)
+
+// statusError is the error of requests to Bearer's API failing with an
+// unexpected status code.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unsupported status code: %d", int(e))
+}
+
+// retryable reports whether the sending of records failing with err may
+// succeed if retried: client errors other than 429 are permanent, as are the
+// rejections of records by Bearer unless marked as retryable.
+func retryable(err error) bool {
+	var partial *partialError
+	if errors.As(err, &partial) {
+		return len(partial.retryable()) > 0
+	}
+	var status statusError
+	if errors.As(err, &status) {
+		return status == http.StatusTooManyRequests || status >= 500
+	}
+	return !errors.Is(err, errClosed)
+}
+
+// deliver sends records to Bearer according to Delivery. Of the records
+// partially rejected, only the retryable ones are sent again. The error is a
+// partialError if only some records were dropped.
+func (a *Agent) deliver(records []ReportLog) error {
+	err := a.logRecords(records)
+	if a.Delivery != DeliveryAtLeastOnce {
+		return err
+	}
+	var rejected []rejectedRecord
+	backoff := deliveryBackoff
+	for attempt := 1; err != nil && attempt < deliveryAttempts && retryable(err); attempt++ {
+		if !a.sleep(backoff) {
+			break
+		}
+		backoff *= 2
+		var partial *partialError
+		if errors.As(err, &partial) {
+			rejected = append(rejected, partial.permanent()...)
+			records = partial.retryable()
+		}
+		err = a.logRecords(records)
+	}
+	if len(rejected) == 0 {
+		return err
+	}
+	var partial *partialError
+	switch {
+	case err == nil:
+	case errors.As(err, &partial):
+		rejected = append(rejected, partial.rejected...)
+	default:
+		for _, record := range records {
+			rejected = append(rejected, rejectedRecord{Message: err.Error(), Retryable: retryable(err), record: record})
+		}
+	}
+	return &partialError{rejected: rejected}
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	s := hex.EncodeToString(buf)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// idempotencyKey returns the key of the request sending records, derived
+// from their UUIDs so that its retries have the same key.
+func idempotencyKey(records []ReportLog) string {
+	hash := sha256.New()
+	for _, record := range records {
+		hash.Write([]byte(record.UUID))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
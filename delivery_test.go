@@ -0,0 +1,81 @@
+package bearer
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Delivery(t *testing.T) {
+	// failing sends the records to fake, but fails the first attempts as if
+	// the response was lost, and returns the idempotency keys of the attempts.
+	failing := func(fake *fakeBearer, failures int, status int) (http.RoundTripper, *[]string) {
+		var keys []string
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != "/logs" {
+				return fake.RoundTrip(req)
+			}
+			keys = append(keys, req.Header.Get("Idempotency-Key"))
+			resp, err := fake.RoundTrip(req)
+			if len(keys) > failures {
+				return resp, err
+			}
+			if status == 0 {
+				return nil, errors.New("connection reset")
+			}
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		}), &keys
+	}
+
+	t.Run("at least once", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		transport, keys := failing(fake, 2, 0)
+		agent := &Agent{SecretKey: "sk_test", Transport: transport, Delivery: DeliveryAtLeastOnce, SyncReporting: true}
+		defer agent.Close()
+		agent.reportHeartbeat(time.Now(), time.Now())
+
+		require.Len(t, *keys, 3)
+		assert.Equal(t, (*keys)[0], (*keys)[2], "retries have the same key")
+		assert.Len(t, fake.Batches(), 3)
+		require.Len(t, fake.Records(), 1, "the record is counted once")
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), fake.Records()[0].UUID)
+		assert.Equal(t, 1, agent.Stats().RecordsSent)
+	})
+
+	t.Run("at most once", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		transport, keys := failing(fake, 1, http.StatusServiceUnavailable)
+		agent := &Agent{SecretKey: "sk_test", Transport: transport, SyncReporting: true}
+		defer agent.Close()
+		agent.reportHeartbeat(time.Now(), time.Now())
+
+		assert.Len(t, *keys, 1)
+		assert.Equal(t, 1, agent.Stats().RecordsDropped)
+	})
+
+	t.Run("permanent failure", func(t *testing.T) {
+		fake := newFakeBearer(`{}`)
+		transport, keys := failing(fake, 1, http.StatusBadRequest)
+		agent := &Agent{SecretKey: "sk_test", Transport: transport, Delivery: DeliveryAtLeastOnce, SyncReporting: true}
+		defer agent.Close()
+		agent.reportHeartbeat(time.Now(), time.Now())
+
+		assert.Len(t, *keys, 1, "client errors aren't retried")
+		assert.Equal(t, 1, agent.Stats().RecordsDropped)
+	})
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, retryable(errors.New("connection reset")))
+	assert.True(t, retryable(statusError(http.StatusTooManyRequests)))
+	assert.True(t, retryable(statusError(http.StatusBadGateway)))
+	assert.False(t, retryable(statusError(http.StatusUnauthorized)))
+	assert.False(t, retryable(errClosed))
+}
@@ -0,0 +1,21 @@
+package bearer
+
+import (
+	"context"
+	"net"
+)
+
+// DialFunc connects to addr on the named network, like net.Dialer.DialContext.
+// Any dialer can be used, e.g. the DialContext method of a SOCKS5 dialer of
+// golang.org/x/net/proxy.
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// UnixSocketDialer returns a DialFunc connecting to the Unix domain socket at
+// path whatever the requested address, e.g. for the Docker API at
+// "/var/run/docker.sock".
+func UnixSocketDialer(path string) DialFunc {
+	var dialer net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
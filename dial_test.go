@@ -0,0 +1,49 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Dialers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bearer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fake := newFakeBearer(`{"blockedDomains":["blocked"]}`)
+	agent := &Agent{
+		SecretKey: "sk_test",
+		Transport: fake,
+		Dialers:   map[string]DialFunc{"docker": UnixSocketDialer(socket), "blocked": UnixSocketDialer(socket)},
+	}
+	client := &http.Client{Transport: agent}
+
+	resp, err := client.Get("http://docker/v1.40/containers/json")
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, `[]`, string(body))
+
+	record := fake.next(t)
+	assert.Equal(t, "docker", record.Hostname)
+	assert.Equal(t, `[]`, record.ResponseBody)
+
+	_, err = client.Get("http://blocked/v1.40/containers/json")
+	assert.Error(t, err, "blocking rules apply")
+}
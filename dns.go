@@ -0,0 +1,25 @@
+package bearer
+
+import (
+	"context"
+	"net"
+)
+
+// overrideAddress returns a dial function connecting to address instead of
+// the requested one. If address has no port, the requested port is kept.
+func overrideAddress(dial DialFunc, address string) DialFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		target := address
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			target = net.JoinHostPort(address, port)
+		}
+		return dial(ctx, network, target)
+	}
+}
@@ -0,0 +1,46 @@
+package bearer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_HostAddresses(t *testing.T) {
+	var host string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host = req.Host
+	}))
+	defer api.Close()
+	_, port, err := net.SplitHostPort(api.Listener.Addr().String())
+	require.NoError(t, err)
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{
+		SecretKey: "sk_test",
+		Transport: fake,
+		HostAddresses: map[string]string{
+			"api.example.com":   "127.0.0.1",
+			"other.example.com": api.Listener.Addr().String(),
+		},
+	}
+	client := &http.Client{Transport: agent}
+
+	tests := []struct {
+		url, host, address string
+	}{
+		{url: "http://api.example.com:" + port + "/users", host: "api.example.com:" + port, address: "127.0.0.1"},
+		{url: "http://other.example.com/users", host: "other.example.com", address: api.Listener.Addr().String()},
+	}
+	for _, test := range tests {
+		resp, err := client.Get(test.url)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, test.host, host)
+		assert.Equal(t, test.address, fake.next(t).AddressOverride)
+	}
+}
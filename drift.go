@@ -0,0 +1,186 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxDriftEndpoints bounds the number of endpoints whose shapes are tracked.
+	maxDriftEndpoints = 1000
+	// maxDriftFields bounds the number of fields tracked per endpoint.
+	maxDriftFields = 1000
+)
+
+// SchemaDrift describes a change of the JSON shape of an endpoint's responses.
+type SchemaDrift struct {
+	// Fingerprint identifies the new shape.
+	Fingerprint string `json:"fingerprint"`
+	// Added are the fields, with their type, never seen before for the
+	// endpoint, e.g. "data.id:number".
+	Added []string `json:"added,omitempty"`
+	// Removed are the fields of the previous response missing from the new one.
+	Removed []string `json:"removed,omitempty"`
+}
+
+// driftDetector tracks the shapes of the responses of each endpoint.
+//
+// Fields missing from a response, as optional fields or items of empty
+// arrays, aren't a drift; a new field or a field of a new type is.
+type driftDetector struct {
+	mutex     sync.Mutex
+	endpoints map[string]*endpointShapes
+}
+
+type endpointShapes struct {
+	known map[string]bool // all the fields seen
+	last  []string        // fields of the last response
+}
+
+// observe records the shape of body for endpoint, and returns the drift if
+// body's shape has fields never seen before, or nil.
+// The first shape seen for an endpoint is its baseline and isn't a drift.
+func (d *driftDetector) observe(endpoint string, body []byte) *SchemaDrift {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil
+	}
+	fields := jsonShape(value)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.endpoints == nil {
+		d.endpoints = map[string]*endpointShapes{}
+	}
+	shapes, ok := d.endpoints[endpoint]
+	if !ok {
+		if len(d.endpoints) >= maxDriftEndpoints {
+			return nil
+		}
+		shapes = &endpointShapes{known: map[string]bool{}}
+		d.endpoints[endpoint] = shapes
+	}
+
+	var added []string
+	for _, field := range fields {
+		if !shapes.known[field] && len(shapes.known) < maxDriftFields {
+			shapes.known[field] = true
+			added = append(added, field)
+		}
+	}
+	previous := shapes.last
+	shapes.last = fields
+	if !ok || len(added) == 0 {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return &SchemaDrift{
+		Fingerprint: hex.EncodeToString(sum[:8]),
+		Added:       added,
+		Removed:     difference(previous, fields),
+	}
+}
+
+// detectSchemaDrift reports a drift record if the response of record has a new shape.
+func (a *Agent) detectSchemaDrift(record ReportLog) {
+	if record.ResponseBody == "" || !strings.Contains(record.ResponseContentType(), "json") {
+		return
+	}
+	endpoint := record.Endpoint
+	if endpoint == "" {
+		endpoint = record.Method + " " + record.Hostname + templatePath(record.Path)
+	}
+	drift := a.drift.observe(endpoint, []byte(record.ResponseBody))
+	if drift == nil {
+		return
+	}
+	a.logger().Info("schema drift", zap.String("endpoint", endpoint), zap.Strings("added", drift.Added), zap.Strings("removed", drift.Removed))
+	a.report(a.context(), ReportLog{
+		Type:        recordTypeSchemaDrift,
+		Protocol:    record.Protocol,
+		Hostname:    record.Hostname,
+		Method:      record.Method,
+		Path:        record.Path,
+		Endpoint:    record.Endpoint,
+		StatusCode:  record.StatusCode,
+		StartedAt:   record.EndedAt,
+		EndedAt:     record.EndedAt,
+		SchemaDrift: drift,
+	})
+}
+
+// jsonShape returns the sorted fields of value with their type, as
+// dot-separated paths where array items are denoted by "[]", and keys which
+// look like identifiers or sensitive values by "{id}" (see shapeKey).
+func jsonShape(value interface{}) []string {
+	set := map[string]bool{}
+	collectShape("", value, set)
+	fields := make([]string, 0, len(set))
+	for field := range set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func collectShape(path string, value interface{}, set map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		set[fmt.Sprintf("%s:object", path)] = true
+		for key, child := range v {
+			key = shapeKey(key)
+			if path == "" {
+				collectShape(key, child, set)
+			} else {
+				collectShape(path+"."+key, child, set)
+			}
+		}
+	case []interface{}:
+		set[fmt.Sprintf("%s:array", path)] = true
+		for _, child := range v {
+			collectShape(path+"[]", child, set)
+		}
+	case string:
+		set[path+":string"] = true
+	case float64:
+		set[path+":number"] = true
+	case bool:
+		set[path+":boolean"] = true
+	case nil:
+		set[path+":null"] = true
+	}
+}
+
+// shapeKey returns "{id}" if key looks like an identifier, as the segments
+// templated by templatePath, or a sensitive value such as an email, e.g. the
+// keys of objects indexing their items by ID, so that they neither drift
+// with every response nor leak in drift records. It returns key otherwise.
+func shapeKey(key string) string {
+	if templatePath(key) != key || sensitiveValues.MatchString(key) {
+		return "{id}"
+	}
+	return key
+}
+
+// difference returns the sorted elements of a which aren't in b.
+func difference(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+	var ret []string
+	for _, s := range a {
+		if !inB[s] {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,123 @@
+package bearer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriftDetector_Observe(t *testing.T) {
+	var d driftDetector
+
+	assert.Nil(t, d.observe("users", []byte(`{"id":42,"tags":["a"]}`)), "baseline")
+	assert.Nil(t, d.observe("users", []byte(`{"id":43,"tags":[]}`)), "same fields")
+	assert.Nil(t, d.observe("users", []byte(`not json`)))
+
+	drift := d.observe("users", []byte(`{"id":"42","tags":["a"],"name":"blah"}`))
+	require.NotNil(t, drift)
+	assert.Equal(t, []string{"id:string", "name:string"}, drift.Added)
+	assert.Equal(t, []string{"id:number"}, drift.Removed)
+	assert.NotEmpty(t, drift.Fingerprint)
+
+	assert.Nil(t, d.observe("users", []byte(`{"id":42,"tags":["a"]}`)), "known shape")
+	assert.Nil(t, d.observe("orders", []byte(`{"id":"42"}`)), "other endpoint")
+}
+
+func TestJSONShape(t *testing.T) {
+	var value interface{} = map[string]interface{}{
+		"data": []interface{}{map[string]interface{}{"id": 1.0, "ok": true, "next": nil}},
+	}
+	assert.Equal(t, []string{
+		":object",
+		"data:array",
+		"data[].id:number",
+		"data[].next:null",
+		"data[].ok:boolean",
+		"data[]:object",
+	}, jsonShape(value))
+}
+
+func TestJSONShape_idKeys(t *testing.T) {
+	shape := func(keys ...string) []string {
+		users := map[string]interface{}{}
+		for _, key := range keys {
+			users[key] = map[string]interface{}{"name": "Jane"}
+		}
+		return jsonShape(map[string]interface{}{"users": users, "total": 1.0})
+	}
+	expected := []string{
+		":object",
+		"total:number",
+		"users.{id}.name:string",
+		"users.{id}:object",
+		"users:object",
+	}
+	assert.Equal(t, expected, shape("12345"))
+	assert.Equal(t, expected, shape("67890", "jane@example.com"), "keys which look like IDs don't drift")
+	assert.Equal(t, expected, shape("0b7c1fa4-2a3f-4d3e-9c0e-6f1d2b3a4c5d", "cus_8a7b6c5d4e3f2g1h"))
+	assert.Equal(t, []string{":object", "user_name:string"}, jsonShape(map[string]interface{}{"user_name": "Jane"}))
+}
+
+func TestAgent_DetectSchemaDrift(t *testing.T) {
+	body := `{"id":42}`
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, DetectSchemaDrift: true}
+	client := &http.Client{Transport: agent}
+
+	for _, b := range []string{`{"id":42}`, `{"id":43}`, `{"id":42,"name":"blah"}`} {
+		body = b
+		resp, err := client.Get(api.URL + "/users")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	var drifts []ReportLog
+	for i := 0; i < 4; i++ {
+		if record := fake.next(t); record.Type == recordTypeSchemaDrift {
+			drifts = append(drifts, record)
+		}
+	}
+	require.Len(t, drifts, 1)
+	assert.Equal(t, "/users", drifts[0].Path)
+	assert.Empty(t, drifts[0].SchemaDrift.Removed)
+	assert.Equal(t, []string{"name:string"}, drifts[0].SchemaDrift.Added)
+}
+
+func TestAgent_DetectSchemaDrift_templatePath(t *testing.T) {
+	body := `{"id":42}`
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, DetectSchemaDrift: true}
+	client := &http.Client{Transport: agent}
+
+	for i, b := range []string{`{"id":42}`, `{"id":42,"name":"blah"}`} {
+		body = b
+		resp, err := client.Get(fmt.Sprintf("%s/users/%d", api.URL, 42+i))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	var drifts []ReportLog
+	for i := 0; i < 3; i++ {
+		if record := fake.next(t); record.Type == recordTypeSchemaDrift {
+			drifts = append(drifts, record)
+		}
+	}
+	require.Len(t, drifts, 1, "the paths of an endpoint share their shapes")
+	assert.Equal(t, []string{"name:string"}, drifts[0].SchemaDrift.Added)
+}
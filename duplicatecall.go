@@ -0,0 +1,88 @@
+package bearer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// callTracker counts the outgoing calls performed while handling an inbound
+// request, by method, URL and body, and tracks their bursts (see
+// observeBurst).
+type callTracker struct {
+	mutex  sync.Mutex
+	calls  map[callKey]int
+	bursts map[burstKey]*callBurst
+	// ended are the bursts of NPlusOneThreshold calls or more which ended
+	// before the inbound request.
+	ended []callBurst
+}
+
+type callKey struct {
+	method, host, uri, body string
+}
+
+// withCallTracker returns a copy of ctx whose outgoing calls are counted.
+func withCallTracker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callsKey, &callTracker{calls: map[callKey]int{}})
+}
+
+func callTrackerFromContext(ctx context.Context) *callTracker {
+	calls, _ := ctx.Value(callsKey).(*callTracker)
+	return calls
+}
+
+// tracksCalls reports whether the calls of req are counted, so that the
+// beginning of its body must be read (see peekRequestBody).
+func (a *Agent) tracksCalls(req *http.Request) bool {
+	return a.DuplicateCallThreshold > 0 && callTrackerFromContext(req.Context()) != nil
+}
+
+// peekRequestBody returns the body of req if it fits in the bodies held in
+// memory (see bodyLimit), nil otherwise, and restores req's body so that it
+// is still sent, streamed beyond the limit.
+func (a *Agent) peekRequestBody(req *http.Request) ([]byte, error) {
+	limit := a.bodyLimit()
+	buf, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(limit)+1))
+	req.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(buf), req.Body), Closer: req.Body}
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > limit {
+		return nil, nil
+	}
+	return buf, nil
+}
+
+// peekedBody is a body whose beginning was read, and put back by Reader.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// countCall counts the call of req with body, and returns the number of
+// identical calls performed for the same inbound request, including this
+// one, if it reaches DuplicateCallThreshold, 0 otherwise. The retries of
+// the agent, and the ones numbered with WithAttempt, aren't counted.
+func (a *Agent) countCall(req *http.Request, body []byte, state *roundTripState) int {
+	if !a.tracksCalls(req) || state.called || AttemptFromContext(req.Context()) > 1 {
+		return 0
+	}
+	state.called = true
+	calls := callTrackerFromContext(req.Context())
+	key := callKey{method: req.Method, host: canonicalHost(req.URL), uri: req.URL.RequestURI()}
+	// as when peeked, bodies beyond the limit are left out of the key
+	if len(body) > 0 && len(body) <= a.bodyLimit() {
+		key.body = bodyDigest(body)
+	}
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+	calls.calls[key]++
+	if count := calls.calls[key]; count >= a.DuplicateCallThreshold {
+		return count
+	}
+	return 0
+}
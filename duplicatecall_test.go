@@ -0,0 +1,115 @@
+package bearer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_DuplicateCallThreshold(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, DuplicateCallThreshold: 2}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls := []struct{ path, body string }{
+			{"/users/1", "a"},
+			{"/users/1", "a"},
+			{"/users/1", "b"},
+			{"/users/1", "a"},
+			{"/users/2", "a"},
+		}
+		for _, call := range calls {
+			outbound, err := http.NewRequestWithContext(req.Context(), "POST", api.URL+call.path, strings.NewReader(call.body))
+			require.NoError(t, err)
+			outbound.Header.Set("Content-Type", "text/plain")
+			resp, err := client.Do(outbound)
+			require.NoError(t, err)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+	}))
+	// identical calls of distinct inbound requests aren't duplicates
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	duplicates := map[string][]int{}
+	for i := 0; i < 12; i++ {
+		record := fake.next(t)
+		if record.Type == recordTypeRequestEnd {
+			key := record.Path + " " + record.RequestBody
+			duplicates[key] = append(duplicates[key], record.Duplicates)
+		}
+	}
+	assert.ElementsMatch(t, []int{0, 2, 3, 0, 2, 3}, duplicates["/users/1 a"])
+	assert.Equal(t, []int{0, 0}, duplicates["/users/1 b"])
+	assert.Equal(t, []int{0, 0}, duplicates["/users/2 a"])
+}
+
+// countingReader counts the bytes read from Reader.
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(&r.read, int64(n))
+	return n, err
+}
+
+func TestAgent_DuplicateCallThreshold_streamed(t *testing.T) {
+	var received int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		received = len(body)
+	}))
+	defer api.Close()
+	fake := newFakeBearer(`{"rejectRules":[{"path":"^/upload"}]}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, DuplicateCallThreshold: 2, MaxBodySize: 10}
+	defer agent.Close()
+	body := &countingReader{Reader: strings.NewReader(strings.Repeat("a", 1000))}
+	var readBeforeSending int64
+	client := &http.Client{Transport: agent.Wrap(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		readBeforeSending = atomic.LoadInt64(&body.read)
+		return http.DefaultTransport.RoundTrip(req)
+	}))}
+
+	req, _ := http.NewRequestWithContext(withCallTracker(context.Background()), "POST", api.URL+"/upload", body)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1000, received)
+	assert.True(t, readBeforeSending <= 11, "only the beginning of the body is read before sending it, not %d bytes", readBeforeSending)
+}
+
+func TestAgent_countCall_largeBodies(t *testing.T) {
+	agent := &Agent{DuplicateCallThreshold: 2, MaxBodySize: 10}
+	ctx := withCallTracker(context.Background())
+	count := func(body string) int {
+		req, _ := http.NewRequestWithContext(ctx, "POST", "https://api.example.com/upload", strings.NewReader(body))
+		peeked, err := agent.peekRequestBody(req)
+		require.NoError(t, err)
+		sent, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, body, string(sent), "the peeked body is sent whole")
+		return agent.countCall(req, peeked, &roundTripState{})
+	}
+	assert.Equal(t, 0, count("small"))
+	assert.Equal(t, 0, count("other"))
+	assert.Equal(t, 2, count("small"))
+	assert.Equal(t, 0, count(strings.Repeat("a", 100)))
+	assert.Equal(t, 2, count(strings.Repeat("b", 100)), "bodies beyond the limit are left out of the key")
+	assert.Equal(t, 3, agent.countCall(httptest.NewRequest("POST", "https://api.example.com/upload", nil).WithContext(ctx), []byte(strings.Repeat("c", 100)), &roundTripState{}))
+}
@@ -0,0 +1,93 @@
+package bearer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// bodyEncryptionAlgorithm is the algorithm with which bodies are encrypted
+// by their data key.
+const bodyEncryptionAlgorithm = "AES-256-GCM"
+
+// KeyWrapper encrypts the data keys with which captured bodies are
+// encrypted, e.g. with a key of a key management service.
+type KeyWrapper interface {
+	// KeyID identifies the key encrypting data keys, so that the customer
+	// can tell which key decrypts them.
+	KeyID() string
+	// WrapKey returns the encryption of key.
+	WrapKey(key []byte) ([]byte, error)
+}
+
+// RSAKeyWrapper encrypts data keys with an RSA public key, using RSA-OAEP
+// with SHA-256, so that only the holder of the private key can decrypt the
+// bodies.
+type RSAKeyWrapper struct {
+	ID        string
+	PublicKey *rsa.PublicKey
+}
+
+// KeyID implements the KeyWrapper interface
+func (w *RSAKeyWrapper) KeyID() string {
+	return w.ID
+}
+
+// WrapKey implements the KeyWrapper interface
+func (w *RSAKeyWrapper) WrapKey(key []byte) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, w.PublicKey, key, nil)
+}
+
+// bodyEncryption describes the encryption of the bodies of a record.
+type bodyEncryption struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	// WrappedKey is the base64-encoded data key, encrypted by the key KeyID.
+	WrappedKey string `json:"wrappedKey"`
+}
+
+// encryptBodies replaces the bodies of r by their encryption with a new
+// data key, wrapped by wrapper. Encrypted bodies are base64-encoded, and
+// start with their nonce.
+func (r *ReportLog) encryptBodies(wrapper KeyWrapper) error {
+	if r.RequestBody == "" && r.ResponseBody == "" {
+		return nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("generate data key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapper.WrapKey(key)
+	if err != nil {
+		return fmt.Errorf("wrap data key: %w", err)
+	}
+
+	for _, body := range []*string{&r.RequestBody, &r.ResponseBody} {
+		if *body == "" {
+			continue
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("generate nonce: %w", err)
+		}
+		*body = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(*body), nil))
+	}
+	r.Encryption = &bodyEncryption{
+		Algorithm:  bodyEncryptionAlgorithm,
+		KeyID:      wrapper.KeyID(),
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+	}
+	return nil
+}
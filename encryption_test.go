@@ -0,0 +1,66 @@
+package bearer
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type keyWrapperFunc func(key []byte) ([]byte, error)
+
+func (f keyWrapperFunc) KeyID() string                      { return "test" }
+func (f keyWrapperFunc) WrapKey(key []byte) ([]byte, error) { return f(key) }
+
+func TestReportLog_encryptBodies(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	wrapper := &RSAKeyWrapper{ID: "key-1", PublicKey: &private.PublicKey}
+
+	record := ReportLog{RequestBody: `{"name":"blah"}`, ResponseBody: `{"id":42}`}
+	require.NoError(t, record.encryptBodies(wrapper))
+	require.NotNil(t, record.Encryption)
+	assert.Equal(t, "AES-256-GCM", record.Encryption.Algorithm)
+	assert.Equal(t, "key-1", record.Encryption.KeyID)
+
+	wrapped, err := base64.StdEncoding.DecodeString(record.Encryption.WrappedKey)
+	require.NoError(t, err)
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, private, wrapped, nil)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	decrypt := func(body string) string {
+		data, err := base64.StdEncoding.DecodeString(body)
+		require.NoError(t, err)
+		plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+		require.NoError(t, err)
+		return string(plain)
+	}
+	assert.Equal(t, `{"name":"blah"}`, decrypt(record.RequestBody))
+	assert.Equal(t, `{"id":42}`, decrypt(record.ResponseBody))
+
+	empty := ReportLog{}
+	require.NoError(t, empty.encryptBodies(wrapper))
+	assert.Nil(t, empty.Encryption)
+}
+
+func TestAgent_BodyEncryption(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, BodyEncryption: keyWrapperFunc(func(key []byte) ([]byte, error) {
+		return nil, errors.New("unavailable")
+	})}
+	agent.report(context.Background(), ReportLog{Type: recordTypeRequestEnd, RequestBody: "secret", ResponseBody: "secret"})
+	record := fake.next(t)
+	assert.Empty(t, record.RequestBody, "bodies which can't be encrypted are dropped")
+	assert.Empty(t, record.ResponseBody)
+}
@@ -0,0 +1,92 @@
+package bearer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// Enricher adds information to records, e.g. about the environment of the
+// application. ctx is the context of the request of the record, or the
+// agent's context for the records of its own events.
+type Enricher interface {
+	Enrich(ctx context.Context, record *ReportLog)
+}
+
+// EnricherFunc adapts a function to the Enricher interface.
+type EnricherFunc func(ctx context.Context, record *ReportLog)
+
+// Enrich calls f.
+func (f EnricherFunc) Enrich(ctx context.Context, record *ReportLog) {
+	f(ctx, record)
+}
+
+// KubernetesEnricher returns an Enricher identifying the pod running the
+// application in records, inside Kubernetes. The pod is read from the
+// environment variables conventionally set through the downward API:
+// POD_NAME, POD_NAMESPACE, NODE_NAME and CONTAINER_IMAGE.
+func KubernetesEnricher() Enricher {
+	var once sync.Once
+	var workload *kubernetesWorkload
+	return EnricherFunc(func(ctx context.Context, record *ReportLog) {
+		once.Do(func() {
+			workload = kubernetesEnvironment(os.Getenv, ioutil.ReadFile)
+		})
+		record.Kubernetes = workload
+	})
+}
+
+// CloudEnricher returns an Enricher identifying the serverless service
+// running the application in records, on AWS Lambda, Cloud Run or Cloud
+// Functions.
+func CloudEnricher() Enricher {
+	var once sync.Once
+	var cloud *cloudEnvironment
+	return EnricherFunc(func(ctx context.Context, record *ReportLog) {
+		once.Do(func() {
+			cloud = newCloudEnvironment(os.Getenv)
+		})
+		record.Cloud = cloud
+	})
+}
+
+// ServiceEnricher returns an Enricher identifying the application in
+// records, by name and version. If empty, the path and version of the
+// application's main module are used, from its build information.
+func ServiceEnricher(name, version string) Enricher {
+	var once sync.Once
+	var service *serviceIdentity
+	return EnricherFunc(func(ctx context.Context, record *ReportLog) {
+		once.Do(func() {
+			buildInfo, ok := debug.ReadBuildInfo()
+			service = newServiceIdentity(name, version, buildInfo, ok)
+		})
+		record.Service = service
+	})
+}
+
+// enrichers holds the enrichers used by default.
+type enrichers struct {
+	once     sync.Once
+	defaults []Enricher
+}
+
+// enrich applies Enrichers, or the default ones, to record.
+func (a *Agent) enrich(ctx context.Context, record *ReportLog) {
+	list := a.Enrichers
+	if list == nil {
+		a.enrichers.once.Do(func() {
+			a.enrichers.defaults = []Enricher{
+				KubernetesEnricher(),
+				CloudEnricher(),
+				ServiceEnricher(a.ServiceName, a.ServiceVersion),
+			}
+		})
+		list = a.enrichers.defaults
+	}
+	for _, enricher := range list {
+		enricher.Enrich(ctx, record)
+	}
+}
@@ -0,0 +1,62 @@
+package bearer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantKey struct{}
+
+func TestAgent_Enrichers(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	tenant := EnricherFunc(func(ctx context.Context, record *ReportLog) {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			record.Attributes = map[string]string{"tenant": tenant}
+		}
+	})
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, Enrichers: []Enricher{tenant, ServiceEnricher("checkout", "")}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	req, err := http.NewRequest("GET", api.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req.WithContext(context.WithValue(req.Context(), tenantKey{}, "acme")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	record := fake.next(t)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, record.Attributes, "enrichers get the request's context")
+	assert.Equal(t, "checkout", record.Service.Name)
+
+	agent.Enrichers = []Enricher{}
+	agent.reportHeartbeat(time.Now(), time.Now())
+	record = fake.next(t)
+	assert.Nil(t, record.Service, "an empty list disables enrichment")
+}
+
+func TestNewCloudEnvironment(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	assert.Nil(t, newCloudEnvironment(env(nil)))
+	assert.Equal(t, &cloudEnvironment{Provider: "aws-lambda", Region: "eu-west-1", Service: "checkout", Revision: "$LATEST"}, newCloudEnvironment(env(map[string]string{
+		"AWS_LAMBDA_FUNCTION_NAME":    "checkout",
+		"AWS_LAMBDA_FUNCTION_VERSION": "$LATEST",
+		"AWS_REGION":                  "eu-west-1",
+	})))
+	assert.Equal(t, &cloudEnvironment{Provider: "gcp-cloud-run", Service: "checkout", Revision: "checkout-00001"}, newCloudEnvironment(env(map[string]string{
+		"K_SERVICE":  "checkout",
+		"K_REVISION": "checkout-00001",
+	})))
+	assert.Equal(t, "gcp-cloud-functions", newCloudEnvironment(env(map[string]string{
+		"K_SERVICE":       "checkout",
+		"FUNCTION_TARGET": "Checkout",
+	})).Provider)
+}
@@ -0,0 +1,77 @@
+package bearer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// Categories of the errors of failed requests.
+const (
+	errorCategoryCanceled          = "canceled"
+	errorCategoryTimeout           = "timeout"
+	errorCategoryDNS               = "dns"
+	errorCategoryConnectionRefused = "connection_refused"
+	errorCategoryConnectionReset   = "connection_reset"
+	errorCategoryTLS               = "tls"
+	errorCategoryOther             = "other"
+)
+
+// classifyError returns the category of err, the error of a failed request.
+func classifyError(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return errorCategoryCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errorCategoryTimeout
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return errorCategoryDNS
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorCategoryTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return errorCategoryConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errorCategoryConnectionReset
+	}
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) ||
+		errors.As(err, &recordHeader) || strings.Contains(err.Error(), "tls: ") {
+		return errorCategoryTLS
+	}
+	return errorCategoryOther
+}
+
+// callerCanceled reports whether req failed with err because its context
+// was canceled or its deadline exceeded, i.e. because the application gave
+// up on it, rather than because of the provider or the network.
+func callerCanceled(req *http.Request, err error) bool {
+	return err != nil && req.Context().Err() != nil
+}
+
+// errorMessage returns the message of err, without the URL of the request
+// added by http.Client, as records carry it already sanitized.
+func errorMessage(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
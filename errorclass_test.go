@@ -0,0 +1,89 @@
+package bearer
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://api.example.com/?api_key=secret", Err: err}
+	}
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{wrap(context.Canceled), errorCategoryCanceled},
+		{wrap(context.DeadlineExceeded), errorCategoryTimeout},
+		{wrap(timeoutError{}), errorCategoryTimeout},
+		{wrap(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "api.example.com"}}), errorCategoryDNS},
+		{wrap(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), errorCategoryConnectionRefused},
+		{wrap(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), errorCategoryConnectionReset},
+		{wrap(io.EOF), errorCategoryConnectionReset},
+		{wrap(fmt.Errorf("tls: failed to verify certificate: %w", x509.UnknownAuthorityError{})), errorCategoryTLS},
+		{wrap(errors.New("tls: handshake failure")), errorCategoryTLS},
+		{wrap(errors.New("something else")), errorCategoryOther},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, classifyError(test.err), test.err.Error())
+	}
+	assert.Equal(t, "something else", errorMessage(wrap(errors.New("something else"))))
+}
+
+func TestAgent_FailedRequest(t *testing.T) {
+	api := httptest.NewServer(http.NotFoundHandler())
+	api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	_, err := (&http.Client{Transport: agent.Wrap(http.DefaultTransport)}).Get(api.URL + "/users?api_key=secret")
+	require.Error(t, err)
+
+	record := fake.next(t)
+	assert.Equal(t, errorCategoryConnectionRefused, record.ErrorCategory)
+	assert.Contains(t, record.ErrorMessage, "connection refused")
+	assert.NotContains(t, record.ErrorMessage, "secret")
+	assert.Equal(t, 0, record.StatusCode)
+}
+
+func TestAgent_CanceledRequest(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SLOs: []SLO{{Name: "api"}}, IgnoreCanceled: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", api.URL, nil)
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: agent.Wrap(http.DefaultTransport)}).Do(req.WithContext(ctx))
+	require.Error(t, err)
+
+	record := fake.next(t)
+	assert.True(t, record.Canceled)
+	assert.Equal(t, errorCategoryTimeout, record.ErrorCategory)
+	assert.True(t, record.Duration >= 20, "duration %f", record.Duration)
+	assert.Equal(t, 0, agent.Stats().SLOs[0].Requests)
+}
@@ -5,4 +5,31 @@ import "errors"
 var (
 	// ErrBlockedDomain is raised when your program tries to make requests to a blacklisted domain.
 	ErrBlockedDomain = errors.New("bearer: blocked domain")
+
+	// ErrBlockedRequest is raised when your program tries to make a request matching a blocking rule.
+	ErrBlockedRequest = errors.New("bearer: blocked request")
+
+	// ErrQuotaExceeded is raised when your program tries to make a request exceeding a blocking quota.
+	ErrQuotaExceeded = errors.New("bearer: quota exceeded")
+
+	// ErrRetryAfter is raised when your program tries to make a request to a host which asked not to be retried yet.
+	ErrRetryAfter = errors.New("bearer: retry after")
+
+	// ErrCleartextHTTP is raised when your program tries to make a request to an external host over cleartext HTTP, with CleartextBlock.
+	ErrCleartextHTTP = errors.New("bearer: cleartext HTTP")
+
+	// ErrTLSPolicy is raised when the response to your program's request is received over a connection violating the enforced TLSPolicy.
+	ErrTLSPolicy = errors.New("bearer: TLS policy violated")
+
+	// ErrCertificatePin is raised when the certificates of a host pinned in CertificatePins don't match its pins.
+	ErrCertificatePin = errors.New("bearer: certificate pin mismatch")
+
+	// ErrPrivateAddress is raised when your program tries to make a request to a private, loopback or link-local address, with SSRFGuard.
+	ErrPrivateAddress = errors.New("bearer: private address")
+
+	// ErrRequestBodyConsumed is raised when the agent recovers from a panic after the body of your program's request was consumed, and can't send it again.
+	ErrRequestBodyConsumed = errors.New("bearer: request body consumed")
+
+	// ErrUnsupportedVersion is raised when Bearer's API no longer supports the version of the agent (see VersionError).
+	ErrUnsupportedVersion = errors.New("bearer: unsupported agent version")
 )
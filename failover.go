@@ -0,0 +1,123 @@
+package bearer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Failover declares the base URLs of a provider's backends, e.g. its
+// primary and secondary regions. Requests to a backend which fail to connect,
+// or are answered with one of Statuses, are retried against the next one.
+// Requests with idempotent methods are also retried if they fail after
+// connecting, e.g. if the connection is reset.
+type Failover struct {
+	// Name identifies the provider in records.
+	Name string
+	// BaseURLs are the base URLs of the backends, by preference, e.g.
+	// "https://eu.api.example.com/v1". Requests whose URL starts with one of
+	// them are subject to failover.
+	BaseURLs []string
+	// Statuses are the response statuses triggering a failover, in addition
+	// to connection failures.
+	Statuses []int
+}
+
+// backend returns the index of the base URL matching u, or -1.
+func (f *Failover) backend(u *url.URL) int {
+	raw := u.String()
+	for i, base := range f.BaseURLs {
+		base = strings.TrimSuffix(base, "/")
+		if raw == base || strings.HasPrefix(raw, base+"/") || strings.HasPrefix(raw, base+"?") {
+			return i
+		}
+	}
+	return -1
+}
+
+// triggers reports whether the response to req, or the error performing it,
+// calls for a failover. Requests which may have reached the backend, i.e.
+// which failed after connecting, are only retried if their method is
+// idempotent.
+func (f *Failover) triggers(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			// the application gave up on the request
+			return false
+		case errors.Is(err, ErrPrivateAddress), errors.Is(err, ErrTLSPolicy), errors.Is(err, ErrCertificatePin):
+			// the agent refused the request
+			return false
+		}
+		return isConnectError(err) || isIdempotent(req.Method)
+	}
+	for _, status := range f.Statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnectError reports whether err is a failure to resolve or connect to
+// a host, before any request was sent.
+func isConnectError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isIdempotent reports whether requests with method may be sent twice, as
+// defined by RFC 7231.
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// failover returns the failover of req's URL, and the index of its backend.
+func (a *Agent) failover(req *http.Request) (*Failover, int) {
+	for i := range a.Failovers {
+		if backend := a.Failovers[i].backend(req.URL); backend >= 0 {
+			return &a.Failovers[i], backend
+		}
+	}
+	return nil, -1
+}
+
+// failoverRetry returns the request retrying req against the next backend
+// of failover, if resp or err calls for it, or nil.
+func (a *Agent) failoverRetry(failover *Failover, backend int, req *http.Request, reqBody []byte, resp *http.Response, err error) *http.Request {
+	if failover == nil || backend+1 >= len(failover.BaseURLs) || !failover.triggers(req, resp, err) {
+		return nil
+	}
+	current := strings.TrimSuffix(failover.BaseURLs[backend], "/")
+	next := strings.TrimSuffix(failover.BaseURLs[backend+1], "/")
+	u, parseErr := url.Parse(next + strings.TrimPrefix(req.URL.String(), current))
+	if parseErr != nil {
+		a.logger().Warn("invalid failover base URL")
+		return nil
+	}
+
+	attempt := AttemptFromContext(req.Context())
+	if attempt == 0 {
+		attempt = 1
+	}
+	retry := req.Clone(WithAttempt(req.Context(), attempt+1))
+	retry.URL = u
+	retry.Host = ""
+	if reqBody != nil {
+		retry.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	return retry
+}
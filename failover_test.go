@@ -0,0 +1,107 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Failovers(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write([]byte(req.URL.Path + "?" + req.URL.RawQuery + " " + string(body)))
+	}))
+	defer secondary.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{
+		SecretKey: "sk_test",
+		Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "config.bearer.sh" || req.URL.Host == "agent.bearer.sh" {
+				return fake.RoundTrip(req)
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+		Failovers: []Failover{
+			{Name: "api", BaseURLs: []string{down.URL + "/v1", primary.URL + "/v1", secondary.URL + "/api/v1"}, Statuses: []int{503}},
+		},
+	}
+	client := &http.Client{Transport: agent}
+
+	resp, err := client.Post(down.URL+"/v1/users?page=2", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "/api/v1/users?page=2 hello", string(body))
+
+	backends := map[int]string{}
+	for i := 0; i < 3; i++ {
+		record := fake.next(t)
+		assert.Equal(t, "api", record.Failover)
+		backends[record.Attempt] = record.Backend
+	}
+	assert.Equal(t, map[int]string{0: down.URL + "/v1", 2: primary.URL + "/v1", 3: secondary.URL + "/api/v1"}, backends)
+
+	// requests to the last backend, or to other URLs, aren't retried
+	resp, err = client.Get(primary.URL + "/v2/users")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestAgent_Failovers_reset(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer primary.Close()
+	var hits int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer secondary.Close()
+
+	agent := &Agent{Failovers: []Failover{{Name: "api", BaseURLs: []string{primary.URL, secondary.URL}}}}
+	client := &http.Client{Transport: agent}
+
+	_, err := client.Post(primary.URL+"/charges", "text/plain", strings.NewReader("hello"))
+	assert.Error(t, err, "requests which may have been received aren't sent twice")
+	assert.Zero(t, atomic.LoadInt32(&hits))
+
+	resp, err := client.Get(primary.URL + "/charges")
+	require.NoError(t, err, "idempotent requests are")
+	resp.Body.Close()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&hits))
+}
+
+func TestFailover_triggers(t *testing.T) {
+	failover := &Failover{}
+	post := httptest.NewRequest("POST", "https://api.example.com/", nil)
+	dial := &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	assert.True(t, failover.triggers(post, nil, dial))
+	assert.True(t, failover.triggers(post, nil, &net.DNSError{Err: "no such host"}))
+	assert.False(t, failover.triggers(post, nil, &net.OpError{Op: "read", Err: errors.New("connection reset")}))
+	get := httptest.NewRequest("GET", "https://api.example.com/", nil)
+	for _, err := range []error{ErrPrivateAddress, ErrTLSPolicy, fmt.Errorf("%w: pin", ErrCertificatePin), context.Canceled} {
+		assert.False(t, failover.triggers(get, nil, err), err.Error())
+	}
+}
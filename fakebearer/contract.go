@@ -0,0 +1,288 @@
+package fakebearer
+
+// LogsRequest is the body of the requests reporting records, POSTed to
+// https://agent.bearer.sh/logs with the application/json content type.
+type LogsRequest struct {
+	SecretKey string    `json:"secretKey"`
+	Runtime   Runtime   `json:"runtime"`
+	Agent     AgentInfo `json:"agent"`
+	Logs      []Record  `json:"logs"`
+	// Bodies are the bodies referenced by the records, by SHA-256 digest.
+	Bodies map[string]string `json:"bodies,omitempty"`
+}
+
+// LogsResponse is the body of the responses to the requests reporting
+// records. An empty body acknowledges all the records.
+type LogsResponse struct {
+	// Rejected are the records which weren't accepted. The others were.
+	Rejected []RejectedRecord `json:"rejected,omitempty"`
+}
+
+// RejectedRecord describes a record rejected by the API.
+type RejectedRecord struct {
+	// Index is the position of the record in LogsRequest.Logs.
+	Index   int    `json:"index"`
+	UUID    string `json:"uuid,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Retryable is set if the record may be accepted if reported again.
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+// Runtime describes the runtime of the reporting application.
+type Runtime struct {
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+// AgentInfo describes the reporting agent.
+type AgentInfo struct {
+	Type     string `json:"type"`
+	Version  string `json:"version"`
+	LogLevel string `json:"log_level"`
+}
+
+// Record describes a request, or an event of the agent depending on its Type.
+type Record struct {
+	Type            string     `json:"type"`
+	Protocol        string     `json:"protocol"`
+	Path            string     `json:"path"`
+	Hostname        string     `json:"hostname"`
+	Method          string     `json:"method"`
+	StartedAt       int        `json:"startedAt"`
+	EndedAt         int        `json:"endedAt"`
+	Duration        float64    `json:"duration"`
+	ErrorCategory   string     `json:"errorCategory,omitempty"`
+	ErrorMessage    string     `json:"errorMessage,omitempty"`
+	Canceled        bool       `json:"canceled,omitempty"`
+	Health          *Health    `json:"health,omitempty"`
+	Heartbeat       *Heartbeat `json:"heartbeat,omitempty"`
+	StatusCode      int        `json:"statusCode"`
+	URL             string     `json:"url"`
+	Port            int        `json:"port,omitempty"`
+	Query           Headers    `json:"query,omitempty"`
+	RequestHeaders  Headers    `json:"requestHeaders"`
+	RequestBody     string     `json:"requestBody"`
+	ResponseHeaders Headers    `json:"responseHeaders"`
+	ResponseBody    string     `json:"responseBody"`
+	// The sizes and digests of bodies are set for bodies too large to be captured.
+	RequestBodySize    int    `json:"requestBodySize,omitempty"`
+	RequestBodySHA256  string `json:"requestBodySha256,omitempty"`
+	ResponseBodySize   int    `json:"responseBodySize,omitempty"`
+	ResponseBodySHA256 string `json:"responseBodySha256,omitempty"`
+	// The encodings of bodies are "base64" for binary bodies.
+	RequestBodyEncoding  string      `json:"requestBodyEncoding,omitempty"`
+	ResponseBodyEncoding string      `json:"responseBodyEncoding,omitempty"`
+	Encryption           *Encryption `json:"encryption,omitempty"`
+	// The references of bodies are the digests of bodies of LogsRequest.Bodies.
+	RequestBodyRef  string       `json:"requestBodyRef,omitempty"`
+	ResponseBodyRef string       `json:"responseBodyRef,omitempty"`
+	ID              string       `json:"id,omitempty"`
+	ParentID        string       `json:"parentId,omitempty"`
+	Attempt         int          `json:"attempt,omitempty"`
+	Endpoint        string       `json:"endpoint,omitempty"`
+	TraceID         string       `json:"traceId,omitempty"`
+	RequestID       string       `json:"requestId,omitempty"`
+	WouldBlock      bool         `json:"wouldBlock,omitempty"`
+	Mutations       []string     `json:"mutations,omitempty"`
+	Violations      []string     `json:"violations,omitempty"`
+	SchemaDrift     *SchemaDrift `json:"schemaDrift,omitempty"`
+	ShadowURL       string       `json:"shadowUrl,omitempty"`
+	Differences     []string     `json:"differences,omitempty"`
+	SLO             *SLOSummary  `json:"slo,omitempty"`
+	RateLimit       *RateLimit   `json:"rateLimit,omitempty"`
+	Failover        string       `json:"failover,omitempty"`
+	Backend         string       `json:"backend,omitempty"`
+	AddressOverride string       `json:"addressOverride,omitempty"`
+	Kubernetes      *Kubernetes  `json:"kubernetes,omitempty"`
+	Service         *Service     `json:"service,omitempty"`
+	Cloud           *Cloud       `json:"cloud,omitempty"`
+	Webhook         *Webhook     `json:"webhook,omitempty"`
+	API             string       `json:"api,omitempty"`
+	// HostClass is "internal" or "external".
+	HostClass string `json:"hostClass,omitempty"`
+	// Attributes are set by the custom enrichers of the agent.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Check is the result of the synthetic check of SYNTHETIC_CHECK records.
+	Check *Check `json:"check,omitempty"`
+	// Insecure is set for requests to external hosts over cleartext HTTP.
+	Insecure bool `json:"insecure,omitempty"`
+	// TLSViolation describes how the TLS connection of the request
+	// violated the TLS policy of the agent.
+	TLSViolation string `json:"tlsViolation,omitempty"`
+	// Volume is the volume of the data exchanged with a host, in
+	// VOLUME_SUMMARY records.
+	Volume *Volume `json:"volume,omitempty"`
+	// Duplicates is the number of identical requests performed while
+	// handling the same inbound request, including this one, once it
+	// reaches the threshold of the agent.
+	Duplicates int `json:"duplicates,omitempty"`
+	// Pagination locates the request in a sequence of pages.
+	Pagination *Pagination `json:"pagination,omitempty"`
+	// Diagnostic is the problem of the usage of an API found by the
+	// agent, in DIAGNOSTIC records.
+	Diagnostic *Diagnostic `json:"diagnostic,omitempty"`
+	// LargeResponse is the size of the response exceeding its limit, in
+	// LARGE_RESPONSE records.
+	LargeResponse *LargeResponse `json:"largeResponse,omitempty"`
+	// Finding is the security problem found by the agent, in
+	// SECURITY_FINDING records.
+	Finding *Finding `json:"finding,omitempty"`
+	// Probe is set for synthetic requests probing the availability of hosts.
+	Probe bool `json:"probe,omitempty"`
+	// UUID identifies the record: records already received are ignored.
+	UUID string `json:"uuid,omitempty"`
+	// Trimmed are the parts of the record trimmed to fit in the maximum size
+	// of records: "responseBody", "requestBody", "responseHeaders",
+	// "requestHeaders" or "query".
+	Trimmed []string `json:"trimmed,omitempty"`
+	// SchemaVersion is the version of the format of the record, migrated to
+	// the latest one by DecodeRecord.
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+// Headers holds the values of headers or query parameters.
+type Headers map[string][]string
+
+// Kubernetes identifies the pod of the reporting application.
+type Kubernetes struct {
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Image     string `json:"image,omitempty"`
+}
+
+// Service identifies the reporting application.
+type Service struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	Module  string `json:"module,omitempty"`
+}
+
+// Cloud identifies the serverless service of the reporting application.
+type Cloud struct {
+	Provider string `json:"provider"`
+	Region   string `json:"region,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// Webhook describes the webhook delivery of INBOUND_REQUEST_END records.
+type Webhook struct {
+	Provider string `json:"provider"`
+	Event    string `json:"event,omitempty"`
+	// Verification is "verified" or "failed" if the signature of the
+	// delivery was verified, with the reason of the failure in
+	// VerificationError.
+	Verification      string `json:"verification,omitempty"`
+	VerificationError string `json:"verificationError,omitempty"`
+}
+
+// Check is the result of a synthetic check performed by the agent.
+type Check struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	// Failure explains why the check failed, e.g. an unexpected status.
+	Failure string `json:"failure,omitempty"`
+}
+
+// Volume is the volume of the bodies exchanged with a host during the
+// period of a VOLUME_SUMMARY record.
+type Volume struct {
+	Requests      int `json:"requests"`
+	BytesSent     int `json:"bytesSent"`
+	BytesReceived int `json:"bytesReceived"`
+}
+
+// Pagination locates a request in a sequence of pages, from page 1.
+type Pagination struct {
+	Sequence string `json:"sequence"`
+	Page     int    `json:"page"`
+}
+
+// Diagnostic is a problem of the usage of an API found by the agent.
+type Diagnostic struct {
+	// Kind is "n_plus_one" for the bursts of requests differing only by an
+	// identifier of their path.
+	Kind string `json:"kind"`
+	// Template is the method and path template of the requests, e.g.
+	// "GET /users/{id}".
+	Template string `json:"template"`
+	Count    int    `json:"count"`
+}
+
+// LargeResponse is the size of a response exceeding the limit configured
+// for its endpoint.
+type LargeResponse struct {
+	Size  int `json:"size"`
+	Limit int `json:"limit"`
+}
+
+// Finding is a security problem found by the agent.
+type Finding struct {
+	// Kind is "secret_detected", "weak_tls", "cleartext_http",
+	// "certificate_expiring" or "certificate_pin_mismatch".
+	Kind    string  `json:"kind"`
+	Host    string  `json:"host"`
+	Message string  `json:"message"`
+	Secret  *Secret `json:"secret,omitempty"`
+}
+
+// Secret describes the likely secrets found in a body by the agent.
+type Secret struct {
+	// Location is "requestBody" or "responseBody".
+	Location     string   `json:"location"`
+	Count        int      `json:"count"`
+	Fingerprints []string `json:"fingerprints"`
+	Redacted     bool     `json:"redacted,omitempty"`
+}
+
+// Health describes an event affecting the agent, in AGENT_HEALTH records.
+type Health struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+// Heartbeat describes the state of the agent, in AGENT_HEARTBEAT records.
+type Heartbeat struct {
+	Uptime         int    `json:"uptime"`
+	Version        string `json:"version"`
+	RecordsSent    int    `json:"recordsSent"`
+	RecordsDropped int    `json:"recordsDropped"`
+	Panics         int    `json:"panics"`
+	Paused         bool   `json:"paused,omitempty"`
+	ConfigHash     string `json:"configHash,omitempty"`
+}
+
+// Encryption describes the encryption of the bodies of a record.
+type Encryption struct {
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"keyId"`
+	WrappedKey string `json:"wrappedKey"`
+}
+
+// SchemaDrift describes a change of the shape of responses, in SCHEMA_DRIFT records.
+type SchemaDrift struct {
+	Fingerprint string   `json:"fingerprint"`
+	Added       []string `json:"added,omitempty"`
+	Removed     []string `json:"removed,omitempty"`
+}
+
+// SLOSummary is the compliance of an SLO, in SLO_SUMMARY records.
+type SLOSummary struct {
+	Name         string  `json:"name"`
+	Requests     int     `json:"requests"`
+	Failures     int     `json:"failures"`
+	Availability float64 `json:"availability"`
+	LatencyP95   int     `json:"latencyP95"`
+	Compliant    bool    `json:"compliant"`
+}
+
+// RateLimit is the rate limit announced by the response to a request.
+type RateLimit struct {
+	Limit      *int `json:"limit,omitempty"`
+	Remaining  *int `json:"remaining,omitempty"`
+	Reset      int  `json:"reset,omitempty"`
+	RetryAfter int  `json:"retryAfter,omitempty"`
+}
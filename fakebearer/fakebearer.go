@@ -0,0 +1,223 @@
+// Package fakebearer implements Bearer's config and report API in memory,
+// for tests and local stacks. Its types describe the API's contract.
+//
+// Use a Server as the transport of the agent, so that its operational
+// requests are served locally and the others are performed by Next:
+//
+//	server := fakebearer.New(`{"blockedDomains":["evil.example.com"]}`)
+//	agent := &bearer.Agent{SecretKey: "sk_test", Transport: server}
+//
+// Reports are decoded strictly: those with fields missing from Record are
+// rejected with a 400 status, so that changes of the wire format are caught.
+// Records of older versions of the format are migrated with DecodeRecord.
+// Records failing Server.Validate are rejected individually in LogsResponse.
+package fakebearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is returned by WaitRecords when the records aren't reported in time.
+var ErrTimeout = errors.New("fakebearer: timeout")
+
+// ErrRetry may be wrapped by the errors of Server.Validate, so that records
+// are rejected as retryable.
+var ErrRetry = errors.New("fakebearer: retry")
+
+// Server serves Bearer's config and report endpoints.
+type Server struct {
+	// If set, requests with another secret key are rejected with a 401 status.
+	SecretKey string
+
+	// Next performs the requests to other hosts than Bearer's.
+	// If nil, http.DefaultTransport is used.
+	Next http.RoundTripper
+
+	// If set, the records for which Validate fails are rejected, and the
+	// others of their report accepted.
+	Validate func(Record) error
+
+	mutex   sync.Mutex
+	config  string
+	batches []LogsRequest
+	records []Record
+	uuids   map[string]bool
+	changed chan struct{}
+}
+
+// New returns a server serving config, a JSON-encoded configuration.
+func New(config string) *Server {
+	return &Server{config: config, changed: make(chan struct{})}
+}
+
+// SetConfig replaces the configuration served.
+func (s *Server) SetConfig(config string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.config = config
+}
+
+// Batches returns the report requests received so far.
+func (s *Server) Batches() []LogsRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]LogsRequest(nil), s.batches...)
+}
+
+// Records returns the records reported so far. Records with the UUID of a
+// record already received are ignored, as by Bearer's API.
+func (s *Server) Records() []Record {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Record(nil), s.records...)
+}
+
+// WaitRecords waits until at least n records are reported, and returns them,
+// or fails with ErrTimeout after timeout.
+func (s *Server) WaitRecords(n int, timeout time.Duration) ([]Record, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mutex.Lock()
+		records, changed := s.records, s.changed
+		s.mutex.Unlock()
+		if len(records) >= n {
+			return append([]Record(nil), records...), nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface. Requests to Bearer's
+// config and agent hosts, in any region, are served by the server.
+func (s *Server) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if !strings.HasSuffix(host, "bearer.sh") || !(strings.HasPrefix(host, "config.") || strings.HasPrefix(host, "agent.")) {
+		next := s.Next
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		return next.RoundTrip(req)
+	}
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// ServeHTTP implements the http.Handler interface, serving GET /config and
+// POST /logs.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/config":
+		s.serveConfig(w, req)
+	case req.Method == http.MethodPost && req.URL.Path == "/logs":
+		s.serveLogs(w, req)
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("no route for %s %s", req.Method, req.URL.Path))
+	}
+}
+
+func (s *Server) serveConfig(w http.ResponseWriter, req *http.Request) {
+	if s.SecretKey != "" && req.Header.Get("Authorization") != s.SecretKey {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid secret key")
+		return
+	}
+	s.mutex.Lock()
+	config := s.config
+	s.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(config))
+}
+
+func (s *Server) serveLogs(w http.ResponseWriter, req *http.Request) {
+	if contentType := req.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		writeError(w, http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE", fmt.Sprintf("unsupported content type %q", contentType))
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	var input struct {
+		LogsRequest
+		Logs []json.RawMessage `json:"logs"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	batch := input.LogsRequest
+	for i, data := range input.Logs {
+		record, err := DecodeRecord(data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("record %d: %s", i, err))
+			return
+		}
+		batch.Logs = append(batch.Logs, record)
+	}
+	if s.SecretKey != "" && batch.SecretKey != s.SecretKey {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid secret key")
+		return
+	}
+
+	var resp LogsResponse
+	s.mutex.Lock()
+	s.batches = append(s.batches, batch)
+	if s.uuids == nil {
+		s.uuids = make(map[string]bool)
+	}
+	for i, record := range batch.Logs {
+		if s.Validate != nil {
+			if err := s.Validate(record); err != nil {
+				resp.Rejected = append(resp.Rejected, RejectedRecord{
+					Index:     i,
+					UUID:      record.UUID,
+					Code:      "INVALID_RECORD",
+					Message:   err.Error(),
+					Retryable: errors.Is(err, ErrRetry),
+				})
+				continue
+			}
+		}
+		if record.UUID != "" {
+			if s.uuids[record.UUID] {
+				continue
+			}
+			s.uuids[record.UUID] = true
+		}
+		s.records = append(s.records, record)
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{code, message})
+}
@@ -0,0 +1,107 @@
+package fakebearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Config(t *testing.T) {
+	server := New(`{"blockedDomains":[]}`)
+	server.SecretKey = "sk_test"
+	client := &http.Client{Transport: server}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://config.eu.bearer.sh/config", nil)
+	req.Header.Set("Authorization", "sk_test")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, `{"blockedDomains":[]}`, string(body))
+
+	server.SetConfig(`{}`)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, `{}`, string(body))
+
+	req.Header.Set("Authorization", "sk_other")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+}
+
+func TestServer_Logs(t *testing.T) {
+	server := New(`{}`)
+	post := func(contentType, body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "https://agent.bearer.sh/logs", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	resp := post("application/json", `{"secretKey":"sk_test","logs":[{"type":"REQUEST_END","requestHeaders":{"Accept":["*/*"]}},{"type":"REQUEST_END","requestHeaders":{"Accept":"*/*"}}]}`)
+	assert.Equal(t, 200, resp.StatusCode)
+	records, err := server.WaitRecords(2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, Headers{"Accept": {"*/*"}}, records[0].RequestHeaders)
+	assert.Equal(t, Headers{"Accept": {"*/*"}}, records[1].RequestHeaders, "legacy headers")
+	assert.Len(t, server.Batches(), 1)
+
+	resp = post("application/json", `{"logs":[{"type":"REQUEST_END","unknown":true}]}`)
+	assert.Equal(t, 400, resp.StatusCode, "unknown fields break the contract")
+	var apiError struct {
+		Code string `json:"code"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&apiError))
+	assert.Equal(t, "BAD_REQUEST", apiError.Code)
+
+	resp = post("application/msgpack", "")
+	assert.Equal(t, 415, resp.StatusCode)
+	assert.Len(t, server.Records(), 2)
+
+	_, err = server.WaitRecords(3, 10*time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+}
+
+func TestServer_RoundTrip(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("api"))
+	}))
+	defer api.Close()
+
+	server := New(`{}`)
+	resp, err := (&http.Client{Transport: server}).Get(api.URL)
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "api", string(body), "other hosts are served by Next")
+}
+
+func TestServer_Validate(t *testing.T) {
+	server := New(`{}`)
+	server.Validate = func(record Record) error {
+		if record.Path == "" {
+			return fmt.Errorf("no path: %w", ErrRetry)
+		}
+		return nil
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://agent.bearer.sh/logs", strings.NewReader(`{"logs":[{"type":"REQUEST_END","path":"/"},{"type":"REQUEST_END","uuid":"a"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+
+	assert.Equal(t, 200, recorder.Code)
+	var resp LogsResponse
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&resp))
+	assert.Equal(t, []RejectedRecord{{Index: 1, UUID: "a", Code: "INVALID_RECORD", Message: "no path: fakebearer: retry", Retryable: true}}, resp.Rejected)
+	assert.Len(t, server.Records(), 1)
+}
@@ -0,0 +1,93 @@
+package fakebearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the latest version of the format of records.
+//
+// Version 1 is the format of records without a version, whose headers may
+// hold their first value only, as a string. Version 2 holds every value of
+// headers, as lists.
+const SchemaVersion = 2
+
+// migrations[i] migrates the fields of a record from version i+1 to i+2.
+var migrations = []func(fields map[string]json.RawMessage) error{
+	migrateListHeaders,
+}
+
+// DecodeRecord decodes a JSON-encoded record of any version up to
+// SchemaVersion, migrating it to the latest one. As reports, records are
+// decoded strictly.
+func DecodeRecord(data []byte) (Record, error) {
+	var record Record
+	data, err := MigrateRecord(data)
+	if err != nil {
+		return record, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&record)
+	return record, err
+}
+
+// MigrateRecord returns a JSON-encoded record migrated to SchemaVersion.
+func MigrateRecord(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	version := 1
+	if raw, ok := fields["schemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("schema version: %w", err)
+		}
+	}
+	if version < 1 || version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d, the latest is %d", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return data, nil
+	}
+	for _, migrate := range migrations[version-1:] {
+		if err := migrate(fields); err != nil {
+			return nil, fmt.Errorf("migrate from schema version %d: %w", version, err)
+		}
+		version++
+	}
+	fields["schemaVersion"] = json.RawMessage(fmt.Sprint(SchemaVersion))
+	return json.Marshal(fields)
+}
+
+// migrateListHeaders turns the values of legacy headers into lists.
+func migrateListHeaders(fields map[string]json.RawMessage) error {
+	for _, key := range []string{"requestHeaders", "responseHeaders"} {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		var headers map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &headers); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		for name, value := range headers {
+			var single string
+			if json.Unmarshal(value, &single) != nil {
+				continue
+			}
+			list, err := json.Marshal([]string{single})
+			if err != nil {
+				return err
+			}
+			headers[name] = list
+		}
+		ret, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+		fields[key] = ret
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package fakebearer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	record, err := DecodeRecord([]byte(`{"type":"REQUEST_END","requestHeaders":{"Accept":"*/*"},"responseHeaders":{"Vary":["Accept","Origin"]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, record.SchemaVersion)
+	assert.Equal(t, Headers{"Accept": {"*/*"}}, record.RequestHeaders, "legacy headers are migrated")
+	assert.Equal(t, Headers{"Vary": {"Accept", "Origin"}}, record.ResponseHeaders)
+
+	record, err = DecodeRecord([]byte(`{"type":"REQUEST_END","schemaVersion":2,"requestHeaders":{"Accept":["*/*"]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, Headers{"Accept": {"*/*"}}, record.RequestHeaders)
+
+	_, err = DecodeRecord([]byte(`{"type":"REQUEST_END","schemaVersion":2,"requestHeaders":{"Accept":"*/*"}}`))
+	assert.Error(t, err, "the latest version isn't migrated")
+	_, err = DecodeRecord([]byte(`{"type":"REQUEST_END","schemaVersion":3}`))
+	assert.EqualError(t, err, "unsupported schema version 3, the latest is 2")
+	_, err = DecodeRecord([]byte(`{"type":"REQUEST_END","unknown":true}`))
+	assert.Error(t, err, "records are decoded strictly")
+}
@@ -0,0 +1,118 @@
+// Package fasthttpbearer instruments github.com/valyala/fasthttp clients with a Bearer agent.
+//
+// fasthttp does not rely on net/http, so the agent cannot be installed as a
+// RoundTripper; instead, wrap the client's Do method:
+//
+//	do := fasthttpbearer.Wrap(agent, client.Do)
+//	err := do(req, resp)
+package fasthttpbearer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/valyala/fasthttp"
+)
+
+// DoFunc has the same signature as fasthttp.Client.Do, fasthttp.HostClient.Do and fasthttp.Do.
+type DoFunc func(req *fasthttp.Request, resp *fasthttp.Response) error
+
+// Wrap returns a DoFunc that applies the agent's policies to requests before
+// calling do, and reports the calls to Bearer like the agent's RoundTripper does.
+func Wrap(agent *bearer.Agent, do DoFunc) DoFunc {
+	return func(req *fasthttp.Request, resp *fasthttp.Response) error {
+		httpReq, err := toHTTPRequest(req)
+		if err != nil {
+			return err
+		}
+
+		transport := agent.Wrap(bearer.RoundTripperFunc(func(httpReq *http.Request) (*http.Response, error) {
+			// the request sent is the one modified by the agent, e.g. by its
+			// mutation rules, while req is left untouched
+			sent := fasthttp.AcquireRequest()
+			defer fasthttp.ReleaseRequest(sent)
+			req.CopyTo(sent)
+			if err := fromHTTPRequest(httpReq, sent); err != nil {
+				return nil, err
+			}
+			if err := do(sent, resp); err != nil {
+				return nil, err
+			}
+			return toHTTPResponse(httpReq, resp), nil
+		}))
+
+		httpResp, err := transport.RoundTrip(httpReq)
+		if err != nil {
+			return err
+		}
+		return httpResp.Body.Close()
+	}
+}
+
+func toHTTPRequest(req *fasthttp.Request) (*http.Request, error) {
+	var body io.Reader
+	if raw := req.Body(); len(raw) > 0 {
+		body = bytes.NewReader(raw)
+	}
+
+	httpReq, err := http.NewRequest(string(req.Header.Method()), req.URI().String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range req.Header.All() {
+		httpReq.Header.Add(string(key), string(value))
+	}
+	return httpReq, nil
+}
+
+// fromHTTPRequest sets the method, URI, headers and body of req to httpReq's.
+func fromHTTPRequest(httpReq *http.Request, req *fasthttp.Request) error {
+	var body []byte
+	if httpReq.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(httpReq.Body)
+		httpReq.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	req.Header.Reset()
+	req.Header.SetMethod(httpReq.Method)
+	req.SetRequestURI(httpReq.URL.String())
+	for key, values := range httpReq.Header {
+		// the host and length are the ones of the URI and body
+		if key == "Host" || key == "Content-Length" {
+			continue
+		}
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if httpReq.Host != "" && httpReq.Host != httpReq.URL.Host {
+		req.UseHostHeader = true
+		req.Header.SetHost(httpReq.Host)
+	}
+	req.SetBody(body)
+	return nil
+}
+
+func toHTTPResponse(req *http.Request, resp *fasthttp.Response) *http.Response {
+	httpResp := &http.Response{
+		Status:     http.StatusText(resp.StatusCode()),
+		StatusCode: resp.StatusCode(),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(resp.Body())),
+		Request:    req,
+	}
+	for key, value := range resp.Header.All() {
+		httpResp.Header.Add(string(key), string(value))
+	}
+	return httpResp
+}
@@ -0,0 +1,102 @@
+package fasthttpbearer
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestWrap(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Set("Hello", "World")
+		ctx.Response.Header.SetBytesV("X-Api-Version", ctx.Request.Header.Peek("X-Api-Version"))
+		ctx.SetBodyString("200 OK")
+	})
+	client := &fasthttp.Client{
+		Dial: func(addr string) (net.Conn, error) { return ln.Dial() },
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		do := Wrap(&bearer.Agent{}, client.Do)
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI("http://api.example.com/sample")
+
+		require.NoError(t, do(req, resp))
+		assert.Equal(t, 200, resp.StatusCode())
+		assert.Equal(t, "200 OK", string(resp.Body()))
+		assert.Equal(t, "World", string(resp.Header.Peek("Hello")))
+	})
+
+	t.Run("blocked-domain", func(t *testing.T) {
+		agent := &bearer.Agent{
+			SecretKey: "sk_test",
+			Transport: bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       ioutil.NopCloser(strings.NewReader(`{"blockedDomains":["api.example.com"]}`)),
+				}, nil
+			}),
+		}
+		called := false
+		do := Wrap(agent, func(req *fasthttp.Request, resp *fasthttp.Response) error {
+			called = true
+			return client.Do(req, resp)
+		})
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI("http://api.example.com/sample")
+
+		err := do(req, resp)
+		assert.True(t, errors.Is(err, bearer.ErrBlockedDomain))
+		assert.False(t, called)
+	})
+
+	t.Run("mutated", func(t *testing.T) {
+		agent := &bearer.Agent{
+			SecretKey: "sk_test",
+			Transport: bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: 200,
+					Header:     http.Header{"Content-Type": []string{"application/json"}},
+					Body:       ioutil.NopCloser(strings.NewReader(`{"mutationRules":[{"host":"api.example.com","setHeaders":{"X-Api-Version":"2020-03-02"}}]}`)),
+				}, nil
+			}),
+		}
+		var body string
+		do := Wrap(agent, func(req *fasthttp.Request, resp *fasthttp.Response) error {
+			body = string(req.Body())
+			return client.Do(req, resp)
+		})
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		req.Header.SetMethod("POST")
+		req.SetRequestURI("http://api.example.com/sample")
+		req.SetBodyString(`{"id":42}`)
+
+		require.NoError(t, do(req, resp))
+		// the server echoes the header it received
+		assert.Equal(t, "2020-03-02", string(resp.Header.Peek("X-Api-Version")))
+		assert.Equal(t, `{"id":42}`, body)
+		assert.Equal(t, "200 OK", string(resp.Body()))
+		assert.Empty(t, req.Header.Peek("X-Api-Version"), "request of the application left untouched")
+	})
+}
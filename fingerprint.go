@@ -0,0 +1,40 @@
+package bearer
+
+import "net/http"
+
+// InboundHeaders selects the headers of inbound requests, and of their
+// responses, captured although they may fingerprint users, e.g. under the
+// GDPR. All are left out of records by default.
+type InboundHeaders struct {
+	// UserAgent captures the User-Agent header.
+	UserAgent bool
+	// Language captures the Accept-Language header.
+	Language bool
+	// Cookies captures the Cookie headers of requests and the Set-Cookie
+	// headers of responses, with the values of cookies masked unless named
+	// in Agent.CookieValues.
+	Cookies bool
+}
+
+// strip removes the headers not captured from the inbound record.
+func (h InboundHeaders) strip(record *ReportLog) {
+	var names []string
+	if !h.UserAgent {
+		names = append(names, "User-Agent")
+	}
+	if !h.Language {
+		names = append(names, "Accept-Language")
+	}
+	if !h.Cookies {
+		names = append(names, "Cookie", "Set-Cookie")
+	}
+	for _, headers := range []map[string][]string{record.RequestHeaders, record.ResponseHeaders} {
+		for name := range headers {
+			for _, stripped := range names {
+				if http.CanonicalHeaderKey(name) == stripped {
+					delete(headers, name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_InboundHeaders(t *testing.T) {
+	serve := func(t *testing.T, headers InboundHeaders) ReportLog {
+		fake := newFakeBearer(`{}`)
+		agent := &Agent{SecretKey: "sk_test", Transport: fake, InboundHeaders: headers}
+		handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			w.Header().Set("X-Request-Id", "1")
+		}))
+		ts := httptest.NewServer(handler)
+		defer ts.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		req.Header.Set("Accept-Language", "fr-FR")
+		req.Header.Set("Accept", "*/*")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return fake.next(t)
+	}
+
+	record := serve(t, InboundHeaders{})
+	assert.Equal(t, []string{"*/*"}, record.RequestHeaders["Accept"])
+	assert.NotContains(t, record.RequestHeaders, "User-Agent")
+	assert.NotContains(t, record.RequestHeaders, "Accept-Language")
+	assert.NotContains(t, record.RequestHeaders, "Cookie")
+	assert.NotContains(t, record.ResponseHeaders, "Set-Cookie")
+	assert.Contains(t, record.ResponseHeaders, "X-Request-Id")
+
+	record = serve(t, InboundHeaders{UserAgent: true, Language: true, Cookies: true})
+	assert.Equal(t, []string{"Mozilla/5.0"}, record.RequestHeaders["User-Agent"])
+	assert.Equal(t, []string{"fr-FR"}, record.RequestHeaders["Accept-Language"])
+	assert.Contains(t, record.RequestHeaders, "Cookie")
+	assert.Contains(t, record.ResponseHeaders, "Set-Cookie")
+}
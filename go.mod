@@ -4,5 +4,7 @@ go 1.13
 
 require (
 	github.com/stretchr/testify v1.4.0
+	go.uber.org/goleak v1.1.10
 	go.uber.org/zap v1.13.0
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 )
@@ -0,0 +1,139 @@
+// Package grpcbearer reports gRPC calls served by the application to Bearer.
+//
+// Calls are reported with the same record schema as the inbound HTTP requests
+// reported by bearer.Agent.Middleware: the gRPC method is used as path and
+// endpoint, the metadata as headers, and the gRPC status code is mapped to
+// the equivalent HTTP status code.
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcbearer.UnaryServerInterceptor(agent)),
+//		grpc.StreamInterceptor(grpcbearer.StreamServerInterceptor(agent)),
+//	)
+package grpcbearer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor reporting unary calls to agent.
+// Like bearer.Agent.Middleware, it prepares the context of calls with bearer.Agent.InboundContext.
+func UnaryServerInterceptor(agent *bearer.Agent) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		header := incomingHeader(ctx)
+		ctx = agent.InboundContext(ctx, header)
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		end := time.Now()
+		report(ctx, agent, header, info.FullMethod, err, start, end)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor reporting streaming calls to agent.
+// A streaming call is reported once, when the handler returns.
+// Like bearer.Agent.Middleware, it prepares the context of calls with bearer.Agent.InboundContext.
+func StreamServerInterceptor(agent *bearer.Agent) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		header := incomingHeader(stream.Context())
+		ctx := agent.InboundContext(stream.Context(), header)
+
+		start := time.Now()
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		end := time.Now()
+		report(ctx, agent, header, info.FullMethod, err, start, end)
+		return err
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// incomingHeader converts the incoming metadata of a call to HTTP headers.
+// Pseudo-headers such as ":authority" are kept with their original name.
+func incomingHeader(ctx context.Context) http.Header {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := http.Header{}
+	for key, values := range md {
+		if len(key) > 0 && key[0] == ':' {
+			header[key] = values
+			continue
+		}
+		header[http.CanonicalHeaderKey(key)] = values
+	}
+	return header
+}
+
+func report(ctx context.Context, agent *bearer.Agent, header http.Header, fullMethod string, err error, start, end time.Time) {
+	authority := ""
+	if values := header[":authority"]; len(values) > 0 {
+		authority = values[0]
+	}
+	req := &http.Request{
+		Method: "POST",
+		URL:    &url.URL{Scheme: "grpc", Host: authority, Path: fullMethod},
+		Header: http.Header{},
+		Host:   authority,
+	}
+	for key, values := range header {
+		if key[0] != ':' {
+			req.Header[key] = values
+		}
+	}
+	req = req.WithContext(bearer.WithEndpoint(ctx, fullMethod))
+
+	code := status.Code(err)
+	resp := &http.Response{
+		StatusCode: HTTPStatusFromCode(code),
+		Header:     http.Header{"Grpc-Status": []string{strconv.Itoa(int(code))}},
+	}
+	agent.ReportInbound(req, resp, start, end)
+}
+
+// HTTPStatusFromCode returns the HTTP status code equivalent to a gRPC status code,
+// following https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
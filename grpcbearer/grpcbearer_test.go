@@ -0,0 +1,104 @@
+package grpcbearer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type record struct {
+	Type       string              `json:"type"`
+	Protocol   string              `json:"protocol"`
+	Hostname   string              `json:"hostname"`
+	Path       string              `json:"path"`
+	Endpoint   string              `json:"endpoint"`
+	StatusCode int                 `json:"statusCode"`
+	Headers    map[string][]string `json:"requestHeaders"`
+	RequestID  string              `json:"requestId"`
+}
+
+// newAgent returns an agent sending its records to the returned channel.
+func newAgent() (*bearer.Agent, chan record) {
+	records := make(chan record, 10)
+	agent := &bearer.Agent{
+		SecretKey: "sk_test",
+		Transport: bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "agent.bearer.sh" {
+				var input struct {
+					Logs []record `json:"logs"`
+				}
+				if err := json.NewDecoder(req.Body).Decode(&input); err != nil {
+					return nil, err
+				}
+				for _, log := range input.Logs {
+					records <- log
+				}
+			}
+			return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{}`))}, nil
+		}),
+	}
+	return agent, records
+}
+
+func next(t *testing.T, records chan record) record {
+	t.Helper()
+	select {
+	case r := <-records:
+		return r
+	case <-time.After(time.Second):
+		require.FailNow(t, "no record reported")
+		return record{}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	agent, records := newAgent()
+	interceptor := UnaryServerInterceptor(agent)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(":authority", "api.example.com", "x-request-id", "42"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}
+
+	resp, err := interceptor(ctx, "hello", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Equal(t, "42", bearer.CorrelationFromContext(ctx).RequestID)
+		return req.(string) + " world", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", resp)
+	r := next(t, records)
+	assert.Equal(t, "INBOUND_REQUEST_END", r.Type)
+	assert.Equal(t, "grpc", r.Protocol)
+	assert.Equal(t, "api.example.com", r.Hostname)
+	assert.Equal(t, "/helloworld.Greeter/SayHello", r.Path)
+	assert.Equal(t, "/helloworld.Greeter/SayHello", r.Endpoint)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Equal(t, []string{"42"}, r.Headers["X-Request-Id"])
+	assert.Equal(t, "42", r.RequestID)
+
+	handlerErr := status.Error(codes.NotFound, "no such greeter")
+	_, err = interceptor(ctx, "hello", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, handlerErr
+	})
+	assert.True(t, errors.Is(err, handlerErr))
+	r = next(t, records)
+	assert.Equal(t, 404, r.StatusCode)
+}
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	assert.Equal(t, 200, HTTPStatusFromCode(codes.OK))
+	assert.Equal(t, 404, HTTPStatusFromCode(codes.NotFound))
+	assert.Equal(t, 503, HTTPStatusFromCode(codes.Unavailable))
+	assert.Equal(t, 500, HTTPStatusFromCode(codes.Internal))
+	assert.Equal(t, 500, HTTPStatusFromCode(codes.Unknown))
+}
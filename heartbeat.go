@@ -0,0 +1,128 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recordTypeAgentHeartbeat is the type of records describing the state of a
+// running agent, reported regularly regardless of traffic.
+const recordTypeAgentHeartbeat = "AGENT_HEARTBEAT"
+
+// recordCounters counts the records sent to Bearer, those which failed to
+// be sent, and those left out by sampling.
+type recordCounters struct {
+	mutex      sync.Mutex
+	sent       int
+	dropped    int
+	sampledOut int
+}
+
+// add counts records sent with err: only the rejected records are dropped
+// if err is a partialError.
+func (c *recordCounters) add(records int, err error) {
+	dropped := 0
+	if err != nil {
+		dropped = records
+		var partial *partialError
+		if errors.As(err, &partial) {
+			dropped = len(partial.rejected)
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sent += records - dropped
+	c.dropped += dropped
+}
+
+func (c *recordCounters) addSampledOut() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sampledOut++
+}
+
+func (c *recordCounters) sampledOutCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sampledOut
+}
+
+func (c *recordCounters) get() (sent, dropped int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sent, c.dropped
+}
+
+// agentHeartbeat is the state of the agent in heartbeat records.
+type agentHeartbeat struct {
+	// Uptime is the number of milliseconds since the agent fetched its
+	// first configuration.
+	Uptime         int    `json:"uptime"`
+	Version        string `json:"version"`
+	RecordsSent    int    `json:"recordsSent"`
+	RecordsDropped int    `json:"recordsDropped"`
+	Panics         int    `json:"panics"`
+	Paused         bool   `json:"paused,omitempty"`
+	// ConfigHash identifies the configuration in use, so that agents which
+	// didn't pick up an update can be told apart.
+	ConfigHash string `json:"configHash,omitempty"`
+}
+
+// startHeartbeats starts reporting heartbeats regularly, if enabled. It is
+// called once the first configuration is fetched.
+func (a *Agent) startHeartbeats() {
+	if a.HeartbeatEvery <= 0 {
+		return
+	}
+	started := time.Now()
+	a.goWorker(func() {
+		defer a.recoverPanic()
+		for {
+			a.reportHeartbeat(started, time.Now())
+			if !a.sleep(a.HeartbeatEvery) {
+				return
+			}
+		}
+	})
+}
+
+// reportHeartbeat reports the state of the agent at now.
+func (a *Agent) reportHeartbeat(started, now time.Time) {
+	sent, dropped := a.records.get()
+	a.report(a.context(), ReportLog{
+		Type:      recordTypeAgentHeartbeat,
+		StartedAt: int(started.UnixNano() / 1000000),
+		EndedAt:   int(now.UnixNano() / 1000000),
+		Heartbeat: &agentHeartbeat{
+			Uptime:         int(now.Sub(started) / time.Millisecond),
+			Version:        version,
+			RecordsSent:    sent,
+			RecordsDropped: dropped,
+			Panics:         int(atomic.LoadInt32(&a.panics)),
+			Paused:         !a.Enabled(),
+			ConfigHash:     a.configHash(),
+		},
+	})
+}
+
+// configHash returns a short hash of the cached configuration, or "" if
+// none was fetched.
+func (a *Agent) configHash() string {
+	a.configMutex.RLock()
+	config := a.configCache
+	a.configMutex.RUnlock()
+	if config == nil {
+		return ""
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
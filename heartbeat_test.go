@@ -0,0 +1,46 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Heartbeat(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{"blockedDomains":["blocked.example.com"]}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, HeartbeatEvery: 20 * time.Millisecond}
+	resp, err := (&http.Client{Transport: agent.Wrap(http.DefaultTransport)}).Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	var heartbeat *agentHeartbeat
+	for heartbeat == nil || heartbeat.RecordsSent == 0 {
+		record := fake.next(t)
+		if record.Type == recordTypeAgentHeartbeat {
+			heartbeat = record.Heartbeat
+			require.NotNil(t, heartbeat)
+		}
+	}
+	assert.Equal(t, version, heartbeat.Version)
+	assert.Zero(t, heartbeat.RecordsDropped)
+	assert.Len(t, heartbeat.ConfigHash, 16)
+	assert.Equal(t, agent.configHash(), heartbeat.ConfigHash)
+	assert.True(t, heartbeat.Uptime >= 0)
+	assert.True(t, agent.Stats().RecordsSent >= heartbeat.RecordsSent)
+}
+
+func TestRecordCounters(t *testing.T) {
+	var counters recordCounters
+	counters.add(2, nil)
+	counters.add(1, assert.AnError)
+	sent, dropped := counters.get()
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, 1, dropped)
+}
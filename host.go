@@ -0,0 +1,129 @@
+package bearer
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Hosts in rules and in the host-keyed options of the agent are either a
+// hostname or IP address, matching any port, or a host and port, matching
+// this port only:
+//
+//	api.example.com        any port
+//	api.example.com:8443   port 8443
+//	api.example.com:443    port 443, including https URLs without a port
+//	::1 or [::1]           IPv6 address, any port
+//	[::1]:8080             IPv6 address, port 8080
+//
+// Hostnames are matched case-insensitively, and internationalized domain
+// names either in Unicode or in punycode (see normalizeHostname). Keys of the
+// host-keyed options must be lowercase, in punycode.
+//
+// The canonical form of a URL's host, used in reporting keys, is its
+// normalized hostname followed by its port only if the port differs from the
+// scheme's default, with IPv6 addresses bracketed only when followed by a port.
+
+// splitHost returns the hostname and port of host, without brackets.
+// The port is empty if host doesn't have any.
+func splitHost(host string) (hostname, port string) {
+	if strings.HasPrefix(host, "[") {
+		if end := strings.Index(host, "]"); end > 0 {
+			return host[1:end], strings.TrimPrefix(host[end+1:], ":")
+		}
+	}
+	if strings.Count(host, ":") == 1 {
+		i := strings.LastIndex(host, ":")
+		return host[:i], host[i+1:]
+	}
+	// a hostname, an IPv4 address or an IPv6 address without port
+	return host, ""
+}
+
+// defaultPort returns the default port of scheme, or "" if unknown.
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+	return ""
+}
+
+// urlPort returns the port of u, or the default port of its scheme.
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPort(u.Scheme)
+}
+
+// urlHostname returns the normalized hostname of u.
+func urlHostname(u *url.URL) string {
+	return normalizeHostname(u.Hostname())
+}
+
+// normalizeURL returns a copy of u with its hostname normalized.
+func normalizeURL(u *url.URL) *url.URL {
+	hostname := urlHostname(u)
+	if hostname == u.Hostname() {
+		return u
+	}
+	ret := *u
+	switch port := u.Port(); {
+	case port != "":
+		ret.Host = net.JoinHostPort(hostname, port)
+	case strings.Contains(hostname, ":"):
+		ret.Host = "[" + hostname + "]"
+	default:
+		ret.Host = hostname
+	}
+	return &ret
+}
+
+// matchHost reports whether the host of u matches pattern.
+func matchHost(pattern string, u *url.URL) bool {
+	hostname, port := splitHost(pattern)
+	if normalizeHostname(hostname) != urlHostname(u) {
+		return false
+	}
+	return port == "" || port == urlPort(u)
+}
+
+// canonicalHost returns the host of u in canonical form.
+func canonicalHost(u *url.URL) string {
+	hostname, port := urlHostname(u), u.Port()
+	if port == "" || port == defaultPort(u.Scheme) {
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+// hostKeys returns the keys under which the host of u may be configured in
+// the host-keyed options of the agent, by precedence.
+func hostKeys(u *url.URL) []string {
+	hostname := urlHostname(u)
+	keys := make([]string, 0, 3)
+	if port := urlPort(u); port != "" {
+		keys = append(keys, net.JoinHostPort(hostname, port))
+	}
+	keys = append(keys, hostname)
+	if strings.Contains(hostname, ":") {
+		keys = append(keys, "["+hostname+"]")
+	}
+	return keys
+}
+
+// lookupHostString returns the value of the host of u in m.
+func lookupHostString(m map[string]string, u *url.URL) (string, bool) {
+	if len(m) == 0 {
+		return "", false
+	}
+	for _, key := range hostKeys(u) {
+		if value, ok := m[key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
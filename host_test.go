@@ -0,0 +1,77 @@
+package bearer
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		matches bool
+	}{
+		{pattern: "api.example.com", url: "https://api.example.com/users", matches: true},
+		{pattern: "api.example.com", url: "https://api.example.com:8443/users", matches: true},
+		{pattern: "api.example.com:8443", url: "https://api.example.com:8443/users", matches: true},
+		{pattern: "api.example.com:8443", url: "https://api.example.com/users", matches: false},
+		{pattern: "api.example.com:443", url: "https://api.example.com/users", matches: true},
+		{pattern: "api.example.com:443", url: "http://api.example.com/users", matches: false},
+		{pattern: "api.example.com:80", url: "http://api.example.com:80/users", matches: true},
+		{pattern: "::1", url: "http://[::1]:8080/", matches: true},
+		{pattern: "[::1]", url: "http://[::1]:8080/", matches: true},
+		{pattern: "[::1]:8080", url: "http://[::1]:8080/", matches: true},
+		{pattern: "[::1]:8081", url: "http://[::1]:8080/", matches: false},
+		{pattern: "::2", url: "http://[::1]/", matches: false},
+		{pattern: "example.com", url: "https://api.example.com/", matches: false},
+		{pattern: "api.example.com", url: "https://API.Example.COM/", matches: true},
+		{pattern: "API.example.com", url: "https://api.example.com./", matches: true},
+		{pattern: "münchen.de", url: "https://xn--mnchen-3ya.de/", matches: true},
+		{pattern: "xn--mnchen-3ya.de", url: "https://MÜNCHEN.de/", matches: true},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		require.NoError(t, err)
+		assert.Equal(t, test.matches, matchHost(test.pattern, u), "%s %s", test.pattern, test.url)
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	tests := map[string]string{
+		"https://api.example.com/users":      "api.example.com",
+		"https://api.example.com:443/users":  "api.example.com",
+		"https://api.example.com:8443/users": "api.example.com:8443",
+		"http://api.example.com:443/users":   "api.example.com:443",
+		"http://[::1]/":                      "::1",
+		"http://[::1]:80/":                   "::1",
+		"http://[::1]:8080/":                 "[::1]:8080",
+	}
+	for raw, expected := range tests {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, expected, canonicalHost(u), raw)
+	}
+}
+
+func TestHostKeys(t *testing.T) {
+	u, _ := url.Parse("https://api.example.com/users")
+	assert.Equal(t, []string{"api.example.com:443", "api.example.com"}, hostKeys(u))
+	u, _ = url.Parse("http://[::1]:8080/")
+	assert.Equal(t, []string{"[::1]:8080", "::1", "[::1]"}, hostKeys(u))
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := map[string]string{
+		"https://API.Example.COM/Users?q=A": "https://api.example.com/Users?q=A",
+		"https://münchen.de:8443/":          "https://xn--mnchen-3ya.de:8443/",
+		"http://[::1]:8080/":                "http://[::1]:8080/",
+	}
+	for raw, expected := range tests {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, expected, normalizeURL(u).String(), raw)
+	}
+}
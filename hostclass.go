@@ -0,0 +1,89 @@
+package bearer
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HostClass tells first-party hosts, e.g. the company's own services, from
+// third-party ones.
+type HostClass string
+
+const (
+	// HostInternal is the class of private IP addresses, cluster DNS names
+	// and the hosts of Agent.InternalHosts.
+	HostInternal HostClass = "internal"
+	// HostExternal is the class of the other hosts.
+	HostExternal HostClass = "external"
+)
+
+// internalSuffixes are the suffixes of the cluster and local DNS names.
+var internalSuffixes = []string{".svc", ".cluster.local", ".local", ".internal", ".localdomain"}
+
+// privateNetworks are the networks of private, loopback and link-local
+// addresses, and of shared address space.
+var privateNetworks = parseNetworks(
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10",
+	"127.0.0.0/8", "169.254.0.0/16", "::1/128", "fc00::/7", "fe80::/10",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, networks[i], _ = net.ParseCIDR(cidr)
+	}
+	return networks
+}
+
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostClass returns the class of the host of u.
+func (a *Agent) hostClass(u *url.URL) HostClass {
+	hostname := urlHostname(u)
+	if ip := net.ParseIP(hostname); ip != nil {
+		if inNetworks(ip, privateNetworks) {
+			return HostInternal
+		}
+		return HostExternal
+	}
+	// single-label names are resolved by the search domains of the cluster
+	if !strings.Contains(hostname, ".") {
+		return HostInternal
+	}
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(hostname, suffix) {
+			return HostInternal
+		}
+	}
+	for _, suffix := range a.InternalHosts {
+		suffix = normalizeHostname(strings.TrimPrefix(suffix, "."))
+		if hostname == suffix || strings.HasSuffix(hostname, "."+suffix) {
+			return HostInternal
+		}
+	}
+	return HostExternal
+}
+
+// classIn reports whether the class of the host of req is among classes,
+// which include every class if empty.
+func (a *Agent) classIn(req *http.Request, classes []HostClass) bool {
+	if len(classes) == 0 {
+		return true
+	}
+	class := a.hostClass(req.URL)
+	for _, c := range classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
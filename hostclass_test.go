@@ -0,0 +1,55 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_HostClass(t *testing.T) {
+	agent := &Agent{InternalHosts: []string{"example.com", ".corp.net"}}
+	tests := map[string]HostClass{
+		"http://10.1.2.3/":                           HostInternal,
+		"http://172.20.0.1/":                         HostInternal,
+		"http://192.168.1.1:8080/":                   HostInternal,
+		"http://127.0.0.1/":                          HostInternal,
+		"http://[fd00::1]/":                          HostInternal,
+		"http://8.8.8.8/":                            HostExternal,
+		"http://payments/":                           HostInternal,
+		"http://payments.default.svc/":               HostInternal,
+		"http://payments.default.svc.cluster.local/": HostInternal,
+		"https://example.com/":                       HostInternal,
+		"https://api.example.com/":                   HostInternal,
+		"https://notexample.com/":                    HostExternal,
+		"https://billing.corp.net/":                  HostInternal,
+		"https://api.stripe.com/":                    HostExternal,
+	}
+	for rawURL, expected := range tests {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, agent.hostClass(u), rawURL)
+	}
+}
+
+func TestAgent_CaptureClasses(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{"blockedDomains":["127.0.0.1"]}`)
+	agent := &Agent{
+		SecretKey:      "sk_test",
+		Transport:      fake,
+		SyncReporting:  true,
+		CaptureClasses: []HostClass{HostExternal},
+		BlockClasses:   []HostClass{HostExternal},
+	}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err, "blocking rules don't apply to internal hosts")
+	resp.Body.Close()
+	assert.Empty(t, fake.Records(), "internal hosts aren't captured")
+}
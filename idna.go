@@ -0,0 +1,35 @@
+package bearer
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// normalizeHostname returns hostname lowercased, without trailing dot, and
+// with its non-ASCII labels mapped and encoded in punycode as net/http does
+// before dialing, as in "xn--mnchen-3ya.de", so that every spelling of a
+// domain, e.g. with full-width characters or ideographic full stops, is
+// equal to the one dialed. Hostnames which aren't valid IDNs are only
+// lowercased.
+func normalizeHostname(hostname string) string {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if isASCII(hostname) {
+		return hostname
+	}
+	ascii, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return hostname
+	}
+	return strings.TrimSuffix(ascii, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
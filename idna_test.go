@@ -0,0 +1,41 @@
+package bearer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := map[string]string{
+		"api.example.com":   "api.example.com",
+		"API.Example.COM":   "api.example.com",
+		"api.example.com.":  "api.example.com",
+		"münchen.de":        "xn--mnchen-3ya.de",
+		"MÜNCHEN.de":        "xn--mnchen-3ya.de",
+		"bücher.example":    "xn--bcher-kva.example",
+		"例え.jp":             "xn--r8jz45g.jp",
+		"xn--mnchen-3ya.de": "xn--mnchen-3ya.de",
+		"::1":               "::1",
+		"example。com":       "example.com",
+		"ｅｘａｍｐｌｅ.com":       "example.com",
+		"ＡＰＩ.example.com":   "api.example.com",
+		"example.com。":      "example.com",
+	}
+	for hostname, expected := range tests {
+		assert.Equal(t, expected, normalizeHostname(hostname), hostname)
+	}
+}
+
+func TestCheckBlocked_idna(t *testing.T) {
+	config := &Config{BlockedDomains: []string{"example.com"}, BlockRules: []BlockRule{{Host: "api.example.org"}}}
+	for _, rawurl := range []string{"http://example。com/", "http://ｅｘａｍｐｌｅ.com/", "http://ａｐｉ.example.org/"} {
+		req, err := http.NewRequest("GET", rawurl, nil)
+		require.NoError(t, err)
+		_, err = checkBlocked(config, req, time.Now())
+		assert.Error(t, err, rawurl)
+	}
+}
@@ -0,0 +1,171 @@
+package bearer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Middleware returns an http.Handler reporting the requests served by next to Bearer.
+// Inbound requests are reported with the same record schema as outgoing ones.
+// Their bodies are held in memory up to MaxBodySize, or 1MiB if unset, and
+// the larger ones are reported with their size and digest only.
+//
+// The context of inbound requests is prepared with InboundContext, so that the
+// records of outgoing requests performed with it can be related to the inbound
+// request which caused them.
+func (a *Agent) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req = req.WithContext(a.InboundContext(req.Context(), req.Header))
+		if !a.isAvailable() || !a.Enabled() {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		var reqBody *boundedBody
+		if req.Body != nil && req.Body != http.NoBody {
+			reqBody = a.newBoundedBody()
+			req.Body = teeReadCloser{Reader: io.TeeReader(req.Body, reqBody), Closer: req.Body}
+		}
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK, body: a.newBoundedBody()}
+
+		start := time.Now()
+		next.ServeHTTP(recorder, req)
+		end := start.Add(time.Since(start))
+
+		resp := &http.Response{
+			StatusCode: recorder.statusCode,
+			Header:     w.Header(),
+		}
+		a.reportInbound(req, resp, reqBody, recorder.body, start, end)
+	})
+}
+
+// ReportInbound reports a call received and served by the application, which
+// did not go through Middleware; for instance a call handled by a non-HTTP
+// server such as gRPC. req and resp describe the call as received and replied,
+// and their bodies, if any, are captured like the ones of Middleware.
+// req's context should be derived from the one returned by InboundContext.
+func (a *Agent) ReportInbound(req *http.Request, resp *http.Response, start, end time.Time) {
+	if !a.isAvailable() || !a.Enabled() {
+		return
+	}
+	var reqBody, respBody *boundedBody
+	if req.Body != nil {
+		reqBody = a.readBoundedBody(req.Body)
+	}
+	if resp.Body != nil {
+		respBody = a.readBoundedBody(resp.Body)
+	}
+	a.reportInbound(req, resp, reqBody, respBody, start, end)
+}
+
+func (a *Agent) reportInbound(req *http.Request, resp *http.Response, reqBody, respBody *boundedBody, start, end time.Time) {
+	defer a.recoverPanic()
+	a.reportBursts(req.Context())
+	// server-side requests have no scheme nor host in their URL
+	inbound := *req
+	u := *req.URL
+	inbound.URL = &u
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if req.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	if u.Host == "" {
+		u.Host = req.Host
+	}
+	if !a.captures(a.config(), &inbound) {
+		return
+	}
+	inbound = *a.nameEndpoint(&inbound)
+
+	reqReader, reqSize, reqDigest := inboundBody(reqBody)
+	recordResp := *resp
+	var respSize int
+	var respDigest string
+	recordResp.Body, respSize, respDigest = inboundBody(respBody)
+	record := newRecord(&inbound, &recordResp, start, end, reqReader, nil)
+	record.RequestBodySize, record.RequestBodySHA256 = reqSize, reqDigest
+	record.ResponseBodySize, record.ResponseBodySHA256 = respSize, respDigest
+	record.Type = recordTypeInboundRequestEnd
+	a.InboundHeaders.strip(&record)
+	if webhook := webhookFromContext(req.Context()); webhook != nil {
+		record.Webhook = webhook.describe(&inbound)
+	}
+	if a.CallGraph {
+		// the record ID stored by InboundContext is the parent of outgoing
+		// requests, and identifies the inbound request itself
+		record.ID = parentRecordFromContext(req.Context())
+		if record.ID == "" {
+			record.ID = newRecordID()
+		}
+	}
+	if !a.sampledOut(&inbound, &record) {
+		a.report(req.Context(), record)
+	}
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseRecorder captures the status code and body written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        *boundedBody
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(buf []byte) (int, error) {
+	r.wroteHeader = true
+	if isParseableContentType.MatchString(r.Header().Get("Content-Type")) {
+		r.body.Write(buf)
+	}
+	return r.ResponseWriter.Write(buf)
+}
+
+// Flush implements http.Flusher when the underlying http.ResponseWriter does.
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying http.ResponseWriter
+// does, e.g. for WebSocket upgrades.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("bearer: %T doesn't implement http.Hijacker", r.ResponseWriter)
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && !r.wroteHeader {
+		// the handler replies on the connection itself
+		r.statusCode = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Push implements http.Pusher when the underlying http.ResponseWriter does.
+func (r *responseRecorder) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := r.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,97 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"received":` + string(body) + `}`))
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/users?page=2", "application/json", strings.NewReader(`{"name":"blah"}`))
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, `{"received":{"name":"blah"}}`, string(body))
+
+	record := fake.next(t)
+	assert.Equal(t, recordTypeInboundRequestEnd, record.Type)
+	assert.Equal(t, "http", record.Protocol)
+	assert.Equal(t, "POST", record.Method)
+	assert.Equal(t, "127.0.0.1", record.Hostname)
+	assert.Equal(t, "/users", record.Path)
+	assert.Equal(t, ts.URL+"/users?page=2", record.URL)
+	assert.Equal(t, http.StatusCreated, record.StatusCode)
+	assert.Equal(t, `{"name":"blah"}`, record.RequestBody)
+	assert.Equal(t, `{"received":{"name":"blah"}}`, record.ResponseBody)
+}
+
+func TestMiddleware_Hijack(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL+"/ws", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	record := fake.next(t)
+	assert.Equal(t, http.StatusSwitchingProtocols, record.StatusCode)
+}
+
+func TestMiddleware_boundedBodies(t *testing.T) {
+	large := strings.Repeat("x", maxInboundBody+1)
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(large))
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "text/plain", strings.NewReader(large))
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Len(t, body, len(large))
+
+	// the bodies exceeding the bound aren't held whole, but digested
+	record := fake.next(t)
+	assert.Empty(t, record.RequestBody)
+	assert.Equal(t, len(large), record.RequestBodySize)
+	assert.Equal(t, sha256Hex(large), record.RequestBodySHA256)
+	assert.Empty(t, record.ResponseBody)
+	assert.Equal(t, len(large), record.ResponseBodySize)
+}
@@ -0,0 +1,100 @@
+package bearer
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxInventoryEntries bounds the number of endpoints in the inventory.
+const maxInventoryEntries = 10000
+
+// InventoryEntry describes an endpoint called by the application since the
+// agent started.
+type InventoryEntry struct {
+	Host string `json:"host"`
+	// API is the logical name of the host's API, if named (see Agent.APINames).
+	API   string    `json:"api,omitempty"`
+	Class HostClass `json:"class"`
+	// Endpoint is the endpoint template of the requests (see WithEndpoint), or
+	// their method and templated path, e.g. "GET /users/{id}".
+	Endpoint  string    `json:"endpoint"`
+	Requests  int       `json:"requests"`
+	Failures  int       `json:"failures"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// inventoryKey identifies the endpoints of the inventory.
+type inventoryKey struct {
+	host, endpoint string
+}
+
+// inventory holds the endpoints called by the application.
+type inventory struct {
+	mutex   sync.Mutex
+	entries map[inventoryKey]*InventoryEntry
+}
+
+// observeInventory adds a request, performed at now, to the inventory.
+func (a *Agent) observeInventory(req *http.Request, api string, now time.Time, resp *http.Response, err error) {
+	endpoint := EndpointFromContext(req.Context())
+	if endpoint == "" {
+		endpoint = req.Method + " " + templatePath(req.URL.Path)
+	}
+	key := inventoryKey{host: canonicalHost(req.URL), endpoint: endpoint}
+
+	inv := &a.inventory
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	entry := inv.entries[key]
+	if entry == nil {
+		if len(inv.entries) >= maxInventoryEntries {
+			return
+		}
+		if inv.entries == nil {
+			inv.entries = map[inventoryKey]*InventoryEntry{}
+		}
+		entry = &InventoryEntry{Host: key.host, API: api, Class: a.hostClass(req.URL), Endpoint: endpoint, FirstSeen: now}
+		inv.entries[key] = entry
+	}
+	entry.Requests++
+	if err != nil || resp == nil || resp.StatusCode >= 500 {
+		entry.Failures++
+	}
+	entry.LastSeen = now
+}
+
+// Inventory returns the endpoints called by the application since the agent
+// started, by host and endpoint, e.g. to list the third-party APIs it
+// depends on. Up to 10000 endpoints are tracked.
+func (a *Agent) Inventory() []InventoryEntry {
+	inv := &a.inventory
+	inv.mutex.Lock()
+	entries := make([]InventoryEntry, 0, len(inv.entries))
+	for _, entry := range inv.entries {
+		entries = append(entries, *entry)
+	}
+	inv.mutex.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Host != entries[j].Host {
+			return entries[i].Host < entries[j].Host
+		}
+		return entries[i].Endpoint < entries[j].Endpoint
+	})
+	return entries
+}
+
+// WriteInventory writes the inventory to w as a JSON document, with the
+// time at which it was generated.
+func (a *Agent) WriteInventory(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		GeneratedAt time.Time        `json:"generatedAt"`
+		Endpoints   []InventoryEntry `json:"endpoints"`
+	}{time.Now().UTC(), a.Inventory()})
+}
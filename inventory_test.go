@@ -0,0 +1,49 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Inventory(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/users/2" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer api.Close()
+	u, _ := url.Parse(api.URL)
+	agent := &Agent{APINames: map[string]string{"127.0.0.1": "users"}}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for _, path := range []string{"/users/1", "/users/2", "/health"} {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	inventory := agent.Inventory()
+	require.Len(t, inventory, 2)
+	assert.Equal(t, u.Host, inventory[0].Host)
+	assert.Equal(t, "GET /health", inventory[0].Endpoint)
+	assert.Equal(t, "GET /users/{id}", inventory[1].Endpoint)
+	assert.Equal(t, "users", inventory[1].API)
+	assert.Equal(t, HostInternal, inventory[1].Class)
+	assert.Equal(t, 2, inventory[1].Requests)
+	assert.Equal(t, 1, inventory[1].Failures)
+	assert.False(t, inventory[1].LastSeen.Before(inventory[1].FirstSeen))
+
+	var buf bytes.Buffer
+	require.NoError(t, agent.WriteInventory(&buf))
+	var export struct {
+		Endpoints []InventoryEntry `json:"endpoints"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &export))
+	assert.Len(t, export.Endpoints, 2)
+}
@@ -0,0 +1,64 @@
+package bearer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// jwtPattern matches JSON Web Tokens, whose header and payload are
+	// base64url-encoded JSON objects.
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]{2,}\.eyJ[A-Za-z0-9_-]{2,}\.[A-Za-z0-9_-]*`)
+	// jwtValue matches values made of a JWT, with an optional scheme as in
+	// "Bearer <token>".
+	jwtValue = regexp.MustCompile(`^(?:[A-Za-z]+ +)?` + jwtPattern.String() + `$`)
+)
+
+// jwtClaims are the claims of JWTs kept in records, which identify their
+// issuer, audience and expiration but not their subject.
+var jwtClaims = []string{"iss", "aud", "exp"}
+
+// summarizeJWT returns the non-sensitive claims of token, e.g.
+// `[JWT iss=https://auth.example.com aud=api exp=1700000000]`, without its
+// signature. Tokens which can't be decoded are masked.
+func summarizeJWT(token string) string {
+	parts := strings.Split(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return defaultSensitivePlaceholder
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return defaultSensitivePlaceholder
+	}
+	summary := []string{"JWT"}
+	for _, name := range jwtClaims {
+		switch claim := claims[name].(type) {
+		case nil:
+		case string:
+			summary = append(summary, name+"="+claim)
+		case float64:
+			summary = append(summary, fmt.Sprintf("%s=%.0f", name, claim))
+		case []interface{}:
+			values := make([]string, len(claim))
+			for i, value := range claim {
+				values[i] = fmt.Sprint(value)
+			}
+			summary = append(summary, name+"="+strings.Join(values, ","))
+		}
+	}
+	return "[" + strings.Join(summary, " ") + "]"
+}
+
+// replaceJWTs returns s with its JWTs summarized, and their number.
+func replaceJWTs(s string) (string, int) {
+	count := 0
+	s = jwtPattern.ReplaceAllStringFunc(s, func(token string) string {
+		count++
+		return summarizeJWT(token)
+	})
+	return s, count
+}
@@ -0,0 +1,48 @@
+package bearer
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJWT(payload string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestSummarizeJWT(t *testing.T) {
+	token := testJWT(`{"iss":"https://auth.example.com","aud":["api","admin"],"exp":1700000000,"sub":"jane@example.com","email":"jane@example.com"}`)
+	assert.Equal(t, "[JWT iss=https://auth.example.com aud=api,admin exp=1700000000]", summarizeJWT(token))
+	assert.Equal(t, "[JWT]", summarizeJWT(testJWT(`{"sub":"jane"}`)))
+	assert.Equal(t, "[FILTERED]", summarizeJWT("eyJhbGciOiJIUzI1NiJ9.eyJ!!!.sig"))
+}
+
+func TestSanitize_JWT(t *testing.T) {
+	token := testJWT(`{"iss":"https://auth.example.com","aud":"api","exp":1700000000,"sub":"42"}`)
+	summary := "[JWT iss=https://auth.example.com aud=api exp=1700000000]"
+	record := ReportLog{
+		URL:   "http://api.example.com/callback?state=" + token,
+		Query: url.Values{"state": {token}},
+		RequestHeaders: map[string][]string{
+			"Authorization": {"Bearer " + token},
+			"X-Token":       {token},
+			"Content-Type":  {"application/json"},
+		},
+		RequestBody:  `{"id_token":"` + token + `","note":"sent ` + token + `"}`,
+		ErrorMessage: "expired " + token,
+	}
+
+	redacted, err := record.sanitize(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer " + summary}, record.RequestHeaders["Authorization"])
+	assert.Equal(t, []string{summary}, record.RequestHeaders["X-Token"])
+	assert.Equal(t, []string{summary}, record.Query["state"])
+	assert.Equal(t, "http://api.example.com/callback?state="+summary, record.URL)
+	assert.Equal(t, `{"id_token":"`+summary+`","note":"sent `+summary+`"}`, record.RequestBody)
+	assert.Equal(t, "expired "+summary, record.ErrorMessage)
+	assert.Equal(t, 6, redacted)
+}
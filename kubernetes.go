@@ -0,0 +1,44 @@
+package bearer
+
+import (
+	"strings"
+)
+
+// serviceAccountNamespaceFile holds the namespace of the pod in the service
+// account volume mounted by Kubernetes.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// kubernetesWorkload identifies the pod running the application in
+// records, so that they can be sliced by workload.
+type kubernetesWorkload struct {
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Image     string `json:"image,omitempty"`
+}
+
+// kubernetesEnvironment returns the workload running the application, or
+// nil outside of Kubernetes. It is read from the environment variables
+// conventionally set through the downward API (POD_NAME, POD_NAMESPACE,
+// NODE_NAME and CONTAINER_IMAGE), falling back to the pod's hostname and
+// service account namespace.
+func kubernetesEnvironment(getenv func(string) string, readFile func(string) ([]byte, error)) *kubernetesWorkload {
+	if getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil
+	}
+	workload := &kubernetesWorkload{
+		Pod:       getenv("POD_NAME"),
+		Namespace: getenv("POD_NAMESPACE"),
+		Node:      getenv("NODE_NAME"),
+		Image:     getenv("CONTAINER_IMAGE"),
+	}
+	if workload.Pod == "" {
+		workload.Pod = getenv("HOSTNAME")
+	}
+	if workload.Namespace == "" {
+		if namespace, err := readFile(serviceAccountNamespaceFile); err == nil {
+			workload.Namespace = strings.TrimSpace(string(namespace))
+		}
+	}
+	return workload
+}
@@ -0,0 +1,37 @@
+package bearer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubernetesEnvironment(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	namespaceFile := func(path string) ([]byte, error) {
+		if path == serviceAccountNamespaceFile {
+			return []byte("payments\n"), nil
+		}
+		return nil, errors.New("no such file")
+	}
+	noFile := func(string) ([]byte, error) { return nil, errors.New("no such file") }
+
+	assert.Nil(t, kubernetesEnvironment(env(map[string]string{"POD_NAME": "api"}), namespaceFile), "outside of Kubernetes")
+
+	assert.Equal(t, &kubernetesWorkload{Pod: "api-7d9f", Namespace: "payments"}, kubernetesEnvironment(env(map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"HOSTNAME":                "api-7d9f",
+	}), namespaceFile))
+
+	assert.Equal(t, &kubernetesWorkload{Pod: "api-1", Namespace: "default", Node: "node-1", Image: "api:1.2"}, kubernetesEnvironment(env(map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"HOSTNAME":                "api-7d9f",
+		"POD_NAME":                "api-1",
+		"POD_NAMESPACE":           "default",
+		"NODE_NAME":               "node-1",
+		"CONTAINER_IMAGE":         "api:1.2",
+	}), noFile), "downward API variables")
+}
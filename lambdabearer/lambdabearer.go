@@ -0,0 +1,187 @@
+// Package lambdabearer reports the requests of AWS Lambda functions to
+// Bearer. Lambda freezes its execution environments between invocations, so
+// records must be sent before the handler returns rather than by background
+// goroutines:
+//
+//	lambda.StartHandler(lambdabearer.Wrap(agent, handler))
+//
+// Alternatively, an internal extension registered with the Lambda Extensions
+// API sends the records of each invocation once its response is returned,
+// before the environment is frozen, not delaying responses:
+//
+//	extension, err := lambdabearer.RegisterExtension(ctx, agent)
+//	lambda.StartHandler(extension.Wrap(handler))
+package lambdabearer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"go.uber.org/zap"
+)
+
+// extensionAPIVersion is the version of the Lambda Extensions API used.
+const extensionAPIVersion = "2020-01-01"
+
+// ErrNoRuntimeAPI is returned by RegisterExtension outside of the Lambda runtime.
+var ErrNoRuntimeAPI = errors.New("lambdabearer: AWS_LAMBDA_RUNTIME_API is not set")
+
+// Handler is the interface of Lambda handlers, as lambda.Handler of
+// github.com/aws/aws-lambda-go.
+type Handler interface {
+	Invoke(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(ctx context.Context, payload []byte) ([]byte, error)
+
+// Invoke calls f.
+func (f HandlerFunc) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	return f(ctx, payload)
+}
+
+// Wrap returns a handler calling handler, and sending the records reported
+// by agent during the invocation before returning.
+func Wrap(agent *bearer.Agent, handler Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, payload []byte) ([]byte, error) {
+		defer flush(agent)
+		return handler.Invoke(ctx, payload)
+	})
+}
+
+func flush(agent *bearer.Agent) {
+	if err := agent.Flush(); err != nil && agent.Logger != nil {
+		agent.Logger.Warn("flush records", zap.Error(err))
+	}
+}
+
+// Extension is an internal Lambda extension sending the records reported by
+// its agent after each invocation.
+type Extension struct {
+	agent   *bearer.Agent
+	client  *http.Client
+	baseURL string
+	id      string
+	// returned is signaled by the handlers wrapped by the extension once
+	// they return.
+	returned chan struct{}
+}
+
+// RegisterExtension registers an internal extension with the Lambda
+// Extensions API of the runtime, and starts processing its events until ctx
+// is done.
+func RegisterExtension(ctx context.Context, agent *bearer.Agent) (*Extension, error) {
+	runtimeAPI := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if runtimeAPI == "" {
+		return nil, ErrNoRuntimeAPI
+	}
+	return registerExtension(ctx, agent, "http://"+runtimeAPI)
+}
+
+func registerExtension(ctx context.Context, agent *bearer.Agent, baseURL string) (*Extension, error) {
+	e := &Extension{
+		agent:    agent,
+		client:   &http.Client{},
+		baseURL:  baseURL + "/" + extensionAPIVersion + "/extension",
+		returned: make(chan struct{}, 1),
+	}
+	// internal extensions can only register for invocations
+	body, _ := json.Marshal(map[string][]string{"events": {"INVOKE"}})
+	req, err := http.NewRequest(http.MethodPost, e.baseURL+"/register", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Lambda-Extension-Name", filepath.Base(os.Args[0]))
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("register extension: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("register extension: status %d", resp.StatusCode)
+	}
+	e.id = resp.Header.Get("Lambda-Extension-Identifier")
+	go e.run(ctx)
+	return e, nil
+}
+
+// Wrap returns a handler calling handler, and letting the extension send
+// the records of the invocation once it returns.
+func (e *Extension) Wrap(handler Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, payload []byte) ([]byte, error) {
+		defer func() {
+			select {
+			case e.returned <- struct{}{}:
+			default:
+			}
+		}()
+		return handler.Invoke(ctx, payload)
+	})
+}
+
+// extensionEvent is an event of the Lambda Extensions API.
+type extensionEvent struct {
+	EventType string `json:"eventType"`
+	// DeadlineMs is the time, in milliseconds since the epoch, at which the
+	// invocation times out.
+	DeadlineMs int64 `json:"deadlineMs"`
+}
+
+// run waits for each invocation to return and sends its records, before
+// asking for the next event, which lets Lambda freeze the environment.
+func (e *Extension) run(ctx context.Context) {
+	for {
+		event, err := e.next(ctx)
+		if err != nil {
+			if ctx.Err() == nil && e.agent.Logger != nil {
+				e.agent.Logger.Warn("lambda extension event", zap.Error(err))
+			}
+			return
+		}
+		if event.EventType != "INVOKE" {
+			continue
+		}
+		// handlers which aren't wrapped never signal
+		deadline := time.NewTimer(time.Until(time.Unix(0, event.DeadlineMs*int64(time.Millisecond))))
+		select {
+		case <-e.returned:
+		case <-deadline.C:
+		case <-ctx.Done():
+		}
+		deadline.Stop()
+		flush(e.agent)
+	}
+}
+
+// next waits for the next event of the Extensions API.
+func (e *Extension) next(ctx context.Context) (extensionEvent, error) {
+	var event extensionEvent
+	req, err := http.NewRequest(http.MethodGet, e.baseURL+"/event/next", nil)
+	if err != nil {
+		return event, err
+	}
+	req.Header.Set("Lambda-Extension-Identifier", e.id)
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return event, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return event, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return event, fmt.Errorf("next event: status %d", resp.StatusCode)
+	}
+	err = json.Unmarshal(body, &event)
+	return event, err
+}
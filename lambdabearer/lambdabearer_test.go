@@ -0,0 +1,86 @@
+package lambdabearer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/Bearer/bearer-go/fakebearer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFunction returns an agent batching records for an hour, and a handler
+// performing a request through it.
+func newFunction() (*bearer.Agent, *fakebearer.Server, Handler, func()) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	fake := fakebearer.New(`{}`)
+	agent := &bearer.Agent{SecretKey: "sk_test", Transport: fake, RefreshConfigEvery: time.Hour, BatchMaxAge: time.Hour}
+	cleanup := func() {
+		agent.Close()
+		api.Close()
+	}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	handler := HandlerFunc(func(ctx context.Context, payload []byte) ([]byte, error) {
+		resp, err := client.Get(api.URL)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return payload, nil
+	})
+	return agent, fake, handler, cleanup
+}
+
+func TestWrap(t *testing.T) {
+	agent, fake, handler, cleanup := newFunction()
+	defer cleanup()
+	output, err := Wrap(agent, handler).Invoke(context.Background(), []byte("payload"))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(output))
+	assert.Len(t, fake.Records(), 1, "records are sent before returning")
+}
+
+func TestExtension(t *testing.T) {
+	agent, fake, handler, cleanup := newFunction()
+	defer cleanup()
+	events := make(chan string, 1)
+	recordsAtNext := make(chan int, 2)
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/2020-01-01/extension/register":
+			assert.NotEmpty(t, req.Header.Get("Lambda-Extension-Name"))
+			w.Header().Set("Lambda-Extension-Identifier", "extension-id")
+		case "/2020-01-01/extension/event/next":
+			assert.Equal(t, "extension-id", req.Header.Get("Lambda-Extension-Identifier"))
+			recordsAtNext <- len(fake.Records())
+			select {
+			case event := <-events:
+				w.Write([]byte(event))
+			case <-req.Context().Done():
+			}
+		}
+	}))
+	defer runtime.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	extension, err := registerExtension(ctx, agent, runtime.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 0, <-recordsAtNext)
+
+	deadline := time.Now().Add(time.Minute).UnixNano() / int64(time.Millisecond)
+	events <- `{"eventType":"INVOKE","deadlineMs":` + strconv.FormatInt(deadline, 10) + `}`
+	_, err = extension.Wrap(handler).Invoke(context.Background(), nil)
+	require.NoError(t, err)
+	select {
+	case records := <-recordsAtNext:
+		assert.Equal(t, 1, records, "records are sent before the next event")
+	case <-time.After(time.Second):
+		require.FailNow(t, "no next event requested")
+	}
+}
@@ -0,0 +1,98 @@
+package bearer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ResponseSizeLimit is the maximum size of the responses to the requests
+// matching all of its non-empty conditions. Conditions are the same as
+// SLO's.
+type ResponseSizeLimit struct {
+	Host     string
+	Method   string
+	Path     string
+	Endpoint string
+
+	// MaxBytes is the size of the bodies above which responses are flagged.
+	MaxBytes int64
+}
+
+func (l ResponseSizeLimit) matches(req *http.Request) bool {
+	if l.Endpoint != "" && !matchWildcard(l.Endpoint, EndpointFromContext(req.Context())) {
+		return false
+	}
+	return matchRequest(req, l.Host, l.Method, l.Path)
+}
+
+// largeResponse describes a response exceeding its size limit, in
+// LARGE_RESPONSE records.
+type largeResponse struct {
+	Size  int64 `json:"size"`
+	Limit int64 `json:"limit"`
+}
+
+// responseSizeLimit returns the first of ResponseSizeLimits matching req,
+// nil if none does.
+func (a *Agent) responseSizeLimit(req *http.Request) *ResponseSizeLimit {
+	for i := range a.ResponseSizeLimits {
+		if a.ResponseSizeLimits[i].MaxBytes > 0 && a.ResponseSizeLimits[i].matches(req) {
+			return &a.ResponseSizeLimits[i]
+		}
+	}
+	return nil
+}
+
+// limitResponseSize counts the body of resp, without buffering it, and flags
+// the response once it is read or closed if it exceeds the size limit of
+// req. The announced Content-Length is trusted for the bodies which aren't
+// read entirely.
+func (a *Agent) limitResponseSize(req *http.Request, api string, resp *http.Response) {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody || isProbe(req.Context()) {
+		return
+	}
+	limit := a.responseSizeLimit(req)
+	if limit == nil {
+		return
+	}
+	record := ReportLog{
+		Type:       recordTypeLargeResponse,
+		Protocol:   req.URL.Scheme,
+		Hostname:   urlHostname(req.URL),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Endpoint:   EndpointFromContext(req.Context()),
+		StatusCode: resp.StatusCode,
+		HostClass:  a.hostClass(req.URL),
+		API:        api,
+	}
+	host, contentLength, maxBytes := canonicalHost(req.URL), resp.ContentLength, limit.MaxBytes
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: func(size int64) {
+		if contentLength > size {
+			size = contentLength
+		}
+		if size <= maxBytes {
+			return
+		}
+		a.flagLargeResponse(host, record, largeResponse{Size: size, Limit: maxBytes})
+	}}
+}
+
+// flagLargeResponse raises an AlertLargeResponse alert for host, and reports
+// the response in a LARGE_RESPONSE record.
+func (a *Agent) flagLargeResponse(host string, record ReportLog, large largeResponse) {
+	defer a.recoverPanic()
+	now := time.Now()
+	path := sensitiveValues.ReplaceAllString(record.Path, defaultSensitivePlaceholder)
+	a.alert(Alert{
+		Kind:    AlertLargeResponse,
+		Host:    host,
+		Message: fmt.Sprintf("%s %s returned %d bytes, above %d", record.Method, path, large.Size, large.Limit),
+		Time:    now,
+	})
+	at := int(now.UnixNano() / 1000000)
+	record.StartedAt, record.EndedAt = at, at
+	record.LargeResponse = &large
+	a.report(a.context(), record)
+}
@@ -0,0 +1,78 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ResponseSizeLimits(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer api.Close()
+	var recorder alertRecorder
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{
+		SecretKey:      "sk_test",
+		Transport:      fake,
+		AlertCallbacks: []func(Alert){recorder.add},
+		ResponseSizeLimits: []ResponseSizeLimit{
+			{Path: "/small", MaxBytes: 200},
+			{Path: "/items", MaxBytes: 50},
+		},
+	}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for _, path := range []string{"/small", "/items"} {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	var large *ReportLog
+	for large == nil {
+		record := fake.next(t)
+		if record.Type == recordTypeLargeResponse {
+			large = &record
+		}
+	}
+	assert.Equal(t, "/items", large.Path)
+	assert.Equal(t, "GET", large.Method)
+	assert.Equal(t, 200, large.StatusCode)
+	assert.Equal(t, &largeResponse{Size: 100, Limit: 50}, large.LargeResponse)
+
+	agent.Close()
+	alerts := recorder.get()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, AlertLargeResponse, alerts[0].Kind)
+	assert.Equal(t, "GET /items returned 100 bytes, above 50", alerts[0].Message)
+}
+
+func TestAgent_ResponseSizeLimits_contentLength(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer api.Close()
+	var recorder alertRecorder
+	agent := &Agent{AlertCallbacks: []func(Alert){recorder.add}, ResponseSizeLimits: []ResponseSizeLimit{{MaxBytes: 50}}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	// the body isn't read, but its announced length exceeds the limit
+	resp, err := client.Get(api.URL + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	agent.Close()
+	alerts := recorder.get()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "GET / returned 100 bytes, above 50", alerts[0].Message)
+}
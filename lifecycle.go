@@ -0,0 +1,104 @@
+package bearer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errClosed is the error of the records reported once the agent is closed.
+var errClosed = errors.New("bearer: agent closed")
+
+// workers tracks the background goroutines of the agent.
+type workers struct {
+	mutex   sync.Mutex
+	done    chan struct{}
+	closed  bool
+	wg      sync.WaitGroup
+	running int32
+}
+
+// Workers returns the number of background goroutines of the agent, e.g.
+// refreshing its configuration or sending records.
+func (a *Agent) Workers() int {
+	return int(atomic.LoadInt32(&a.background.running))
+}
+
+// Close stops the background goroutines of the agent, once they sent the
+// records reported so far, and closes the idle connections of its host
+// transports. Requests may still be performed with a closed agent, but
+// aren't reported anymore. The background goroutines also stop once
+// Context is done, but not when the agent is unreachable: they keep it from
+// being garbage-collected, so agents must be closed or their Context
+// canceled.
+func (a *Agent) Close() error {
+	w := &a.background
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(a.stopped())
+	}
+	w.mutex.Unlock()
+	w.wg.Wait()
+
+	a.hostTransports.mutex.Lock()
+	defer a.hostTransports.mutex.Unlock()
+	a.hostTransports.closeIdleConnections()
+	return nil
+}
+
+// stopped returns a channel closed once the agent is closed. The lock of
+// the workers must be held.
+func (a *Agent) stopped() chan struct{} {
+	if a.background.done == nil {
+		a.background.done = make(chan struct{})
+	}
+	return a.background.done
+}
+
+// closed reports whether the agent is closed, or its context done.
+func (a *Agent) closed() bool {
+	w := &a.background
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.closed || a.context().Err() != nil
+}
+
+// goWorker runs f in a background goroutine, tracked until it returns, and
+// returns false without running f if the agent is closed.
+func (a *Agent) goWorker(f func()) bool {
+	w := &a.background
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed || a.context().Err() != nil {
+		return false
+	}
+	w.wg.Add(1)
+	atomic.AddInt32(&w.running, 1)
+	go func() {
+		defer w.wg.Done()
+		defer atomic.AddInt32(&w.running, -1)
+		f()
+	}()
+	return true
+}
+
+// sleep waits for d, and returns false early if the agent is closed or its
+// context is done.
+func (a *Agent) sleep(d time.Duration) bool {
+	a.background.mutex.Lock()
+	done := a.stopped()
+	a.background.mutex.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	case <-a.context().Done():
+		return false
+	}
+}
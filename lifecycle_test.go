@@ -0,0 +1,59 @@
+package bearer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestAgent_Close(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	defer http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{
+		SecretKey:          "sk_test",
+		Transport:          fake,
+		RefreshConfigEvery: time.Hour,
+		HeartbeatEvery:     time.Hour,
+		SLOs:               []SLO{{Availability: 99}},
+		SLOSummaryEvery:    time.Hour,
+	}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.True(t, agent.Workers() >= 3, "config refresher, heartbeats and SLO summaries")
+
+	require.NoError(t, agent.Close())
+	assert.Zero(t, agent.Workers())
+	// the record and the heartbeat were sent before Close returned
+	assert.Len(t, fake.Records(), 2)
+	assert.Equal(t, 2, agent.Stats().RecordsSent)
+
+	resp, err = client.Get(api.URL)
+	require.NoError(t, err, "closed agents still perform requests")
+	resp.Body.Close()
+	assert.Zero(t, agent.Workers())
+	assert.Equal(t, 1, agent.Stats().RecordsDropped)
+	require.NoError(t, agent.Close(), "Close is idempotent")
+}
+
+func TestAgent_Context(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(context.Background())
+	agent := &Agent{SecretKey: "sk_test", Transport: newFakeBearer(`{}`), Context: ctx, HeartbeatEvery: time.Hour}
+	agent.config()
+	assert.Equal(t, 2, agent.Workers(), "config refresher and heartbeats")
+
+	cancel()
+	assert.Eventually(t, func() bool { return agent.Workers() == 0 }, time.Second, time.Millisecond)
+}
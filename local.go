@@ -0,0 +1,73 @@
+package bearer
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// LocalTraffic is the handling of the requests to loopback and link-local
+// destinations, e.g. health checks and calls to sidecars.
+type LocalTraffic int
+
+const (
+	// LocalTrafficDefault handles local requests as DefaultLocalTraffic.
+	LocalTrafficDefault LocalTraffic = iota
+	// LocalTrafficInstrument handles local requests as the others.
+	LocalTrafficInstrument
+	// LocalTrafficSkip makes local requests bypass the agent: they are
+	// performed by its transport, unreported and free of its policies,
+	// except BlockedDomains, BlockRules and ShouldBlock, so that e.g. cloud
+	// metadata endpoints can still be blocked.
+	LocalTrafficSkip
+)
+
+// DefaultLocalTraffic is the handling of local requests by the agents whose
+// LocalTraffic is unset. Applications may set it to LocalTrafficSkip before
+// creating their agents.
+var DefaultLocalTraffic = LocalTrafficInstrument
+
+// localNetworks are the networks of loopback and link-local addresses.
+var localNetworks = parseNetworks("127.0.0.0/8", "169.254.0.0/16", "::1/128", "fe80::/10")
+
+// skipsLocal reports whether req is a local request bypassing the agent.
+func (a *Agent) skipsLocal(req *http.Request) bool {
+	mode := a.LocalTraffic
+	if mode == LocalTrafficDefault {
+		mode = DefaultLocalTraffic
+	}
+	if mode != LocalTrafficSkip || !isLocalHost(urlHostname(req.URL)) {
+		return false
+	}
+	for _, host := range a.LocalExceptions {
+		if matchHost(host, req.URL) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLocalBlocked returns the error blocking req, a local request bypassing
+// the agent, if any.
+func (a *Agent) checkLocalBlocked(req *http.Request) error {
+	req = a.nameEndpoint(req)
+	dryRun, err := a.checkBlocked(a.config(), req)
+	if err == nil {
+		return nil
+	}
+	if dryRun || a.BlockDryRun {
+		a.audit(AuditWouldBlock, req, err.Error())
+		return nil
+	}
+	a.audit(AuditBlocked, req, err.Error())
+	return err
+}
+
+// isLocalHost reports whether hostname is a loopback or link-local destination.
+func isLocalHost(hostname string) bool {
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && inNetworks(ip, localNetworks)
+}
@@ -0,0 +1,65 @@
+package bearer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsLocalHost(t *testing.T) {
+	for _, host := range []string{"localhost", "app.localhost", "127.0.0.1", "127.1.2.3", "::1", "169.254.169.254", "fe80::1"} {
+		assert.True(t, isLocalHost(host), host)
+	}
+	for _, host := range []string{"10.0.0.1", "example.com", "localhost.example.com", "8.8.8.8"} {
+		assert.False(t, isLocalHost(host), host)
+	}
+}
+
+func TestAgent_LocalTraffic(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	u, _ := url.Parse(api.URL)
+	get := func(agent *Agent) {
+		client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+		resp, err := client.Get(api.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, LocalTraffic: LocalTrafficSkip}
+	defer agent.Close()
+	get(agent)
+	assert.Empty(t, fake.Records(), "local requests bypass the agent")
+
+	agent.LocalExceptions = []string{u.Host}
+	get(agent)
+	assert.Len(t, fake.Records(), 1, "exceptions are instrumented")
+
+	fake = newFakeBearer(`{"blockedDomains":["127.0.0.1"],"blockRules":[{"host":"169.254.169.254"}]}`)
+	blocking := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, LocalTraffic: LocalTrafficSkip}
+	defer blocking.Close()
+	client := &http.Client{Transport: blocking.Wrap(http.DefaultTransport)}
+	_, err := client.Get(api.URL)
+	assert.True(t, errors.Is(err, ErrBlockedDomain), "blocked domains apply to local requests")
+	_, err = client.Get("http://169.254.169.254/latest/meta-data/")
+	assert.True(t, errors.Is(err, ErrBlockedRequest), "block rules apply to local requests")
+	assert.Empty(t, fake.Records())
+
+	defer func() { DefaultLocalTraffic = LocalTrafficInstrument }()
+	DefaultLocalTraffic = LocalTrafficSkip
+	fake = newFakeBearer(`{}`)
+	defaultAgent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true}
+	defer defaultAgent.Close()
+	get(defaultAgent)
+	assert.Empty(t, fake.Records(), "the default is configurable")
+	instrumenting := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, LocalTraffic: LocalTrafficInstrument}
+	defer instrumenting.Close()
+	get(instrumenting)
+	assert.Len(t, fake.Records(), 1)
+}
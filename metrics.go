@@ -0,0 +1,47 @@
+package bearer
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestMetrics are the metrics of a request performed through the agent.
+type RequestMetrics struct {
+	Host string
+	// API is the logical name of the host's API, if named (see Agent.APINames).
+	API    string
+	Method string
+	// StatusCode is the status of the response, 0 if the request failed.
+	StatusCode int
+	Duration   time.Duration
+	// Failed is set if the request failed or its status is 5xx.
+	Failed bool
+}
+
+// MetricsSink receives the metrics of the requests performed through the
+// agent. ObserveRequest is called before the responses are returned, so it
+// should aggregate metrics and export them in the background.
+type MetricsSink interface {
+	ObserveRequest(RequestMetrics)
+}
+
+// observeMetrics passes the metrics of a request, which took duration and
+// completed with resp or failed with err, to MetricsSinks.
+func (a *Agent) observeMetrics(req *http.Request, api string, duration time.Duration, resp *http.Response, err error) {
+	if len(a.MetricsSinks) == 0 {
+		return
+	}
+	metrics := RequestMetrics{
+		Host:     canonicalHost(req.URL),
+		API:      api,
+		Method:   req.Method,
+		Duration: duration,
+		Failed:   err != nil || resp == nil || resp.StatusCode >= 500,
+	}
+	if err == nil && resp != nil {
+		metrics.StatusCode = resp.StatusCode
+	}
+	for _, sink := range a.MetricsSinks {
+		sink.ObserveRequest(metrics)
+	}
+}
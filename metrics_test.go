@@ -0,0 +1,29 @@
+package bearer
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metricsRecorder []RequestMetrics
+
+func (r *metricsRecorder) ObserveRequest(metrics RequestMetrics) {
+	*r = append(*r, metrics)
+}
+
+func TestAgent_MetricsSinks(t *testing.T) {
+	var recorder metricsRecorder
+	agent := &Agent{MetricsSinks: []MetricsSink{&recorder}}
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com:8443/charges", nil)
+	agent.observeMetrics(req, "example", time.Second, &http.Response{StatusCode: 201}, nil)
+	agent.observeMetrics(req, "example", time.Second, nil, errors.New("timeout"))
+
+	assert.Equal(t, metricsRecorder{
+		{Host: "api.example.com:8443", API: "example", Method: "POST", StatusCode: 201, Duration: time.Second},
+		{Host: "api.example.com:8443", API: "example", Method: "POST", Duration: time.Second, Failed: true},
+	}, recorder)
+}
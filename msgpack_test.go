@@ -0,0 +1,181 @@
+package bearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeMsgPack(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{5, []byte{0x05}},
+		{-1, []byte{0xff}},
+		{-100, []byte{0xd0, 0x9c}},
+		{300, []byte{0xcd, 0x01, 0x2c}},
+		{"ab", []byte{0xa2, 'a', 'b'}},
+		{[]string{"a"}, []byte{0x91, 0xa1, 'a'}},
+		{map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{struct {
+			A int    `json:"a"`
+			B string `json:"b,omitempty"`
+			c int
+		}{A: 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+	}
+	for _, test := range tests {
+		got, err := encodeMsgPack(test.value)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, got, "%#v", test.value)
+	}
+
+	_, err := encodeMsgPack(map[int]string{1: "a"})
+	assert.Error(t, err)
+}
+
+func TestEncodeMsgPack_matchesJSON(t *testing.T) {
+	limit := 10
+	record := ReportLog{
+		Type:            recordTypeRequestEnd,
+		Hostname:        "api.example.com",
+		Duration:        12.5,
+		StatusCode:      200,
+		Query:           url.Values{"q": {"a", "b"}},
+		RequestHeaders:  map[string][]string{"Accept": {"*/*"}},
+		ResponseBody:    strings.Repeat("x", 300),
+		RateLimit:       &rateLimitRecord{Limit: &limit},
+		Mutations:       []string{"add header"},
+		ResponseHeaders: nil,
+	}
+	type legacyRecord struct {
+		ReportLog
+		RequestHeaders map[string]string `json:"requestHeaders"`
+	}
+	for _, value := range []interface{}{record, legacyRecord{ReportLog: record, RequestHeaders: map[string]string{"Accept": "*/*"}}} {
+		data, err := encodeMsgPack(value)
+		require.NoError(t, err)
+		decoded, rest := decodeMsgPack(t, data)
+		assert.Empty(t, rest)
+
+		jsonData, err := json.Marshal(value)
+		require.NoError(t, err)
+		var want interface{}
+		require.NoError(t, json.Unmarshal(jsonData, &want))
+		assert.Equal(t, want, decoded)
+	}
+}
+
+func TestAgent_ReportEncoding(t *testing.T) {
+	var contentTypes []string
+	var reported []interface{}
+	agent := &Agent{SecretKey: "sk_test", ReportEncoding: EncodingMsgPack}
+	agent.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		contentType := req.Header.Get("Content-Type")
+		contentTypes = append(contentTypes, contentType)
+		body, _ := ioutil.ReadAll(req.Body)
+		status := 200
+		switch {
+		case len(contentTypes) == 2:
+			status = http.StatusUnsupportedMediaType
+		case contentType == string(EncodingMsgPack):
+			value, _ := decodeMsgPack(t, body)
+			reported = append(reported, value)
+		default:
+			var value interface{}
+			require.NoError(t, json.Unmarshal(body, &value))
+			reported = append(reported, value)
+		}
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(`{}`))}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, agent.logRecords([]ReportLog{{Type: recordTypeRequestEnd}}))
+	}
+	assert.Equal(t, []string{"application/msgpack", "application/msgpack", "application/json", "application/json"}, contentTypes)
+	require.Len(t, reported, 3)
+	assert.Equal(t, reported[0], reported[1], "the encodings describe the same report")
+}
+
+// decodeMsgPack decodes the MessagePack value at the start of data as
+// encoding/json would decode its JSON encoding.
+func decodeMsgPack(t *testing.T, data []byte) (interface{}, []byte) {
+	t.Helper()
+	require.NotEmpty(t, data)
+	b, data := data[0], data[1:]
+	readUint := func(n int) uint64 {
+		var v uint64
+		for _, c := range data[:n] {
+			v = v<<8 | uint64(c)
+		}
+		data = data[n:]
+		return v
+	}
+	str := func(n int) interface{} {
+		s := string(data[:n])
+		data = data[n:]
+		return s
+	}
+	array := func(n int) interface{} {
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i], data = decodeMsgPack(t, data)
+		}
+		return values
+	}
+	object := func(n int) interface{} {
+		values := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			var key, value interface{}
+			key, data = decodeMsgPack(t, data)
+			value, data = decodeMsgPack(t, data)
+			values[key.(string)] = value
+		}
+		return values
+	}
+	var v interface{}
+	switch {
+	case b <= 0x7f:
+		v = float64(b)
+	case b >= 0xe0:
+		v = float64(int8(b))
+	case b&0xe0 == 0xa0:
+		v = str(int(b & 0x1f))
+	case b&0xf0 == 0x90:
+		v = array(int(b & 0x0f))
+	case b&0xf0 == 0x80:
+		v = object(int(b & 0x0f))
+	case b == 0xc0:
+		v = nil
+	case b == 0xc2:
+		v = false
+	case b == 0xc3:
+		v = true
+	case b == 0xcb:
+		v = math.Float64frombits(readUint(8))
+	case b >= 0xcc && b <= 0xcf:
+		v = float64(readUint(1 << (b - 0xcc)))
+	case b >= 0xd0 && b <= 0xd3:
+		n := 1 << (b - 0xd0)
+		v = float64(int64(readUint(n)<<(64-8*n)) >> (64 - 8*n))
+	case b >= 0xd9 && b <= 0xdb:
+		v = str(int(readUint(1 << (b - 0xd9))))
+	case b == 0xdc || b == 0xdd:
+		v = array(int(readUint(2 << (b - 0xdc))))
+	case b == 0xde || b == 0xdf:
+		v = object(int(readUint(2 << (b - 0xde))))
+	default:
+		panic(fmt.Sprintf("unexpected msgpack byte %#x", b))
+	}
+	return v, data
+}
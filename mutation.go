@@ -0,0 +1,60 @@
+package bearer
+
+import (
+	"net/http"
+	"sort"
+)
+
+// MutationRule modifies the requests matching all of its non-empty conditions
+// before they are sent. Conditions are the same as BlockRule's.
+type MutationRule struct {
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+
+	// SetHeaders are set on matching requests, replacing existing values.
+	SetHeaders map[string]string `json:"setHeaders,omitempty"`
+	// DefaultHeaders are set on matching requests which don't have them yet.
+	DefaultHeaders map[string]string `json:"defaultHeaders,omitempty"`
+}
+
+// mutate returns req modified by the rules of config which match it, along
+// with a description of the applied mutations. req is copied before being
+// modified.
+func mutate(config *Config, req *http.Request) (*http.Request, []string) {
+	var mutations []string
+	cloned := false
+	for _, rule := range config.MutationRules {
+		if !matchRequest(req, rule.Host, rule.Method, rule.Path) {
+			continue
+		}
+		for _, key := range sortedKeys(rule.SetHeaders) {
+			if !cloned {
+				// a RoundTripper must not modify the request it is given
+				req, cloned = req.Clone(req.Context()), true
+			}
+			req.Header.Set(key, rule.SetHeaders[key])
+			mutations = append(mutations, "set header "+http.CanonicalHeaderKey(key))
+		}
+		for _, key := range sortedKeys(rule.DefaultHeaders) {
+			if req.Header.Get(key) != "" {
+				continue
+			}
+			if !cloned {
+				req, cloned = req.Clone(req.Context()), true
+			}
+			req.Header.Set(key, rule.DefaultHeaders[key])
+			mutations = append(mutations, "set header "+http.CanonicalHeaderKey(key))
+		}
+	}
+	return req, mutations
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
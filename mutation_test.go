@@ -0,0 +1,52 @@
+package bearer
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutate(t *testing.T) {
+	config := &Config{
+		MutationRules: []MutationRule{
+			{Host: "api.example.com", SetHeaders: map[string]string{"x-api-version": "2020-03-02", "Accept-Encoding": "identity"}},
+			{Host: "api.example.com", Path: "/users/*", DefaultHeaders: map[string]string{"Accept": "application/json"}},
+		},
+	}
+
+	t.Run("set", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "https://api.example.com/", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		mutated, mutations := mutate(config, req)
+		assert.Equal(t, "2020-03-02", mutated.Header.Get("X-Api-Version"))
+		assert.Equal(t, "identity", mutated.Header.Get("Accept-Encoding"))
+		assert.Equal(t, "", mutated.Header.Get("Accept"))
+		assert.Equal(t, []string{"set header Accept-Encoding", "set header X-Api-Version"}, mutations)
+		assert.Equal(t, "gzip", req.Header.Get("Accept-Encoding"))
+	})
+
+	t.Run("default", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "https://api.example.com/users/42", nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "text/plain")
+		_, mutations := mutate(config, req)
+		assert.NotContains(t, mutations, "set header Accept")
+
+		req.Header.Del("Accept")
+		mutated, mutations := mutate(config, req)
+		assert.Contains(t, mutations, "set header Accept")
+		assert.Equal(t, "application/json", mutated.Header.Get("Accept"))
+	})
+
+	t.Run("no-match", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "https://other.example.com/users/42", nil)
+		require.NoError(t, err)
+		mutated, mutations := mutate(config, req)
+		assert.True(t, req == mutated)
+		assert.Empty(t, mutations)
+	})
+}
@@ -0,0 +1,127 @@
+package bearer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// defaultNPlusOneWindow is the maximum interval between the requests of a
+// burst if NPlusOneWindow isn't set.
+const defaultNPlusOneWindow = time.Second
+
+// diagnostic describes a problem of the usage of an API, in DIAGNOSTIC
+// records.
+type diagnostic struct {
+	// Kind is "n_plus_one" for the bursts of requests differing only by an
+	// identifier of their path.
+	Kind string `json:"kind"`
+	// Template is the method and path template of the requests, e.g.
+	// "GET /users/{id}".
+	Template string `json:"template"`
+	Count    int    `json:"count"`
+}
+
+const diagnosticNPlusOne = "n_plus_one"
+
+// burstKey identifies the requests differing only by an identifier of
+// their path.
+type burstKey struct {
+	method, host, template string
+}
+
+// callBurst is a burst of requests with the same burstKey.
+type callBurst struct {
+	key         burstKey
+	url         *url.URL
+	endpoint    string
+	api         string
+	count       int
+	first, last time.Time
+}
+
+func (a *Agent) nPlusOneWindow() time.Duration {
+	if a.NPlusOneWindow > 0 {
+		return a.NPlusOneWindow
+	}
+	return defaultNPlusOneWindow
+}
+
+// observeBurst adds the request of req, sent at, to the burst of the
+// requests differing only by an identifier of their path, if it has one.
+func (a *Agent) observeBurst(req *http.Request, api string, at time.Time) {
+	calls := callTrackerFromContext(req.Context())
+	if calls == nil || a.NPlusOneThreshold <= 0 || AttemptFromContext(req.Context()) > 1 {
+		return
+	}
+	template := templatePath(req.URL.Path)
+	if template == req.URL.Path {
+		return
+	}
+	key := burstKey{method: req.Method, host: canonicalHost(req.URL), template: template}
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+	if calls.bursts == nil {
+		calls.bursts = map[burstKey]*callBurst{}
+	}
+	burst := calls.bursts[key]
+	if burst != nil && at.Sub(burst.last) > a.nPlusOneWindow() {
+		if burst.count >= a.NPlusOneThreshold {
+			calls.ended = append(calls.ended, *burst)
+		}
+		burst = nil
+	}
+	if burst == nil {
+		burst = &callBurst{key: key, url: req.URL, endpoint: EndpointFromContext(req.Context()), api: api, first: at}
+		calls.bursts[key] = burst
+	}
+	burst.count++
+	burst.last = at
+}
+
+// reportBursts reports the bursts of NPlusOneThreshold requests or more
+// performed with ctx, the context of an inbound request which completed, as
+// DIAGNOSTIC records.
+func (a *Agent) reportBursts(ctx context.Context) {
+	calls := callTrackerFromContext(ctx)
+	if calls == nil || a.NPlusOneThreshold <= 0 {
+		return
+	}
+	calls.mutex.Lock()
+	bursts := calls.ended
+	for _, burst := range calls.bursts {
+		if burst.count >= a.NPlusOneThreshold {
+			bursts = append(bursts, *burst)
+		}
+	}
+	calls.ended, calls.bursts = nil, nil
+	calls.mutex.Unlock()
+
+	sort.Slice(bursts, func(i, j int) bool { return bursts[i].first.Before(bursts[j].first) })
+	correlation := CorrelationFromContext(ctx)
+	for _, burst := range bursts {
+		a.report(ctx, ReportLog{
+			Type:      recordTypeDiagnostic,
+			Protocol:  burst.url.Scheme,
+			Hostname:  urlHostname(burst.url),
+			Method:    burst.key.method,
+			Path:      burst.key.template,
+			Endpoint:  burst.endpoint,
+			HostClass: a.hostClass(burst.url),
+			API:       burst.api,
+			StartedAt: int(burst.first.UnixNano() / 1000000),
+			EndedAt:   int(burst.last.UnixNano() / 1000000),
+			Duration:  durationMillis(burst.first, burst.last),
+			ParentID:  parentRecordFromContext(ctx),
+			TraceID:   correlation.TraceID,
+			RequestID: correlation.RequestID,
+			Diagnostic: &diagnostic{
+				Kind:     diagnosticNPlusOne,
+				Template: burst.key.method + " " + burst.key.template,
+				Count:    burst.count,
+			},
+		})
+	}
+}
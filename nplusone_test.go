@@ -0,0 +1,73 @@
+package bearer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_NPlusOneThreshold(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, NPlusOneThreshold: 3, CallGraph: true}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	handler := agent.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		paths := []string{"/users", "/orders/1", "/orders/2"}
+		for i := 1; i <= 5; i++ {
+			paths = append(paths, fmt.Sprintf("/users/%d", i))
+		}
+		for _, path := range paths {
+			outbound, err := http.NewRequestWithContext(req.Context(), "GET", api.URL+path, nil)
+			require.NoError(t, err)
+			resp, err := client.Do(outbound)
+			require.NoError(t, err)
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var diagnostics []ReportLog
+	var inbound ReportLog
+	for i := 0; i < 10; i++ {
+		switch record := fake.next(t); record.Type {
+		case recordTypeDiagnostic:
+			diagnostics = append(diagnostics, record)
+		case recordTypeInboundRequestEnd:
+			inbound = record
+		}
+	}
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, &diagnostic{Kind: diagnosticNPlusOne, Template: "GET /users/{id}", Count: 5}, diagnostics[0].Diagnostic)
+	assert.Equal(t, "/users/{id}", diagnostics[0].Path)
+	assert.Equal(t, inbound.ID, diagnostics[0].ParentID)
+}
+
+func TestAgent_observeBurst(t *testing.T) {
+	agent := &Agent{NPlusOneThreshold: 2, NPlusOneWindow: time.Second}
+	ctx := agent.InboundContext(context.Background(), http.Header{})
+	now := time.Now()
+	// the bursts are separated by more than the window
+	for i, at := range []time.Duration{0, 500 * time.Millisecond, 3 * time.Second, 5 * time.Second, 5200 * time.Millisecond, 5400 * time.Millisecond} {
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("https://api.example.com/items/%d", i), nil).WithContext(ctx)
+		agent.observeBurst(req, "", now.Add(at))
+	}
+
+	calls := callTrackerFromContext(ctx)
+	require.Len(t, calls.ended, 1)
+	assert.Equal(t, 2, calls.ended[0].count)
+	burst := calls.bursts[burstKey{method: "DELETE", host: "api.example.com", template: "/items/{id}"}]
+	require.NotNil(t, burst)
+	assert.Equal(t, 3, burst.count)
+	assert.Equal(t, 400*time.Millisecond, burst.last.Sub(burst.first))
+}
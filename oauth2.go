@@ -0,0 +1,147 @@
+package bearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryDelta is how long before their expiry tokens are renewed.
+const tokenExpiryDelta = 10 * time.Second
+
+// ClientCredentials configures the OAuth2 client credentials grant of a provider.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// If true, the client credentials are sent in the body of token requests
+	// instead of with HTTP basic authentication.
+	AuthInBody bool
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// OAuth2Transport is an http.RoundTripper obtaining OAuth2 tokens with the
+// client credentials grant, and adding them to the requests to their host.
+// Tokens are cached until they expire, or are rejected with a 401 status.
+//
+// Token requests are performed through Agent, so that they are reported and
+// sanitized like the other requests:
+//
+//	client := &http.Client{Transport: &bearer.OAuth2Transport{
+//		Agent:       agent,
+//		Credentials: map[string]*bearer.ClientCredentials{"api.example.com": {...}},
+//	}}
+type OAuth2Transport struct {
+	Agent *Agent
+	// Credentials are the client credentials of each host, with an optional port.
+	Credentials map[string]*ClientCredentials
+	// Next performs the requests. If empty, will use Agent as default.
+	Next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *OAuth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = t.Agent
+	}
+	var credentials *ClientCredentials
+	for _, key := range hostKeys(req.URL) {
+		if c, ok := t.Credentials[key]; ok {
+			credentials = c
+			break
+		}
+	}
+	if credentials == nil {
+		return next.RoundTrip(req)
+	}
+
+	token, err := credentials.getToken(req, t.Agent)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		credentials.invalidate(token)
+	}
+	return resp, err
+}
+
+// getToken returns a valid token, requesting a new one through agent if needed.
+func (c *ClientCredentials) getToken(req *http.Request, agent *Agent) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if c.AuthInBody {
+		form.Set("client_id", c.ClientID)
+		form.Set("client_secret", c.ClientSecret)
+	}
+	tokenReq, err := http.NewRequest("POST", c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("create token request: %w", err)
+	}
+	tokenReq = tokenReq.WithContext(req.Context())
+	tokenReq.Header.Set("Accept", "application/json")
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if !c.AuthInBody {
+		tokenReq.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	resp, err := agent.RoundTrip(tokenReq)
+	if err != nil {
+		return "", fmt.Errorf("perform token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request: unexpected status %d", resp.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("parse token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token response: missing access_token")
+	}
+
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryDelta)
+	if token.ExpiresIn == 0 {
+		// tokens without expiry are kept until rejected
+		c.expires = time.Now().Add(100 * 365 * 24 * time.Hour)
+	}
+	return c.token, nil
+}
+
+// invalidate drops token from the cache, unless it was already renewed.
+func (c *ClientCredentials) invalidate(token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
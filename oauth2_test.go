@@ -0,0 +1,80 @@
+package bearer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuth2Transport(t *testing.T) {
+	tokens := 0
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/token":
+			id, secret, _ := req.BasicAuth()
+			require.NoError(t, req.ParseForm())
+			assert.Equal(t, "client_credentials", req.PostForm.Get("grant_type"))
+			assert.Equal(t, "read write", req.PostForm.Get("scope"))
+			if id != "id" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":3600}`, tokens)
+		case "/revoke":
+			tokens++
+		default:
+			if req.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", tokens) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "config.bearer.sh" || req.URL.Host == "agent.bearer.sh" {
+			return fake.RoundTrip(req)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	credentials := &ClientCredentials{TokenURL: api.URL + "/token", ClientID: "id", ClientSecret: "secret", Scopes: []string{"read", "write"}}
+	client := &http.Client{Transport: &OAuth2Transport{
+		Agent:       agent,
+		Credentials: map[string]*ClientCredentials{"127.0.0.1": credentials},
+		Next:        http.DefaultTransport,
+	}}
+
+	get := func(path string) int {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get("/users"))
+	assert.Equal(t, http.StatusOK, get("/users"))
+	assert.Equal(t, 1, tokens, "token is cached")
+
+	// token requests are reported and sanitized
+	record := fake.next(t)
+	assert.Equal(t, "/token", record.Path)
+	assert.Equal(t, defaultSensitivePlaceholder, record.RequestHeaders["Authorization"][0])
+	assert.Equal(t, `{"access_token":"[FILTERED]","expires_in":3600,"token_type":"bearer"}`, record.ResponseBody)
+
+	// rejected tokens are renewed
+	get("/revoke")
+	assert.Equal(t, http.StatusUnauthorized, get("/users"))
+	assert.Equal(t, http.StatusOK, get("/users"))
+	assert.Equal(t, 3, tokens)
+
+	credentials.ClientSecret = "wrong"
+	credentials.token = ""
+	_, err := client.Get(api.URL + "/users")
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+// Package openapibearer validates the calls to third-party APIs against their
+// OpenAPI 3 specification, using github.com/getkin/kin-openapi.
+//
+// Validation failures are recorded in the calls' records, so that changes of
+// a provider's schema are caught as soon as they happen:
+//
+//	validator, err := openapibearer.Load("stripe.yaml")
+//	agent.Validators = map[string]bearer.Validator{"api.stripe.com": validator}
+package openapibearer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Validator validates requests and responses against an OpenAPI document.
+// It implements bearer.Validator.
+type Validator struct {
+	router  routers.Router
+	options *openapi3filter.Options
+}
+
+// Load returns a Validator for the OpenAPI document stored at path, in JSON or YAML.
+func Load(path string) (*Validator, error) {
+	doc, err := openapi3.NewLoader().LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(doc)
+}
+
+// New returns a Validator for doc.
+// Requests are matched against the servers declared by doc.
+func New(doc *openapi3.T) (*Validator, error) {
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{
+		router: router,
+		options: &openapi3filter.Options{
+			// credentials are the application's business, not the schema's
+			AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	}, nil
+}
+
+// Validate implements bearer.Validator.
+func (v *Validator) Validate(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) []string {
+	route, pathParams, err := v.router.FindRoute(req)
+	if err != nil {
+		return []string{"openapi: " + err.Error()}
+	}
+
+	// the validation reads the bodies
+	req = req.Clone(req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+
+	ctx := req.Context()
+	options := *v.options
+	if !isCaptured(req.Header.Get("Content-Type"), reqBody) {
+		options.ExcludeRequestBody = true
+	}
+	reqInput := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    &options,
+	}
+	var reasons []string
+	if err := openapi3filter.ValidateRequest(ctx, reqInput); err != nil {
+		reasons = append(reasons, errorReasons("openapi: invalid request: ", err)...)
+	}
+
+	respOptions := *v.options
+	if !isCaptured(resp.Header.Get("Content-Type"), respBody) {
+		respOptions.ExcludeResponseBody = true
+	}
+	respInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: reqInput,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Options:                &respOptions,
+	}
+	respInput.SetBodyBytes(respBody)
+	if err := openapi3filter.ValidateResponse(ctx, respInput); err != nil {
+		reasons = append(reasons, errorReasons("openapi: invalid response: ", err)...)
+	}
+	return reasons
+}
+
+// isCaptured reports whether a body of the given content type was captured by the agent.
+// Bodies which aren't captured can't be validated.
+func isCaptured(contentType string, body []byte) bool {
+	return len(body) > 0 || contentType == ""
+}
+
+func errorReasons(prefix string, err error) []string {
+	var multi openapi3.MultiError
+	if !errors.As(err, &multi) {
+		return []string{prefix + err.Error()}
+	}
+	reasons := make([]string, 0, len(multi))
+	for _, err := range multi {
+		reasons = append(reasons, errorReasons(prefix, err)...)
+	}
+	return reasons
+}
@@ -0,0 +1,82 @@
+package openapibearer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const spec = `
+openapi: 3.0.0
+info:
+  title: Sample
+  version: "1.0"
+servers:
+  - url: https://api.example.com
+paths:
+  /users/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: integer
+      responses:
+        "200":
+          description: a user
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id, name]
+                properties:
+                  id:
+                    type: integer
+                  name:
+                    type: string
+`
+
+func TestValidator(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(spec))
+	require.NoError(t, err)
+	validator, err := New(doc)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url      string
+		status   int
+		body     string
+		expected []string
+	}{
+		{"https://api.example.com/users/42", 200, `{"id":42,"name":"blah"}`, nil},
+		{"https://api.example.com/users/42", 200, `{"id":"42","name":"blah"}`, []string{"openapi: invalid response: "}},
+		{"https://api.example.com/users/42", 200, `{"id":42}`, []string{"openapi: invalid response: "}},
+		{"https://api.example.com/users/42", 404, `{}`, []string{"openapi: invalid response: "}},
+		{"https://api.example.com/users/blah", 200, `{"id":42,"name":"blah"}`, []string{"openapi: invalid request: "}},
+		{"https://api.example.com/orders/42", 200, `{}`, []string{"openapi: "}},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(context.Background(), "GET", test.url, nil)
+			require.NoError(t, err)
+			resp := &http.Response{
+				StatusCode: test.status,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}
+
+			reasons := validator.Validate(req, nil, resp, []byte(test.body))
+			require.Len(t, reasons, len(test.expected), "%v", reasons)
+			for idx, expected := range test.expected {
+				assert.True(t, strings.HasPrefix(reasons[idx], expected), reasons[idx])
+			}
+		})
+	}
+}
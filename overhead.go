@@ -0,0 +1,116 @@
+package bearer
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// overheadSamples is the number of requests over which the agent's
+	// overhead is measured.
+	overheadSamples = 1000
+	// overheadEvaluateEvery is the number of requests between two
+	// adjustments of the capture level.
+	overheadEvaluateEvery = 100
+)
+
+// captureLevel is the detail with which requests are captured in records.
+type captureLevel int32
+
+const (
+	captureFull captureLevel = iota
+	// captureHeaders leaves bodies out of records, and doesn't buffer them.
+	captureHeaders
+	// captureMetadata captures the metadata of records only, as PrivacyMode.
+	captureMetadata
+)
+
+func (l captureLevel) String() string {
+	switch l {
+	case captureHeaders:
+		return "headers"
+	case captureMetadata:
+		return "metadata"
+	default:
+		return "full"
+	}
+}
+
+// overheadTracker holds the latest overheads added by the agent to requests.
+type overheadTracker struct {
+	mutex    sync.Mutex
+	samples  []time.Duration
+	next     int
+	observed int
+	p99      time.Duration
+	level    int32
+}
+
+// captureLevel returns the current capture level of the agent.
+func (a *Agent) captureLevel() captureLevel {
+	return captureLevel(atomic.LoadInt32(&a.overhead.level))
+}
+
+// observeOverhead records the overhead added by the agent to a request, and
+// adjusts the capture level every overheadEvaluateEvery requests: it is
+// lowered while the 99th percentile of the overheads exceeds
+// OverheadBudget, and raised again once it is below half of it.
+func (a *Agent) observeOverhead(overhead time.Duration) {
+	if a.OverheadBudget <= 0 {
+		return
+	}
+	t := &a.overhead
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.samples) < overheadSamples {
+		t.samples = append(t.samples, overhead)
+	} else {
+		t.samples[t.next] = overhead
+		t.next = (t.next + 1) % overheadSamples
+	}
+	t.observed++
+	if t.observed%overheadEvaluateEvery != 0 {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), t.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	t.p99 = sorted[(len(sorted)*99-1)/100]
+	level := captureLevel(atomic.LoadInt32(&t.level))
+	switch {
+	case t.p99 > a.OverheadBudget && level < captureMetadata:
+		level++
+	case t.p99 < a.OverheadBudget/2 && level > captureFull:
+		level--
+	default:
+		return
+	}
+	atomic.StoreInt32(&t.level, int32(level))
+	// the samples of the previous level don't tell about the new one
+	t.samples, t.next = t.samples[:0], 0
+	a.logger().Info("capture level adjusted to the agent's overhead",
+		zap.Stringer("level", level), zap.Duration("p99", t.p99))
+}
+
+// overheadP99 returns the 99th percentile of the latest overheads, as of
+// the last adjustment of the capture level.
+func (a *Agent) overheadP99() time.Duration {
+	a.overhead.mutex.Lock()
+	defer a.overhead.mutex.Unlock()
+	return a.overhead.p99
+}
+
+// withoutBody returns a copy of resp without its body, or nil.
+func withoutBody(resp *http.Response) *http.Response {
+	if resp == nil {
+		return nil
+	}
+	ret := *resp
+	ret.Body = nil
+	return &ret
+}
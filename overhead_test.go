@@ -0,0 +1,66 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_observeOverhead(t *testing.T) {
+	agent := &Agent{OverheadBudget: time.Millisecond}
+	observe := func(overhead time.Duration) captureLevel {
+		for i := 0; i < overheadEvaluateEvery; i++ {
+			agent.observeOverhead(overhead)
+		}
+		return agent.captureLevel()
+	}
+	assert.Equal(t, captureFull, observe(100*time.Microsecond))
+	assert.Equal(t, captureHeaders, observe(5*time.Millisecond))
+	assert.Equal(t, captureMetadata, observe(5*time.Millisecond))
+	assert.Equal(t, captureMetadata, observe(5*time.Millisecond))
+	assert.Equal(t, captureMetadata, observe(800*time.Microsecond), "within budget")
+	// the overheads above the budget are left out of the window gradually
+	for i := 0; i < overheadSamples/overheadEvaluateEvery && agent.captureLevel() == captureMetadata; i++ {
+		observe(100 * time.Microsecond)
+	}
+	assert.Equal(t, captureHeaders, agent.captureLevel())
+	assert.Equal(t, captureFull, observe(100*time.Microsecond))
+	assert.Equal(t, "full", agent.Stats().CaptureLevel)
+	assert.Equal(t, 100*time.Microsecond, agent.Stats().OverheadP99)
+
+	disabled := &Agent{}
+	disabled.observeOverhead(time.Second)
+	assert.Zero(t, disabled.Stats().OverheadP99)
+}
+
+func TestAgent_captureLevel(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer api.Close()
+
+	for _, level := range []captureLevel{captureHeaders, captureMetadata} {
+		t.Run(level.String(), func(t *testing.T) {
+			fake := newFakeBearer(`{}`)
+			agent := &Agent{SecretKey: "sk_test", Transport: fake, OverheadBudget: time.Hour}
+			atomic.StoreInt32(&agent.overhead.level, int32(level))
+			client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+			resp, err := client.Post(api.URL+"/users/42", "application/json", strings.NewReader(`{"name":"blah"}`))
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			record := fake.next(t)
+			assert.Empty(t, record.RequestBody)
+			assert.Empty(t, record.ResponseBody)
+			assert.Equal(t, level == captureHeaders, len(record.ResponseHeaders) > 0)
+			assert.Equal(t, level == captureHeaders, record.Path == "/users/42")
+		})
+	}
+}
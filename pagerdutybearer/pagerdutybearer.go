@@ -0,0 +1,119 @@
+// Package pagerdutybearer triggers PagerDuty incidents for the alerts raised
+// by the agent, with the Events API v2:
+//
+//	notifier := &pagerdutybearer.Notifier{RoutingKey: os.Getenv("PAGERDUTY_ROUTING_KEY")}
+//	agent.AlertCallbacks = append(agent.AlertCallbacks, notifier.Notify)
+//
+// The alerts of a kind for a host share a dedup key, so that PagerDuty groups
+// them in a single incident.
+package pagerdutybearer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+)
+
+const (
+	// DefaultEventsURL is the endpoint of the Events API v2.
+	DefaultEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// defaultTimeout is the timeout of the requests of notifiers without Client.
+	defaultTimeout = 10 * time.Second
+)
+
+// Notifier triggers PagerDuty events for alerts.
+type Notifier struct {
+	// RoutingKey is the integration key of the PagerDuty service.
+	RoutingKey string
+	// EventsURL is the endpoint of the Events API, DefaultEventsURL if empty.
+	EventsURL string
+	// Client performs the requests. If nil, a client with a 10s timeout is used.
+	Client *http.Client
+	// If set, OnError is called with the errors of Notify.
+	OnError func(error)
+}
+
+// event is the body of the requests to the Events API v2.
+type event struct {
+	RoutingKey  string  `json:"routing_key"`
+	EventAction string  `json:"event_action"`
+	DedupKey    string  `json:"dedup_key"`
+	Payload     payload `json:"payload"`
+}
+
+type payload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp"`
+	Component     string                 `json:"component"`
+	Class         string                 `json:"class"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+// severity returns the PagerDuty severity of alert.
+func severity(alert bearer.Alert) string {
+	if alert.Kind == bearer.AlertLatency {
+		return "warning"
+	}
+	return "error"
+}
+
+// Notify triggers an event for alert, and reports errors to OnError. It can
+// be appended to the agent's AlertCallbacks.
+func (n *Notifier) Notify(alert bearer.Alert) {
+	if err := n.Send(context.Background(), alert); err != nil && n.OnError != nil {
+		n.OnError(err)
+	}
+}
+
+// Send triggers an event for alert.
+func (n *Notifier) Send(ctx context.Context, alert bearer.Alert) error {
+	body, err := json.Marshal(event{
+		RoutingKey:  n.RoutingKey,
+		EventAction: "trigger",
+		DedupKey:    fmt.Sprintf("bearer-%s-%s", alert.Kind, alert.Host),
+		Payload: payload{
+			Summary:       alert.String(),
+			Source:        alert.Host,
+			Severity:      severity(alert),
+			Timestamp:     alert.Time.UTC().Format(time.RFC3339),
+			Component:     alert.Host,
+			Class:         string(alert.Kind),
+			CustomDetails: map[string]interface{}{"message": alert.Message, "suppressed": alert.Suppressed},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	url := n.EventsURL
+	if url == "" {
+		url = DefaultEventsURL
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("pagerdutybearer: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("pagerdutybearer: enqueue event: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("pagerdutybearer: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package pagerdutybearer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	var received event
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&received))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	notifier := &Notifier{RoutingKey: "key", EventsURL: ts.URL}
+	at := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, notifier.Send(context.Background(), bearer.Alert{Kind: bearer.AlertLatency, Host: "api.stripe.com", Message: "GET /v1/charges took 2s", Time: at}))
+
+	assert.Equal(t, "key", received.RoutingKey)
+	assert.Equal(t, "trigger", received.EventAction)
+	assert.Equal(t, "bearer-latency-api.stripe.com", received.DedupKey)
+	assert.Equal(t, "latency on api.stripe.com: GET /v1/charges took 2s", received.Payload.Summary)
+	assert.Equal(t, "warning", received.Payload.Severity)
+	assert.Equal(t, "2026-10-15T12:00:00Z", received.Payload.Timestamp)
+	assert.Equal(t, "latency", received.Payload.Class)
+
+	var errs []error
+	notifier = &Notifier{RoutingKey: "key", EventsURL: "http://127.0.0.1:1", OnError: func(err error) { errs = append(errs, err) }}
+	notifier.Notify(bearer.Alert{Kind: bearer.AlertError, Host: "api.stripe.com"})
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,237 @@
+package bearer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxPaginationCursors bounds the number of next pages awaited.
+	maxPaginationCursors = 1000
+	// paginationTimeout is the delay after which a next page is no longer
+	// awaited.
+	paginationTimeout = 10 * time.Minute
+	// minBodyCursorLength is the length of the cursors below which they are
+	// only looked for in the query of requests, not in their bodies.
+	minBodyCursorLength = 8
+)
+
+var (
+	// nextCursorKeys match the fields of JSON responses holding the cursor
+	// or the URL of their next page, e.g. "next_page_token" or "nextLink".
+	nextCursorKeys = regexp.MustCompile(`(?i)^(@odata\.)?next(_?page)?(_?(token|cursor|url|link|key))?$`)
+	// paginationObjects match the fields of JSON responses nesting their
+	// pagination fields, e.g. Slack's "response_metadata".
+	paginationObjects = regexp.MustCompile(`(?i)^(pagination|paging|meta|links|response_metadata)$`)
+)
+
+// pagination locates the request of a record in a sequence of pages.
+type pagination struct {
+	// Sequence identifies the pages of a sequence.
+	Sequence string `json:"sequence"`
+	// Page is the depth of the request in its sequence, from 1.
+	Page int `json:"page"`
+}
+
+// paginationTracker holds the cursors of the next pages of each host and
+// path, i.e. the URLs of Link headers and the tokens of JSON responses.
+type paginationTracker struct {
+	mutex   sync.Mutex
+	cursors map[string]map[string]*awaitedPage
+	count   int
+}
+
+// awaitedPage is the next page of a sequence.
+type awaitedPage struct {
+	pagination
+	at time.Time
+}
+
+// paginate returns the pagination of the request of record, which followed
+// a previous page or whose response links to a next one, nil otherwise.
+func (a *Agent) paginate(req *http.Request, reqBody []byte, resp *http.Response, record *ReportLog) *pagination {
+	t := &a.pagination
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var page *pagination
+	if pages := t.cursors[paginationKey(req.URL)]; pages != nil {
+		candidates := []string{req.URL.String()}
+		for _, values := range req.URL.Query() {
+			candidates = append(candidates, values...)
+		}
+		for _, candidate := range candidates {
+			if awaited := pages[candidate]; awaited != nil {
+				page = &pagination{Sequence: awaited.Sequence, Page: awaited.Page}
+				t.remove(req.URL, candidate)
+				break
+			}
+		}
+		if page == nil && len(reqBody) > 0 {
+			for cursor, awaited := range pages {
+				if len(cursor) >= minBodyCursorLength && strings.Contains(string(reqBody), cursor) {
+					page = &pagination{Sequence: awaited.Sequence, Page: awaited.Page}
+					t.remove(req.URL, cursor)
+					break
+				}
+			}
+		}
+	}
+
+	next, link := nextCursor(req.URL, resp, record)
+	if next == "" {
+		return page
+	}
+	if page == nil {
+		page = &pagination{Sequence: newRecordID(), Page: 1}
+	}
+	nextPage := &awaitedPage{pagination: pagination{Sequence: page.Sequence, Page: page.Page + 1}, at: now}
+	if link != nil {
+		t.add(link, next, nextPage, now)
+	} else {
+		t.add(req.URL, next, nextPage, now)
+	}
+	return page
+}
+
+// add awaits page at the cursor for the host and path of u, unless too many
+// pages are awaited.
+func (t *paginationTracker) add(u *url.URL, cursor string, page *awaitedPage, now time.Time) {
+	if t.cursors == nil {
+		t.cursors = map[string]map[string]*awaitedPage{}
+	}
+	if t.count >= maxPaginationCursors {
+		t.expire(now)
+		if t.count >= maxPaginationCursors {
+			return
+		}
+	}
+	key := paginationKey(u)
+	if t.cursors[key] == nil {
+		t.cursors[key] = map[string]*awaitedPage{}
+	}
+	if t.cursors[key][cursor] == nil {
+		t.count++
+	}
+	t.cursors[key][cursor] = page
+}
+
+func (t *paginationTracker) remove(u *url.URL, cursor string) {
+	key := paginationKey(u)
+	delete(t.cursors[key], cursor)
+	t.count--
+	if len(t.cursors[key]) == 0 {
+		delete(t.cursors, key)
+	}
+}
+
+// expire forgets the pages awaited for longer than paginationTimeout.
+func (t *paginationTracker) expire(now time.Time) {
+	for key, pages := range t.cursors {
+		for cursor, page := range pages {
+			if now.Sub(page.at) > paginationTimeout {
+				delete(pages, cursor)
+				t.count--
+			}
+		}
+		if len(pages) == 0 {
+			delete(t.cursors, key)
+		}
+	}
+}
+
+func paginationKey(u *url.URL) string {
+	return canonicalHost(u) + " " + u.Path
+}
+
+// nextCursor returns the cursor of the next page of the response to a
+// request to u: the URL of its Link header with rel="next", or the value of
+// a next page field of its JSON body. If the cursor is a URL, it is returned
+// resolved too.
+func nextCursor(u *url.URL, resp *http.Response, record *ReportLog) (string, *url.URL) {
+	if resp != nil {
+		for _, header := range resp.Header["Link"] {
+			if next := nextLink(header); next != "" {
+				if link, err := u.Parse(next); err == nil {
+					return link.String(), link
+				}
+			}
+		}
+	}
+	if record.ResponseBody == "" || !strings.Contains(record.ResponseContentType(), "json") {
+		return "", nil
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(record.ResponseBody), &body); err != nil {
+		return "", nil
+	}
+	cursor := nextField(body)
+	if cursor == "" {
+		for key, value := range body {
+			if nested, ok := value.(map[string]interface{}); ok && paginationObjects.MatchString(key) {
+				if cursor = nextField(nested); cursor != "" {
+					break
+				}
+			}
+		}
+	}
+	if strings.HasPrefix(cursor, "/") || strings.HasPrefix(cursor, "http://") || strings.HasPrefix(cursor, "https://") {
+		if link, err := u.Parse(cursor); err == nil {
+			return link.String(), link
+		}
+	}
+	return cursor, nil
+}
+
+// nextField returns the value of the next page field of a JSON object, "" if
+// it has none.
+func nextField(object map[string]interface{}) string {
+	for key, value := range object {
+		if !nextCursorKeys.MatchString(key) {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// nextLink returns the target of the link with the "next" relation type of
+// a Link header, "" if there isn't any.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			name, value := param, ""
+			if i := strings.Index(param, "="); i >= 0 {
+				name, value = param[:i], param[i+1:]
+			}
+			if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "next") {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
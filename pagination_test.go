@@ -0,0 +1,89 @@
+package bearer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextLink(t *testing.T) {
+	tests := map[string]string{
+		`<https://api.github.com/repos?page=2>; rel="next", <https://api.github.com/repos?page=5>; rel="last"`: "https://api.github.com/repos?page=2",
+		`</items?cursor=abc>; rel="prev", </items?cursor=def>; rel="next"`:                                     "/items?cursor=def",
+		`<https://example.com/2>; title="x"; rel="last next"`:                                                  "https://example.com/2",
+		`<https://example.com/1>; rel="prev"`:                                                                  "",
+		`rel="next"`:                                                                                           "",
+	}
+	for header, expected := range tests {
+		assert.Equal(t, expected, nextLink(header), header)
+	}
+}
+
+func TestAgent_DetectPagination(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/repos":
+			// pages linked by Link headers
+			if page := req.URL.Query().Get("page"); page != "3" {
+				next := map[string]string{"": "2", "2": "3"}[page]
+				w.Header().Set("Link", fmt.Sprintf(`</repos?page=%s>; rel="next"`, next))
+			}
+			w.Write([]byte(`[]`))
+		case "/conversations":
+			// pages linked by the cursors of Slack's response_metadata
+			if req.URL.Query().Get("cursor") == "" {
+				w.Write([]byte(`{"ok":true,"response_metadata":{"next_cursor":"dGVhbTpDMDYxRkE1UEI="}}`))
+			} else {
+				w.Write([]byte(`{"ok":true,"response_metadata":{"next_cursor":""}}`))
+			}
+		default:
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, DetectPagination: true}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	get := func(path string) {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	get("/repos")
+	get("/repos?page=2")
+	get("/repos?page=3")
+	get("/conversations")
+	get("/conversations?cursor=dGVhbTpDMDYxRkE1UEI%3D")
+	get("/other")
+
+	// the records may be reported in any order
+	byURL := map[string]*pagination{}
+	for i := 0; i < 6; i++ {
+		record := fake.next(t)
+		byURL[strings.TrimPrefix(record.URL, api.URL)] = record.Pagination
+	}
+	var pages []*pagination
+	for _, path := range []string{"/repos", "/repos?page=2", "/repos?page=3", "/conversations", "/conversations?cursor=dGVhbTpDMDYxRkE1UEI%3D", "/other"} {
+		pages = append(pages, byURL[path])
+	}
+	for i, page := range pages[:5] {
+		require.NotNil(t, page, i)
+	}
+	assert.Equal(t, []int{1, 2, 3, 1, 2}, []int{pages[0].Page, pages[1].Page, pages[2].Page, pages[3].Page, pages[4].Page})
+	assert.Equal(t, pages[0].Sequence, pages[1].Sequence)
+	assert.Equal(t, pages[0].Sequence, pages[2].Sequence)
+	assert.Equal(t, pages[3].Sequence, pages[4].Sequence)
+	assert.NotEqual(t, pages[0].Sequence, pages[3].Sequence)
+	assert.Nil(t, pages[5])
+	assert.False(t, strings.Contains(fmt.Sprint(agent.pagination.cursors), "repos"))
+}
@@ -0,0 +1,131 @@
+package bearer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// recordTypeAgentHealth is the type of records describing events
+	// affecting the agent itself.
+	recordTypeAgentHealth = "AGENT_HEALTH"
+
+	// maxPanicStack bounds the size of the stacks of panics in records.
+	maxPanicStack = 4096
+)
+
+// agentHealth describes an event affecting the agent.
+type agentHealth struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+// recovered logs and counts a panic recovered from the agent's own code, and
+// reports it unless it was raised while reporting an agent health event.
+func (a *Agent) recovered(r interface{}, healthRecord bool) {
+	atomic.AddInt32(&a.panics, 1)
+	stack := debug.Stack()
+	a.logger().Error("recovered panic", zap.Any("r", r), zap.ByteString("stack", stack))
+	if healthRecord || !a.isAvailable() {
+		return
+	}
+	if len(stack) > maxPanicStack {
+		stack = stack[:maxPanicStack]
+	}
+	a.report(a.context(), ReportLog{
+		Type: recordTypeAgentHealth,
+		Health: &agentHealth{
+			Event:   "panic",
+			Message: sensitiveValues.ReplaceAllString(fmt.Sprint(r), defaultSensitivePlaceholder),
+			Stack:   string(stack),
+		},
+	})
+}
+
+// recoverPanic recovers from panics of the agent's background goroutines.
+// It must be deferred directly.
+func (a *Agent) recoverPanic() {
+	if r := recover(); r != nil {
+		a.recovered(r, false)
+	}
+}
+
+// roundTripState tracks the progress of a request through the agent, so
+// that the request still completes if the agent's code panics.
+type roundTripState struct {
+	// inTransport is true while the transport performs the request.
+	inTransport bool
+	// sent is true once the transport returned resp and err.
+	sent bool
+	resp *http.Response
+	err  error
+	// transportTime and waited are the times spent in the transport, and
+	// waiting on purpose, e.g. for Retry-After windows, which aren't
+	// overheads of the agent.
+	transportTime time.Duration
+	waited        time.Duration
+	// called is true once the call was counted by countCall, so that the
+	// retries of the agent aren't.
+	called bool
+	// consumed is true once the body of the request may have been consumed,
+	// and body is its content if the agent read it first.
+	consumed bool
+	body     []byte
+}
+
+// recoverRoundTrip recovers from a panic of the agent's code during the
+// round trip of req: if req wasn't sent yet, it is sent as is with
+// transport, or the agent's transport of its host, bypassing the agent's
+// policies, and the transport's result is returned otherwise. If the body of
+// req was consumed and can't be rebuilt, ErrRequestBodyConsumed is returned
+// instead. Panics of the transport itself are propagated.
+func (a *Agent) recoverRoundTrip(req *http.Request, transport http.RoundTripper, state *roundTripState, resp **http.Response, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if state.inTransport {
+		panic(r)
+	}
+	a.recovered(r, false)
+	if state.sent {
+		*resp, *err = state.resp, state.err
+		return
+	}
+
+	if transport == nil {
+		transport = a.hostTransport(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody && state.consumed {
+		body, bodyErr := rebuildBody(req, state)
+		if bodyErr != nil {
+			*resp, *err = nil, fmt.Errorf("%w: %v", ErrRequestBodyConsumed, bodyErr)
+			return
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	*resp, *err = transport.RoundTrip(req)
+}
+
+// rebuildBody returns a new body for req, whose body was consumed.
+func rebuildBody(req *http.Request, state *roundTripState) (io.ReadCloser, error) {
+	switch {
+	case state.body != nil:
+		return ioutil.NopCloser(bytes.NewReader(state.body)), nil
+	case req.GetBody != nil:
+		return req.GetBody()
+	default:
+		return nil, errors.New("no GetBody")
+	}
+}
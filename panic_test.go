@@ -0,0 +1,146 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_RecoverPanics(t *testing.T) {
+	calls := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		name  string
+		agent func(*Agent)
+	}{
+		{name: "before sending", agent: func(agent *Agent) {
+			agent.ShouldBlock = func(req *http.Request, config *Config) error { panic("boom") }
+		}},
+		{name: "after sending", agent: func(agent *Agent) {
+			agent.Validators = map[string]Validator{"127.0.0.1": validatorFunc(func(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) []string {
+				panic("boom")
+			})}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls = 0
+			fake := newFakeBearer(`{}`)
+			agent := &Agent{SecretKey: "sk_test", Transport: fake}
+			test.agent(agent)
+
+			resp, err := (&http.Client{Transport: agent.Wrap(http.DefaultTransport)}).Get(api.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+			assert.Equal(t, 1, calls, "request is sent once")
+			assert.Equal(t, 1, agent.Stats().Panics)
+
+			record := fake.next(t)
+			assert.Equal(t, recordTypeAgentHealth, record.Type)
+			require.NotNil(t, record.Health)
+			assert.Equal(t, "panic", record.Health.Event)
+			assert.Equal(t, "boom", record.Health.Message)
+			assert.NotEmpty(t, record.Health.Stack)
+		})
+	}
+}
+
+func TestAgent_RecoverPanics_hostTransport(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer api.Close()
+	agent := &Agent{
+		SecretKey:     "sk_test",
+		Transport:     newFakeBearer(`{}`),
+		HostAddresses: map[string]string{"api.example.com": api.Listener.Addr().String()},
+		ShouldBlock:   func(req *http.Request, config *Config) error { panic("boom") },
+	}
+	defer agent.Close()
+
+	// the request is sent to the address overriding its host's
+	resp, err := (&http.Client{Transport: agent}).Get("http://api.example.com/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+	assert.Equal(t, 1, agent.Stats().Panics)
+}
+
+func TestAgent_TransportPanics(t *testing.T) {
+	agent := &Agent{}
+	transport := agent.Wrap(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		panic("transport")
+	}))
+	assert.PanicsWithValue(t, "transport", func() {
+		transport.RoundTrip(httptest.NewRequest("GET", "http://api.example.com", nil))
+	})
+	assert.Equal(t, 0, agent.Stats().Panics)
+}
+
+func TestAgent_RecoverPanics_consumedBody(t *testing.T) {
+	var mutex sync.Mutex
+	var bodies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer api.Close()
+	var checks int32
+	agent := &Agent{
+		TokenRefresh: &TokenRefresh{
+			Hosts:   []string{"127.0.0.1"},
+			Refresh: func(ctx context.Context) (string, error) { return "Bearer new", nil },
+		},
+		// the retry with the refreshed credential panics
+		ShouldBlock: func(req *http.Request, config *Config) error {
+			if atomic.AddInt32(&checks, 1) > 1 {
+				panic("boom")
+			}
+			return nil
+		},
+	}
+	defer agent.Close()
+
+	// without GetBody, the body read by the agent is sent again
+	req, _ := http.NewRequest("POST", api.URL, ioutil.NopCloser(strings.NewReader("hello")))
+	req.ContentLength = 5
+	resp, err := agent.Wrap(http.DefaultTransport).RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, []string{"hello", "hello"}, bodies)
+	assert.Equal(t, 1, agent.Stats().Panics)
+}
+
+func TestAgent_recoverRoundTrip_consumedBody(t *testing.T) {
+	agent := &Agent{}
+	transport := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Error("the request is sent without its body")
+		return nil, nil
+	})
+	req, _ := http.NewRequest("POST", "http://api.example.com", ioutil.NopCloser(strings.NewReader("hello")))
+	resp, err := func() (resp *http.Response, err error) {
+		defer agent.recoverRoundTrip(req, transport, &roundTripState{consumed: true}, &resp, &err)
+		panic("boom")
+	}()
+	assert.Nil(t, resp)
+	assert.True(t, errors.Is(err, ErrRequestBodyConsumed))
+}
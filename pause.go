@@ -0,0 +1,31 @@
+package bearer
+
+import "sync/atomic"
+
+// Pause turns off the capture of requests and the enforcement of policies,
+// e.g. during an incident in which the agent is suspected. Requests are then
+// performed directly, with the agent's host transports only, and aren't
+// reported. Heartbeats and configuration refreshes continue.
+func (a *Agent) Pause() {
+	a.SetEnabled(false)
+}
+
+// Resume undoes Pause.
+func (a *Agent) Resume() {
+	a.SetEnabled(true)
+}
+
+// SetEnabled resumes the agent if enabled is true, and pauses it otherwise.
+// It is safe to call concurrently with requests.
+func (a *Agent) SetEnabled(enabled bool) {
+	var paused int32
+	if !enabled {
+		paused = 1
+	}
+	atomic.StoreInt32(&a.paused, paused)
+}
+
+// Enabled reports whether the agent isn't paused.
+func (a *Agent) Enabled() bool {
+	return atomic.LoadInt32(&a.paused) == 0
+}
@@ -0,0 +1,36 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Pause(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{"blockedDomains":["127.0.0.1"]}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	assert.True(t, agent.Enabled())
+
+	agent.Pause()
+	assert.False(t, agent.Enabled())
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err, "policies aren't enforced")
+	resp.Body.Close()
+	assert.Empty(t, fake.Records(), "requests aren't reported")
+
+	agent.Resume()
+	_, err = client.Get(api.URL)
+	assert.Error(t, err)
+
+	agent.SetEnabled(false)
+	assert.False(t, agent.Enabled())
+	agent.SetEnabled(true)
+	assert.True(t, agent.Enabled())
+}
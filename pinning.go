@@ -0,0 +1,72 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// certificatePins returns the SPKI pins of the host of req, if any.
+func (a *Agent) certificatePins(req *http.Request) ([]string, bool) {
+	for _, key := range hostKeys(req.URL) {
+		if pins, ok := a.CertificatePins[key]; ok {
+			return pins, true
+		}
+	}
+	return nil, false
+}
+
+// spkiPin returns the pin of cert: the base64-encoded SHA-256 digest of its
+// subject public key info.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// matchPins returns ErrCertificatePin unless a certificate of certs has one
+// of pins, with or without the "sha256/" prefix.
+func matchPins(pins []string, certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		pin := spkiPin(cert)
+		for _, expected := range pins {
+			if strings.TrimPrefix(expected, "sha256/") == pin {
+				return nil
+			}
+		}
+	}
+	return ErrCertificatePin
+}
+
+// verifyPins returns a tls.Config.VerifyPeerCertificate function failing the
+// handshakes with hosts whose certificates don't match pins.
+func verifyPins(pins []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 {
+			// the chain isn't verified with InsecureSkipVerify
+			for _, raw := range rawCerts {
+				if cert, err := x509.ParseCertificate(raw); err == nil {
+					certs = append(certs, cert)
+				}
+			}
+		}
+		return matchPins(pins, certs)
+	}
+}
+
+// checkPins returns ErrCertificatePin if the host of req is pinned, and the
+// certificates of resp don't match its pins. Connections to pinned hosts
+// fail on handshake, but for the ones of the transports given to Wrap,
+// whose responses are rejected instead.
+func (a *Agent) checkPins(req *http.Request, resp *http.Response) error {
+	pins, ok := a.certificatePins(req)
+	if !ok || resp == nil || resp.TLS == nil {
+		return nil
+	}
+	return matchPins(pins, resp.TLS.PeerCertificates)
+}
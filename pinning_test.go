@@ -0,0 +1,53 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_CertificatePins(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	pin := "sha256/" + spkiPin(api.Certificate())
+	wrong := "sha256/" + strings.Repeat("A", 43) + "="
+
+	for _, pins := range [][]string{{wrong, pin}, {wrong}} {
+		var out bytes.Buffer
+		agent := &Agent{ReportWriter: &out, SyncReporting: true, Transport: api.Client().Transport, CertificatePins: map[string][]string{"127.0.0.1": pins}}
+		client := &http.Client{Transport: agent}
+		resp, err := client.Get(api.URL)
+		if len(pins) == 2 {
+			require.NoError(t, err, "hosts with one of their pins are trusted")
+			resp.Body.Close()
+			agent.Close()
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrCertificatePin), "handshakes fail with mismatching pins")
+
+		// the transports given to Wrap aren't the agent's
+		client = &http.Client{Transport: agent.Wrap(api.Client().Transport)}
+		_, err = client.Get(api.URL)
+		assert.True(t, errors.Is(err, ErrCertificatePin), "responses are rejected with mismatching pins")
+		agent.Close()
+
+		var findings []SecurityFinding
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var record ReportLog
+			require.NoError(t, json.Unmarshal([]byte(line), &record))
+			if record.Finding != nil {
+				findings = append(findings, *record.Finding)
+			}
+		}
+		require.Len(t, findings, 1, "mismatches are reported once per host")
+		assert.Equal(t, FindingCertificatePin, findings[0].Kind)
+		assert.Equal(t, "127.0.0.1", findings[0].Host)
+	}
+}
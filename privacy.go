@@ -0,0 +1,78 @@
+package bearer
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// pathIDSegment matches the segments of paths which are numbers or UUIDs.
+	pathIDSegment = regexp.MustCompile(`^(?:\d+|[0-9a-fA-F]{8}-(?:[0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12})$`)
+	// pathTokenSegment matches the segments of paths which are long tokens,
+	// identifiers if they contain digits.
+	pathTokenSegment = regexp.MustCompile(`^[A-Za-z0-9_-]{16,}$`)
+)
+
+// templatePath returns path with the segments which look like identifiers
+// replaced by "{id}", e.g. "/users/{id}/orders".
+func templatePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if pathIDSegment.MatchString(segment) || (pathTokenSegment.MatchString(segment) && strings.ContainsAny(segment, "0123456789")) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// metadataOnly returns the metadata of r, without any of the bodies,
+// headers, query or error messages which may carry payloads, and with a
+// templated path.
+func (r ReportLog) metadataOnly() ReportLog {
+	path := templatePath(r.Path)
+	ret := ReportLog{
+		Type:          r.Type,
+		Protocol:      r.Protocol,
+		Hostname:      r.Hostname,
+		Port:          r.Port,
+		Method:        r.Method,
+		Path:          path,
+		Endpoint:      r.Endpoint,
+		StatusCode:    r.StatusCode,
+		StartedAt:     r.StartedAt,
+		EndedAt:       r.EndedAt,
+		Duration:      r.Duration,
+		ErrorCategory: r.ErrorCategory,
+		Canceled:      r.Canceled,
+		ID:            r.ID,
+		ParentID:      r.ParentID,
+		Attempt:       r.Attempt,
+		Probe:         r.Probe,
+		Check:         r.Check,
+		Finding:       r.Finding,
+		Insecure:      r.Insecure,
+		TLSViolation:  r.TLSViolation,
+		Volume:        r.Volume,
+		LargeResponse: r.LargeResponse,
+		Pagination:    r.Pagination,
+		Duplicates:    r.Duplicates,
+		Diagnostic:    r.Diagnostic,
+		TraceID:       r.TraceID,
+		RequestID:     r.RequestID,
+		WouldBlock:    r.WouldBlock,
+		Health:        r.Health,
+		Heartbeat:     r.Heartbeat,
+		SLO:           r.SLO,
+		HostClass:     r.HostClass,
+		API:           r.API,
+		Webhook:       r.Webhook,
+	}
+	if r.URL != "" {
+		if u, err := url.Parse(r.URL); err == nil {
+			// the braces of templates are left unescaped, as in Path
+			ret.URL = u.Scheme + "://" + u.Host + path
+		}
+	}
+	return ret
+}
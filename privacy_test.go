@@ -0,0 +1,57 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplatePath(t *testing.T) {
+	tests := map[string]string{
+		"":                 "",
+		"/":                "/",
+		"/users":           "/users",
+		"/users/42/orders": "/users/{id}/orders",
+		"/v1/items/550e8400-e29b-41d4-a716-446655440000": "/v1/items/{id}",
+		"/files/a1b2c3d4e5f6a7b8c9":                      "/files/{id}",
+		"/docs/getting-started-guide":                    "/docs/getting-started-guide",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, templatePath(path), path)
+	}
+}
+
+func TestAgent_PrivacyMode(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Secret", "value")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, PrivacyMode: true}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	resp, err := client.Post(api.URL+"/users/42?name=blah", "application/json", strings.NewReader(`{"name":"blah"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	record := fake.next(t)
+	assert.Equal(t, recordTypeRequestEnd, record.Type)
+	assert.Equal(t, "POST", record.Method)
+	assert.Equal(t, "127.0.0.1", record.Hostname)
+	assert.Equal(t, "/users/{id}", record.Path)
+	assert.Equal(t, api.URL+"/users/{id}", record.URL)
+	assert.Equal(t, http.StatusCreated, record.StatusCode)
+	assert.NotZero(t, record.EndedAt)
+	assert.Empty(t, record.RequestBody)
+	assert.Empty(t, record.ResponseBody)
+	assert.Empty(t, record.RequestHeaders)
+	assert.Empty(t, record.ResponseHeaders)
+	assert.Empty(t, record.Query)
+}
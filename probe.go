@@ -0,0 +1,75 @@
+package bearer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func isProbe(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey).(bool)
+	return probe
+}
+
+// probeURL returns the URL probed for host, a hostname or a URL.
+func probeURL(host string) string {
+	if strings.Contains(host, "://") {
+		return host
+	}
+	return "https://" + host + "/"
+}
+
+// Probe performs a synthetic GET request to host, e.g. "api.stripe.com" or a
+// URL such as "https://api.stripe.com/healthcheck", through the agent. Its
+// record is reported like the others, with Probe set. It fails, raising an
+// AlertProbeFailure alert, if the request fails or its response has a 5xx
+// status.
+func (a *Agent) Probe(ctx context.Context, host string) error {
+	req, err := http.NewRequest(http.MethodGet, probeURL(host), nil)
+	if err != nil {
+		return fmt.Errorf("create probe request: %w", err)
+	}
+	err = a.probe(req.WithContext(context.WithValue(ctx, probeKey, true)), host)
+	if err != nil {
+		a.alert(Alert{Kind: AlertProbeFailure, Host: canonicalHost(req.URL), Message: err.Error(), Time: time.Now()})
+	}
+	return err
+}
+
+// probe performs the probe req of host.
+func (a *Agent) probe(req *http.Request, host string) error {
+	resp, err := a.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("probe %s: status %d", host, resp.StatusCode)
+	}
+	return nil
+}
+
+// startProbes starts probing ProbeHosts regularly, if enabled. It is called
+// once the first configuration is fetched.
+func (a *Agent) startProbes() {
+	if a.ProbeEvery <= 0 || len(a.ProbeHosts) == 0 {
+		return
+	}
+	a.goWorker(func() {
+		defer a.recoverPanic()
+		for {
+			for _, host := range a.ProbeHosts {
+				// failures are reported by the records of probes
+				a.Probe(a.context(), host)
+			}
+			if !a.sleep(a.ProbeEvery) {
+				return
+			}
+		}
+	})
+}
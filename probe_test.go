@@ -0,0 +1,52 @@
+package bearer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Probe(t *testing.T) {
+	status := http.StatusOK
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	fake.Next = http.DefaultTransport
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true}
+	defer agent.Close()
+
+	require.NoError(t, agent.Probe(context.Background(), api.URL+"/health"))
+	record := fake.next(t)
+	assert.True(t, record.Probe)
+	assert.Equal(t, "/health", record.Path)
+
+	status = http.StatusBadGateway
+	assert.Error(t, agent.Probe(context.Background(), api.URL))
+	assert.Equal(t, 502, fake.next(t).StatusCode)
+
+	assert.Equal(t, "https://api.stripe.com/", probeURL("api.stripe.com"))
+}
+
+func TestAgent_ProbeEvery(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	fake.Next = http.DefaultTransport
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, ProbeHosts: []string{api.URL}, ProbeEvery: 10 * time.Millisecond}
+	defer agent.Close()
+	agent.config()
+
+	records, err := fake.WaitRecords(2, time.Second)
+	require.NoError(t, err)
+	assert.True(t, records[0].Probe)
+	assert.True(t, records[1].Probe)
+}
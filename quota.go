@@ -0,0 +1,188 @@
+package bearer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// QuotaPeriod is the period after which the usage of a quota is reset.
+type QuotaPeriod string
+
+// Quota periods, starting at midnight, respectively on the first day of the
+// month, in the timezone of the Bearer config.
+const (
+	QuotaDaily   QuotaPeriod = "daily"
+	QuotaMonthly QuotaPeriod = "monthly"
+)
+
+// Quota is a budget of requests, for the requests matching all of its
+// non-empty conditions, e.g. the requests to a metered API. Conditions are
+// the same as BlockRule's.
+type Quota struct {
+	// Name identifies the quota in Stats.
+	Name string
+
+	Host   string
+	Method string
+	Path   string
+
+	// Period is the period of the budget. If empty, will use QuotaDaily as default.
+	Period QuotaPeriod
+	// Limit is the budget per period.
+	Limit float64
+	// If set, Cost returns the cost of a request, e.g. for APIs billing
+	// some calls more than others. Requests cost 1 otherwise.
+	Cost func(req *http.Request) float64
+	// WarnAt is the fraction of the budget, e.g. 0.8, above which OnQuotaWarning
+	// is called once per period. If zero, warnings are only issued once the
+	// budget is exhausted.
+	WarnAt float64
+	// If true, requests exceeding the budget are blocked with ErrQuotaExceeded.
+	Block bool
+	// Windows restrict the quota to periods of time, e.g. a provider's
+	// maintenance window, evaluated in the config's timezone: requests
+	// outside of them are neither charged nor blocked. The quota applies at
+	// any time if empty.
+	Windows []TimeWindow
+}
+
+// QuotaStatus is the usage of a quota over its current period.
+type QuotaStatus struct {
+	Quota       Quota
+	PeriodStart time.Time
+	Used        float64
+	Remaining   float64
+}
+
+func (q Quota) cost(req *http.Request) float64 {
+	if q.Cost != nil {
+		return q.Cost(req)
+	}
+	return 1
+}
+
+// periodStart returns the start of the period of the quota containing now.
+func (q Quota) periodStart(now time.Time, location *time.Location) time.Time {
+	now = now.In(location)
+	if q.Period == QuotaMonthly {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+}
+
+type quotaUsage struct {
+	periodStart time.Time
+	used        float64
+	warned      bool
+}
+
+// quotaTracker holds the usage of the agent's quotas, in the same order.
+type quotaTracker struct {
+	mutex sync.Mutex
+	usage []quotaUsage
+}
+
+// current returns the usage of the agent's quota i, reset if its period is over.
+// The tracker's mutex must be held.
+func (t *quotaTracker) current(quotas []Quota, i int, now time.Time, location *time.Location) *quotaUsage {
+	if len(t.usage) != len(quotas) {
+		t.usage = make([]quotaUsage, len(quotas))
+	}
+	usage := &t.usage[i]
+	if start := quotas[i].periodStart(now, location); !usage.periodStart.Equal(start) {
+		*usage = quotaUsage{periodStart: start}
+	}
+	return usage
+}
+
+// quotaCharge is the cost of a request to the quota of index.
+type quotaCharge struct {
+	index int
+	cost  float64
+}
+
+// consumeQuotas charges req to the quotas it matches, and returns
+// ErrQuotaExceeded if it exceeds a blocking one, in which case it isn't
+// charged unless BlockDryRun is set. Costs are computed, and warnings
+// issued, without holding the lock of the quotas, so that Cost and
+// OnQuotaWarning may call Stats.
+func (a *Agent) consumeQuotas(config *Config, req *http.Request, now time.Time) error {
+	if len(a.Quotas) == 0 {
+		return nil
+	}
+	var charges []quotaCharge
+	local := now.In(config.Location())
+	for i, quota := range a.Quotas {
+		if inWindows(quota.Windows, local) && matchRequest(req, quota.Host, quota.Method, quota.Path) {
+			charges = append(charges, quotaCharge{index: i, cost: quota.cost(req)})
+		}
+	}
+	warnings, err := a.chargeQuotas(config, charges, now)
+	for _, status := range warnings {
+		a.logger().Warn("quota usage", zap.String("quota", status.Quota.Name), zap.Float64("used", status.Used), zap.Float64("limit", status.Quota.Limit))
+		if a.OnQuotaWarning != nil {
+			a.OnQuotaWarning(status)
+		}
+	}
+	return err
+}
+
+// chargeQuotas applies charges, unless one exceeds a blocking quota and
+// BlockDryRun isn't set, and returns the statuses of the quotas reaching
+// their warning threshold.
+func (a *Agent) chargeQuotas(config *Config, charges []quotaCharge, now time.Time) ([]QuotaStatus, error) {
+	if len(charges) == 0 {
+		return nil, nil
+	}
+	a.quotas.mutex.Lock()
+	defer a.quotas.mutex.Unlock()
+
+	var exceeded error
+	for _, charge := range charges {
+		quota := a.Quotas[charge.index]
+		usage := a.quotas.current(a.Quotas, charge.index, now, config.Location())
+		if quota.Block && usage.used+charge.cost > quota.Limit {
+			if !a.BlockDryRun {
+				return nil, ErrQuotaExceeded
+			}
+			exceeded = ErrQuotaExceeded
+		}
+	}
+
+	var warnings []QuotaStatus
+	for _, charge := range charges {
+		quota := a.Quotas[charge.index]
+		usage := &a.quotas.usage[charge.index]
+		usage.used += charge.cost
+		if !usage.warned && (usage.used >= quota.Limit || (quota.WarnAt > 0 && usage.used >= quota.WarnAt*quota.Limit)) {
+			usage.warned = true
+			warnings = append(warnings, quotaStatus(quota, *usage))
+		}
+	}
+	return warnings, exceeded
+}
+
+// quotaStatuses returns the usage of the agent's quotas at now.
+func (a *Agent) quotaStatuses(config *Config, now time.Time) []QuotaStatus {
+	if len(a.Quotas) == 0 {
+		return nil
+	}
+	a.quotas.mutex.Lock()
+	defer a.quotas.mutex.Unlock()
+	statuses := make([]QuotaStatus, len(a.Quotas))
+	for i, quota := range a.Quotas {
+		statuses[i] = quotaStatus(quota, *a.quotas.current(a.Quotas, i, now, config.Location()))
+	}
+	return statuses
+}
+
+func quotaStatus(quota Quota, usage quotaUsage) QuotaStatus {
+	remaining := quota.Limit - usage.used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return QuotaStatus{Quota: quota, PeriodStart: usage.periodStart, Used: usage.used, Remaining: remaining}
+}
@@ -0,0 +1,124 @@
+package bearer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Quotas(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+
+	var warnings []QuotaStatus
+	agent := &Agent{
+		Quotas: []Quota{
+			{Name: "search", Path: "/search", Limit: 3, Block: true, Cost: func(req *http.Request) float64 {
+				if req.Method == "POST" {
+					return 2
+				}
+				return 1
+			}},
+			{Name: "all", Limit: 10, WarnAt: 0.5, Period: QuotaMonthly},
+		},
+		OnQuotaWarning: func(status QuotaStatus) { warnings = append(warnings, status) },
+	}
+	client := &http.Client{Transport: agent}
+
+	for _, test := range []struct {
+		method, path string
+		err          bool
+	}{
+		{method: "GET", path: "/search"},
+		{method: "POST", path: "/search"},
+		{method: "GET", path: "/search", err: true},
+		{method: "GET", path: "/other"},
+		{method: "GET", path: "/other"},
+		{method: "GET", path: "/other"},
+	} {
+		req, err := http.NewRequest(test.method, api.URL+test.path, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if test.err {
+			assert.True(t, errors.Is(err, ErrQuotaExceeded), "%s %s: %v", test.method, test.path, err)
+			continue
+		}
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	stats := agent.Stats()
+	require.Len(t, stats.Quotas, 2)
+	assert.Equal(t, 3.0, stats.Quotas[0].Used)
+	assert.Equal(t, 0.0, stats.Quotas[0].Remaining)
+	assert.Equal(t, 5.0, stats.Quotas[1].Used)
+	assert.Equal(t, 5.0, stats.Quotas[1].Remaining)
+	assert.Equal(t, 1, stats.Quotas[1].PeriodStart.Day())
+
+	require.Len(t, warnings, 2)
+	assert.Equal(t, "search", warnings[0].Quota.Name)
+	assert.Equal(t, "all", warnings[1].Quota.Name)
+}
+
+func TestAgent_ConsumeQuotas_Period(t *testing.T) {
+	agent := &Agent{Quotas: []Quota{{Limit: 1, Block: true}}}
+	config := &Config{}
+	req := httptest.NewRequest("GET", "http://api.example.com", nil)
+	day := time.Date(2020, 3, 14, 23, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, agent.consumeQuotas(config, req, day))
+	assert.Equal(t, ErrQuotaExceeded, agent.consumeQuotas(config, req, day))
+	assert.NoError(t, agent.consumeQuotas(config, req, day.Add(2*time.Hour)))
+
+	agent.BlockDryRun = true
+	assert.Equal(t, ErrQuotaExceeded, agent.consumeQuotas(config, req, day.Add(2*time.Hour)))
+	assert.Equal(t, 2.0, agent.quotaStatuses(config, day.Add(2*time.Hour))[0].Used)
+}
+
+func TestAgent_ConsumeQuotas_Windows(t *testing.T) {
+	agent := &Agent{Quotas: []Quota{{Limit: 1, Block: true, Windows: []TimeWindow{{Start: "02:00", End: "04:00"}}}}}
+	config := &Config{Timezone: "America/New_York"}
+	req := httptest.NewRequest("GET", "http://api.example.com", nil)
+	maintenance := time.Date(2020, 3, 4, 8, 0, 0, 0, time.UTC) // 03:00 in New York
+
+	assert.NoError(t, agent.consumeQuotas(config, req, maintenance))
+	assert.Equal(t, ErrQuotaExceeded, agent.consumeQuotas(config, req, maintenance))
+	assert.NoError(t, agent.consumeQuotas(config, req, maintenance.Add(time.Hour)), "requests outside the windows aren't blocked")
+	assert.Equal(t, 1.0, agent.quotaStatuses(config, maintenance.Add(time.Hour))[0].Used, "nor charged")
+}
+
+func TestAgent_Quotas_reentrant(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+
+	var warnings []QuotaStatus
+	var agent *Agent
+	agent = &Agent{
+		Quotas: []Quota{{Name: "all", Limit: 1, Cost: func(req *http.Request) float64 {
+			agent.Stats()
+			return 1
+		}}},
+		OnQuotaWarning: func(status QuotaStatus) { warnings = agent.Stats().Quotas },
+	}
+	done := make(chan error, 1)
+	go func() {
+		resp, err := (&http.Client{Transport: agent}).Get(api.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("Cost and OnQuotaWarning may call Stats")
+	}
+	require.Len(t, warnings, 1)
+	assert.Equal(t, 1.0, warnings[0].Used)
+}
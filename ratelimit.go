@@ -0,0 +1,162 @@
+package bearer
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRateLimitHosts bounds the number of hosts whose rate limits are tracked.
+const maxRateLimitHosts = 1000
+
+// RateLimit is the state of a provider's rate limit, as advertised by the
+// headers of its last response.
+type RateLimit struct {
+	// Limit is the number of requests allowed per window, -1 if unknown.
+	Limit int
+	// Remaining is the number of requests left in the window, -1 if unknown.
+	Remaining int
+	// Reset is the end of the window, zero if unknown.
+	Reset time.Time
+	// RetryAfter is the time before which the provider asked not to retry,
+	// zero if it didn't.
+	RetryAfter time.Time
+	// UpdatedAt is the time of the response the limit was parsed from.
+	UpdatedAt time.Time
+}
+
+// rateLimitHeaders are the header names, by precedence, of each rate limit field.
+var (
+	rateLimitLimitHeaders     = []string{"RateLimit-Limit", "X-RateLimit-Limit", "X-Rate-Limit-Limit"}
+	rateLimitRemainingHeaders = []string{"RateLimit-Remaining", "X-RateLimit-Remaining", "X-Rate-Limit-Remaining"}
+	rateLimitResetHeaders     = []string{"RateLimit-Reset", "X-RateLimit-Reset", "X-Rate-Limit-Reset"}
+)
+
+// parseRateLimit returns the rate limit advertised by header at now, and
+// false if header doesn't advertise any.
+//
+// Reset headers are either a number of seconds, as in the IETF RateLimit
+// headers draft, or a Unix timestamp, as used by e.g. GitHub. Retry-After is
+// either a number of seconds or an HTTP date.
+func parseRateLimit(header http.Header, now time.Time) (RateLimit, bool) {
+	limit := RateLimit{Limit: -1, Remaining: -1, UpdatedAt: now}
+	found := false
+	if value, ok := headerInt(header, rateLimitLimitHeaders); ok {
+		limit.Limit = value
+		found = true
+	}
+	if value, ok := headerInt(header, rateLimitRemainingHeaders); ok {
+		limit.Remaining = value
+		found = true
+	}
+	if value, ok := headerInt(header, rateLimitResetHeaders); ok {
+		if value > 1000000000 {
+			limit.Reset = time.Unix(int64(value), 0)
+		} else {
+			limit.Reset = now.Add(time.Duration(value) * time.Second)
+		}
+		found = true
+	}
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			limit.RetryAfter = now.Add(time.Duration(seconds) * time.Second)
+			found = true
+		} else if date, err := http.ParseTime(value); err == nil {
+			limit.RetryAfter = date
+			found = true
+		}
+	}
+	return limit, found
+}
+
+// headerInt returns the first of the names present in header as a
+// non-negative integer. Values with several parts, e.g. "100, 100;w=60",
+// are read up to the first non-digit.
+func headerInt(header http.Header, names []string) (int, bool) {
+	for _, name := range names {
+		value := strings.TrimSpace(header.Get(name))
+		end := 0
+		for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			continue
+		}
+		if ret, err := strconv.Atoi(value[:end]); err == nil {
+			return ret, true
+		}
+	}
+	return 0, false
+}
+
+// rateLimitTracker holds the last rate limit of each host, and the time
+// before which the hosts subject to a RetryAfterRule asked not to be retried.
+type rateLimitTracker struct {
+	mutex      sync.RWMutex
+	hosts      map[string]RateLimit
+	retryAfter map[string]time.Time
+}
+
+// RateLimit returns the last rate limit advertised by host, and false if
+// host didn't advertise any. Hosts are in canonical form, e.g.
+// "api.example.com" for https://api.example.com or "[::1]:8080".
+func (a *Agent) RateLimit(host string) (RateLimit, bool) {
+	a.rateLimits.mutex.RLock()
+	defer a.rateLimits.mutex.RUnlock()
+	limit, ok := a.rateLimits.hosts[strings.ToLower(host)]
+	return limit, ok
+}
+
+// observeRateLimit records the rate limit advertised by resp, if any, and
+// returns it.
+func (a *Agent) observeRateLimit(req *http.Request, resp *http.Response, now time.Time) *RateLimit {
+	if resp == nil {
+		return nil
+	}
+	limit, ok := parseRateLimit(resp.Header, now)
+	if !ok {
+		return nil
+	}
+	host := strings.ToLower(canonicalHost(req.URL))
+	a.rateLimits.mutex.Lock()
+	defer a.rateLimits.mutex.Unlock()
+	if a.rateLimits.hosts == nil {
+		a.rateLimits.hosts = map[string]RateLimit{}
+	}
+	if _, known := a.rateLimits.hosts[host]; known || len(a.rateLimits.hosts) < maxRateLimitHosts {
+		a.rateLimits.hosts[host] = limit
+	}
+	return &limit
+}
+
+// rateLimitRecord is a rate limit in records, with times in milliseconds.
+type rateLimitRecord struct {
+	Limit      *int `json:"limit,omitempty"`
+	Remaining  *int `json:"remaining,omitempty"`
+	Reset      int  `json:"reset,omitempty"`
+	RetryAfter int  `json:"retryAfter,omitempty"`
+}
+
+func newRateLimitRecord(limit *RateLimit) *rateLimitRecord {
+	if limit == nil {
+		return nil
+	}
+	record := &rateLimitRecord{}
+	if limit.Limit >= 0 {
+		value := limit.Limit
+		record.Limit = &value
+	}
+	if limit.Remaining >= 0 {
+		value := limit.Remaining
+		record.Remaining = &value
+	}
+	if !limit.Reset.IsZero() {
+		record.Reset = int(limit.Reset.UnixNano() / 1000000)
+	}
+	if !limit.RetryAfter.IsZero() {
+		record.RetryAfter = int(limit.RetryAfter.UnixNano() / 1000000)
+	}
+	return record
+}
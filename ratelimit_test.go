@@ -0,0 +1,88 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Date(2020, 3, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected RateLimit
+		found    bool
+	}{
+		{name: "none", header: http.Header{}, found: false},
+		{
+			name:     "ietf",
+			header:   http.Header{"Ratelimit-Limit": {"100, 100;w=60"}, "Ratelimit-Remaining": {"42"}, "Ratelimit-Reset": {"30"}},
+			expected: RateLimit{Limit: 100, Remaining: 42, Reset: now.Add(30 * time.Second)},
+			found:    true,
+		},
+		{
+			name:     "github",
+			header:   http.Header{"X-Ratelimit-Limit": {"5000"}, "X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1584190800"}},
+			expected: RateLimit{Limit: 5000, Remaining: 0, Reset: time.Unix(1584190800, 0)},
+			found:    true,
+		},
+		{
+			name:     "retry-after seconds",
+			header:   http.Header{"Retry-After": {"120"}},
+			expected: RateLimit{Limit: -1, Remaining: -1, RetryAfter: now.Add(2 * time.Minute)},
+			found:    true,
+		},
+		{
+			name:     "retry-after date",
+			header:   http.Header{"Retry-After": {"Sat, 14 Mar 2020 12:05:00 GMT"}},
+			expected: RateLimit{Limit: -1, Remaining: -1, RetryAfter: now.Add(5 * time.Minute)},
+			found:    true,
+		},
+		{name: "invalid", header: http.Header{"X-Ratelimit-Remaining": {"many"}, "Retry-After": {"soon"}}, found: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limit, found := parseRateLimit(test.header, now)
+			assert.Equal(t, test.found, found)
+			if test.found {
+				assert.Equal(t, test.expected.Limit, limit.Limit)
+				assert.Equal(t, test.expected.Remaining, limit.Remaining)
+				assert.True(t, test.expected.Reset.Equal(limit.Reset), "reset %s", limit.Reset)
+				assert.True(t, test.expected.RetryAfter.Equal(limit.RetryAfter), "retry after %s", limit.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestAgent_RateLimit(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "10")
+		w.Header().Set("X-RateLimit-Remaining", "9")
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	host := api.Listener.Addr().String()
+	_, ok := agent.RateLimit(host)
+	assert.False(t, ok)
+
+	resp, err := (&http.Client{Transport: agent.Wrap(http.DefaultTransport)}).Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	limit, ok := agent.RateLimit(host)
+	require.True(t, ok)
+	assert.Equal(t, 10, limit.Limit)
+	assert.Equal(t, 9, limit.Remaining)
+
+	record := fake.next(t)
+	require.NotNil(t, record.RateLimit)
+	assert.Equal(t, 9, *record.RateLimit.Remaining)
+	assert.Zero(t, record.RateLimit.Reset)
+}
@@ -0,0 +1,52 @@
+package bearer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region is the Bearer region to which the agent sends its data.
+type Region string
+
+// Bearer regions.
+const (
+	RegionUS Region = "us"
+	RegionEU Region = "eu"
+)
+
+// regionKeyPrefixes are the prefixes of the secret keys of each region but
+// the US one, which is the default.
+var regionKeyPrefixes = map[Region]string{
+	RegionEU: "sk_eu_",
+}
+
+// regionDomains are the domains of the endpoints of each region.
+var regionDomains = map[Region]string{
+	RegionUS: "bearer.sh",
+	RegionEU: "eu.bearer.sh",
+}
+
+// region returns the region of the agent: Region if set, or the region
+// identified by the prefix of its secret key.
+func (a *Agent) region() Region {
+	if a.Region != "" {
+		return a.Region
+	}
+	for region, prefix := range regionKeyPrefixes {
+		if strings.HasPrefix(a.SecretKey, prefix) {
+			return region
+		}
+	}
+	return RegionUS
+}
+
+// endpoint returns the URL of path on the service of the agent's region,
+// e.g. "config" or "agent".
+func (a *Agent) endpoint(service, path string) (string, error) {
+	region := a.region()
+	domain, ok := regionDomains[region]
+	if !ok {
+		return "", fmt.Errorf("unknown Bearer region %q", region)
+	}
+	return "https://" + service + "." + domain + path, nil
+}
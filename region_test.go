@@ -0,0 +1,50 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_endpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		agent     *Agent
+		configURL string
+		logsURL   string
+	}{
+		{name: "default", agent: &Agent{SecretKey: "sk_123"}, configURL: "https://config.bearer.sh/config", logsURL: "https://agent.bearer.sh/logs"},
+		{name: "key prefix", agent: &Agent{SecretKey: "sk_eu_123"}, configURL: "https://config.eu.bearer.sh/config", logsURL: "https://agent.eu.bearer.sh/logs"},
+		{name: "explicit", agent: &Agent{SecretKey: "sk_123", Region: RegionEU}, configURL: "https://config.eu.bearer.sh/config", logsURL: "https://agent.eu.bearer.sh/logs"},
+		{name: "explicit over key", agent: &Agent{SecretKey: "sk_eu_123", Region: RegionUS}, configURL: "https://config.bearer.sh/config", logsURL: "https://agent.bearer.sh/logs"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configURL, err := test.agent.endpoint("config", "/config")
+			require.NoError(t, err)
+			assert.Equal(t, test.configURL, configURL)
+			logsURL, err := test.agent.endpoint("agent", "/logs")
+			require.NoError(t, err)
+			assert.Equal(t, test.logsURL, logsURL)
+		})
+	}
+
+	_, err := (&Agent{Region: "mars"}).endpoint("config", "/config")
+	assert.Error(t, err)
+}
+
+func TestAgent_Region(t *testing.T) {
+	var hosts []string
+	agent := &Agent{SecretKey: "sk_eu_123", Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(`{}`))}, nil
+	})}
+	_, err := agent.Config()
+	require.NoError(t, err)
+	require.NoError(t, agent.logRecords([]ReportLog{{Type: recordTypeRequestEnd}}))
+	assert.Equal(t, []string{"config.eu.bearer.sh", "agent.eu.bearer.sh"}, hosts)
+}
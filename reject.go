@@ -0,0 +1,117 @@
+package bearer
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// RejectRule excludes the requests matching all of its non-empty conditions
+// from capture entirely, e.g. the calls to the company's own domains: they
+// are performed, and subject to the other rules, but never reported.
+type RejectRule struct {
+	// Host is a regular expression matching the host of rejected requests,
+	// without their port. For instance `(^|\.)internal\.example\.com$`.
+	Host string `json:"host,omitempty"`
+	// Path is a regular expression matching the path of rejected requests.
+	Path string `json:"path,omitempty"`
+	// Headers are the values of the headers of rejected requests, by name.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	host, path *regexp.Regexp
+	invalid    bool
+}
+
+// compile compiles the regular expressions of the rule. A rule with an
+// invalid expression matches no request.
+func (r *RejectRule) compile() error {
+	var err error
+	if r.Host != "" {
+		if r.host, err = regexp.Compile(r.Host); err != nil {
+			r.invalid = true
+			return err
+		}
+	}
+	if r.Path != "" {
+		if r.path, err = regexp.Compile(r.Path); err != nil {
+			r.invalid = true
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether req is rejected by r.
+// A rule without any condition matches no request.
+func (r RejectRule) Matches(req *http.Request) bool {
+	if r.Host == "" && r.Path == "" && len(r.Headers) == 0 {
+		return false
+	}
+	if r.invalid {
+		return false
+	}
+	if (r.Host != "" && r.host == nil) || (r.Path != "" && r.path == nil) {
+		// the rule wasn't compiled by Agent.Config
+		if err := r.compile(); err != nil {
+			return false
+		}
+	}
+	if r.host != nil && !r.host.MatchString(req.URL.Hostname()) {
+		return false
+	}
+	if r.path != nil && !r.path.MatchString(req.URL.Path) {
+		return false
+	}
+	for name, value := range r.Headers {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// String describes the conditions of r, e.g. for audit entries.
+func (r RejectRule) String() string {
+	var conditions []string
+	if r.Host != "" {
+		conditions = append(conditions, "host "+r.Host)
+	}
+	if r.Path != "" {
+		conditions = append(conditions, "path "+r.Path)
+	}
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conditions = append(conditions, "header "+name+": "+r.Headers[name])
+	}
+	return "reject rule matching " + strings.Join(conditions, ", ")
+}
+
+// compileRejectRules compiles the reject rules of config once.
+func (a *Agent) compileRejectRules(config *Config) {
+	for i := range config.RejectRules {
+		if err := config.RejectRules[i].compile(); err != nil {
+			a.logger().Warn("compile reject rule", zap.Error(err))
+		}
+	}
+}
+
+// captures reports whether req is captured in a record.
+func (a *Agent) captures(config *Config, req *http.Request) bool {
+	if !a.isAvailable() || !a.classIn(req, a.CaptureClasses) {
+		return false
+	}
+	for _, rule := range config.RejectRules {
+		if rule.Matches(req) {
+			a.audit(AuditRejected, req, rule.String())
+			return false
+		}
+	}
+	return true
+}
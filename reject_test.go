@@ -0,0 +1,53 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectRule_Matches(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://api.internal.example.com:8443/v1/users", nil)
+	req.Header.Set("X-Internal", "yes")
+	tests := []struct {
+		rule     RejectRule
+		expected bool
+	}{
+		{RejectRule{}, false},
+		{RejectRule{Host: `(^|\.)internal\.example\.com$`}, true},
+		{RejectRule{Host: `^example\.com$`}, false},
+		{RejectRule{Path: `^/v1/`}, true},
+		{RejectRule{Host: `internal`, Path: `^/v2/`}, false},
+		{RejectRule{Headers: map[string]string{"X-Internal": "yes"}}, true},
+		{RejectRule{Headers: map[string]string{"X-Internal": "no"}}, false},
+		{RejectRule{Host: `(`}, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.rule.Matches(req), "%+v", test.rule)
+	}
+}
+
+func TestAgent_RejectRules(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{"rejectRules":[{"path":"^/health"},{"host":"("}]}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, AuditLogSize: 10}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for _, path := range []string{"/health", "/users"} {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err, "rejected requests are performed")
+		resp.Body.Close()
+	}
+	records := fake.Records()
+	require.Len(t, records, 1)
+	assert.Equal(t, "/users", records[0].Path)
+	entries := agent.AuditLog()
+	require.Len(t, entries, 1, "rejected requests are audited")
+	assert.Equal(t, AuditRejected, entries[0].Decision)
+	assert.Equal(t, "/health", entries[0].Path)
+	assert.Equal(t, "reject rule matching path ^/health", entries[0].Reason)
+}
@@ -0,0 +1,30 @@
+// Package restybearer installs a Bearer agent into github.com/go-resty/resty clients.
+//
+// Resty retries requests above the http.RoundTripper layer, so installing
+// the agent with resty.Client.SetTransport alone would report every attempt
+// as an independent call. Install also records the attempt number of each
+// request so that retries can be told apart.
+package restybearer
+
+import (
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/go-resty/resty/v2"
+)
+
+// Install configures client to send its requests through agent, and returns client.
+// The transport already configured on client, if any, is kept and used by the agent.
+func Install(agent *bearer.Agent, client *resty.Client) *resty.Client {
+	if transport := client.GetClient().Transport; transport != nil {
+		client.SetTransport(agent.Wrap(transport))
+	} else {
+		client.SetTransport(agent)
+	}
+
+	// user-defined middlewares run before each attempt, before the underlying
+	// *http.Request is built from the request's context
+	client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		req.SetContext(bearer.WithAttempt(req.Context(), req.Attempt))
+		return nil
+	})
+	return client
+}
@@ -0,0 +1,50 @@
+package restybearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstall(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("200 OK"))
+	}))
+	defer ts.Close()
+
+	var mutex sync.Mutex
+	var attempts []int
+	transport := bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		attempts = append(attempts, bearer.AttemptFromContext(req.Context()))
+		mutex.Unlock()
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	client := resty.New().
+		SetTransport(transport).
+		SetRetryCount(3).
+		SetRetryWaitTime(time.Millisecond).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			return resp.StatusCode() == http.StatusServiceUnavailable
+		})
+	Install(&bearer.Agent{}, client)
+
+	resp, err := client.R().Get(ts.URL)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode())
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+}
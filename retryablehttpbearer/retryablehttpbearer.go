@@ -0,0 +1,39 @@
+// Package retryablehttpbearer installs a Bearer agent into github.com/hashicorp/go-retryablehttp clients.
+//
+// go-retryablehttp retries requests above the http.RoundTripper layer, so
+// installing the agent as the transport of the underlying http.Client alone
+// would report every attempt as an independent call. Install also records the
+// attempt number of each request so that retries can be told apart.
+package retryablehttpbearer
+
+import (
+	"net/http"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// Install configures client to send its requests through agent, and returns client.
+// The transport already configured on client.HTTPClient, if any, is kept and used by the agent.
+// An existing RequestLogHook is preserved and still called before each attempt.
+func Install(agent *bearer.Agent, client *retryablehttp.Client) *retryablehttp.Client {
+	if client.HTTPClient == nil {
+		client.HTTPClient = &http.Client{}
+	}
+	if transport := client.HTTPClient.Transport; transport != nil {
+		client.HTTPClient.Transport = agent.Wrap(transport)
+	} else {
+		client.HTTPClient.Transport = agent
+	}
+
+	previous := client.RequestLogHook
+	client.RequestLogHook = func(logger retryablehttp.Logger, req *http.Request, retry int) {
+		// the hook receives the very *http.Request passed to the http.Client
+		// right after it returns, so its context can be updated in place
+		*req = *req.WithContext(bearer.WithAttempt(req.Context(), retry+1))
+		if previous != nil {
+			previous(logger, req, retry)
+		}
+	}
+	return client
+}
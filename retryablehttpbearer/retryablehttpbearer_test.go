@@ -0,0 +1,50 @@
+package retryablehttpbearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstall(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("200 OK"))
+	}))
+	defer ts.Close()
+
+	var mutex sync.Mutex
+	var attempts []int
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryWaitMin = time.Millisecond
+	client.RetryWaitMax = time.Millisecond
+	client.HTTPClient.Transport = bearer.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		attempts = append(attempts, bearer.AttemptFromContext(req.Context()))
+		mutex.Unlock()
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	hooked := 0
+	client.RequestLogHook = func(retryablehttp.Logger, *http.Request, int) { hooked++ }
+	Install(&bearer.Agent{}, client)
+
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+	assert.Equal(t, 3, hooked)
+}
@@ -0,0 +1,83 @@
+package bearer
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RetryAfterRule makes the agent comply with the Retry-After header of the
+// 429 and 503 responses of Host, or of any host if Host is empty: until the
+// provider's window passes, further requests to the host are delayed or fail
+// fast with ErrRetryAfter.
+type RetryAfterRule struct {
+	Host string
+
+	// If true, requests are delayed until the window passes, or their context
+	// is done. Otherwise, they fail fast.
+	Wait bool
+	// MaxWait bounds the delay of requests when Wait is set: requests that
+	// would be delayed longer fail fast. Unbounded if zero.
+	MaxWait time.Duration
+}
+
+// retryAfterRule returns the first of the agent's Retry-After rules matching req, or nil.
+func (a *Agent) retryAfterRule(req *http.Request) *RetryAfterRule {
+	for i, rule := range a.RetryAfter {
+		if matchRequest(req, rule.Host, "", "") {
+			return &a.RetryAfter[i]
+		}
+	}
+	return nil
+}
+
+// awaitRetryAfter delays req, or returns an error wrapping ErrRetryAfter,
+// if its host asked not to be retried before now.
+func (a *Agent) awaitRetryAfter(req *http.Request, now time.Time) error {
+	rule := a.retryAfterRule(req)
+	if rule == nil {
+		return nil
+	}
+	a.rateLimits.mutex.RLock()
+	until := a.rateLimits.retryAfter[canonicalHost(req.URL)]
+	a.rateLimits.mutex.RUnlock()
+	wait := until.Sub(now)
+	if wait <= 0 {
+		return nil
+	}
+
+	if !rule.Wait || (rule.MaxWait > 0 && wait > rule.MaxWait) {
+		return fmt.Errorf("%w until %s", ErrRetryAfter, until.Format(time.RFC3339))
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// observeRetryAfter records the window during which req's host asked not to
+// be retried, if resp is a 429 or 503 response with a Retry-After header.
+func (a *Agent) observeRetryAfter(req *http.Request, resp *http.Response, limit *RateLimit) {
+	if resp == nil || limit == nil || limit.RetryAfter.IsZero() {
+		return
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	if a.retryAfterRule(req) == nil {
+		return
+	}
+	host := canonicalHost(req.URL)
+	a.rateLimits.mutex.Lock()
+	defer a.rateLimits.mutex.Unlock()
+	if a.rateLimits.retryAfter == nil {
+		a.rateLimits.retryAfter = map[string]time.Time{}
+	}
+	if _, known := a.rateLimits.retryAfter[host]; known || len(a.rateLimits.retryAfter) < maxRateLimitHosts {
+		a.rateLimits.retryAfter[host] = limit.RetryAfter
+	}
+}
@@ -0,0 +1,73 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_RetryAfter(t *testing.T) {
+	calls := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		name     string
+		rule     RetryAfterRule
+		err      error
+		minDelay time.Duration
+	}{
+		{name: "fail fast", rule: RetryAfterRule{}, err: ErrRetryAfter},
+		{name: "wait", rule: RetryAfterRule{Wait: true}, minDelay: 500 * time.Millisecond},
+		{name: "max wait", rule: RetryAfterRule{Wait: true, MaxWait: time.Millisecond}, err: ErrRetryAfter},
+		{name: "other host", rule: RetryAfterRule{Host: "api.example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls = 0
+			agent := &Agent{RetryAfter: []RetryAfterRule{test.rule}}
+			client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+			resp, err := client.Get(api.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+			start := time.Now()
+			resp, err = client.Get(api.URL)
+			if test.err != nil {
+				assert.True(t, errors.Is(err, test.err), "%v", err)
+				assert.Equal(t, 1, calls)
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.True(t, time.Since(start) >= test.minDelay)
+		})
+	}
+}
+
+func TestAgent_AwaitRetryAfter_Context(t *testing.T) {
+	agent := &Agent{RetryAfter: []RetryAfterRule{{Wait: true}}}
+	now := time.Now()
+	agent.rateLimits.retryAfter = map[string]time.Time{"api.example.com": now.Add(time.Hour)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "http://api.example.com", nil).WithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, agent.awaitRetryAfter(req, now))
+	assert.NoError(t, agent.awaitRetryAfter(req, now.Add(2*time.Hour)))
+}
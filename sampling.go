@@ -0,0 +1,85 @@
+package bearer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// SamplingRule reduces the number of records of the requests to Host, or to
+// any host if Host is empty, without losing the interesting ones: failed
+// requests, error responses (4xx and 5xx), requests flagged by assertions or
+// blocking rules, and requests slower than SlowerThan are always reported,
+// while the others are reported at Rate.
+//
+// Requests carrying a trace (see Correlation) are kept or left out according
+// to their trace ID, so that the records of a distributed trace are
+// consistently kept or left out by the services using the same rate, as
+// OpenTelemetry's trace ID ratio based sampler does with spans.
+type SamplingRule struct {
+	Host string
+
+	// Rate is the fraction of the other requests reported, from 0 to 1.
+	Rate float64
+	// SlowerThan is the duration above which requests are always reported.
+	// Ignored if zero.
+	SlowerThan time.Duration
+}
+
+// samplingRule returns the first of the agent's sampling rules matching req, or nil.
+func (a *Agent) samplingRule(req *http.Request) *SamplingRule {
+	for i, rule := range a.Sampling {
+		if matchRequest(req, rule.Host, "", "") {
+			return &a.Sampling[i]
+		}
+	}
+	return nil
+}
+
+// sampledOut reports whether the record of req is left out by the sampling
+// rules, in which case it is counted in the agent's statistics and audited.
+func (a *Agent) sampledOut(req *http.Request, record *ReportLog) bool {
+	rule := a.samplingRule(req)
+	if rule == nil || keepRecord(rule, record) || sampleIn(record.TraceID, rule.Rate) {
+		return false
+	}
+	a.records.addSampledOut()
+	a.audit(AuditSampledOut, req, fmt.Sprintf("sampled at rate %g", rule.Rate))
+	return true
+}
+
+// keepRecord reports whether record is always reported under rule.
+func keepRecord(rule *SamplingRule, record *ReportLog) bool {
+	switch {
+	case record.ErrorCategory != "" || record.StatusCode >= 400:
+		return true
+	case len(record.Violations) > 0 || record.WouldBlock:
+		return true
+	case rule.SlowerThan > 0 && record.Duration > float64(rule.SlowerThan)/float64(time.Millisecond):
+		return true
+	default:
+		return false
+	}
+}
+
+// sampleIn decides whether to keep a request at rate, from its trace ID if
+// any, or randomly.
+func sampleIn(traceID string, rate float64) bool {
+	if traceID == "" {
+		return rand.Float64() < rate
+	}
+	// as OpenTelemetry, compare the last 63 bits of the ID to the rate
+	var value uint64
+	if id, err := hex.DecodeString(traceID); err == nil && len(id) == 16 {
+		value = binary.BigEndian.Uint64(id[8:]) >> 1
+	} else {
+		hash := fnv.New64a()
+		hash.Write([]byte(traceID))
+		value = hash.Sum64() >> 1
+	}
+	return value < uint64(rate*(1<<63))
+}
@@ -0,0 +1,74 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepRecord(t *testing.T) {
+	rule := &SamplingRule{SlowerThan: 100 * time.Millisecond}
+	assert.False(t, keepRecord(rule, &ReportLog{StatusCode: 200, Duration: 10}))
+	assert.True(t, keepRecord(rule, &ReportLog{StatusCode: 404, Duration: 10}), "client errors")
+	assert.True(t, keepRecord(rule, &ReportLog{StatusCode: 503, Duration: 10}), "server errors")
+	assert.True(t, keepRecord(rule, &ReportLog{ErrorCategory: "TIMEOUT"}), "failed requests")
+	assert.True(t, keepRecord(rule, &ReportLog{StatusCode: 200, Duration: 150}), "slow requests")
+	assert.True(t, keepRecord(rule, &ReportLog{StatusCode: 200, Violations: []string{"status"}}), "violations")
+	assert.False(t, keepRecord(&SamplingRule{}, &ReportLog{StatusCode: 200, Duration: 150}), "no latency threshold")
+}
+
+func TestAgent_Sampling(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, AuditLogSize: 10, Sampling: []SamplingRule{
+		{Host: "example.com", Rate: 1},
+		{Rate: 0},
+	}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for _, path := range []string{"/ok", "/ok", "/error"} {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	records := fake.Records()
+	require.Len(t, records, 1, "successes are left out")
+	assert.Equal(t, "/error", records[0].Path)
+	assert.Equal(t, 2, agent.Stats().RecordsSampledOut)
+	entries := agent.AuditLog()
+	require.Len(t, entries, 2, "sampled out records are audited")
+	assert.Equal(t, AuditSampledOut, entries[0].Decision)
+	assert.Equal(t, "/ok", entries[0].Path)
+	assert.Equal(t, "sampled at rate 0", entries[0].Reason)
+}
+
+func TestSampleIn(t *testing.T) {
+	assert.True(t, sampleIn("4bf92f3577b34da6a3ce929d0e0e4736", 1))
+	assert.False(t, sampleIn("4bf92f3577b34da6a3ce929d0e0e4736", 0))
+	// the last 8 bytes of the ID are 0xa3ce929d0e0e4736, i.e. 0.64 of 2^64
+	assert.False(t, sampleIn("4bf92f3577b34da6a3ce929d0e0e4736", 0.6))
+	assert.True(t, sampleIn("4bf92f3577b34da6a3ce929d0e0e4736", 0.7))
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		traceID := randomHex(16)
+		decision := sampleIn(traceID, 0.5)
+		for j := 0; j < 3; j++ {
+			require.Equal(t, decision, sampleIn(traceID, 0.5), "the decision is consistent for a trace")
+		}
+		if decision {
+			kept++
+		}
+	}
+	assert.InDelta(t, 500, kept, 100)
+	assert.Equal(t, sampleIn("not-hex", 0.5), sampleIn("not-hex", 0.5))
+}
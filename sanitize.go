@@ -1,14 +1,17 @@
 package bearer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"regexp"
 	"strings"
 )
 
 const (
-	defaultStripSensitiveKeys   = `(?i)^authorization$|^password$|^secret$|^passwd$|^api.?key$|^access.?token$|^auth.?token$|^credentials$|^mysql_pwd$|^stripetoken$|^card.?number.?$|^secret$|^client.?id$|^client.?secret$`
+	defaultStripSensitiveKeys   = `(?i)^authorization$|^password$|^secret$|^passwd$|^api.?key$|^access.?token$|^refresh.?token$|^id.?token$|^auth.?token$|^credentials$|^mysql_pwd$|^stripetoken$|^card.?number.?$|^secret$|^client.?id$|^client.?secret$|^x.amz.security.token$|^x.amz.signature$|^x.amz.credential$`
 	defaultStripSensitiveRegex  = `[a-zA-Z0-9]{1}[a-zA-Z0-9.!#$%&’*+=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9-]+(?:\\.[a-zA-Z0-9-]+)*|(?:\\d[ -]*?){13,16}`
 	defaultSensitivePlaceholder = `[FILTERED]`
 )
@@ -19,42 +22,144 @@ var (
 	// FIXME: remove globals
 )
 
-// sanitize prevents most of the credentials from being sent to Bearer
-func (r *reportLog) sanitize() error {
-	// sanitize headers
-	if r.RequestHeaders != nil {
-		for k, v := range r.RequestHeaders {
-			if sensitiveKeys.MatchString(k) {
-				r.RequestHeaders[k] = defaultSensitivePlaceholder
-			} else {
-				r.RequestHeaders[k] = sensitiveValues.ReplaceAllString(v, defaultSensitivePlaceholder)
-			}
+// Redaction is the way the values of sensitive keys are redacted.
+type Redaction int
+
+// Redactions of sensitive values.
+const (
+	// RedactMask replaces values with the placeholder of their rule.
+	RedactMask Redaction = iota
+	// RedactLast4 replaces values with the placeholder of their rule followed
+	// by their last 4 characters, e.g. "[FILTERED]4242". Values of 8
+	// characters or less are masked.
+	RedactLast4
+	// RedactHash replaces values with the beginning of their SHA-256 digest,
+	// e.g. "sha256:9f86d081884c7d65", so that equal values can be related.
+	// Values with few possibilities, such as card numbers, can be guessed
+	// back from their digest.
+	RedactHash
+	// RedactDrop removes the values from the record, along with their key.
+	RedactDrop
+)
+
+// SanitizeRule redacts the values of the headers, query parameters, and
+// fields of JSON and form bodies whose name matches Keys.
+type SanitizeRule struct {
+	Keys      *regexp.Regexp
+	Redaction Redaction
+	// Placeholder replaces the values masked by RedactMask and RedactLast4,
+	// "[FILTERED]" if empty.
+	Placeholder string
+}
+
+// defaultSanitizeRule masks the values of the keys which are sensitive by
+// default.
+var defaultSanitizeRule = SanitizeRule{Keys: sensitiveKeys}
+
+// redact returns the redacted value, and false if it must be dropped.
+func (rule *SanitizeRule) redact(value string) (string, bool) {
+	placeholder := rule.Placeholder
+	if placeholder == "" {
+		placeholder = defaultSensitivePlaceholder
+	}
+	switch rule.Redaction {
+	case RedactLast4:
+		if runes := []rune(value); len(runes) > 8 {
+			return placeholder + string(runes[len(runes)-4:]), true
 		}
+		return placeholder, true
+	case RedactHash:
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:8]), true
+	case RedactDrop:
+		return "", false
+	default:
+		return placeholder, true
 	}
-	if r.ResponseHeaders != nil {
-		for k, v := range r.ResponseHeaders {
-			if sensitiveKeys.MatchString(k) {
-				r.ResponseHeaders[k] = defaultSensitivePlaceholder
-			} else {
-				r.ResponseHeaders[k] = sensitiveValues.ReplaceAllString(v, defaultSensitivePlaceholder)
-			}
+}
+
+// sanitizer redacts the values of sensitive keys, with the first of its
+// rules matching them or else the default one.
+type sanitizer struct {
+	rules []SanitizeRule
+	// redacted is the number of values redacted without the default
+	// placeholder, e.g. JWTs summarized, which filteredValues doesn't count.
+	redacted int
+}
+
+// rule returns the rule redacting the values of key, nil if they aren't
+// sensitive.
+func (s *sanitizer) rule(key string) *SanitizeRule {
+	for i := range s.rules {
+		if s.rules[i].Keys != nil && s.rules[i].Keys.MatchString(key) {
+			return &s.rules[i]
 		}
 	}
+	if sensitiveKeys.MatchString(key) {
+		return &defaultSanitizeRule
+	}
+	return nil
+}
+
+// redactValues redacts values in place with rule, and returns false if
+// they must be dropped. Values made of a JWT are summarized rather than
+// masked by the default rule, so that authentication remains debuggable.
+func (s *sanitizer) redactValues(rule *SanitizeRule, values []string) bool {
+	for idx := range values {
+		if rule == &defaultSanitizeRule && jwtValue.MatchString(values[idx]) {
+			values[idx] = s.sanitizeValue(values[idx])
+			continue
+		}
+		value, keep := rule.redact(values[idx])
+		if !keep {
+			s.redacted += len(values)
+			return false
+		}
+		if !strings.Contains(value, defaultSensitivePlaceholder) {
+			s.redacted++
+		}
+		values[idx] = value
+	}
+	return true
+}
+
+// sanitizeValue returns value with its JWTs summarized, and the values which
+// look sensitive, e.g. emails, filtered.
+func (s *sanitizer) sanitizeValue(value string) string {
+	value, jwts := replaceJWTs(value)
+	s.redacted += jwts
+	return sensitiveValues.ReplaceAllString(value, defaultSensitivePlaceholder)
+}
+
+// sanitize prevents most of the credentials from being sent to Bearer. The
+// values of sensitive keys are redacted by the first of rules matching them,
+// or else masked. It returns the number of values redacted without the
+// default placeholder.
+func (r *ReportLog) sanitize(rules []SanitizeRule) (int, error) {
+	s := &sanitizer{rules: rules}
+
+	// sanitize headers
+	s.sanitizeHeaders(r.RequestHeaders)
+	s.sanitizeHeaders(r.ResponseHeaders)
+
+	r.ErrorMessage = s.sanitizeValue(r.ErrorMessage)
 
 	// sanitize URL & query
 	if r.URL != "" {
-		r.URL = sensitiveValues.ReplaceAllString(r.URL, defaultSensitivePlaceholder)
-		r.Path = sensitiveValues.ReplaceAllString(r.Path, defaultSensitivePlaceholder)
+		// the values of the query are counted once, with r.Query
+		urlSanitizer := &sanitizer{rules: rules}
+		r.URL = urlSanitizer.sanitizeValue(r.URL)
+		r.Path = urlSanitizer.sanitizeValue(r.Path)
 		u, err := url.Parse(r.URL)
 		if err != nil {
-			return err
+			return s.redacted, err
 		}
 		changed := false
 		queries := u.Query()
 		for k, values := range queries {
-			if sensitiveKeys.MatchString(k) {
-				for idx := range values {
-					values[idx] = defaultSensitivePlaceholder
+			if rule := urlSanitizer.rule(k); rule != nil {
+				if !urlSanitizer.redactValues(rule, values) {
+					delete(queries, k)
 				}
 				changed = true
 			}
@@ -65,26 +170,58 @@ func (r *reportLog) sanitize() error {
 		}
 	}
 
+	for k, values := range r.Query {
+		if rule := s.rule(k); rule != nil {
+			if !s.redactValues(rule, values) {
+				delete(r.Query, k)
+			}
+			continue
+		}
+		for idx := range values {
+			values[idx] = s.sanitizeValue(values[idx])
+		}
+	}
+
 	// sanitize bodies
 	if r.RequestBody != "" && strings.HasPrefix(r.RequestContentType(), "application/json") {
-		body, err := sanitizeJSON(r.RequestBody)
+		body, err := s.sanitizeJSON(r.RequestBody)
 		if err != nil {
-			return err
+			return s.redacted, err
 		}
 		r.RequestBody = body
 	}
 	if r.ResponseBody != "" && strings.HasPrefix(r.ResponseContentType(), "application/json") {
-		body, err := sanitizeJSON(r.ResponseBody)
+		body, err := s.sanitizeJSON(r.ResponseBody)
 		if err != nil {
-			return err
+			return s.redacted, err
 		}
 		r.ResponseBody = body
 	}
+	if r.RequestBody != "" && strings.HasPrefix(r.RequestContentType(), "application/x-www-form-urlencoded") {
+		r.RequestBody = s.sanitizeForm(r.RequestBody)
+	}
+	if r.ResponseBody != "" && strings.HasPrefix(r.ResponseContentType(), "application/x-www-form-urlencoded") {
+		r.ResponseBody = s.sanitizeForm(r.ResponseBody)
+	}
 
-	return nil
+	return s.redacted, nil
 }
 
-func sanitizeJSON(input string) (string, error) {
+func (s *sanitizer) sanitizeHeaders(headers map[string][]string) {
+	for k, values := range headers {
+		if rule := s.rule(k); rule != nil {
+			if !s.redactValues(rule, values) {
+				delete(headers, k)
+			}
+			continue
+		}
+		for idx, v := range values {
+			values[idx] = s.sanitizeValue(v)
+		}
+	}
+}
+
+func (s *sanitizer) sanitizeJSON(input string) (string, error) {
 	var obj map[string]interface{}
 	if err := json.Unmarshal([]byte(input), &obj); err != nil {
 		// json cannot unmarshal to the map[string]interface{} destination
@@ -93,12 +230,20 @@ func sanitizeJSON(input string) (string, error) {
 	}
 
 	for k, v := range obj {
-		if sensitiveKeys.MatchString(k) {
-			obj[k] = defaultSensitivePlaceholder
+		if rule := s.rule(k); rule != nil {
+			value := []string{fmt.Sprint(v)}
+			if t, ok := v.(string); ok {
+				value[0] = t
+			}
+			if s.redactValues(rule, value) {
+				obj[k] = value[0]
+			} else {
+				delete(obj, k)
+			}
 		} else {
 			switch t := v.(type) {
 			case string:
-				obj[k] = sensitiveValues.ReplaceAllString(t, defaultSensitivePlaceholder)
+				obj[k] = s.sanitizeValue(t)
 				// FIXME: support nested maps
 			}
 		}
@@ -110,3 +255,24 @@ func sanitizeJSON(input string) (string, error) {
 	}
 	return string(out), nil
 }
+
+func (s *sanitizer) sanitizeForm(input string) string {
+	values, err := url.ParseQuery(input)
+	if err != nil {
+		// we cannot check for key/values
+		return s.sanitizeValue(input)
+	}
+
+	for k, v := range values {
+		if rule := s.rule(k); rule != nil {
+			if !s.redactValues(rule, v) {
+				delete(values, k)
+			}
+			continue
+		}
+		for idx := range v {
+			v[idx] = s.sanitizeValue(v[idx])
+		}
+	}
+	return values.Encode()
+}
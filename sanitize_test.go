@@ -3,6 +3,7 @@ package bearer
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"testing"
 	"time"
 
@@ -11,7 +12,7 @@ import (
 )
 
 func TestSanitize(t *testing.T) {
-	saneReport := reportLog{
+	saneReport := ReportLog{
 		Protocol:        "https",
 		Path:            "/sample",
 		Hostname:        "api.example.com",
@@ -21,57 +22,61 @@ func TestSanitize(t *testing.T) {
 		Type:            "REQUEST_END",
 		StatusCode:      200,
 		URL:             "http://api.example.com/sample",
-		RequestHeaders:  map[string]string{"Accept": "application/json"},
+		RequestHeaders:  map[string][]string{"Accept": {"application/json"}},
 		RequestBody:     `{"body":"data"}`,
-		ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+		ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
 		ResponseBody:    `{"ok":true}`,
 		// instrumentation: ,
 	}
 
 	var tests = []struct {
-		input          reportLog
-		expectedOutput reportLog
+		input          ReportLog
+		expectedOutput ReportLog
 		expectedErr    error
 	}{
 		{saneReport, saneReport, nil},
-		{reportLog{RequestHeaders: map[string]string{"authorization": "hello"}}, reportLog{RequestHeaders: map[string]string{"authorization": "[FILTERED]"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Authorization": "hello"}}, reportLog{RequestHeaders: map[string]string{"Authorization": "[FILTERED]"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"AutHorizAtion": "hello"}}, reportLog{RequestHeaders: map[string]string{"AutHorizAtion": "[FILTERED]"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Authorization2": "hello"}}, reportLog{RequestHeaders: map[string]string{"Authorization2": "hello"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"2Authorization": "hello"}}, reportLog{RequestHeaders: map[string]string{"2Authorization": "hello"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Blah": "hello"}}, reportLog{RequestHeaders: map[string]string{"Blah": "hello"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Blah": "contact@example.com"}}, reportLog{RequestHeaders: map[string]string{"Blah": "[FILTERED].com"}}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Blah": "aaa bbb@ccc ddd eee@fff.ggg hhh"}}, reportLog{RequestHeaders: map[string]string{"Blah": "aaa [FILTERED] ddd [FILTERED].ggg hhh"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"authorization": "hello"}}, reportLog{ResponseHeaders: map[string]string{"authorization": "[FILTERED]"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"Authorization": "hello"}}, reportLog{ResponseHeaders: map[string]string{"Authorization": "[FILTERED]"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"AutHorizAtion": "hello"}}, reportLog{ResponseHeaders: map[string]string{"AutHorizAtion": "[FILTERED]"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"Authorization2": "hello"}}, reportLog{ResponseHeaders: map[string]string{"Authorization2": "hello"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"2Authorization": "hello"}}, reportLog{ResponseHeaders: map[string]string{"2Authorization": "hello"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"Blah": "hello"}}, reportLog{ResponseHeaders: map[string]string{"Blah": "hello"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"Blah": "contact@example.com"}}, reportLog{ResponseHeaders: map[string]string{"Blah": "[FILTERED].com"}}, nil},
-		{reportLog{ResponseHeaders: map[string]string{"Blah": "aaa bbb@ccc ddd eee@fff.ggg hhh"}}, reportLog{ResponseHeaders: map[string]string{"Blah": "aaa [FILTERED] ddd [FILTERED].ggg hhh"}}, nil},
-		{reportLog{URL: "http://api.example.com/blah/blih?bluh=bloh&blouh=blanh"}, reportLog{URL: "http://api.example.com/blah/blih?bluh=bloh&blouh=blanh"}, nil},
-		{reportLog{URL: "http://api.example.com/blah/blih?bluh=Authorization&authorization=blanh"}, reportLog{URL: ""}, nil},
-		{reportLog{URL: "http://api.example.com/email/contact@example.org"}, reportLog{URL: "http://api.example.com/email/[FILTERED].org"}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `{"authorization":"blah"}`}, reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `{"authorization":"[FILTERED]"}`}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json; charset=utf-8"}, RequestBody: `{"authorization":"blah"}`}, reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json; charset=utf-8"}, RequestBody: `{"authorization":"[FILTERED]"}`}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `[42]`}, reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `[42]`}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `42`}, reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `42`}, nil},
-		{reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `{}`}, reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `{}`}, nil},
-		// FIXME: {reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `{"a":{"authorization":"blah"}}`}, reportLog{RequestHeaders: map[string]string{"Content-Type": "application/json"}, RequestBody: `{"a":{"authorization}:"[FILTERED]"}`}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"authorization": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"authorization": {"[FILTERED]"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Authorization": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"Authorization": {"[FILTERED]"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"AutHorizAtion": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"AutHorizAtion": {"[FILTERED]"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Authorization2": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"Authorization2": {"hello"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"2Authorization": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"2Authorization": {"hello"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Blah": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"Blah": {"hello"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Blah": {"contact@example.com"}}}, ReportLog{RequestHeaders: map[string][]string{"Blah": {"[FILTERED].com"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Blah": {"aaa bbb@ccc ddd eee@fff.ggg hhh"}}}, ReportLog{RequestHeaders: map[string][]string{"Blah": {"aaa [FILTERED] ddd [FILTERED].ggg hhh"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"authorization": {"hello"}}}, ReportLog{ResponseHeaders: map[string][]string{"authorization": {"[FILTERED]"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"Authorization": {"hello"}}}, ReportLog{ResponseHeaders: map[string][]string{"Authorization": {"[FILTERED]"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"AutHorizAtion": {"hello"}}}, ReportLog{ResponseHeaders: map[string][]string{"AutHorizAtion": {"[FILTERED]"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"Authorization2": {"hello"}}}, ReportLog{ResponseHeaders: map[string][]string{"Authorization2": {"hello"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"2Authorization": {"hello"}}}, ReportLog{ResponseHeaders: map[string][]string{"2Authorization": {"hello"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"Blah": {"hello"}}}, ReportLog{ResponseHeaders: map[string][]string{"Blah": {"hello"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"Blah": {"contact@example.com"}}}, ReportLog{ResponseHeaders: map[string][]string{"Blah": {"[FILTERED].com"}}}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"Blah": {"aaa bbb@ccc ddd eee@fff.ggg hhh"}}}, ReportLog{ResponseHeaders: map[string][]string{"Blah": {"aaa [FILTERED] ddd [FILTERED].ggg hhh"}}}, nil},
+		{ReportLog{URL: "http://api.example.com/blah/blih?bluh=bloh&blouh=blanh"}, ReportLog{URL: "http://api.example.com/blah/blih?bluh=bloh&blouh=blanh"}, nil},
+		{ReportLog{URL: "http://api.example.com/blah/blih?bluh=Authorization&authorization=blanh"}, ReportLog{URL: ""}, nil},
+		{ReportLog{Query: url.Values{"access_token": {"blah"}, "email": {"contact@example.org"}, "page": {"2"}}}, ReportLog{Query: url.Values{"access_token": {"[FILTERED]"}, "email": {"[FILTERED].org"}, "page": {"2"}}}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"X-Amz-Security-Token": {"hello"}}}, ReportLog{RequestHeaders: map[string][]string{"X-Amz-Security-Token": {"[FILTERED]"}}}, nil},
+		{ReportLog{URL: "http://api.example.com/email/contact@example.org"}, ReportLog{URL: "http://api.example.com/email/[FILTERED].org"}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `{"authorization":"blah"}`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `{"authorization":"[FILTERED]"}`}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json; charset=utf-8"}}, RequestBody: `{"authorization":"blah"}`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json; charset=utf-8"}}, RequestBody: `{"authorization":"[FILTERED]"}`}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/x-www-form-urlencoded"}}, RequestBody: `client_id=blah&client_secret=blih&grant_type=client_credentials`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/x-www-form-urlencoded"}}, RequestBody: `client_id=%5BFILTERED%5D&client_secret=%5BFILTERED%5D&grant_type=client_credentials`}, nil},
+		{ReportLog{ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}}, ResponseBody: `{"refresh_token":"blah"}`}, ReportLog{ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}}, ResponseBody: `{"refresh_token":"[FILTERED]"}`}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `[42]`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `[42]`}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `42`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `42`}, nil},
+		{ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `{}`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `{}`}, nil},
+		// FIXME: {ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `{"a":{"authorization":"blah"}}`}, ReportLog{RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: `{"a":{"authorization}:"[FILTERED]"}`}, nil},
 	}
 	i := 0
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			err := test.input.sanitize()
+			_, err := test.input.sanitize(nil)
 			require.NoError(t, err)
-			checkSamereportLogs(t, test.expectedOutput, test.input)
+			checkSameReportLogs(t, test.expectedOutput, test.input)
 		})
 		i++
 	}
 }
 
-func checkSamereportLogs(t *testing.T, a, b reportLog) {
+func checkSameReportLogs(t *testing.T, a, b ReportLog) {
 	t.Helper()
 
 	assert.Equal(t, a.Protocol, b.Protocol)
@@ -96,3 +101,38 @@ func checkSamereportLogs(t *testing.T, a, b reportLog) {
 	assert.Equal(t, a.ResponseHeaders, b.ResponseHeaders)
 	assert.Equal(t, a.ResponseBody, b.ResponseBody)
 }
+
+func TestSanitize_Rules(t *testing.T) {
+	rules := []SanitizeRule{
+		{Keys: regexp.MustCompile(`(?i)^card.?number$`), Redaction: RedactLast4, Placeholder: "****"},
+		{Keys: regexp.MustCompile(`(?i)^x-user-id$|^user_id$`), Redaction: RedactHash},
+		{Keys: regexp.MustCompile(`(?i)^x-session$|^session$`), Redaction: RedactDrop},
+		{Keys: regexp.MustCompile(`(?i)^x-internal$`), Placeholder: "<redacted>"},
+	}
+	record := ReportLog{
+		URL:   "http://api.example.com/pay?session=abc&user_id=42&page=2",
+		Query: url.Values{"session": {"abc"}, "user_id": {"42"}, "page": {"2"}},
+		RequestHeaders: map[string][]string{
+			"Content-Type":  {"application/json"},
+			"Authorization": {"Bearer token"},
+			"X-User-Id":     {"42"},
+			"X-Session":     {"abc"},
+			"X-Internal":    {"secret"},
+		},
+		RequestBody: `{"cardNumber":"4242424242424242","amount":10}`,
+	}
+
+	redacted, err := record.sanitize(rules)
+	require.NoError(t, err)
+	hash := "sha256:73475cb40a568e8d"
+	assert.Equal(t, "http://api.example.com/pay?page=2&user_id="+url.QueryEscape(hash), record.URL)
+	assert.Equal(t, url.Values{"user_id": {hash}, "page": {"2"}}, record.Query)
+	assert.Equal(t, map[string][]string{
+		"Content-Type":  {"application/json"},
+		"Authorization": {"[FILTERED]"},
+		"X-User-Id":     {hash},
+		"X-Internal":    {"<redacted>"},
+	}, record.RequestHeaders)
+	assert.Equal(t, `{"amount":10,"cardNumber":"****4242"}`, record.RequestBody)
+	assert.Equal(t, 6, redacted, "values redacted without the default placeholder")
+}
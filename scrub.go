@@ -0,0 +1,72 @@
+package bearer
+
+import (
+	"regexp"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Scrubber replaces the matches of a regular expression in the bodies of
+// records, e.g. the secrets of formats specific to an organization.
+type Scrubber struct {
+	// Pattern is the regular expression of the scrubbed values, e.g.
+	// `acme_[0-9a-f]{32}`.
+	Pattern string `json:"pattern"`
+	// Replacement replaces the matches of Pattern, expanded as in
+	// regexp.Regexp.ReplaceAllString: "$1" is the first submatch. Matches
+	// are replaced with "[FILTERED]" if empty.
+	Replacement string `json:"replacement,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// compile compiles the pattern of the scrubber. A scrubber with an invalid
+// pattern scrubs nothing.
+func (s *Scrubber) compile() error {
+	var err error
+	s.pattern, err = regexp.Compile(s.Pattern)
+	return err
+}
+
+// scrub returns value with the matches of the scrubber replaced.
+func (s *Scrubber) scrub(value string) string {
+	if s.pattern == nil || value == "" {
+		return value
+	}
+	replacement := s.Replacement
+	if replacement == "" {
+		replacement = defaultSensitivePlaceholder
+	}
+	return s.pattern.ReplaceAllString(value, replacement)
+}
+
+// scrubbers holds the compiled Agent.Scrubbers.
+type scrubbers struct {
+	once     sync.Once
+	compiled []Scrubber
+}
+
+// compileScrubbers compiles scrubbers, logging the invalid ones.
+func (a *Agent) compileScrubbers(scrubbers []Scrubber) {
+	for i := range scrubbers {
+		if err := scrubbers[i].compile(); err != nil {
+			a.logger().Warn("compile scrubber", zap.String("pattern", scrubbers[i].Pattern), zap.Error(err))
+		}
+	}
+}
+
+// scrub applies the scrubbers of the agent, then the ones of config, to the
+// bodies of record.
+func (a *Agent) scrub(config *Config, record *ReportLog) {
+	a.scrubbers.once.Do(func() {
+		a.scrubbers.compiled = append([]Scrubber(nil), a.Scrubbers...)
+		a.compileScrubbers(a.scrubbers.compiled)
+	})
+	for _, scrubbers := range [][]Scrubber{a.scrubbers.compiled, config.Scrubbers} {
+		for i := range scrubbers {
+			record.RequestBody = scrubbers[i].scrub(record.RequestBody)
+			record.ResponseBody = scrubbers[i].scrub(record.ResponseBody)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Scrubbers(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("key acme_0123456789abcdef, account ACC-1234-5678"))
+	}))
+	defer api.Close()
+	fake := newFakeBearer(`{"scrubbers":[{"pattern":"ACC-(\\d+)-\\d+","replacement":"ACC-$1-****"},{"pattern":"("}]}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, Scrubbers: []Scrubber{
+		{Pattern: `acme_[0-9a-f]{16}`},
+	}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	resp, err := client.Post(api.URL, "text/plain", strings.NewReader("token acme_fedcba9876543210"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	record := fake.next(t)
+	assert.Equal(t, "token [FILTERED]", record.RequestBody)
+	assert.Equal(t, "key [FILTERED], account ACC-1234-****", record.ResponseBody)
+}
@@ -0,0 +1,129 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SecretScan is the way the agent deals with likely secrets, e.g. API keys,
+// in the bodies of records.
+type SecretScan int
+
+// Secret scans.
+const (
+	// SecretScanOff doesn't look for secrets.
+	SecretScanOff SecretScan = iota
+	// SecretScanFlag reports a FindingSecret security finding for each body
+	// holding likely secrets, which are left in the body.
+	SecretScanFlag
+	// SecretScanRedact reports findings like SecretScanFlag, and replaces
+	// the secrets with "[FILTERED]".
+	SecretScanRedact
+)
+
+const (
+	// minSecretLength is the length of the shortest secrets detected.
+	minSecretLength = 20
+	// minSecretEntropy is the Shannon entropy per character, in bits, of
+	// the strings detected as secrets. Random base62 strings of 20
+	// characters have about 4.1 bits per character, English words or
+	// hexadecimal digests less than 4.
+	minSecretEntropy = 4.0
+)
+
+var (
+	// secretCandidate matches the strings which may be secrets: long runs of
+	// the characters of base64 and of usual token formats.
+	secretCandidate = regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`)
+	hasLetter       = regexp.MustCompile(`[A-Za-z]`)
+	hasDigit        = regexp.MustCompile(`[0-9]`)
+)
+
+// SecretDetection describes the likely secrets found in a body.
+type SecretDetection struct {
+	// Location is "requestBody" or "responseBody".
+	Location string `json:"location"`
+	Count    int    `json:"count"`
+	// Fingerprints are the beginnings of the SHA-256 digests of the secrets,
+	// to relate the detections of a same secret.
+	Fingerprints []string `json:"fingerprints"`
+	Redacted     bool     `json:"redacted,omitempty"`
+}
+
+// entropy returns the Shannon entropy of s, in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	var h float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// isLikelySecret reports whether s looks like a secret: long, random and
+// mixing letters and digits.
+func isLikelySecret(s string) bool {
+	return len(s) >= minSecretLength && hasLetter.MatchString(s) && hasDigit.MatchString(s) && entropy(s) >= minSecretEntropy
+}
+
+// scanSecrets returns body with its likely secrets filtered if redact is
+// set, and the detection of its secrets, nil if it has none.
+func scanSecrets(location, body string, redact bool) (string, *SecretDetection) {
+	var detection *SecretDetection
+	scanned := secretCandidate.ReplaceAllStringFunc(body, func(candidate string) string {
+		if !isLikelySecret(strings.TrimRight(candidate, "=")) {
+			return candidate
+		}
+		if detection == nil {
+			detection = &SecretDetection{Location: location, Redacted: redact}
+		}
+		detection.Count++
+		sum := sha256.Sum256([]byte(candidate))
+		detection.Fingerprints = append(detection.Fingerprints, hex.EncodeToString(sum[:8]))
+		if redact {
+			return defaultSensitivePlaceholder
+		}
+		return candidate
+	})
+	return scanned, detection
+}
+
+// scanSecrets looks for likely secrets in the bodies of record, reporting a
+// security finding for each body holding some.
+func (a *Agent) scanSecrets(record *ReportLog) {
+	if a.SecretScan == SecretScanOff {
+		return
+	}
+	redact := a.SecretScan == SecretScanRedact
+	var detections []*SecretDetection
+	var detection *SecretDetection
+	if record.RequestBody, detection = scanSecrets("requestBody", record.RequestBody, redact); detection != nil {
+		detections = append(detections, detection)
+	}
+	if record.ResponseBody, detection = scanSecrets("responseBody", record.ResponseBody, redact); detection != nil {
+		detections = append(detections, detection)
+	}
+	for _, detection := range detections {
+		a.logger().Warn("secret detected", zap.String("host", record.Hostname), zap.String("location", detection.Location), zap.Int("count", detection.Count))
+		a.reportFinding(*record, SecurityFinding{
+			Kind:    FindingSecret,
+			Host:    record.Hostname,
+			Message: fmt.Sprintf("%d likely secrets in %s", detection.Count, detection.Location),
+			Time:    time.Now(),
+			Secret:  detection,
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package bearer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// certificateExpiryWarning is how long before their expiry certificates are
+// reported as expiring.
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// maxFindings bounds the number of kinds and hosts whose findings are
+// tracked. The findings of further hosts aren't reported.
+const maxFindings = 10000
+
+// FindingKind is the kind of a security finding.
+type FindingKind string
+
+// Kinds of security findings.
+const (
+	// FindingSecret is found when likely secrets are in the bodies of a
+	// request, with SecretScan.
+	FindingSecret FindingKind = "secret_detected"
+	// FindingWeakTLS is found when a host negotiates a version of TLS below
+	// 1.2.
+	FindingWeakTLS FindingKind = "weak_tls"
+	// FindingCleartextHTTP is found when an external host is called over
+	// HTTP rather than HTTPS.
+	FindingCleartextHTTP FindingKind = "cleartext_http"
+	// FindingCertificateExpiring is found when the certificate of a host
+	// expires within 30 days.
+	FindingCertificateExpiring FindingKind = "certificate_expiring"
+	// FindingCertificatePin is found when the certificates of a host don't
+	// match its pins in CertificatePins.
+	FindingCertificatePin FindingKind = "certificate_pin_mismatch"
+)
+
+// SecurityFinding describes a security problem found by the agent, reported
+// in SECURITY_FINDING records rather than with the records of requests.
+type SecurityFinding struct {
+	Kind FindingKind `json:"kind"`
+	Host string      `json:"host"`
+	// Message describes the finding, e.g. the version of TLS negotiated.
+	Message string    `json:"message"`
+	Time    time.Time `json:"-"`
+	// Secret describes the secrets of FindingSecret findings.
+	Secret *SecretDetection `json:"secret,omitempty"`
+}
+
+// findingKey identifies the findings reported once per host.
+type findingKey struct {
+	kind FindingKind
+	host string
+}
+
+// findingTracker tracks the findings reported once per host.
+type findingTracker struct {
+	mutex    sync.Mutex
+	reported map[findingKey]bool
+}
+
+// first reports whether key wasn't reported yet, and tracks it, unless too
+// many findings are tracked already.
+func (t *findingTracker) first(key findingKey) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.reported[key] || len(t.reported) >= maxFindings {
+		return false
+	}
+	if t.reported == nil {
+		t.reported = map[findingKey]bool{}
+	}
+	t.reported[key] = true
+	return true
+}
+
+// observeSecurity reports the security findings of a request, completed
+// with resp or failed with err, once per kind and host.
+func (a *Agent) observeSecurity(req *http.Request, resp *http.Response, err error) {
+	host := urlHostname(req.URL)
+	now := time.Now()
+	if errors.Is(err, ErrCertificatePin) {
+		a.findOnce(req, SecurityFinding{Kind: FindingCertificatePin, Host: host, Message: "certificates not matching the pins of the host", Time: now})
+	}
+	if !a.SecurityFindings || resp == nil {
+		return
+	}
+	if req.URL.Scheme == "http" && a.hostClass(req.URL) == HostExternal {
+		a.findOnce(req, SecurityFinding{Kind: FindingCleartextHTTP, Host: host, Message: "request over cleartext HTTP", Time: now})
+	}
+	if resp.TLS == nil {
+		return
+	}
+	if resp.TLS.Version < tls.VersionTLS12 {
+		a.findOnce(req, SecurityFinding{Kind: FindingWeakTLS, Host: host, Message: fmt.Sprintf("%s negotiated", tlsVersionName(resp.TLS.Version)), Time: now})
+	}
+	if certs := resp.TLS.PeerCertificates; len(certs) > 0 && certs[0].NotAfter.Sub(now) < certificateExpiryWarning {
+		a.findOnce(req, SecurityFinding{Kind: FindingCertificateExpiring, Host: host, Message: "certificate expires on " + certs[0].NotAfter.UTC().Format(time.RFC3339), Time: now})
+	}
+}
+
+// tlsVersionName returns the name of a version of TLS, e.g. "TLS 1.0".
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionSSL30:
+		return "SSL 3.0"
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS version %#04x", version)
+}
+
+// findOnce reports finding, unless a finding of its kind was already
+// reported for its host.
+func (a *Agent) findOnce(req *http.Request, finding SecurityFinding) {
+	if !a.findings.first(findingKey{finding.Kind, finding.Host}) {
+		return
+	}
+	a.reportFinding(ReportLog{
+		Protocol:  req.URL.Scheme,
+		Hostname:  urlHostname(req.URL),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Endpoint:  EndpointFromContext(req.Context()),
+		HostClass: a.hostClass(req.URL),
+	}, finding)
+}
+
+// reportFinding passes finding to SecurityCallbacks, and reports it in a
+// SECURITY_FINDING record describing the request of record.
+func (a *Agent) reportFinding(record ReportLog, finding SecurityFinding) {
+	a.goWorker(func() {
+		defer a.recoverPanic()
+		for _, callback := range a.SecurityCallbacks {
+			callback(finding)
+		}
+	})
+	at := int(finding.Time.UnixNano() / 1000000)
+	a.report(a.context(), ReportLog{
+		Type:      recordTypeSecurityFinding,
+		Protocol:  record.Protocol,
+		Hostname:  record.Hostname,
+		Method:    record.Method,
+		Path:      record.Path,
+		Endpoint:  record.Endpoint,
+		HostClass: record.HostClass,
+		API:       record.API,
+		StartedAt: at,
+		EndedAt:   at,
+		Finding:   &finding,
+	})
+}
@@ -0,0 +1,96 @@
+package bearer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_SecurityFindings(t *testing.T) {
+	var out bytes.Buffer
+	var mutex sync.Mutex
+	var findings []SecurityFinding
+	agent := &Agent{ReportWriter: &out, SyncReporting: true, SecurityFindings: true, SecurityCallbacks: []func(SecurityFinding){
+		func(finding SecurityFinding) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			findings = append(findings, finding)
+		},
+	}}
+	defer agent.Close()
+	cleartext, _ := http.NewRequest("GET", "http://api.example.com/users", nil)
+	internal, _ := http.NewRequest("GET", "http://users.svc/users", nil)
+	weak, _ := http.NewRequest("GET", "https://legacy.example.com/users", nil)
+	weakResp := &http.Response{StatusCode: 200, TLS: &tls.ConnectionState{
+		Version:          tls.VersionTLS10,
+		PeerCertificates: []*x509.Certificate{{NotAfter: time.Now().Add(24 * time.Hour)}},
+	}}
+	for i := 0; i < 2; i++ {
+		agent.observeSecurity(cleartext, &http.Response{StatusCode: 200}, nil)
+		agent.observeSecurity(internal, &http.Response{StatusCode: 200}, nil)
+		agent.observeSecurity(weak, weakResp, nil)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3, "findings are reported once per kind and host")
+	var kinds []FindingKind
+	for _, line := range lines {
+		var record ReportLog
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, recordTypeSecurityFinding, record.Type)
+		require.NotNil(t, record.Finding)
+		kinds = append(kinds, record.Finding.Kind)
+	}
+	assert.Equal(t, []FindingKind{FindingCleartextHTTP, FindingWeakTLS, FindingCertificateExpiring}, kinds)
+	require.NoError(t, agent.Flush())
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(findings) == 3
+	}, time.Second, time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, finding := range findings {
+		if finding.Kind == FindingWeakTLS {
+			assert.Equal(t, "legacy.example.com", finding.Host)
+			assert.Equal(t, "TLS 1.0 negotiated", finding.Message)
+		}
+	}
+}
+
+func TestAgent_SecurityFindings_normalizedHost(t *testing.T) {
+	var out bytes.Buffer
+	agent := &Agent{ReportWriter: &out, SyncReporting: true, SecurityFindings: true}
+	defer agent.Close()
+	for _, rawurl := range []string{"http://api.example.com/users", "http://API.example.com./users", "http://api.example.com:80/users"} {
+		req, _ := http.NewRequest("GET", rawurl, nil)
+		agent.observeSecurity(req, &http.Response{StatusCode: 200}, nil)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 1, "findings are reported once per normalized host")
+	var record ReportLog
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	require.NotNil(t, record.Finding)
+	assert.Equal(t, "api.example.com", record.Finding.Host)
+}
+
+func TestFindingTracker_bounded(t *testing.T) {
+	var tracker findingTracker
+	for i := 0; i < maxFindings; i++ {
+		require.True(t, tracker.first(findingKey{FindingWeakTLS, strconv.Itoa(i)}))
+	}
+	assert.False(t, tracker.first(findingKey{FindingWeakTLS, "0"}))
+	assert.False(t, tracker.first(findingKey{FindingWeakTLS, "api.example.com"}), "further findings aren't tracked")
+	assert.Len(t, tracker.reported, maxFindings)
+}
@@ -0,0 +1,35 @@
+package bearer
+
+import (
+	"path"
+	"runtime/debug"
+)
+
+// serviceIdentity identifies the application in records, so that the
+// traffic of accounts shared by several services can be attributed.
+type serviceIdentity struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	// Module is the path of the application's main module.
+	Module string `json:"module,omitempty"`
+}
+
+// newServiceIdentity returns the identity of the application, named after
+// its main module if name is empty, and versioned by it if version is.
+func newServiceIdentity(name, version string, buildInfo *debug.BuildInfo, ok bool) *serviceIdentity {
+	service := &serviceIdentity{Name: name, Version: version}
+	if ok && buildInfo.Main.Path != "" {
+		service.Module = buildInfo.Main.Path
+		if service.Name == "" {
+			service.Name = path.Base(buildInfo.Main.Path)
+		}
+		// binaries built from a local checkout have no module version
+		if service.Version == "" && buildInfo.Main.Version != "(devel)" {
+			service.Version = buildInfo.Main.Version
+		}
+	}
+	if *service == (serviceIdentity{}) {
+		return nil
+	}
+	return service
+}
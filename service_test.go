@@ -0,0 +1,33 @@
+package bearer
+
+import (
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServiceIdentity(t *testing.T) {
+	buildInfo := &debug.BuildInfo{Main: debug.Module{Path: "github.com/acme/payments", Version: "v1.4.0"}}
+	assert.Equal(t, &serviceIdentity{Name: "payments", Version: "v1.4.0", Module: "github.com/acme/payments"},
+		newServiceIdentity("", "", buildInfo, true))
+	assert.Equal(t, &serviceIdentity{Name: "checkout", Version: "2020.1", Module: "github.com/acme/payments"},
+		newServiceIdentity("checkout", "2020.1", buildInfo, true), "the settings prevail")
+
+	devel := &debug.BuildInfo{Main: debug.Module{Path: "github.com/acme/payments", Version: "(devel)"}}
+	assert.Equal(t, &serviceIdentity{Name: "payments", Module: "github.com/acme/payments"}, newServiceIdentity("", "", devel, true))
+
+	assert.Equal(t, &serviceIdentity{Name: "checkout"}, newServiceIdentity("checkout", "", nil, false))
+	assert.Nil(t, newServiceIdentity("", "", nil, false), "no identity without build info")
+}
+
+func TestAgent_ServiceName(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, ServiceName: "checkout", ServiceVersion: "1.2.3"}
+	defer agent.Close()
+	agent.reportHeartbeat(time.Now(), time.Now())
+	record := fake.next(t)
+	assert.Equal(t, "checkout", record.Service.Name)
+	assert.Equal(t, "1.2.3", record.Service.Version)
+}
@@ -0,0 +1,296 @@
+package bearer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxShadowDifferences bounds the number of differences listed per response.
+const maxShadowDifferences = 20
+
+// ShadowRule duplicates the requests matching all of its non-empty
+// conditions to BaseURL, e.g. a new version of an API, and compares the
+// responses. Conditions are the same as BlockRule's.
+//
+// Shadow requests are sent in the background with the headers of the
+// original requests, including their credentials, and their responses are
+// never returned to the application. Only shadow requests which are safe to
+// send twice should be configured.
+type ShadowRule struct {
+	Host   string
+	Method string
+	Path   string
+
+	// BaseURL replaces the scheme and host of the requests, and prefixes their path.
+	BaseURL string
+}
+
+// ShadowDiff describes the differences between the response to a request
+// and the response to its shadow.
+type ShadowDiff struct {
+	Request          *http.Request
+	ShadowURL        string
+	StatusCode       int
+	ShadowStatusCode int
+	// Differences describe how the responses differ. They name the differing
+	// fields of JSON bodies but don't quote their values.
+	Differences []string
+	// Err is the error returned by the shadow request, if any.
+	Err error
+}
+
+// shadowRule returns the first of the agent's shadow rules matching req, or nil.
+func (a *Agent) shadowRule(req *http.Request) *ShadowRule {
+	for i, rule := range a.Shadows {
+		if matchRequest(req, rule.Host, rule.Method, rule.Path) {
+			return &a.Shadows[i]
+		}
+	}
+	return nil
+}
+
+// shadow sends a copy of req to the base URL of rule in the background, and
+// compares its response with resp once the application read or closed the
+// body of resp, which is held up to MaxBodySize bytes as it is read. The
+// copy is sent with transport, the one wrapped with Wrap, or else with the
+// transport of its own host: the TLS configuration, address or pins of req's
+// host don't apply to it.
+func (a *Agent) shadow(rule *ShadowRule, transport http.RoundTripper, req *http.Request, reqBody []byte, resp *http.Response) {
+	shadowURL, err := shadowURL(rule.BaseURL, req.URL)
+	if err != nil {
+		a.logger().Warn("invalid shadow base URL", zap.String("baseURL", rule.BaseURL), zap.Error(err))
+		return
+	}
+	// the shadow request must outlive the original one
+	shadowReq := req.Clone(a.context())
+	shadowReq.URL = shadowURL
+	shadowReq.Host = ""
+	if reqBody != nil {
+		shadowReq.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	if transport == nil {
+		transport = a.hostTransport(shadowReq)
+	}
+
+	read := make(chan shadowedBody, 1)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		read <- shadowedBody{data: []byte{}, digest: bodyDigest(nil)}
+	} else {
+		body := &digestingBody{ReadCloser: resp.Body, body: a.newBoundedBody()}
+		body.onDone(func(size int64, data []byte, digest string) {
+			if data != nil {
+				digest = bodyDigest(data)
+			}
+			read <- shadowedBody{data: data, digest: digest}
+		})
+		resp.Body = body
+	}
+	a.background.mutex.Lock()
+	stopped := a.stopped()
+	a.background.mutex.Unlock()
+
+	a.goWorker(func() {
+		defer a.recoverPanic()
+		diff := ShadowDiff{Request: req, ShadowURL: shadowURL.String(), StatusCode: resp.StatusCode}
+		shadowResp, err := transport.RoundTrip(shadowReq)
+		var shadowBody shadowedBody
+		if err == nil {
+			shadowBody, err = a.readShadowBody(shadowResp)
+			if err != nil {
+				err = fmt.Errorf("read shadow response: %w", err)
+			}
+		}
+		var body shadowedBody
+		select {
+		case body = <-read:
+		case <-stopped:
+			return
+		case <-a.context().Done():
+			return
+		}
+		if err != nil {
+			diff.Err = err
+			diff.Differences = []string{fmt.Sprintf("shadow request failed: %v", err)}
+		} else {
+			diff.ShadowStatusCode = shadowResp.StatusCode
+			diff.Differences = diffResponses(resp, body, shadowResp, shadowBody)
+		}
+		if len(diff.Differences) == 0 {
+			return
+		}
+		for i, difference := range diff.Differences {
+			// errors may quote URLs
+			diff.Differences[i] = sensitiveValues.ReplaceAllString(difference, defaultSensitivePlaceholder)
+		}
+
+		if a.OnShadowDiff != nil {
+			a.OnShadowDiff(diff)
+		}
+		if a.isAvailable() {
+			a.report(a.context(), ReportLog{
+				Type:        recordTypeShadowDiff,
+				Protocol:    req.URL.Scheme,
+				Hostname:    urlHostname(req.URL),
+				Method:      req.Method,
+				Path:        req.URL.Path,
+				URL:         withoutUserinfo(normalizeURL(req.URL)).String(),
+				ShadowURL:   redactedURL(shadowURL),
+				StatusCode:  resp.StatusCode,
+				Endpoint:    EndpointFromContext(req.Context()),
+				Differences: diff.Differences,
+			})
+		}
+	})
+}
+
+// shadowedBody is a response body compared with its shadow's. Data holds the
+// body if it was read entirely without exceeding MaxBodySize, and digest its
+// SHA-256 digest if it was read entirely.
+type shadowedBody struct {
+	data   []byte
+	digest string
+}
+
+// readShadowBody reads the body of the response to a shadow request, holding
+// up to MaxBodySize bytes of it.
+func (a *Agent) readShadowBody(resp *http.Response) (shadowedBody, error) {
+	defer resp.Body.Close()
+	body := a.newBoundedBody()
+	if _, err := io.Copy(body, resp.Body); err != nil {
+		return shadowedBody{}, err
+	}
+	digest := hex.EncodeToString(body.hash.Sum(nil))
+	if body.size > int64(body.buf.Len()) {
+		return shadowedBody{digest: digest}, nil
+	}
+	return shadowedBody{data: append([]byte{}, body.buf.Bytes()...), digest: digest}, nil
+}
+
+// shadowURL returns u with the scheme and host of base, and its path prefixed by base's.
+func shadowURL(base string, u *url.URL) (*url.URL, error) {
+	ret, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Scheme == "" || ret.Host == "" {
+		return nil, fmt.Errorf("missing scheme or host")
+	}
+	ret.Path = strings.TrimSuffix(ret.Path, "/") + u.Path
+	ret.RawPath = ""
+	ret.RawQuery = u.RawQuery
+	return ret, nil
+}
+
+// diffResponses returns the differences between two responses. Bodies are
+// compared by digest if either wasn't held entirely, and not at all if the
+// application closed the body of resp before its end.
+func diffResponses(resp *http.Response, body shadowedBody, shadowResp *http.Response, shadowBody shadowedBody) []string {
+	var differences []string
+	if resp.StatusCode != shadowResp.StatusCode {
+		differences = append(differences, fmt.Sprintf("status %d != %d", resp.StatusCode, shadowResp.StatusCode))
+	}
+	contentType, shadowContentType := resp.Header.Get("Content-Type"), shadowResp.Header.Get("Content-Type")
+	if contentType != shadowContentType {
+		differences = append(differences, fmt.Sprintf("content type %q != %q", contentType, shadowContentType))
+	}
+
+	var value, shadowValue interface{}
+	switch {
+	case body.digest == "":
+	case body.data != nil && shadowBody.data != nil && json.Unmarshal(body.data, &value) == nil && json.Unmarshal(shadowBody.data, &shadowValue) == nil:
+		diffJSON("", value, shadowValue, &differences)
+	case body.digest != shadowBody.digest:
+		differences = append(differences, "body differs")
+	}
+	if len(differences) > maxShadowDifferences {
+		differences = append(differences[:maxShadowDifferences], "...")
+	}
+	return differences
+}
+
+// diffJSON appends to differences the paths at which a and b differ.
+func diffJSON(path string, a, b interface{}, differences *[]string) {
+	if len(*differences) > maxShadowDifferences {
+		return
+	}
+	name := path
+	if name == "" {
+		name = "body"
+	}
+	typeA, typeB := jsonType(a), jsonType(b)
+	if typeA != typeB {
+		*differences = append(*differences, fmt.Sprintf("%s: %s != %s", name, typeA, typeB))
+		return
+	}
+
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b := b.(map[string]interface{})
+		keys := make([]string, 0, len(a)+len(b))
+		for key := range a {
+			keys = append(keys, key)
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			valueA, okA := a[key]
+			valueB, okB := b[key]
+			switch {
+			case !okB:
+				*differences = append(*differences, fmt.Sprintf("%s: missing from shadow", child))
+			case !okA:
+				*differences = append(*differences, fmt.Sprintf("%s: only in shadow", child))
+			default:
+				diffJSON(child, valueA, valueB, differences)
+			}
+		}
+	case []interface{}:
+		b := b.([]interface{})
+		if len(a) != len(b) {
+			*differences = append(*differences, fmt.Sprintf("%s: %d != %d items", name, len(a), len(b)))
+			return
+		}
+		for i := range a {
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), a[i], b[i], differences)
+		}
+	default:
+		if a != b {
+			*differences = append(*differences, fmt.Sprintf("%s: value differs", name))
+		}
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
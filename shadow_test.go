@@ -0,0 +1,230 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Shadows(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":42,"name":"blah","tags":["a"]}`))
+	}))
+	defer primary.Close()
+	var shadowBody string
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		shadowBody = req.URL.Path + " " + string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"42","tags":["a"],"email":"blah@example.com"}`))
+	}))
+	defer secondary.Close()
+
+	fake := newFakeBearer(`{}`)
+	diffs := make(chan ShadowDiff, 1)
+	agent := &Agent{
+		SecretKey:    "sk_test",
+		Shadows:      []ShadowRule{{Path: "/users", BaseURL: secondary.URL + "/v2/"}},
+		OnShadowDiff: func(diff ShadowDiff) { diffs <- diff },
+	}
+	agent.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "config.bearer.sh" || req.URL.Host == "agent.bearer.sh" {
+			return fake.RoundTrip(req)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := &http.Client{Transport: agent}
+
+	resp, err := client.Post(primary.URL+"/users", "application/json", strings.NewReader(`{"name":"blah"}`))
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, `{"id":42,"name":"blah","tags":["a"]}`, string(body), "primary response unaffected")
+
+	select {
+	case diff := <-diffs:
+		assert.Equal(t, secondary.URL+"/v2/users", diff.ShadowURL)
+		assert.Equal(t, []string{
+			"email: only in shadow",
+			"id: number != string",
+			"name: missing from shadow",
+		}, diff.Differences)
+		assert.NoError(t, diff.Err)
+	case <-time.After(time.Second):
+		t.Fatal("no shadow diff")
+	}
+	assert.Equal(t, `/v2/users {"name":"blah"}`, shadowBody)
+
+	var types []string
+	for i := 0; i < 2; i++ {
+		record := fake.next(t)
+		types = append(types, record.Type)
+		if record.Type == recordTypeShadowDiff {
+			assert.Equal(t, "/users", record.Path)
+			assert.Len(t, record.Differences, 3)
+		}
+	}
+	assert.ElementsMatch(t, []string{recordTypeRequestEnd, recordTypeShadowDiff}, types)
+}
+
+func TestShadowURL(t *testing.T) {
+	u, _ := url.Parse("http://api.example.com/users/42?page=1")
+	ret, err := shadowURL("https://v2.example.com/api", u)
+	require.NoError(t, err)
+	assert.Equal(t, "https://v2.example.com/api/users/42?page=1", ret.String())
+
+	_, err = shadowURL("v2.example.com", u)
+	assert.Error(t, err)
+}
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		a, b     interface{}
+		expected []string
+	}{
+		{a: map[string]interface{}{"id": 1.0}, b: map[string]interface{}{"id": 1.0}},
+		{a: map[string]interface{}{"id": 1.0}, b: map[string]interface{}{"id": 2.0}, expected: []string{"id: value differs"}},
+		{a: []interface{}{1.0}, b: []interface{}{1.0, 2.0}, expected: []string{"body: 1 != 2 items"}},
+		{a: map[string]interface{}{"data": []interface{}{true}}, b: map[string]interface{}{"data": []interface{}{nil}}, expected: []string{"data[0]: boolean != null"}},
+	}
+	for _, test := range tests {
+		var differences []string
+		diffJSON("", test.a, test.b, &differences)
+		assert.Equal(t, test.expected, differences)
+	}
+}
+
+func TestAgent_Shadows_hostTransport(t *testing.T) {
+	var primaryHits, shadowHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&shadowHits, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer secondary.Close()
+
+	fake := newFakeBearer(`{}`)
+	diffs := make(chan ShadowDiff, 1)
+	agent := &Agent{
+		SecretKey:     "sk_test",
+		HostAddresses: map[string]string{"api.example.com": primary.Listener.Addr().String()},
+		Shadows:       []ShadowRule{{Host: "api.example.com", BaseURL: secondary.URL}},
+		OnShadowDiff:  func(diff ShadowDiff) { diffs <- diff },
+	}
+	agent.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "config.bearer.sh" || req.URL.Host == "agent.bearer.sh" {
+			return fake.RoundTrip(req)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := &http.Client{Transport: agent}
+
+	resp, err := client.Post("http://api.example.com/orders", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// the shadow request isn't sent to the address overriding the primary host's
+	select {
+	case diff := <-diffs:
+		assert.NoError(t, diff.Err)
+		assert.Equal(t, http.StatusCreated, diff.ShadowStatusCode)
+	case <-time.After(time.Second):
+		t.Fatal("no shadow diff")
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&primaryHits))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&shadowHits))
+}
+
+func TestAgent_Shadows_streamed(t *testing.T) {
+	release := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/truncated" {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte(`{"id":`))
+			return
+		}
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":43}`))
+	}))
+	defer secondary.Close()
+
+	fake := newFakeBearer(`{}`)
+	diffs := make(chan ShadowDiff, 1)
+	agent := &Agent{
+		SecretKey:    "sk_test",
+		MaxBodySize:  50,
+		Shadows:      []ShadowRule{{BaseURL: secondary.URL}},
+		OnShadowDiff: func(diff ShadowDiff) { diffs <- diff },
+	}
+	agent.Transport = RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "config.bearer.sh" || req.URL.Host == "agent.bearer.sh" {
+			return fake.RoundTrip(req)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := &http.Client{Transport: agent}
+	u, _ := url.Parse(primary.URL + "/users")
+	u.User = url.UserPassword("user", "secret")
+
+	done := make(chan *http.Response)
+	go func() {
+		resp, err := client.Get(u.String())
+		assert.NoError(t, err)
+		done <- resp
+	}()
+	var resp *http.Response
+	select {
+	case resp = <-done:
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("the primary response is returned before its body is received")
+	}
+	select {
+	case <-diffs:
+		t.Fatal("responses are compared once the body is read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, `{"id":42}`, string(body))
+
+	select {
+	case diff := <-diffs:
+		assert.Equal(t, []string{"id: value differs"}, diff.Differences)
+	case <-time.After(time.Second):
+		t.Fatal("no shadow diff")
+	}
+	for i := 0; i < 2; i++ {
+		if record := fake.next(t); record.Type == recordTypeShadowDiff {
+			assert.Equal(t, primary.URL+"/users", record.URL, "credentials are removed")
+		}
+	}
+
+	resp, err = client.Get(primary.URL + "/truncated")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Error(t, err, "read errors are returned to the application")
+}
@@ -0,0 +1,72 @@
+package bearer
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultShutdownTimeout is the time for which the agent sends its pending
+// records on shutdown, within the 10s grace period of Cloud Run and Cloud
+// Functions.
+const defaultShutdownTimeout = 8 * time.Second
+
+// CloseOnSignal closes the agent, sending the records reported so far, once
+// the process receives one of signals, by default SIGTERM and SIGINT, e.g.
+// when a Cloud Run or Cloud Functions instance shuts down. Closing gives up
+// after timeout, by default 8s, then the signal is raised again so that the
+// application, or the default action, handles it. Call stop to stop
+// watching for the signals.
+func (a *Agent) CloseOnSignal(timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(done)
+		})
+	}
+
+	// not a worker of the agent, which closing waits for
+	go func() {
+		select {
+		case sig := <-received:
+			a.logger().Info("closing on signal", zap.Stringer("signal", sig))
+			a.closeWithin(timeout)
+			stop()
+			if process, err := os.FindProcess(os.Getpid()); err == nil {
+				process.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+	return stop
+}
+
+// closeWithin closes the agent, or gives up after timeout.
+func (a *Agent) closeWithin(timeout time.Duration) {
+	closed := make(chan struct{})
+	go func() {
+		a.Close()
+		close(closed)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-closed:
+	case <-timer.C:
+		a.logger().Warn("records not sent before shutdown", zap.Duration("timeout", timeout))
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_CloseOnSignal(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, RefreshConfigEvery: time.Hour, BatchMaxAge: time.Hour}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// the application's own handler, so that the signal doesn't terminate the test
+	application := make(chan os.Signal, 2)
+	signal.Notify(application, syscall.SIGUSR1)
+	defer signal.Stop(application)
+	stop := agent.CloseOnSignal(time.Second, syscall.SIGUSR1)
+	defer stop()
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	<-application
+	select {
+	case <-application:
+	case <-time.After(time.Second):
+		require.FailNow(t, "signal not raised again")
+	}
+	assert.Len(t, fake.Records(), 1, "records are sent before the signal is raised again")
+	assert.Zero(t, agent.Workers())
+}
@@ -0,0 +1,79 @@
+package bearer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signer signs requests before they are sent, e.g. by setting signature headers.
+type Signer interface {
+	// Sign signs req, whose body has the content of body, at now.
+	Sign(req *http.Request, body []byte, now time.Time) error
+}
+
+// HMACSigner signs requests with an HMAC of their timestamp and body,
+// separated by a dot, as e.g. "1584190800.{"id":42}".
+type HMACSigner struct {
+	Secret []byte
+	// Hash is the hash function of the HMAC. If empty, will use SHA-256 as default.
+	Hash func() hash.Hash
+	// SignatureHeader holds the hex-encoded HMAC, after SignaturePrefix.
+	// If empty, will use "X-Signature" as default.
+	SignatureHeader string
+	SignaturePrefix string
+	// TimestampHeader holds the Unix time of the signature.
+	// If empty, will use "X-Timestamp" as default.
+	TimestampHeader string
+}
+
+// Sign implements the Signer interface
+func (s *HMACSigner) Sign(req *http.Request, body []byte, now time.Time) error {
+	newHash := s.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	signatureHeader := s.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = "X-Signature"
+	}
+	timestampHeader := s.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(newHash, s.Secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(signatureHeader, s.SignaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// signer returns the signer of req's host, or nil.
+func (a *Agent) signer(req *http.Request) Signer {
+	if len(a.Signers) == 0 {
+		return nil
+	}
+	for _, key := range hostKeys(req.URL) {
+		if signer, ok := a.Signers[key]; ok {
+			return signer
+		}
+	}
+	return nil
+}
+
+// sign returns a copy of req signed by signer.
+func sign(signer Signer, req *http.Request, body []byte) (*http.Request, error) {
+	req = req.Clone(req.Context())
+	if err := signer.Sign(req, body, time.Now()); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -0,0 +1,98 @@
+package bearer
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACSigner_Sign(t *testing.T) {
+	now := time.Unix(1584190800, 0)
+	expected := func(newHash func() hash.Hash) string {
+		mac := hmac.New(newHash, []byte("secret"))
+		mac.Write([]byte(`1584190800.{"id":42}`))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name            string
+		signer          *HMACSigner
+		signatureHeader string
+		timestampHeader string
+		signature       string
+	}{
+		{
+			name:            "defaults",
+			signer:          &HMACSigner{Secret: []byte("secret")},
+			signatureHeader: "X-Signature",
+			timestampHeader: "X-Timestamp",
+			signature:       expected(sha256.New),
+		},
+		{
+			name:            "custom",
+			signer:          &HMACSigner{Secret: []byte("secret"), Hash: sha1.New, SignatureHeader: "X-Hub-Signature", SignaturePrefix: "sha1=", TimestampHeader: "X-Hub-Timestamp"},
+			signatureHeader: "X-Hub-Signature",
+			timestampHeader: "X-Hub-Timestamp",
+			signature:       "sha1=" + expected(sha1.New),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://api.example.com", nil)
+			require.NoError(t, test.signer.Sign(req, []byte(`{"id":42}`), now))
+			assert.Equal(t, "1584190800", req.Header.Get(test.timestampHeader))
+			assert.Equal(t, test.signature, req.Header.Get(test.signatureHeader))
+		})
+	}
+}
+
+type signerFunc func(req *http.Request, body []byte, now time.Time) error
+
+func (f signerFunc) Sign(req *http.Request, body []byte, now time.Time) error {
+	return f(req, body, now)
+}
+
+func TestAgent_Signers(t *testing.T) {
+	var signature, body string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		signature = req.Header.Get("X-Signature")
+		raw, _ := ioutil.ReadAll(req.Body)
+		body = string(raw)
+	}))
+	defer api.Close()
+
+	agent := &Agent{Signers: map[string]Signer{
+		"127.0.0.1": signerFunc(func(req *http.Request, body []byte, now time.Time) error {
+			req.Header.Set("X-Signature", strings.ToUpper(string(body)))
+			return nil
+		}),
+		"api.example.com": signerFunc(func(req *http.Request, body []byte, now time.Time) error {
+			return errors.New("no key")
+		}),
+	}}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	req, err := http.NewRequest("POST", api.URL, strings.NewReader("hello"))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "HELLO", signature)
+	assert.Equal(t, "hello", body)
+	assert.Empty(t, req.Header.Get("X-Signature"), "original request is left untouched")
+
+	_, err = client.Post("http://api.example.com", "text/plain", strings.NewReader("hello"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+// Package slackbearer posts the alerts raised by the agent to a Slack
+// channel, through an incoming webhook:
+//
+//	notifier := &slackbearer.Notifier{WebhookURL: os.Getenv("SLACK_WEBHOOK_URL")}
+//	agent.AlertCallbacks = append(agent.AlertCallbacks, notifier.Notify)
+package slackbearer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+)
+
+// defaultTimeout is the timeout of the requests of notifiers without Client.
+const defaultTimeout = 10 * time.Second
+
+// Notifier posts alerts to a Slack incoming webhook.
+type Notifier struct {
+	// WebhookURL is the URL of the incoming webhook, e.g.
+	// https://hooks.slack.com/services/T000/B000/XXXX.
+	WebhookURL string
+	// Client performs the requests. If nil, a client with a 10s timeout is used.
+	Client *http.Client
+	// If set, OnError is called with the errors of Notify.
+	OnError func(error)
+}
+
+// Notify posts alert, and reports errors to OnError. It can be appended to
+// the agent's AlertCallbacks.
+func (n *Notifier) Notify(alert bearer.Alert) {
+	if err := n.Send(context.Background(), alert); err != nil && n.OnError != nil {
+		n.OnError(err)
+	}
+}
+
+// Send posts alert.
+func (n *Notifier) Send(ctx context.Context, alert bearer.Alert) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{":rotating_light: " + alert.String()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("slackbearer: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("slackbearer: post alert: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slackbearer: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package slackbearer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier(t *testing.T) {
+	var text string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(req.Body).Decode(&body)
+		text = body.Text
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	notifier := &Notifier{WebhookURL: ts.URL}
+	alert := bearer.Alert{Kind: bearer.AlertError, Host: "api.stripe.com", Message: "status 503", Suppressed: 3}
+	require.NoError(t, notifier.Send(context.Background(), alert))
+	assert.Equal(t, ":rotating_light: error on api.stripe.com: status 503 (3 similar alerts suppressed)", text)
+
+	status = http.StatusForbidden
+	var errs []error
+	notifier.OnError = func(err error) { errs = append(errs, err) }
+	notifier.Notify(alert)
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "slackbearer: unexpected status 403")
+}
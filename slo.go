@@ -0,0 +1,251 @@
+package bearer
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultSLOWindow is the rolling window of SLOs without a Window.
+	defaultSLOWindow = time.Hour
+	// maxSLOSamples bounds the number of requests kept per SLO.
+	maxSLOSamples = 10000
+)
+
+// SLO is a service level objective for the requests matching all of its
+// non-empty conditions. Conditions are the same as BlockRule's, and Endpoint
+// is matched against the endpoint set with WithEndpoint.
+//
+// A request fails if the transport returns an error or its status is 5xx.
+type SLO struct {
+	// Name identifies the SLO in Stats and summary records.
+	// If empty, it is made of the SLO's conditions.
+	Name string
+
+	Host     string
+	Method   string
+	Path     string
+	Endpoint string
+
+	// Availability is the minimum percentage of successful requests, e.g. 99.9.
+	// It isn't checked if zero.
+	Availability float64
+	// LatencyP95 is the maximum 95th percentile latency. It isn't checked if zero.
+	LatencyP95 time.Duration
+	// Window is the rolling period over which compliance is computed.
+	// If empty, will use 1h as default.
+	Window time.Duration
+}
+
+// SLOStatus is the compliance of the requests of the rolling window of an SLO.
+type SLOStatus struct {
+	SLO      SLO
+	Requests int
+	Failures int
+	// Availability is the observed percentage of successful requests, 100
+	// if there weren't any requests.
+	Availability float64
+	LatencyP95   time.Duration
+	Compliant    bool
+}
+
+// Stats is a snapshot of the statistics computed locally by an agent.
+type Stats struct {
+	SLOs   []SLOStatus
+	Quotas []QuotaStatus
+	// APIs are the usage of the named APIs (see Agent.APINames).
+	APIs []APIStatus
+	// Panics is the number of panics recovered from the agent's code.
+	Panics int
+	// RecordsSent and RecordsDropped are the numbers of records sent to
+	// Bearer, and of records which failed to be sent.
+	RecordsSent    int
+	RecordsDropped int
+	// RecordsSampledOut is the number of records left out by sampling rules.
+	RecordsSampledOut int
+	// CaptureLevel is the detail of records, "full", "headers" or
+	// "metadata", as adjusted to OverheadBudget, and OverheadP99 the 99th
+	// percentile of the overhead on which it was last adjusted.
+	CaptureLevel string
+	OverheadP99  time.Duration
+	// Volumes are the volumes of the data exchanged with each host.
+	Volumes []HostVolume
+}
+
+// Stats returns a snapshot of the agent's statistics.
+func (a *Agent) Stats() Stats {
+	now := time.Now()
+	sent, dropped := a.records.get()
+	return Stats{
+		SLOs:              a.sloStatuses(now),
+		Quotas:            a.quotaStatuses(a.config(), now),
+		APIs:              a.apiStatuses(),
+		Panics:            int(atomic.LoadInt32(&a.panics)),
+		RecordsSent:       sent,
+		RecordsDropped:    dropped,
+		RecordsSampledOut: a.records.sampledOutCount(),
+		CaptureLevel:      a.captureLevel().String(),
+		OverheadP99:       a.overheadP99(),
+		Volumes:           a.volumes.volumes(),
+	}
+}
+
+func (s SLO) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	var parts []string
+	for _, part := range []string{s.Method, s.Host, s.Path, s.Endpoint} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s SLO) window() time.Duration {
+	if s.Window > 0 {
+		return s.Window
+	}
+	return defaultSLOWindow
+}
+
+func (s SLO) matches(req *http.Request) bool {
+	if s.Endpoint != "" && !matchWildcard(s.Endpoint, EndpointFromContext(req.Context())) {
+		return false
+	}
+	return matchRequest(req, s.Host, s.Method, s.Path)
+}
+
+type sloSample struct {
+	at       time.Time
+	duration time.Duration
+	failed   bool
+}
+
+// sloTracker holds the samples of the agent's SLOs, in the same order.
+type sloTracker struct {
+	mutex   sync.Mutex
+	samples [][]sloSample
+	summary sync.Once
+}
+
+// observeSLOs records a request in the samples of the SLOs it matches.
+func (a *Agent) observeSLOs(req *http.Request, start, end time.Time, resp *http.Response, err error) {
+	if len(a.SLOs) == 0 || (a.IgnoreCanceled && callerCanceled(req, err)) {
+		return
+	}
+	if a.SLOSummaryEvery > 0 && a.isAvailable() {
+		a.slos.summary.Do(func() { a.goWorker(a.reportSLOSummaries) })
+	}
+
+	sample := sloSample{at: end, duration: end.Sub(start), failed: err != nil || resp == nil || resp.StatusCode >= 500}
+	a.slos.mutex.Lock()
+	defer a.slos.mutex.Unlock()
+	if len(a.slos.samples) != len(a.SLOs) {
+		a.slos.samples = make([][]sloSample, len(a.SLOs))
+	}
+	for i, slo := range a.SLOs {
+		if !slo.matches(req) {
+			continue
+		}
+		samples := append(pruneSamples(a.slos.samples[i], end.Add(-slo.window())), sample)
+		if len(samples) > maxSLOSamples {
+			samples = samples[len(samples)-maxSLOSamples:]
+		}
+		a.slos.samples[i] = samples
+	}
+}
+
+// sloStatuses returns the compliance of the agent's SLOs at now.
+func (a *Agent) sloStatuses(now time.Time) []SLOStatus {
+	if len(a.SLOs) == 0 {
+		return nil
+	}
+	a.slos.mutex.Lock()
+	defer a.slos.mutex.Unlock()
+	if len(a.slos.samples) != len(a.SLOs) {
+		a.slos.samples = make([][]sloSample, len(a.SLOs))
+	}
+
+	statuses := make([]SLOStatus, len(a.SLOs))
+	for i, slo := range a.SLOs {
+		samples := pruneSamples(a.slos.samples[i], now.Add(-slo.window()))
+		a.slos.samples[i] = samples
+		statuses[i] = computeSLOStatus(slo, samples)
+	}
+	return statuses
+}
+
+func computeSLOStatus(slo SLO, samples []sloSample) SLOStatus {
+	status := SLOStatus{SLO: slo, Requests: len(samples), Availability: 100}
+	if len(samples) == 0 {
+		status.Compliant = true
+		return status
+	}
+
+	durations := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		durations[i] = sample.duration
+		if sample.failed {
+			status.Failures++
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	status.LatencyP95 = durations[int(math.Ceil(0.95*float64(len(durations))))-1]
+	status.Availability = 100 * float64(status.Requests-status.Failures) / float64(status.Requests)
+	status.Compliant = (slo.Availability == 0 || status.Availability >= slo.Availability) &&
+		(slo.LatencyP95 == 0 || status.LatencyP95 <= slo.LatencyP95)
+	return status
+}
+
+// pruneSamples drops the samples before since, which are sorted by time.
+func pruneSamples(samples []sloSample, since time.Time) []sloSample {
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].at.Before(since) })
+	return samples[i:]
+}
+
+// reportSLOSummaries reports the compliance of the agent's SLOs regularly.
+func (a *Agent) reportSLOSummaries() {
+	defer a.recoverPanic()
+	for a.sleep(a.SLOSummaryEvery) {
+		now := time.Now()
+		for _, status := range a.sloStatuses(now) {
+			a.report(a.context(), ReportLog{
+				Type:      recordTypeSLOSummary,
+				Hostname:  status.SLO.Host,
+				Method:    status.SLO.Method,
+				Path:      status.SLO.Path,
+				Endpoint:  status.SLO.Endpoint,
+				StartedAt: int(now.Add(-status.SLO.window()).UnixNano() / 1000000),
+				EndedAt:   int(now.UnixNano() / 1000000),
+				SLO: &sloSummary{
+					Name:         status.SLO.name(),
+					Requests:     status.Requests,
+					Failures:     status.Failures,
+					Availability: status.Availability,
+					LatencyP95:   int(status.LatencyP95 / time.Millisecond),
+					Compliant:    status.Compliant,
+				},
+			})
+		}
+	}
+}
+
+// sloSummary is the compliance of an SLO in summary records.
+type sloSummary struct {
+	Name         string  `json:"name"`
+	Requests     int     `json:"requests"`
+	Failures     int     `json:"failures"`
+	Availability float64 `json:"availability"`
+	LatencyP95   int     `json:"latencyP95"`
+	Compliant    bool    `json:"compliant"`
+}
@@ -0,0 +1,84 @@
+package bearer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Stats(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer api.Close()
+
+	agent := &Agent{SLOs: []SLO{
+		{Name: "api", Availability: 90},
+		{Path: "/ok", Availability: 99.9},
+		{Path: "/never"},
+	}}
+	client := &http.Client{Transport: agent}
+	for _, path := range []string{"/ok", "/ok", "/ok", "/fail"} {
+		resp, err := client.Get(api.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	stats := agent.Stats()
+	require.Len(t, stats.SLOs, 3)
+	assert.Equal(t, 4, stats.SLOs[0].Requests)
+	assert.Equal(t, 1, stats.SLOs[0].Failures)
+	assert.Equal(t, 75.0, stats.SLOs[0].Availability)
+	assert.False(t, stats.SLOs[0].Compliant)
+	assert.Equal(t, 3, stats.SLOs[1].Requests)
+	assert.True(t, stats.SLOs[1].Compliant)
+	assert.Equal(t, 0, stats.SLOs[2].Requests)
+	assert.True(t, stats.SLOs[2].Compliant)
+}
+
+func TestComputeSLOStatus(t *testing.T) {
+	var samples []sloSample
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, sloSample{duration: time.Duration(i) * time.Millisecond, failed: i == 100})
+	}
+
+	status := computeSLOStatus(SLO{Availability: 99, LatencyP95: 95 * time.Millisecond}, samples)
+	assert.Equal(t, 95*time.Millisecond, status.LatencyP95)
+	assert.Equal(t, 99.0, status.Availability)
+	assert.True(t, status.Compliant)
+
+	status = computeSLOStatus(SLO{LatencyP95: 90 * time.Millisecond}, samples)
+	assert.False(t, status.Compliant)
+}
+
+func TestAgent_ObserveSLOs_Window(t *testing.T) {
+	agent := &Agent{SLOs: []SLO{{Window: time.Minute}}}
+	req := httptest.NewRequest("GET", "http://api.example.com", nil)
+	now := time.Now()
+	agent.observeSLOs(req, now.Add(-2*time.Minute), now.Add(-2*time.Minute), nil, errors.New("failed"))
+	agent.observeSLOs(req, now, now, &http.Response{StatusCode: 200}, nil)
+
+	statuses := agent.sloStatuses(now)
+	assert.Equal(t, 1, statuses[0].Requests)
+	assert.Equal(t, 0, statuses[0].Failures)
+}
+
+func TestAgent_SLOSummaryEvery(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SLOs: []SLO{{Name: "api"}}, SLOSummaryEvery: 10 * time.Millisecond}
+	agent.observeSLOs(httptest.NewRequest("GET", "http://api.example.com", nil), time.Now(), time.Now(), &http.Response{StatusCode: 200}, nil)
+
+	record := fake.next(t)
+	assert.Equal(t, recordTypeSLOSummary, record.Type)
+	require.NotNil(t, record.SLO)
+	assert.Equal(t, "api", record.SLO.Name)
+	assert.Equal(t, 1, record.SLO.Requests)
+	assert.True(t, record.SLO.Compliant)
+}
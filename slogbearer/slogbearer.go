@@ -0,0 +1,74 @@
+// Package slogbearer logs the records reported by the agent with log/slog,
+// making them visible in the pipelines already collecting the logs of the
+// application:
+//
+//	agent.OnRecord = slogbearer.Exporter{Logger: slog.Default()}.Export
+package slogbearer
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+
+	bearer "github.com/Bearer/bearer-go"
+)
+
+// Message is the message of the lines logging records.
+const Message = "bearer record"
+
+// Exporter logs records, one line per record with an attribute per field of
+// the record, e.g. "type" or "statusCode".
+type Exporter struct {
+	// Logger is the logger of the records, slog.Default() if nil.
+	Logger *slog.Logger
+	// Level is the level of the lines logging records, slog.LevelInfo by
+	// default.
+	Level slog.Level
+	// If set, the bodies of records are logged too. They are omitted by
+	// default, to keep lines short.
+	Bodies bool
+}
+
+// Export logs record, for Agent.OnRecord.
+func (e Exporter) Export(record bearer.ReportLog) {
+	logger := e.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	ctx := context.Background()
+	if !logger.Enabled(ctx, e.Level) {
+		return
+	}
+	logger.LogAttrs(ctx, e.Level, Message, e.attrs(record)...)
+}
+
+// attrs returns the attributes of the non-empty fields of record, named
+// after their JSON names and sorted by name.
+func (e Exporter) attrs(record bearer.ReportLog) []slog.Attr {
+	if !e.Bodies {
+		record.RequestBody = ""
+		record.ResponseBody = ""
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return []slog.Attr{slog.String("error", err.Error())}
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return []slog.Attr{slog.String("error", err.Error())}
+	}
+	names := make([]string, 0, len(fields))
+	for name, value := range fields {
+		if value == nil || value == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attrs := make([]slog.Attr, len(names))
+	for i, name := range names {
+		attrs[i] = slog.Any(name, fields[name])
+	}
+	return attrs
+}
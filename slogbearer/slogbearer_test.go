@@ -0,0 +1,54 @@
+package slogbearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	record := bearer.ReportLog{
+		Type:         "REQUEST_END",
+		Method:       "GET",
+		URL:          "https://api.example.com/users",
+		StatusCode:   200,
+		ResponseBody: `{"id":1}`,
+	}
+
+	Exporter{Logger: logger, Level: slog.LevelDebug}.Export(record)
+	Exporter{Logger: logger, Level: slog.LevelWarn, Bodies: true}.Export(record)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "DEBUG", entry["level"])
+	assert.Equal(t, Message, entry["msg"])
+	assert.Equal(t, "REQUEST_END", entry["type"])
+	assert.Equal(t, "https://api.example.com/users", entry["url"])
+	assert.Equal(t, float64(200), entry["statusCode"])
+	assert.NotContains(t, entry, "responseBody", "bodies are omitted by default")
+	assert.NotContains(t, entry, "requestHeaders", "empty fields are omitted")
+
+	entry = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, `{"id":1}`, entry["responseBody"])
+}
+
+func TestExporter_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	Exporter{Logger: logger, Level: slog.LevelDebug}.Export(bearer.ReportLog{Type: "REQUEST_END"})
+
+	assert.Empty(t, buf.String(), "records below the level of the logger are discarded")
+}
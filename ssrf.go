@@ -0,0 +1,146 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ssrfNetworks are the networks the requests of the SSRF guard can't reach:
+// the private, loopback, link-local networks, including the metadata
+// services of clouds at 169.254.169.254, and unspecified addresses.
+var ssrfNetworks = append(parseNetworks("0.0.0.0/8", "::/128"), privateNetworks...)
+
+// ssrfAllowedHost reports whether the host of req is allow-listed in
+// SSRFAllowlist.
+func (a *Agent) ssrfAllowedHost(req *http.Request) bool {
+	for _, key := range hostKeys(req.URL) {
+		for _, allowed := range a.SSRFAllowlist {
+			if strings.EqualFold(allowed, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ssrfAllowedNetworks returns the networks allow-listed in SSRFAllowlist,
+// as CIDRs or IP addresses.
+func (a *Agent) ssrfAllowedNetworks() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, allowed := range a.SSRFAllowlist {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			networks = append(networks, network)
+		} else if ip := net.ParseIP(allowed); ip != nil {
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		}
+	}
+	return networks
+}
+
+// guard installs the SSRF guard on transport. The addresses dialed are
+// checked, except the ones of proxies: the targets of proxied requests are
+// checked instead, before the proxy connects to them.
+func (a *Agent) guard(transport *http.Transport) {
+	allowed := a.ssrfAllowedNetworks()
+	proxies := &sync.Map{}
+	if transport.Proxy != nil {
+		transport.Proxy = guardProxy(transport.Proxy, allowed, proxies)
+	}
+	transport.DialContext = guardDial(transport.DialContext, allowed, proxies)
+}
+
+// guardProxy returns a proxy function failing with ErrPrivateAddress if the
+// host of a request sent through a proxy resolves to an address of
+// ssrfNetworks outside of allowed. The addresses of the proxies used are
+// stored in proxies. As the proxy resolves the host again, DNS rebinding
+// isn't prevented for proxied requests.
+func guardProxy(proxy func(*http.Request) (*url.URL, error), allowed []*net.IPNet, proxies *sync.Map) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if _, err := checkHost(req.Context(), req.URL.Hostname(), allowed); err != nil {
+			return nil, err
+		}
+		proxies.Store(proxyAddress(proxyURL), true)
+		return proxyURL, nil
+	}
+}
+
+// proxyAddress returns the address dialed to connect to the proxy of
+// proxyURL.
+func proxyAddress(proxyURL *url.URL) string {
+	if port := proxyURL.Port(); port != "" {
+		return net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	port := map[string]string{"http": "80", "https": "443", "socks5": "1080"}[proxyURL.Scheme]
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// checkHost returns the addresses of host, or ErrPrivateAddress if any of
+// them is in ssrfNetworks but not in allowed.
+func checkHost(ctx context.Context, host string, allowed []*net.IPNet) ([]net.IPAddr, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if inNetworks(ip.IP, ssrfNetworks) && !inNetworks(ip.IP, allowed) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, ip.IP)
+		}
+	}
+	return ips, nil
+}
+
+// guardDial returns a dial function failing with ErrPrivateAddress if the
+// host dialed resolves to an address of ssrfNetworks outside of allowed.
+// The connection is made to the addresses checked rather than to the host,
+// so that the host can't resolve to another address once checked, e.g. by
+// DNS rebinding. The addresses of proxies, stored in proxies if not nil,
+// aren't checked.
+func guardDial(dial DialFunc, allowed []*net.IPNet, proxies *sync.Map) DialFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if proxies != nil {
+			if _, ok := proxies.Load(addr); ok {
+				return dial(ctx, network, addr)
+			}
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := checkHost(ctx, host, allowed)
+		if errors.Is(err, ErrPrivateAddress) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		} else if err != nil {
+			return nil, err
+		}
+		var checked []string
+		for _, ip := range ips {
+			if (network == "tcp4" && ip.IP.To4() == nil) || (network == "tcp6" && ip.IP.To4() != nil) {
+				continue
+			}
+			checked = append(checked, net.JoinHostPort(ip.IP.String(), port))
+		}
+		if len(checked) == 0 {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "no suitable address", Name: host}}
+		}
+		var conn net.Conn
+		for _, address := range checked {
+			if conn, err = dial(ctx, network, address); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
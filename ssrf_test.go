@@ -0,0 +1,95 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardDial(t *testing.T) {
+	dial := guardDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("dialed " + addr)
+	}, parseNetworks("10.1.0.0/16"), nil)
+	for addr, blocked := range map[string]bool{
+		"169.254.169.254:80": true,
+		"127.0.0.1:80":       true,
+		"[::1]:80":           true,
+		"0.0.0.0:80":         true,
+		"192.168.1.1:443":    true,
+		"10.1.2.3:443":       false,
+		"93.184.216.34:443":  false,
+	} {
+		_, err := dial(context.Background(), "tcp", addr)
+		assert.Equal(t, blocked, errors.Is(err, ErrPrivateAddress), addr)
+		if !blocked {
+			assert.EqualError(t, err, "dialed "+addr)
+		}
+	}
+}
+
+func TestGuardDial_Rebinding(t *testing.T) {
+	var dialed []string
+	dial := guardDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, errors.New("unreachable")
+	}, parseNetworks("127.0.0.0/8"), nil)
+
+	_, err := dial(context.Background(), "tcp4", "localhost:8080")
+	assert.EqualError(t, err, "unreachable")
+	assert.Equal(t, []string{"127.0.0.1:8080"}, dialed, "the address checked is dialed, rather than the host")
+}
+
+func TestAgent_SSRFGuard(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	for _, allowlist := range [][]string{nil, {"127.0.0.0/8"}, {"127.0.0.1"}} {
+		agent := &Agent{SSRFGuard: true, SSRFAllowlist: allowlist, AuditLogSize: 1}
+		client := &http.Client{Transport: agent}
+		resp, err := client.Get(api.URL)
+		if allowlist == nil {
+			assert.True(t, errors.Is(err, ErrPrivateAddress))
+			require.Len(t, agent.AuditLog(), 1)
+			assert.Equal(t, AuditBlocked, agent.AuditLog()[0].Decision)
+		} else {
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		agent.Close()
+	}
+}
+
+func TestAgent_SSRFGuard_proxy(t *testing.T) {
+	// the proxy is on a loopback address, which is dialed anyway
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = append(proxied, req.URL.String())
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	agent := &Agent{SSRFGuard: true, Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	defer agent.Close()
+	client := &http.Client{Transport: agent}
+
+	_, err = client.Get("http://169.254.169.254/latest/meta-data/")
+	assert.True(t, errors.Is(err, ErrPrivateAddress), "the target of the proxy is checked")
+	resp, err := client.Get("http://93.184.216.34/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"http://93.184.216.34/"}, proxied)
+}
+
+func TestAgent_SSRFGuard_sharedTransport(t *testing.T) {
+	agent := &Agent{SSRFGuard: true}
+	defer agent.Close()
+	transport := agent.hostTransport(httptest.NewRequest("GET", "https://a.example.com/", nil))
+	assert.True(t, transport == agent.hostTransport(httptest.NewRequest("GET", "https://b.example.com/", nil)))
+	assert.Empty(t, agent.hostTransports.transports, "no transport per host")
+}
@@ -0,0 +1,251 @@
+// Package statsdbearer exports the metrics of the requests performed through
+// the agent to a statsd server, or to a DogStatsD agent with tags:
+//
+//	sink, err := statsdbearer.New("127.0.0.1:8125", statsdbearer.Options{DogStatsD: true, Tags: []string{"env:prod"}})
+//	agent.MetricsSinks = append(agent.MetricsSinks, sink)
+//	defer sink.Close()
+//
+// Every FlushEvery, the sink sends for each host the number of requests and
+// errors as counters, the error rate as a gauge, and a sample of the request
+// latencies as timers, and the bytes sent and received as counters. With
+// DogStatsD, metrics are tagged with the host, the
+// API name and the method; with plain statsd, the host is part of the
+// metrics' names.
+package statsdbearer
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+)
+
+const (
+	// defaultFlushEvery is the flush interval of sinks without FlushEvery.
+	defaultFlushEvery = 10 * time.Second
+	// defaultPrefix is the prefix of the metrics of sinks without Prefix.
+	defaultPrefix = "bearer."
+	// maxSamples bounds the number of latencies sent per series and flush.
+	maxSamples = 100
+	// maxPacketSize is the maximum size of the UDP packets sent, below the
+	// MTU of most networks.
+	maxPacketSize = 1432
+)
+
+// Options configure a Sink.
+type Options struct {
+	// Prefix is the prefix of the names of metrics, "bearer." by default.
+	Prefix string
+	// Tags are added to every metric, with DogStatsD.
+	Tags []string
+	// DogStatsD enables the tags of the DogStatsD protocol.
+	DogStatsD bool
+	// FlushEvery is the interval between flushes, 10 seconds by default.
+	FlushEvery time.Duration
+}
+
+// series identifies the metrics of the requests of a host, API and method.
+type series struct {
+	host, api, method string
+}
+
+// aggregate holds the metrics of a series since the last flush.
+type aggregate struct {
+	requests, errors int
+	// volumes is the number of requests whose bytes were counted.
+	volumes                  int
+	bytesSent, bytesReceived int64
+	// latencies is a uniform sample of the latencies, in milliseconds.
+	latencies []float64
+}
+
+// Sink aggregates the metrics of requests, and sends them regularly to a
+// statsd server. It implements bearer.MetricsSink and bearer.VolumeSink.
+type Sink struct {
+	options Options
+	conn    net.Conn
+
+	mutex      sync.Mutex
+	aggregates map[series]*aggregate
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+	close   sync.Once
+}
+
+// New returns a sink sending metrics to the statsd server at address, e.g.
+// "127.0.0.1:8125", over UDP.
+func New(address string, options Options) (*Sink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("statsdbearer: %w", err)
+	}
+	if options.Prefix == "" {
+		options.Prefix = defaultPrefix
+	}
+	if options.FlushEvery <= 0 {
+		options.FlushEvery = defaultFlushEvery
+	}
+	s := &Sink{options: options, conn: conn, aggregates: map[series]*aggregate{}, done: make(chan struct{})}
+	s.stopped.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// ObserveRequest implements the bearer.MetricsSink interface.
+func (s *Sink) ObserveRequest(metrics bearer.RequestMetrics) {
+	latency := float64(metrics.Duration) / float64(time.Millisecond)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	agg := s.aggregate(series{host: metrics.Host, api: metrics.API, method: metrics.Method})
+	agg.requests++
+	if metrics.Failed {
+		agg.errors++
+	}
+	// reservoir sampling keeps a uniform sample of the latencies
+	if len(agg.latencies) < maxSamples {
+		agg.latencies = append(agg.latencies, latency)
+	} else if i := rand.Intn(agg.requests); i < maxSamples {
+		agg.latencies[i] = latency
+	}
+}
+
+// ObserveVolume implements the bearer.VolumeSink interface. The volume of a
+// request is observed once its response is read, so possibly after its
+// metrics were flushed.
+func (s *Sink) ObserveVolume(volume bearer.RequestVolume) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	agg := s.aggregate(series{host: volume.Host, api: volume.API, method: volume.Method})
+	agg.volumes++
+	agg.bytesSent += volume.BytesSent
+	agg.bytesReceived += volume.BytesReceived
+}
+
+// aggregate returns the aggregate of key, created if needed. s.mutex must be
+// held.
+func (s *Sink) aggregate(key series) *aggregate {
+	agg := s.aggregates[key]
+	if agg == nil {
+		agg = &aggregate{}
+		s.aggregates[key] = agg
+	}
+	return agg
+}
+
+// Flush sends the metrics aggregated since the last flush.
+func (s *Sink) Flush() error {
+	s.mutex.Lock()
+	aggregates := s.aggregates
+	s.aggregates = map[series]*aggregate{}
+	s.mutex.Unlock()
+
+	var lines []string
+	for key, agg := range aggregates {
+		lines = append(lines, s.lines(key, agg)...)
+	}
+	sort.Strings(lines)
+	return s.send(lines)
+}
+
+// lines returns the statsd lines of the metrics of a series.
+func (s *Sink) lines(key series, agg *aggregate) []string {
+	name := func(metric string) string {
+		if s.options.DogStatsD {
+			return s.options.Prefix + metric
+		}
+		return s.options.Prefix + metric + "." + sanitize(key.host)
+	}
+	suffix := ""
+	if s.options.DogStatsD {
+		tags := append([]string{"host:" + key.host, "method:" + key.method}, s.options.Tags...)
+		if key.api != "" {
+			tags = append(tags, "api:"+key.api)
+		}
+		suffix = "|#" + strings.Join(tags, ",")
+	}
+	var lines []string
+	if agg.requests > 0 {
+		lines = append(lines,
+			fmt.Sprintf("%s:%d|c%s", name("requests"), agg.requests, suffix),
+			fmt.Sprintf("%s:%d|c%s", name("errors"), agg.errors, suffix),
+			fmt.Sprintf("%s:%g|g%s", name("error_rate"), float64(agg.errors)/float64(agg.requests), suffix),
+		)
+	}
+	rate := ""
+	if len(agg.latencies) < agg.requests {
+		rate = fmt.Sprintf("|@%g", float64(len(agg.latencies))/float64(agg.requests))
+	}
+	for _, latency := range agg.latencies {
+		lines = append(lines, fmt.Sprintf("%s:%g|ms%s%s", name("latency"), latency, rate, suffix))
+	}
+	if agg.volumes > 0 {
+		lines = append(lines,
+			fmt.Sprintf("%s:%d|c%s", name("bytes_sent"), agg.bytesSent, suffix),
+			fmt.Sprintf("%s:%d|c%s", name("bytes_received"), agg.bytesReceived, suffix),
+		)
+	}
+	return lines
+}
+
+// send sends lines in packets of up to maxPacketSize bytes.
+func (s *Sink) send(lines []string) error {
+	var packet []byte
+	var err error
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacketSize {
+			if _, writeErr := s.conn.Write(packet); writeErr != nil {
+				err = writeErr
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, writeErr := s.conn.Write(packet); writeErr != nil {
+			err = writeErr
+		}
+	}
+	return err
+}
+
+func (s *Sink) run() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(s.options.FlushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops the sink once it flushed the metrics aggregated so far.
+func (s *Sink) Close() error {
+	var err error
+	s.close.Do(func() {
+		close(s.done)
+		s.stopped.Wait()
+		err = s.Flush()
+		if closeErr := s.conn.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+// sanitize returns host usable in the names of statsd metrics.
+func sanitize(host string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(host)
+}
@@ -0,0 +1,95 @@
+package statsdbearer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	bearer "github.com/Bearer/bearer-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen returns a UDP server, and a function returning the lines it received.
+func listen(t *testing.T) (net.PacketConn, func() []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return conn, func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				sort.Strings(lines)
+				return lines
+			}
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+	}
+}
+
+func TestSink_DogStatsD(t *testing.T) {
+	conn, received := listen(t)
+	defer conn.Close()
+	sink, err := New(conn.LocalAddr().String(), Options{DogStatsD: true, Tags: []string{"env:test"}, FlushEvery: time.Hour})
+	require.NoError(t, err)
+
+	sink.ObserveRequest(bearer.RequestMetrics{Host: "api.stripe.com", API: "stripe", Method: "GET", StatusCode: 200, Duration: 10 * time.Millisecond})
+	sink.ObserveRequest(bearer.RequestMetrics{Host: "api.stripe.com", API: "stripe", Method: "GET", Duration: 30 * time.Millisecond, Failed: true})
+	sink.ObserveVolume(bearer.RequestVolume{Host: "api.stripe.com", API: "stripe", Method: "GET", BytesReceived: 120})
+	sink.ObserveVolume(bearer.RequestVolume{Host: "api.stripe.com", API: "stripe", Method: "GET", BytesSent: 8, BytesReceived: 30})
+	require.NoError(t, sink.Close())
+
+	tags := "|#host:api.stripe.com,method:GET,env:test,api:stripe"
+	assert.Equal(t, []string{
+		"bearer.bytes_received:150|c" + tags,
+		"bearer.bytes_sent:8|c" + tags,
+		"bearer.error_rate:0.5|g" + tags,
+		"bearer.errors:1|c" + tags,
+		"bearer.latency:10|ms" + tags,
+		"bearer.latency:30|ms" + tags,
+		"bearer.requests:2|c" + tags,
+	}, received())
+}
+
+func TestSink_Statsd(t *testing.T) {
+	conn, received := listen(t)
+	defer conn.Close()
+	sink, err := New(conn.LocalAddr().String(), Options{Prefix: "app.", FlushEvery: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	agent := &bearer.Agent{MetricsSinks: []bearer.MetricsSink{sink}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+	resp, err := (&http.Client{Transport: agent}).Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	lines := received()
+	host := strings.NewReplacer(".", "_", ":", "_").Replace(strings.TrimPrefix(ts.URL, "http://"))
+	assert.Contains(t, lines, "app.requests."+host+":1|c")
+	assert.Contains(t, lines, "app.errors."+host+":0|c")
+}
+
+func TestSink_lines_sampled(t *testing.T) {
+	sink := &Sink{options: Options{Prefix: "bearer.", DogStatsD: true}, aggregates: map[series]*aggregate{}}
+	for i := 0; i < 4*maxSamples; i++ {
+		sink.ObserveRequest(bearer.RequestMetrics{Host: "h", Method: "GET"})
+	}
+	lines := sink.lines(series{host: "h", method: "GET"}, sink.aggregates[series{host: "h", method: "GET"}])
+	assert.Len(t, lines, 3+maxSamples)
+	assert.Equal(t, "bearer.latency:0|ms|@0.25|#host:h,method:GET", lines[3])
+}
+
+func TestSink_lines_volumeOnly(t *testing.T) {
+	sink := &Sink{options: Options{Prefix: "bearer."}, aggregates: map[series]*aggregate{}}
+	sink.ObserveVolume(bearer.RequestVolume{Host: "h", Method: "GET", BytesReceived: 42})
+	lines := sink.lines(series{host: "h", method: "GET"}, sink.aggregates[series{host: "h", method: "GET"}])
+	assert.Equal(t, []string{"bearer.bytes_sent.h:0|c", "bearer.bytes_received.h:42|c"}, lines)
+}
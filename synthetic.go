@@ -0,0 +1,128 @@
+package bearer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultCheckEvery is the interval between synthetic checks if their
+	// Every isn't set.
+	defaultCheckEvery = time.Minute
+	// defaultCheckTimeout is the timeout of synthetic checks if their
+	// Timeout isn't set.
+	defaultCheckTimeout = 10 * time.Second
+)
+
+// SyntheticCheck is a request performed regularly by the agent to check that
+// a dependency is available.
+type SyntheticCheck struct {
+	// Name identifies the check in its records, URL by default.
+	Name string
+	// Method is the method of the request, GET by default.
+	Method string
+	URL    string
+	// ExpectedStatus is the status of successful checks. If zero, checks
+	// succeed with any status below 400.
+	ExpectedStatus int
+	// If set, checks slower than MaxLatency fail.
+	MaxLatency time.Duration
+	// Every is the interval between checks, 1 minute by default.
+	Every time.Duration
+	// Timeout is the timeout of the request, 10 seconds by default.
+	Timeout time.Duration
+}
+
+// checkResult is the result of a synthetic check in its record.
+type checkResult struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	// Failure explains why the check failed.
+	Failure string `json:"failure,omitempty"`
+}
+
+// failure returns the reason why a check with the response status and
+// latency, or failing with err, failed, or "" if it succeeded.
+func (c SyntheticCheck) failure(status int, latency time.Duration, err error) string {
+	switch {
+	case err != nil:
+		return errorMessage(err)
+	case c.ExpectedStatus != 0 && status != c.ExpectedStatus:
+		return fmt.Sprintf("status %d, expected %d", status, c.ExpectedStatus)
+	case c.ExpectedStatus == 0 && status >= 400:
+		return fmt.Sprintf("status %d", status)
+	case c.MaxLatency > 0 && latency > c.MaxLatency:
+		return fmt.Sprintf("latency %s exceeds %s", latency, c.MaxLatency)
+	}
+	return ""
+}
+
+// runCheck performs check, and reports its result.
+func (a *Agent) runCheck(ctx context.Context, check SyntheticCheck) {
+	method := check.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(method, check.URL, nil)
+	if err != nil {
+		a.logger().Warn("invalid synthetic check", zap.String("url", check.URL), zap.Error(err))
+		return
+	}
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	resp, err := a.hostTransport(req).RoundTrip(req)
+	end := time.Now()
+	if resp != nil {
+		resp.Body.Close()
+		// the body isn't part of the result
+		resp.Body = nil
+	}
+	record := newRecord(req, resp, start, end, nil, err)
+	record.Type = recordTypeSyntheticCheck
+	record.Check = &checkResult{Name: check.Name}
+	if record.Check.Name == "" {
+		record.Check.Name = check.URL
+	}
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	record.Check.Failure = check.failure(status, end.Sub(start), err)
+	record.Check.Success = record.Check.Failure == ""
+	a.report(a.context(), record)
+	if !record.Check.Success {
+		a.alert(Alert{Kind: AlertProbeFailure, Host: canonicalHost(req.URL), Message: record.Check.Name + ": " + record.Check.Failure, Time: end})
+	}
+}
+
+// startSyntheticChecks starts performing SyntheticChecks regularly. It is
+// called once the first configuration is fetched.
+func (a *Agent) startSyntheticChecks() {
+	for _, check := range a.SyntheticChecks {
+		check := check
+		every := check.Every
+		if every <= 0 {
+			every = defaultCheckEvery
+		}
+		a.goWorker(func() {
+			defer a.recoverPanic()
+			for {
+				a.runCheck(a.context(), check)
+				if !a.sleep(every) {
+					return
+				}
+			}
+		})
+	}
+}
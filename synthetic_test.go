@@ -0,0 +1,55 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyntheticCheck_failure(t *testing.T) {
+	check := SyntheticCheck{}
+	assert.Equal(t, "", check.failure(302, time.Second, nil))
+	assert.Equal(t, "status 404", check.failure(404, time.Second, nil))
+	assert.Equal(t, "connection refused", check.failure(0, 0, errors.New("connection refused")))
+
+	check = SyntheticCheck{ExpectedStatus: 204, MaxLatency: 100 * time.Millisecond}
+	assert.Equal(t, "status 200, expected 204", check.failure(200, time.Millisecond, nil))
+	assert.Equal(t, "latency 200ms exceeds 100ms", check.failure(204, 200*time.Millisecond, nil))
+	assert.Equal(t, "", check.failure(204, time.Millisecond, nil))
+}
+
+func TestAgent_SyntheticChecks(t *testing.T) {
+	var methods []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		methods = append(methods, req.Method)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true}
+	defer agent.Close()
+
+	agent.runCheck(context.Background(), SyntheticCheck{Name: "api", Method: http.MethodHead, URL: api.URL + "/health"})
+	record := fake.next(t)
+	assert.Equal(t, recordTypeSyntheticCheck, record.Type)
+	assert.Equal(t, &checkResult{Name: "api", Failure: "status 503"}, record.Check)
+	assert.Equal(t, 503, record.StatusCode)
+	assert.Equal(t, "/health", record.Path)
+	assert.Equal(t, []string{http.MethodHead}, methods)
+
+	agent = &Agent{SecretKey: "sk_test", Transport: fake, SyntheticChecks: []SyntheticCheck{{URL: api.URL, ExpectedStatus: 503, Every: 10 * time.Millisecond}}}
+	defer agent.Close()
+	agent.config()
+	records, err := fake.WaitRecords(3, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, api.URL, records[1].Check.Name)
+	assert.True(t, records[1].Check.Success)
+	assert.True(t, records[2].Check.Success)
+}
@@ -0,0 +1,193 @@
+package bearer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// LoadClientTLSConfig returns a TLS configuration presenting the client
+// certificate of certFile and keyFile, and trusting the certificates of
+// caFile instead of the system's, if caFile is not empty. Files are PEM-encoded.
+func LoadClientTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA file: no certificate found")
+		}
+	}
+	return config, nil
+}
+
+// hostTransports holds the transports managed by the agent for hosts with a
+// dedicated TLS configuration, address or dialer.
+type hostTransports struct {
+	mutex      sync.Mutex
+	transports map[string]*http.Transport
+	// guarded is the transport shared by the hosts which only need the
+	// SSRF guard, however many they are.
+	guarded *http.Transport
+	// enforced is the transport shared by the hosts which only need the
+	// enforced TLS policy.
+	enforced *http.Transport
+	// policy is the enforced TLS policy applied to the transports.
+	policy *TLSPolicy
+}
+
+// hostTransport returns the transport performing the requests to req's host.
+func (a *Agent) hostTransport(req *http.Request) http.RoundTripper {
+	var config *tls.Config
+	var dial DialFunc
+	hasConfig, hasDialer := false, false
+	for _, key := range hostKeys(req.URL) {
+		if !hasConfig {
+			config, hasConfig = a.TLSConfigs[key]
+		}
+		if !hasDialer {
+			dial, hasDialer = a.Dialers[key]
+		}
+	}
+	address, hasAddress := lookupHostString(a.HostAddresses, req.URL)
+	pins, hasPins := a.certificatePins(req)
+	guarded := a.SSRFGuard && !a.ssrfAllowedHost(req)
+	policy := a.handshakePolicy(a.config())
+	if !hasConfig && !hasAddress && !hasDialer && !hasPins {
+		if guarded {
+			return a.guardedTransport(policy)
+		}
+		if _, ok := a.transport().(*http.Transport); ok && policy != nil {
+			return a.enforcedTransport(policy)
+		}
+		return a.transport()
+	}
+	// the options of the host may differ by port, e.g. Dialers["h:443"],
+	// and transports by scheme
+	key := req.URL.Scheme + "://" + hostKeys(req.URL)[0]
+
+	a.hostTransports.mutex.Lock()
+	defer a.hostTransports.mutex.Unlock()
+	a.applyHandshakePolicy(policy)
+	if transport, ok := a.hostTransports.transports[key]; ok {
+		return transport
+	}
+	transport := a.baseTransport().Clone()
+	if hasConfig {
+		transport.TLSClientConfig = config.Clone()
+	}
+	if hasPins || policy != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+	}
+	if hasPins {
+		transport.TLSClientConfig.VerifyPeerCertificate = verifyPins(pins)
+	}
+	if policy != nil {
+		policy.apply(transport.TLSClientConfig)
+	}
+	if hasDialer {
+		transport.DialContext = dial
+		// dialers handle the connection to proxies themselves
+		transport.Proxy = nil
+	}
+	if guarded {
+		// the address overriding the host's is the one checked
+		a.guard(transport)
+	}
+	if hasAddress {
+		transport.DialContext = overrideAddress(transport.DialContext, address)
+	}
+	if a.hostTransports.transports == nil {
+		a.hostTransports.transports = map[string]*http.Transport{}
+	}
+	a.hostTransports.transports[key] = transport
+	return transport
+}
+
+// guardedTransport returns the transport of the hosts which only need the
+// SSRF guard, and policy if it isn't nil.
+func (a *Agent) guardedTransport(policy *TLSPolicy) *http.Transport {
+	a.hostTransports.mutex.Lock()
+	defer a.hostTransports.mutex.Unlock()
+	a.applyHandshakePolicy(policy)
+	if a.hostTransports.guarded == nil {
+		transport := a.policyTransport(policy)
+		a.guard(transport)
+		a.hostTransports.guarded = transport
+	}
+	return a.hostTransports.guarded
+}
+
+// enforcedTransport returns the transport of the hosts which only need
+// policy.
+func (a *Agent) enforcedTransport(policy *TLSPolicy) *http.Transport {
+	a.hostTransports.mutex.Lock()
+	defer a.hostTransports.mutex.Unlock()
+	a.applyHandshakePolicy(policy)
+	if a.hostTransports.enforced == nil {
+		a.hostTransports.enforced = a.policyTransport(policy)
+	}
+	return a.hostTransports.enforced
+}
+
+// policyTransport returns a clone of the base transport applying policy, if
+// it isn't nil.
+func (a *Agent) policyTransport(policy *TLSPolicy) *http.Transport {
+	transport := a.baseTransport().Clone()
+	if policy != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		policy.apply(transport.TLSClientConfig)
+	}
+	return transport
+}
+
+// applyHandshakePolicy discards the managed transports if they apply
+// another policy than policy, e.g. after the remote configuration changed.
+// The lock of the transports must be held.
+func (a *Agent) applyHandshakePolicy(policy *TLSPolicy) {
+	t := &a.hostTransports
+	if reflect.DeepEqual(t.policy, policy) {
+		return
+	}
+	t.closeIdleConnections()
+	t.transports, t.guarded, t.enforced = nil, nil, nil
+	t.policy = policy
+}
+
+// closeIdleConnections closes the idle connections of the transports. The
+// lock of the transports must be held.
+func (t *hostTransports) closeIdleConnections() {
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+	for _, transport := range []*http.Transport{t.guarded, t.enforced} {
+		if transport != nil {
+			transport.CloseIdleConnections()
+		}
+	}
+}
+
+// baseTransport returns the transport cloned into the transports managed by
+// the agent.
+func (a *Agent) baseTransport() *http.Transport {
+	if base, ok := a.transport().(*http.Transport); ok {
+		return base
+	}
+	return defaultHTTPTransport
+}
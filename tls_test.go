@@ -0,0 +1,96 @@
+package bearer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClientCertificate returns a self-signed client certificate and its key, PEM-encoded.
+func newClientCertificate(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestAgent_TLSConfigs(t *testing.T) {
+	api := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	api.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	api.StartTLS()
+	defer api.Close()
+
+	dir, err := ioutil.TempDir("", "bearer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certPEM, keyPEM := newClientCertificate(t)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: api.Certificate().Raw})
+	for name, content := range map[string][]byte{"cert.pem": certPEM, "key.pem": keyPEM, "ca.pem": caPEM} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), content, 0600))
+	}
+
+	config, err := LoadClientTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem"))
+	require.NoError(t, err)
+	agent := &Agent{TLSConfigs: map[string]*tls.Config{"127.0.0.1": config}}
+	resp, err := (&http.Client{Transport: agent}).Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Same(t, agent.hostTransport(resp.Request), agent.hostTransport(resp.Request), "transports are reused")
+
+	_, err = (&http.Client{Transport: &Agent{}}).Get(api.URL)
+	assert.Error(t, err, "server certificate is unknown without the CA")
+
+	_, err = LoadClientTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem.missing"))
+	assert.Error(t, err)
+	_, err = LoadClientTLSConfig(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "key.pem"))
+	assert.Error(t, err)
+}
+
+func TestAgent_hostTransport_key(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("unreachable")
+	}
+	agent := &Agent{
+		HostAddresses: map[string]string{"api.example.com": "127.0.0.1"},
+		Dialers:       map[string]DialFunc{"api.example.com:443": dial},
+	}
+	secure := agent.hostTransport(httptest.NewRequest("GET", "https://api.example.com/", nil))
+	plain := agent.hostTransport(httptest.NewRequest("GET", "http://api.example.com/", nil))
+	assert.False(t, secure == plain, "the dialer of port 443 isn't used for port 80")
+	assert.Same(t, secure, agent.hostTransport(httptest.NewRequest("GET", "https://api.example.com:443/", nil)))
+	assert.False(t, secure == agent.hostTransport(httptest.NewRequest("GET", "http://api.example.com:443/", nil)))
+}
@@ -0,0 +1,173 @@
+package bearer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// TLSPolicy is the minimum security of the TLS connections of requests, for
+// compliance-driven egress requirements. Enforced policies are applied to the
+// TLS configuration of the transports managed by the agent, so that
+// handshakes with non-compliant hosts fail. The connections of the
+// transports passed to Wrap are checked once established instead, so that
+// requests to non-compliant hosts are sent, but their responses are rejected.
+type TLSPolicy struct {
+	// MinVersion is the minimum version of TLS, e.g. "1.2".
+	MinVersion string `json:"minVersion,omitempty"`
+	// CipherSuites are the names of the approved cipher suites, as named by
+	// crypto/tls, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". All are
+	// approved if empty. TLS 1.3 suites must be listed too.
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+	// Enforce rejects the responses received over non-compliant
+	// connections, with ErrTLSPolicy. They are flagged in records otherwise.
+	Enforce bool `json:"enforce,omitempty"`
+}
+
+// tlsVersions are the versions of TLS by their names in TLSPolicy.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuiteNames are the names of the cipher suites of crypto/tls, by ID.
+var cipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                "TLS_RSA_WITH_RC4_128_SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            "TLS_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            "TLS_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	tls.TLS_AES_128_GCM_SHA256:                  "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                  "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:            "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+// cipherSuiteIDs are the IDs of the cipher suites, by name, including the
+// names of ChaCha20-Poly1305 suites before Go 1.16.
+var cipherSuiteIDs = map[string]uint16{
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+func init() {
+	for id, name := range cipherSuiteNames {
+		cipherSuiteIDs[name] = id
+	}
+}
+
+// cipherSuiteName returns the name of the cipher suite id, or its hex
+// representation if it is unknown.
+func cipherSuiteName(id uint16) string {
+	if name, ok := cipherSuiteNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+// isTLS13Suite reports whether id is a TLS 1.3 cipher suite, which crypto/tls
+// doesn't allow to restrict.
+func isTLS13Suite(id uint16) bool {
+	switch id {
+	case tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256:
+		return true
+	}
+	return false
+}
+
+// violation returns how state violates the policy, or "" if it complies.
+func (p *TLSPolicy) violation(state *tls.ConnectionState) string {
+	if min, ok := tlsVersions[p.MinVersion]; ok && state.Version < min {
+		return fmt.Sprintf("%s below TLS %s", tlsVersionName(state.Version), p.MinVersion)
+	}
+	if len(p.CipherSuites) == 0 {
+		return ""
+	}
+	for _, approved := range p.CipherSuites {
+		if id, ok := cipherSuiteIDs[approved]; ok && id == state.CipherSuite {
+			return ""
+		}
+	}
+	return "cipher suite " + cipherSuiteName(state.CipherSuite) + " not approved"
+}
+
+// apply restricts config to the versions and cipher suites of the policy.
+// Since TLS 1.3 suites can't be restricted, TLS 1.3 is disabled unless one
+// of them is approved, and required if only TLS 1.3 suites are.
+func (p *TLSPolicy) apply(config *tls.Config) {
+	if min, ok := tlsVersions[p.MinVersion]; ok && config.MinVersion < min {
+		config.MinVersion = min
+	}
+	if len(p.CipherSuites) == 0 {
+		return
+	}
+	var suites []uint16
+	tls13 := false
+	for _, name := range p.CipherSuites {
+		if id, ok := cipherSuiteIDs[name]; ok && isTLS13Suite(id) {
+			tls13 = true
+		} else if ok {
+			suites = append(suites, id)
+		}
+	}
+	config.CipherSuites = suites
+	if !tls13 {
+		config.MaxVersion = tls.VersionTLS12
+	}
+	if len(suites) == 0 {
+		// only TLS 1.3 suites are approved, or none is known
+		config.MinVersion = tls.VersionTLS13
+	}
+}
+
+// tlsPolicy returns the TLS policy of config, or else TLSPolicy.
+func (a *Agent) tlsPolicy(config *Config) *TLSPolicy {
+	if config.TLSPolicy != nil {
+		return config.TLSPolicy
+	}
+	return a.TLSPolicy
+}
+
+// handshakePolicy returns the TLS policy applied to the transports managed by
+// the agent, nil if the policy of config isn't enforced.
+func (a *Agent) handshakePolicy(config *Config) *TLSPolicy {
+	policy := a.tlsPolicy(config)
+	if policy == nil || !policy.Enforce || (policy.MinVersion == "" && len(policy.CipherSuites) == 0) {
+		return nil
+	}
+	return policy
+}
+
+// checkTLSPolicy returns how the connection of resp violates the TLS policy,
+// "" if it complies, and ErrTLSPolicy if the policy is enforced. Only the
+// connections of the transports passed to Wrap, and of the ones which aren't
+// an *http.Transport, can violate an enforced policy.
+func (a *Agent) checkTLSPolicy(config *Config, resp *http.Response) (string, error) {
+	policy := a.tlsPolicy(config)
+	if policy == nil || resp == nil || resp.TLS == nil {
+		return "", nil
+	}
+	violation := policy.violation(resp.TLS)
+	if violation == "" || !policy.Enforce {
+		return violation, nil
+	}
+	return violation, fmt.Errorf("%w: %s", ErrTLSPolicy, violation)
+}
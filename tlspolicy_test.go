@@ -0,0 +1,83 @@
+package bearer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSPolicy_violation(t *testing.T) {
+	policy := &TLSPolicy{MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+	assert.Equal(t, "TLS 1.1 below TLS 1.2", policy.violation(&tls.ConnectionState{Version: tls.VersionTLS11}))
+	assert.Equal(t, "", policy.violation(&tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}))
+	assert.Equal(t, "cipher suite TLS_AES_128_GCM_SHA256 not approved", policy.violation(&tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256}))
+	assert.Equal(t, "", (&TLSPolicy{MinVersion: "1.3"}).violation(&tls.ConnectionState{Version: tls.VersionTLS13}))
+}
+
+func TestAgent_TLSPolicy(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer api.Close()
+	policy := &TLSPolicy{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+
+	var out bytes.Buffer
+	agent := &Agent{ReportWriter: &out, SyncReporting: true, TLSPolicy: policy}
+	client := &http.Client{Transport: agent.Wrap(api.Client().Transport)}
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err, "violations are flagged unless the policy is enforced")
+	resp.Body.Close()
+	agent.Close()
+	var record ReportLog
+	require.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Contains(t, record.TLSViolation, "not approved")
+
+	fake := newFakeBearer(`{"tlsPolicy":{"minVersion":"1.2","cipherSuites":["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"],"enforce":true}}`)
+	agent = &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, TLSPolicy: &TLSPolicy{}}
+	defer agent.Close()
+	client = &http.Client{Transport: agent.Wrap(api.Client().Transport)}
+	_, err = client.Get(api.URL)
+	assert.True(t, errors.Is(err, ErrTLSPolicy), "the remote policy overrides the local one")
+	record = fake.next(t)
+	assert.Contains(t, record.TLSViolation, "not approved")
+	assert.Contains(t, record.ErrorMessage, ErrTLSPolicy.Error())
+}
+
+func TestTLSPolicy_apply(t *testing.T) {
+	config := &tls.Config{}
+	(&TLSPolicy{MinVersion: "1.1", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305"}}).apply(config)
+	assert.Equal(t, uint16(tls.VersionTLS11), config.MinVersion)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MaxVersion, "TLS 1.3 suites aren't approved")
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305}, config.CipherSuites)
+
+	config = &tls.Config{}
+	(&TLSPolicy{CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}).apply(config)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion, "only TLS 1.3 suites are approved")
+	assert.Zero(t, config.MaxVersion)
+}
+
+func TestAgent_TLSPolicy_handshake(t *testing.T) {
+	hits := 0
+	api := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { hits++ }))
+	api.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	api.StartTLS()
+	defer api.Close()
+
+	agent := &Agent{Transport: api.Client().Transport, TLSPolicy: &TLSPolicy{MinVersion: "1.3", Enforce: true}}
+	defer agent.Close()
+	_, err := (&http.Client{Transport: agent}).Get(api.URL)
+	assert.Error(t, err, "the handshake fails")
+	assert.Zero(t, hits, "the request isn't sent")
+
+	agent.TLSPolicy = &TLSPolicy{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, Enforce: true}
+	resp, err := (&http.Client{Transport: agent}).Get(api.URL)
+	require.NoError(t, err, "managed transports follow the policy changes")
+	resp.Body.Close()
+	assert.Equal(t, uint16(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256), resp.TLS.CipherSuite)
+	assert.Equal(t, 1, hits)
+}
@@ -0,0 +1,116 @@
+package bearer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TokenRefresh refreshes the credentials of requests rejected with a 401
+// status, and retries them once with the new credential.
+type TokenRefresh struct {
+	// Hosts are the hosts whose 401 responses trigger a refresh.
+	Hosts []string
+	// Header is the header holding the credential. If empty, will use
+	// "Authorization" as default.
+	Header string
+	// Refresh returns the new value of Header, e.g. "Bearer <token>".
+	// Concurrent rejections share a single call, and requests sent before the
+	// last refresh are retried with its credential without calling Refresh.
+	// Applications should store the new credential for their next requests.
+	Refresh func(ctx context.Context) (string, error)
+}
+
+func (r *TokenRefresh) header() string {
+	if r.Header != "" {
+		return r.Header
+	}
+	return "Authorization"
+}
+
+func (r *TokenRefresh) applies(req *http.Request) bool {
+	if r == nil || r.Refresh == nil || req.Context().Value(tokenRefreshedKey) != nil {
+		return false
+	}
+	for _, host := range r.Hosts {
+		if matchHost(host, req.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// tokenRefresher coordinates the calls to the agent's TokenRefresh.
+type tokenRefresher struct {
+	mutex       sync.Mutex
+	call        *tokenCall
+	token       string
+	refreshedAt time.Time
+}
+
+// refreshToken returns a credential newer than the requests started at start.
+func (a *Agent) refreshToken(ctx context.Context, start time.Time) (string, error) {
+	r := &a.tokens
+	r.mutex.Lock()
+	if !r.refreshedAt.IsZero() && start.Before(r.refreshedAt) {
+		defer r.mutex.Unlock()
+		return r.token, nil
+	}
+	if call := r.call; call != nil {
+		r.mutex.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	r.call = call
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		if call.err == nil {
+			r.token = call.token
+			r.refreshedAt = time.Now()
+		}
+		r.call = nil
+		r.mutex.Unlock()
+		close(call.done)
+	}()
+	call.token, call.err = a.TokenRefresh.Refresh(ctx)
+	return call.token, call.err
+}
+
+// tokenRefreshRetry returns the request retrying req with a refreshed
+// credential, if resp rejected req's credential, or nil.
+func (a *Agent) tokenRefreshRetry(req *http.Request, reqBody []byte, resp *http.Response, start time.Time) *http.Request {
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized || !a.TokenRefresh.applies(req) {
+		return nil
+	}
+	token, err := a.refreshToken(req.Context(), start)
+	if err != nil {
+		a.logger().Warn("refresh token", zap.String("host", urlHostname(req.URL)), zap.Error(err))
+		return nil
+	}
+
+	ctx := context.WithValue(req.Context(), tokenRefreshedKey, true)
+	attempt := AttemptFromContext(ctx)
+	if attempt == 0 {
+		attempt = 1
+	}
+	retry := req.Clone(WithAttempt(ctx, attempt+1))
+	retry.Header.Set(a.TokenRefresh.header(), token)
+	if reqBody != nil {
+		retry.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	return retry
+}
@@ -0,0 +1,90 @@
+package bearer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_TokenRefresh(t *testing.T) {
+	var token atomic.Value
+	token.Store("Bearer new")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != token.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write(body)
+	}))
+	defer api.Close()
+
+	var refreshes int32
+	agent := &Agent{TokenRefresh: &TokenRefresh{
+		Hosts: []string{"127.0.0.1"},
+		Refresh: func(ctx context.Context) (string, error) {
+			atomic.AddInt32(&refreshes, 1)
+			time.Sleep(20 * time.Millisecond)
+			return token.Load().(string), nil
+		},
+	}}
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest("POST", api.URL, strings.NewReader("hello"))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer old")
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "hello", string(body))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&refreshes))
+
+	// a rejected new credential is refreshed and retried only once
+	token.Store("Bearer newer")
+	resp, err := client.Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	token.Store("Bearer never")
+	agent.TokenRefresh.Refresh = func(ctx context.Context) (string, error) { return "Bearer wrong", nil }
+	resp, err = client.Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestAgent_TokenRefresh_Error(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer api.Close()
+
+	agent := &Agent{TokenRefresh: &TokenRefresh{
+		Hosts:   []string{"127.0.0.1"},
+		Refresh: func(ctx context.Context) (string, error) { return "", errors.New("refresh failed") },
+	}}
+	resp, err := (&http.Client{Transport: agent.Wrap(http.DefaultTransport)}).Get(api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,104 @@
+package bearer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"unicode/utf8"
+)
+
+// errRecordTooLarge is the error of the records too large to be sent even
+// once trimmed.
+var errRecordTooLarge = errors.New("bearer: record too large")
+
+// trimSteps are the ways to shrink records, from the least useful parts of
+// records to the most. Each removes or shortens a part by at least excess
+// bytes if possible, and reports whether it changed the record.
+var trimSteps = []struct {
+	part string
+	trim func(r *ReportLog, excess int) bool
+}{
+	{"responseBody", func(r *ReportLog, excess int) bool {
+		return r.trimBody(&r.ResponseBody, &r.ResponseBodyEncoding, excess)
+	}},
+	{"requestBody", func(r *ReportLog, excess int) bool { return r.trimBody(&r.RequestBody, &r.RequestBodyEncoding, excess) }},
+	{"responseHeaders", func(r *ReportLog, excess int) bool {
+		ret := len(r.ResponseHeaders) > 0
+		r.ResponseHeaders = nil
+		return ret
+	}},
+	{"requestHeaders", func(r *ReportLog, excess int) bool {
+		ret := len(r.RequestHeaders) > 0
+		r.RequestHeaders = nil
+		return ret
+	}},
+	{"query", func(r *ReportLog, excess int) bool {
+		ret := len(r.Query) > 0
+		r.Query = nil
+		if u, err := url.Parse(r.URL); err == nil && u.RawQuery != "" {
+			u.RawQuery = ""
+			r.URL = u.String()
+			ret = true
+		}
+		return ret
+	}},
+}
+
+// trim shrinks the record until its JSON encoding fits in max bytes, and
+// reports whether it does.
+func (r *ReportLog) trim(max int) bool {
+	for _, step := range trimSteps {
+		trimmed := false
+		for excess := r.size() - max; excess > 0 && step.trim(r, excess); excess = r.size() - max {
+			if !trimmed {
+				// marked before measuring again, as the mark counts too
+				r.Trimmed = append(r.Trimmed, step.part)
+				trimmed = true
+			}
+		}
+	}
+	return r.size() <= max
+}
+
+// size returns the size of the JSON encoding of the record.
+func (r *ReportLog) size() int {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// trimBody truncates body, whose encoding is encoding, by at least excess
+// bytes, and reports whether it was changed. Encrypted and base64-encoded
+// bodies can't be decoded once truncated: they are removed whole.
+func (r *ReportLog) trimBody(body, encoding *string, excess int) bool {
+	if r.Encryption == nil && *encoding == "" {
+		return truncateBody(body, excess)
+	}
+	if *body == "" {
+		return false
+	}
+	*body, *encoding = "", ""
+	if r.RequestBody == "" && r.ResponseBody == "" {
+		r.Encryption = nil
+	}
+	return true
+}
+
+// truncateBody removes at least excess bytes from the end of body, without
+// splitting characters, and reports whether body was truncated.
+func truncateBody(body *string, excess int) bool {
+	if *body == "" {
+		return false
+	}
+	n := len(*body) - excess
+	for n > 0 && !utf8.RuneStart((*body)[n]) {
+		n--
+	}
+	if n < 0 {
+		n = 0
+	}
+	*body = (*body)[:n]
+	return true
+}
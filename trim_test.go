@@ -0,0 +1,127 @@
+package bearer
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportLog_trim(t *testing.T) {
+	record := func() ReportLog {
+		return ReportLog{
+			Type:            recordTypeRequestEnd,
+			URL:             "https://api.example.com/items?page=2",
+			Query:           url.Values{"page": {"2"}},
+			RequestHeaders:  map[string][]string{"Accept": {"application/json"}},
+			ResponseHeaders: map[string][]string{"Content-Type": {"application/json"}},
+			RequestBody:     strings.Repeat("é", 100),
+			ResponseBody:    strings.Repeat("x", 1000),
+		}
+	}
+
+	r := record()
+	assert.True(t, r.trim(r.size()))
+	assert.Empty(t, r.Trimmed, "records which fit are left as is")
+
+	r = record()
+	max := r.size() - 500
+	require.True(t, r.trim(max))
+	assert.LessOrEqual(t, r.size(), max)
+	assert.Equal(t, []string{"responseBody"}, r.Trimmed)
+	assert.NotEmpty(t, r.ResponseBody, "bodies are truncated before being removed")
+
+	r = record()
+	max = r.size() - 1100
+	require.True(t, r.trim(max))
+	assert.LessOrEqual(t, r.size(), max)
+	assert.Equal(t, []string{"responseBody", "requestBody"}, r.Trimmed)
+	assert.Empty(t, r.ResponseBody)
+	assert.True(t, strings.HasPrefix(record().RequestBody, r.RequestBody), "characters aren't split")
+
+	r = record()
+	require.True(t, r.trim(350))
+	assert.Equal(t, []string{"responseBody", "requestBody", "responseHeaders", "requestHeaders", "query"}, r.Trimmed)
+	assert.Equal(t, "https://api.example.com/items", r.URL)
+
+	r = record()
+	assert.False(t, r.trim(10))
+}
+
+func TestReportLog_trim_encoded(t *testing.T) {
+	r := ReportLog{
+		RequestBody:          strings.Repeat("x", 100),
+		ResponseBody:         strings.Repeat("eA==", 100),
+		ResponseBodyEncoding: bodyEncodingBase64,
+	}
+	require.True(t, r.trim(r.size()-10))
+	assert.Equal(t, []string{"responseBody"}, r.Trimmed)
+	assert.Empty(t, r.ResponseBody, "encoded bodies are removed whole")
+	assert.Empty(t, r.ResponseBodyEncoding)
+	assert.Len(t, r.RequestBody, 100)
+}
+
+func TestAgent_MaxRecordSize_encrypted(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{
+		SecretKey:      "sk_test",
+		Transport:      fake,
+		SyncReporting:  true,
+		MaxRecordSize:  1000,
+		BodyEncryption: &RSAKeyWrapper{ID: "key-1", PublicKey: &private.PublicKey},
+	}
+	defer agent.Close()
+
+	agent.report(context.Background(), ReportLog{Type: recordTypeRequestEnd, RequestBody: "small", ResponseBody: strings.Repeat("x", 2000)})
+	record := fake.next(t)
+	assert.Equal(t, []string{"responseBody"}, record.Trimmed)
+	assert.Empty(t, record.ResponseBody, "encrypted bodies are removed whole")
+	require.NotNil(t, record.Encryption)
+
+	// the body left is decrypted as a whole
+	wrapped, err := base64.StdEncoding.DecodeString(record.Encryption.WrappedKey)
+	require.NoError(t, err)
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, private, wrapped, nil)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	data, err := base64.StdEncoding.DecodeString(record.RequestBody)
+	require.NoError(t, err)
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	require.NoError(t, err)
+	assert.Equal(t, "small", string(plain))
+}
+
+func TestAgent_MaxRecordSize(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, SyncReporting: true, MaxRecordSize: 1000}
+	defer agent.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/items", nil)
+	req.Header.Set("Content-Type", "application/json")
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}, Body: http.NoBody}
+	body := ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 2000)))
+	agent.report(req.Context(), newRecord(req, resp, time.Now(), time.Now(), body, nil))
+	record := fake.next(t)
+	assert.Equal(t, []string{"requestBody"}, record.Trimmed)
+
+	agent.MaxRecordSize = 10
+	agent.reportHeartbeat(time.Now(), time.Now())
+	assert.Equal(t, 1, agent.Stats().RecordsDropped, "records which don't fit are dropped")
+}
@@ -1,37 +1,204 @@
 package bearer
 
-import "strings"
+import (
+	"net/url"
+	"strings"
+	"time"
+)
 
 // Config is retrieved from Bearer's API.
 type Config struct {
-	BlockedDomains []string `json:"blockedDomains"`
+	BlockedDomains []string    `json:"blockedDomains"`
+	BlockRules     []BlockRule `json:"blockRules"`
+	// MutationRules modify outgoing requests before they are sent.
+	MutationRules []MutationRule `json:"mutationRules"`
+	// Timezone is the IANA name of the timezone in which time windows are
+	// evaluated, e.g. "Europe/Paris". UTC is used if empty.
+	Timezone string `json:"timezone"`
+	// APINames are the logical names of the APIs served by hosts, keyed by
+	// hostname or wildcard pattern (see Agent.APINames).
+	APINames map[string]string `json:"apiNames"`
+	// RejectRules exclude requests from capture.
+	RejectRules []RejectRule `json:"rejectRules"`
+	// TLSPolicy is the minimum security of the TLS connections of requests,
+	// overriding Agent.TLSPolicy.
+	TLSPolicy *TLSPolicy `json:"tlsPolicy"`
+	// Scrubbers replace values in the bodies of records, after the ones of
+	// Agent.Scrubbers.
+	Scrubbers []Scrubber `json:"scrubbers"`
 	// FIXME: add missing fieldss
+
+	location *time.Location
+}
+
+// Location returns the location of the config's timezone, or UTC if it is
+// unset or unknown. It is resolved once for the configs fetched by the agent,
+// and on every call for the others.
+func (c *Config) Location() *time.Location {
+	if c.location != nil {
+		return c.location
+	}
+	if c.Timezone != "" {
+		if location, err := time.LoadLocation(c.Timezone); err == nil {
+			return location
+		}
+	}
+	return time.UTC
 }
 
-// reportLog is the log object sent to Bearer's API.
-type reportLog struct {
-	Protocol        string            `json:"protocol"`
-	Path            string            `json:"path"`
-	Hostname        string            `json:"hostname"`
-	Method          string            `json:"method"`
-	StartedAt       int               `json:"startedAt"`
-	EndedAt         int               `json:"endedAt"`
-	Type            string            `json:"type"`
-	StatusCode      int               `json:"statusCode"`
-	URL             string            `json:"url"`
-	RequestHeaders  map[string]string `json:"requestHeaders"`
-	RequestBody     string            `json:"requestBody"`
-	ResponseHeaders map[string]string `json:"responseHeaders"`
-	ResponseBody    string            `json:"responseBody"`
+const (
+	// recordTypeRequestEnd is the type of records describing outgoing requests.
+	recordTypeRequestEnd = "REQUEST_END"
+	// recordTypeInboundRequestEnd is the type of records describing requests
+	// received and served by the application.
+	recordTypeInboundRequestEnd = "INBOUND_REQUEST_END"
+	// recordTypeSchemaDrift is the type of records describing a change of
+	// the shape of an endpoint's responses.
+	recordTypeSchemaDrift = "SCHEMA_DRIFT"
+	// recordTypeShadowDiff is the type of records describing the differences
+	// between the response to a request and the response to its shadow.
+	recordTypeShadowDiff = "SHADOW_DIFF"
+	// recordTypeSLOSummary is the type of records summarizing the compliance
+	// of an SLO.
+	recordTypeSLOSummary = "SLO_SUMMARY"
+	// recordTypeSyntheticCheck is the type of records describing the result
+	// of a synthetic check.
+	recordTypeSyntheticCheck = "SYNTHETIC_CHECK"
+	// recordTypeSecurityFinding is the type of records describing security
+	// problems found by the agent, e.g. secrets in bodies.
+	recordTypeSecurityFinding = "SECURITY_FINDING"
+	// recordTypeVolumeSummary is the type of records summarizing the volume
+	// of the data exchanged with a host.
+	recordTypeVolumeSummary = "VOLUME_SUMMARY"
+	// recordTypeLargeResponse is the type of records describing responses
+	// exceeding their ResponseSizeLimit.
+	recordTypeLargeResponse = "LARGE_RESPONSE"
+	// recordTypeDiagnostic is the type of records describing problems of
+	// the usage of APIs, e.g. N+1 requests.
+	recordTypeDiagnostic = "DIAGNOSTIC"
+)
+
+const (
+	// recordSchemaVersion is the version of the format of records. It must be
+	// increased, along with a migration in fakebearer, whenever the format
+	// changes incompatibly.
+	recordSchemaVersion = 2
+	// legacySchemaVersion is the version of records with legacy headers,
+	// holding their first value only.
+	legacySchemaVersion = 1
+)
+
+// ReportLog is the record of a request, or of an event of the agent, sent to
+// Bearer's API. Enrichers may modify it before it is sanitized.
+type ReportLog struct {
+	Protocol        string              `json:"protocol"`
+	Path            string              `json:"path"`
+	Hostname        string              `json:"hostname"`
+	Method          string              `json:"method"`
+	StartedAt       int                 `json:"startedAt"`
+	EndedAt         int                 `json:"endedAt"`
+	Duration        float64             `json:"duration"`
+	ErrorCategory   string              `json:"errorCategory,omitempty"`
+	ErrorMessage    string              `json:"errorMessage,omitempty"`
+	Canceled        bool                `json:"canceled,omitempty"`
+	Health          *agentHealth        `json:"health,omitempty"`
+	Heartbeat       *agentHeartbeat     `json:"heartbeat,omitempty"`
+	Type            string              `json:"type"`
+	StatusCode      int                 `json:"statusCode"`
+	URL             string              `json:"url"`
+	Port            int                 `json:"port,omitempty"`
+	Query           url.Values          `json:"query,omitempty"`
+	RequestHeaders  map[string][]string `json:"requestHeaders"`
+	RequestBody     string              `json:"requestBody"`
+	ResponseHeaders map[string][]string `json:"responseHeaders"`
+	ResponseBody    string              `json:"responseBody"`
+	// The sizes and digests of bodies are set for bodies too large to be captured.
+	RequestBodySize    int    `json:"requestBodySize,omitempty"`
+	RequestBodySHA256  string `json:"requestBodySha256,omitempty"`
+	ResponseBodySize   int    `json:"responseBodySize,omitempty"`
+	ResponseBodySHA256 string `json:"responseBodySha256,omitempty"`
+	// The encodings of bodies are "base64" for bodies which aren't valid
+	// UTF-8, with Base64Bodies.
+	RequestBodyEncoding  string `json:"requestBodyEncoding,omitempty"`
+	ResponseBodyEncoding string `json:"responseBodyEncoding,omitempty"`
+	// Encryption is set for records whose bodies are encrypted.
+	Encryption *bodyEncryption `json:"encryption,omitempty"`
+	// The references of bodies are set for bodies sent once per batch, by digest.
+	RequestBodyRef  string           `json:"requestBodyRef,omitempty"`
+	ResponseBodyRef string           `json:"responseBodyRef,omitempty"`
+	ID              string           `json:"id,omitempty"`
+	ParentID        string           `json:"parentId,omitempty"`
+	Attempt         int              `json:"attempt,omitempty"`
+	Endpoint        string           `json:"endpoint,omitempty"`
+	TraceID         string           `json:"traceId,omitempty"`
+	RequestID       string           `json:"requestId,omitempty"`
+	WouldBlock      bool             `json:"wouldBlock,omitempty"`
+	Mutations       []string         `json:"mutations,omitempty"`
+	Violations      []string         `json:"violations,omitempty"`
+	SchemaDrift     *SchemaDrift     `json:"schemaDrift,omitempty"`
+	ShadowURL       string           `json:"shadowUrl,omitempty"`
+	Differences     []string         `json:"differences,omitempty"`
+	SLO             *sloSummary      `json:"slo,omitempty"`
+	RateLimit       *rateLimitRecord `json:"rateLimit,omitempty"`
+	Failover        string           `json:"failover,omitempty"`
+	Backend         string           `json:"backend,omitempty"`
+	AddressOverride string           `json:"addressOverride,omitempty"`
+	// Kubernetes identifies the pod of the application, if any.
+	Kubernetes *kubernetesWorkload `json:"kubernetes,omitempty"`
+	// Service identifies the application.
+	Service *serviceIdentity `json:"service,omitempty"`
+	// Cloud identifies the serverless service of the application, if any.
+	Cloud *cloudEnvironment `json:"cloud,omitempty"`
+	// Webhook describes the webhook delivery of inbound requests received
+	// by WebhookHandler.
+	Webhook *webhookDelivery `json:"webhook,omitempty"`
+	// API is the logical name of the API of the request, if named.
+	API string `json:"api,omitempty"`
+	// HostClass is the class of the host of the request.
+	HostClass HostClass `json:"hostClass,omitempty"`
+	// Attributes are set by custom enrichers.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Check is the result of the synthetic check of SYNTHETIC_CHECK records.
+	Check *checkResult `json:"check,omitempty"`
+	// Insecure is set for the requests to external hosts over cleartext
+	// HTTP.
+	Insecure bool `json:"insecure,omitempty"`
+	// TLSViolation describes how the TLS connection of the request violated
+	// the TLS policy, if it did.
+	TLSViolation string `json:"tlsViolation,omitempty"`
+	// Volume is the volume exchanged with a host, in VOLUME_SUMMARY records.
+	Volume *volumeSummary `json:"volume,omitempty"`
+	// Duplicates is the number of identical requests performed for the same
+	// inbound request, including this one, once it reaches
+	// DuplicateCallThreshold.
+	Duplicates int `json:"duplicates,omitempty"`
+	// Pagination locates the request in a sequence of pages.
+	Pagination *pagination `json:"pagination,omitempty"`
+	// Diagnostic is the problem of DIAGNOSTIC records.
+	Diagnostic *diagnostic `json:"diagnostic,omitempty"`
+	// LargeResponse is the size of the response of LARGE_RESPONSE records.
+	LargeResponse *largeResponse `json:"largeResponse,omitempty"`
+	// Finding is the security problem of SECURITY_FINDING records.
+	Finding *SecurityFinding `json:"finding,omitempty"`
+	// Probe is set for the records of the synthetic requests of Probe.
+	Probe bool `json:"probe,omitempty"`
+	// UUID identifies the record, so that it is counted once however many
+	// times it is sent.
+	UUID string `json:"uuid,omitempty"`
+	// Trimmed are the parts of the record trimmed to fit in MaxRecordSize,
+	// e.g. "responseBody" or "query".
+	Trimmed []string `json:"trimmed,omitempty"`
+	// SchemaVersion is the version of the format of the record.
+	SchemaVersion int `json:"schemaVersion"`
 	// FIXME: Instrumentation
 }
 
 // RequestContentType returns the value of the requesting "Content-Type" HTTP header.
-func (r reportLog) RequestContentType() string {
+func (r ReportLog) RequestContentType() string {
 	if r.RequestHeaders != nil {
 		for k, v := range r.RequestHeaders {
-			if strings.ToLower(k) == "content-type" {
-				return v
+			if strings.ToLower(k) == "content-type" && len(v) > 0 {
+				return v[0]
 			}
 		}
 	}
@@ -39,11 +206,11 @@ func (r reportLog) RequestContentType() string {
 }
 
 // ResponseContentType returns the value of the replying "Content-Type" HTTP header.
-func (r reportLog) ResponseContentType() string {
+func (r ReportLog) ResponseContentType() string {
 	if r.ResponseHeaders != nil {
 		for k, v := range r.ResponseHeaders {
-			if strings.ToLower(k) == "content-type" {
-				return v
+			if strings.ToLower(k) == "content-type" && len(v) > 0 {
+				return v[0]
 			}
 		}
 	}
@@ -0,0 +1,38 @@
+package bearer
+
+import (
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+)
+
+// withoutUserinfo returns u without the "user:password@" credentials
+// embedded in it, if any.
+func withoutUserinfo(u *url.URL) *url.URL {
+	if u.User == nil {
+		return u
+	}
+	ret := *u
+	ret.User = nil
+	return &ret
+}
+
+// redactedURL returns u without its userinfo and query, and with the
+// sensitive values of its path filtered, for logs and the URLs of records
+// which aren't sanitized.
+func redactedURL(u *url.URL) string {
+	path := sensitiveValues.ReplaceAllString(u.EscapedPath(), defaultSensitivePlaceholder)
+	return u.Scheme + "://" + normalizeURL(u).Host + path
+}
+
+// warnURLCredentials warns, once per host, that req embeds credentials in
+// its URL. They are left out of records, but may leak in other logs.
+func (a *Agent) warnURLCredentials(req *http.Request) {
+	if req.URL.User == nil {
+		return
+	}
+	if _, warned := a.urlCredentials.LoadOrStore(req.URL.Host, true); !warned {
+		a.logger().Warn("credentials embedded in URL", zap.String("host", req.URL.Host))
+	}
+}
@@ -0,0 +1,32 @@
+package bearer
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+// bodyEncodingBase64 is the encoding of base64-encoded bodies.
+const bodyEncodingBase64 = "base64"
+
+// encodeInvalidBodies makes the bodies of the record valid UTF-8, so that
+// they are reported the same whatever the encoding of reports: invalid
+// bodies are base64-encoded if base64Encoded is set, or have their invalid
+// bytes replaced by U+FFFD.
+func (r *ReportLog) encodeInvalidBodies(base64Encoded bool) {
+	r.RequestBodyEncoding = encodeInvalidBody(&r.RequestBody, base64Encoded)
+	r.ResponseBodyEncoding = encodeInvalidBody(&r.ResponseBody, base64Encoded)
+}
+
+// encodeInvalidBody makes body valid UTF-8, and returns its encoding.
+func encodeInvalidBody(body *string, base64Encoded bool) string {
+	if utf8.ValidString(*body) {
+		return ""
+	}
+	if base64Encoded {
+		*body = base64.StdEncoding.EncodeToString([]byte(*body))
+		return bodyEncodingBase64
+	}
+	*body = strings.ToValidUTF8(*body, string(utf8.RuneError))
+	return ""
+}
@@ -0,0 +1,40 @@
+package bearer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportLog_encodeInvalidBodies(t *testing.T) {
+	record := ReportLog{RequestBody: "héllo", ResponseBody: "a\xffb"}
+	record.encodeInvalidBodies(false)
+	assert.Equal(t, "héllo", record.RequestBody)
+	assert.Equal(t, "a�b", record.ResponseBody)
+	assert.Empty(t, record.ResponseBodyEncoding)
+
+	record = ReportLog{RequestBody: "héllo", ResponseBody: "a\xffb"}
+	record.encodeInvalidBodies(true)
+	assert.Equal(t, "héllo", record.RequestBody)
+	assert.Empty(t, record.RequestBodyEncoding)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("a\xffb")), record.ResponseBody)
+	assert.Equal(t, "base64", record.ResponseBodyEncoding)
+}
+
+func TestAgent_Base64Bodies(t *testing.T) {
+	var buf bytes.Buffer
+	agent := &Agent{ReportWriter: &buf, Base64Bodies: true, SyncReporting: true}
+	agent.report(context.Background(), ReportLog{Type: recordTypeRequestEnd, ResponseBody: "\x00\xff\xfe"})
+
+	var record ReportLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "base64", record.ResponseBodyEncoding)
+	body, err := base64.StdEncoding.DecodeString(record.ResponseBody)
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\xff\xfe", string(body))
+}
@@ -2,15 +2,29 @@ package bearer
 
 import "net/http"
 
-func goHeadersToBearerHeaders(input http.Header) map[string]string {
+// goHeadersToBearerHeaders returns a copy of input, which records may modify.
+func goHeadersToBearerHeaders(input http.Header) map[string][]string {
 	if input == nil {
 		return nil
 	}
-	ret := map[string]string{}
+	ret := make(map[string][]string, len(input))
 	for key, values := range input {
-		// bearer headers only support one value per key
-		// so we take the first one and ignore the other ones
-		ret[key] = values[0]
+		ret[key] = append([]string(nil), values...)
+	}
+	return ret
+}
+
+// legacyHeaders returns headers with their first value only, as reported
+// before records supported repeated headers.
+func legacyHeaders(headers map[string][]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(headers))
+	for key, values := range headers {
+		if len(values) > 0 {
+			ret[key] = values[0]
+		}
 	}
 	return ret
 }
@@ -0,0 +1,135 @@
+package bearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// agentName identifies this agent to Bearer's API.
+	agentName = "bearer-go"
+
+	// protocolVersion is the version of the format of the requests sent to
+	// Bearer's API.
+	protocolVersion = "1"
+
+	// minimumVersionHeader is the response header through which Bearer's API
+	// announces the oldest agent version it supports.
+	minimumVersionHeader = "Bearer-Minimum-Version"
+)
+
+// VersionError is returned by calls to Bearer's API which rejected the
+// version of the agent or of its protocol. It matches ErrUnsupportedVersion.
+type VersionError struct {
+	// Version is the version of the agent.
+	Version string
+	// MinimumVersion is the oldest version supported, if known.
+	MinimumVersion string
+	// Message is the explanation given by the API, if any.
+	Message string
+}
+
+func (e *VersionError) Error() string {
+	msg := fmt.Sprintf("bearer: unsupported agent version %s", e.Version)
+	if e.MinimumVersion != "" {
+		msg += fmt.Sprintf(", minimum is %s", e.MinimumVersion)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap returns ErrUnsupportedVersion.
+func (e *VersionError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+// setAgentHeaders identifies the agent in a request to Bearer's API.
+func setAgentHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", agentName+"/"+version)
+	req.Header.Set("Bearer-Agent", agentName)
+	req.Header.Set("Bearer-Agent-Version", version)
+	req.Header.Set("Bearer-Protocol-Version", protocolVersion)
+}
+
+// checkVersion returns a *VersionError if resp, from Bearer's API, rejects
+// the version of the agent, and logs a warning once if it announces that the
+// version is deprecated. The body of rejections is consumed.
+func (a *Agent) checkVersion(resp *http.Response) error {
+	minimum := resp.Header.Get(minimumVersionHeader)
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		if minimum != "" && compareVersions(version, minimum) < 0 {
+			a.deprecation.Do(func() {
+				a.logger().Warn("bearer agent version is deprecated, please upgrade",
+					zap.String("version", version), zap.String("minimumVersion", minimum))
+			})
+		}
+		return nil
+	}
+
+	var body struct {
+		MinimumVersion string `json:"minimumVersion"`
+		Message        string `json:"message"`
+	}
+	if data, err := ioutil.ReadAll(resp.Body); err == nil {
+		_ = json.Unmarshal(data, &body)
+	}
+	if minimum == "" {
+		minimum = body.MinimumVersion
+	}
+	return &VersionError{Version: version, MinimumVersion: minimum, Message: body.Message}
+}
+
+// compareVersions compares two semantic versions, with an optional "v"
+// prefix, and returns -1, 0 or 1. Pre-release and build suffixes are
+// ignored. Versions which aren't numbered, such as development builds, are
+// newer than any numbered one.
+func compareVersions(a, b string) int {
+	partsA, okA := versionParts(a)
+	partsB, okB := versionParts(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+	for i := range partsA {
+		if partsA[i] != partsB[i] {
+			if partsA[i] < partsB[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts returns the major, minor and patch numbers of version.
+func versionParts(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	fields := strings.Split(version, ".")
+	if len(fields) > len(parts) {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,75 @@
+package bearer
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.2.3-rc.1", "1.2.3", 0},
+		{"dev", "1.0.0", 1},
+		{"1.0.0", "dev", -1},
+		{"dev", "dev", 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, compareVersions(test.a, test.b), "%s vs %s", test.a, test.b)
+	}
+}
+
+func TestAgent_VersionNegotiation(t *testing.T) {
+	var headers []http.Header
+	respond := func(status int, header http.Header, body string) *Agent {
+		headers = nil
+		return &Agent{SecretKey: "sk_test", Transport: RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			headers = append(headers, req.Header)
+			return &http.Response{StatusCode: status, Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+		})}
+	}
+
+	t.Run("headers", func(t *testing.T) {
+		agent := respond(200, http.Header{}, `{}`)
+		_, err := agent.Config()
+		require.NoError(t, err)
+		require.NoError(t, agent.logRecords([]ReportLog{{Type: recordTypeRequestEnd}}))
+		require.Len(t, headers, 2)
+		for _, header := range headers {
+			assert.Equal(t, "bearer-go/"+version, header.Get("User-Agent"))
+			assert.Equal(t, "bearer-go", header.Get("Bearer-Agent"))
+			assert.Equal(t, version, header.Get("Bearer-Agent-Version"))
+			assert.Equal(t, protocolVersion, header.Get("Bearer-Protocol-Version"))
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		agent := respond(http.StatusUpgradeRequired, http.Header{}, `{"minimumVersion":"2.0.0","message":"protocol 1 was retired"}`)
+		_, err := agent.Config()
+		assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+		var versionErr *VersionError
+		require.True(t, errors.As(err, &versionErr))
+		assert.Equal(t, &VersionError{Version: version, MinimumVersion: "2.0.0", Message: "protocol 1 was retired"}, versionErr)
+
+		err = agent.logRecords([]ReportLog{{Type: recordTypeRequestEnd}})
+		assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+	})
+
+	t.Run("deprecated", func(t *testing.T) {
+		agent := respond(200, http.Header{minimumVersionHeader: {"2.0.0"}}, `{}`)
+		_, err := agent.Config()
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,212 @@
+package bearer
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxVolumeHosts bounds the number of hosts whose volumes are tracked.
+const maxVolumeHosts = 1000
+
+// HostVolume is the volume of the data exchanged with a host: the bodies of
+// the requests sent to it and of the responses it sent back.
+type HostVolume struct {
+	Host          string
+	Requests      int
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// RequestVolume is the volume of the bodies of a request and its response.
+type RequestVolume struct {
+	Host string
+	// API is the logical name of the host's API, if named (see Agent.APINames).
+	API           string
+	Method        string
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// VolumeSink is implemented by the MetricsSinks which also receive the
+// volume of requests, once their responses are read entirely or closed.
+type VolumeSink interface {
+	ObserveVolume(RequestVolume)
+}
+
+// volumeTracker holds the volume of the data exchanged with each host.
+type volumeTracker struct {
+	mutex sync.Mutex
+	hosts map[string]*HostVolume
+	// summarized are the volumes as of the last summary record.
+	summarized map[string]HostVolume
+	summary    sync.Once
+}
+
+// add adds a request, if request is set, and bytes to the volume of host,
+// unless too many hosts are tracked already.
+func (t *volumeTracker) add(host string, request bool, sent, received int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.hosts == nil {
+		t.hosts = map[string]*HostVolume{}
+	}
+	volume := t.hosts[host]
+	if volume == nil {
+		if len(t.hosts) >= maxVolumeHosts {
+			return
+		}
+		volume = &HostVolume{Host: host}
+		t.hosts[host] = volume
+	}
+	if request {
+		volume.Requests++
+	}
+	volume.BytesSent += sent
+	volume.BytesReceived += received
+}
+
+// volumes returns the volumes of the hosts, sorted by host.
+func (t *volumeTracker) volumes() []HostVolume {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.hosts) == 0 {
+		return nil
+	}
+	volumes := make([]HostVolume, 0, len(t.hosts))
+	for _, volume := range t.hosts {
+		volumes = append(volumes, *volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Host < volumes[j].Host })
+	return volumes
+}
+
+// countingBody counts the bytes read from a body as they are read, and
+// calls done with their number once the body is read entirely or closed.
+type countingBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *countingBody) count() int64 {
+	return atomic.LoadInt64(&b.n)
+}
+
+func (b *countingBody) finish() {
+	b.once.Do(func() { b.done(b.count()) })
+}
+
+// countRequest returns a copy of req whose body is counted, without being
+// buffered, and the counter of its body, nil if it has none.
+func (a *Agent) countRequest(req *http.Request) (*http.Request, *countingBody) {
+	a.observeVolume()
+	host := canonicalHost(req.URL)
+	a.volumes.add(host, true, 0, 0)
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body := &countingBody{ReadCloser: req.Body, done: func(n int64) {
+		a.volumes.add(host, false, n, 0)
+	}}
+	counted := *req
+	counted.Body = body
+	return &counted, body
+}
+
+// countResponse counts the body of resp, and passes the volume of the
+// request to the VolumeSinks of MetricsSinks once it is read or closed.
+func (a *Agent) countResponse(req *http.Request, api string, sent *countingBody, resp *http.Response) {
+	host := canonicalHost(req.URL)
+	observe := func(received int64) {
+		volume := RequestVolume{Host: host, API: api, Method: req.Method, BytesReceived: received}
+		if sent != nil {
+			volume.BytesSent = sent.count()
+		}
+		for _, sink := range a.MetricsSinks {
+			if sink, ok := sink.(VolumeSink); ok {
+				sink.ObserveVolume(volume)
+			}
+		}
+	}
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		observe(0)
+		return
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: func(n int64) {
+		a.volumes.add(host, false, 0, n)
+		observe(n)
+	}}
+}
+
+// observeVolume starts reporting volume summaries, with VolumeSummaryEvery.
+func (a *Agent) observeVolume() {
+	if a.VolumeSummaryEvery > 0 && a.isAvailable() {
+		a.volumes.summary.Do(func() { a.goWorker(a.reportVolumeSummaries) })
+	}
+}
+
+// volumeSummary is the volume of the data exchanged with a host during the
+// period of a VOLUME_SUMMARY record.
+type volumeSummary struct {
+	Requests      int   `json:"requests"`
+	BytesSent     int64 `json:"bytesSent"`
+	BytesReceived int64 `json:"bytesReceived"`
+}
+
+// reportVolumeSummaries reports the volume exchanged with each host since
+// the previous summary regularly.
+func (a *Agent) reportVolumeSummaries() {
+	defer a.recoverPanic()
+	since := time.Now()
+	for a.sleep(a.VolumeSummaryEvery) {
+		now := time.Now()
+		volumes := a.volumes.volumes()
+		t := &a.volumes
+		t.mutex.Lock()
+		previous := t.summarized
+		t.summarized = make(map[string]HostVolume, len(volumes))
+		for _, volume := range volumes {
+			t.summarized[volume.Host] = volume
+		}
+		t.mutex.Unlock()
+		for _, volume := range volumes {
+			last := previous[volume.Host]
+			summary := volumeSummary{
+				Requests:      volume.Requests - last.Requests,
+				BytesSent:     volume.BytesSent - last.BytesSent,
+				BytesReceived: volume.BytesReceived - last.BytesReceived,
+			}
+			if summary == (volumeSummary{}) {
+				continue
+			}
+			a.report(a.context(), ReportLog{
+				Type:      recordTypeVolumeSummary,
+				Hostname:  volume.Host,
+				StartedAt: int(since.UnixNano() / 1000000),
+				EndedAt:   int(now.UnixNano() / 1000000),
+				Volume:    &summary,
+			})
+		}
+		since = now
+	}
+}
@@ -0,0 +1,84 @@
+package bearer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type volumeSink struct {
+	mutex   sync.Mutex
+	volumes []RequestVolume
+}
+
+func (s *volumeSink) ObserveRequest(RequestMetrics) {}
+
+func (s *volumeSink) ObserveVolume(volume RequestVolume) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.volumes = append(s.volumes, volume)
+}
+
+func TestAgent_Volumes(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("hello world"))
+	}))
+	defer api.Close()
+	sink := &volumeSink{}
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake, MetricsSinks: []MetricsSink{sink}, VolumeSummaryEvery: 10 * time.Millisecond}
+	defer agent.Close()
+	client := &http.Client{Transport: agent.Wrap(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		// the body of the request is streamed, without a known length
+		resp, err := client.Post(api.URL, "application/octet-stream", ioutil.NopCloser(strings.NewReader("12345")))
+		require.NoError(t, err)
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	host := strings.TrimPrefix(api.URL, "http://")
+	assert.Equal(t, []HostVolume{{Host: host, Requests: 2, BytesSent: 10, BytesReceived: 22}}, agent.Stats().Volumes)
+	sink.mutex.Lock()
+	assert.Equal(t, []RequestVolume{
+		{Host: host, Method: "POST", BytesSent: 5, BytesReceived: 11},
+		{Host: host, Method: "POST", BytesSent: 5, BytesReceived: 11},
+	}, sink.volumes)
+	sink.mutex.Unlock()
+
+	// the requests may be summarized in several periods
+	var total volumeSummary
+	for total.Requests < 2 {
+		record := fake.next(t)
+		if record.Type != recordTypeVolumeSummary {
+			continue
+		}
+		assert.Equal(t, host, record.Hostname)
+		require.NotNil(t, record.Volume)
+		total.Requests += record.Volume.Requests
+		total.BytesSent += record.Volume.BytesSent
+		total.BytesReceived += record.Volume.BytesReceived
+	}
+	assert.Equal(t, volumeSummary{Requests: 2, BytesSent: 10, BytesReceived: 22}, total)
+}
+
+func TestVolumeTracker_maxHosts(t *testing.T) {
+	var tracker volumeTracker
+	for i := 0; i < maxVolumeHosts+10; i++ {
+		tracker.add(fmt.Sprintf("host%d.example.com", i), true, 1, 1)
+	}
+	tracker.add("host0.example.com", true, 1, 1)
+	volumes := tracker.volumes()
+	assert.Len(t, volumes, maxVolumeHosts)
+	assert.Equal(t, HostVolume{Host: "host0.example.com", Requests: 2, BytesSent: 2, BytesReceived: 2}, volumes[0])
+}
@@ -0,0 +1,117 @@
+package bearer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+)
+
+// Outcomes of the verification of webhook signatures.
+const (
+	webhookVerified = "verified"
+	webhookFailed   = "failed"
+)
+
+// webhookEventHeaders are the headers in which providers send the type of
+// the events they deliver, e.g. "push" for GitHub.
+var webhookEventHeaders = []string{
+	"X-GitHub-Event",
+	"X-Gitlab-Event",
+	"X-Shopify-Topic",
+	"X-Event-Key",
+	"X-Hub-Event",
+}
+
+// webhookDelivery describes a webhook delivered to the application.
+type webhookDelivery struct {
+	// Provider is the provider of the webhook, e.g. "stripe".
+	Provider string `json:"provider"`
+	// Event is the type of event delivered, if sent in a header.
+	Event string `json:"event,omitempty"`
+	// Verification is the outcome of the verification of the delivery's
+	// signature, if verified, and VerificationError its failure reason.
+	Verification      string `json:"verification,omitempty"`
+	VerificationError string `json:"verificationError,omitempty"`
+}
+
+// webhookState is the state of a webhook delivery being handled, stored in
+// the context of its request.
+type webhookState struct {
+	provider string
+	verified bool
+	err      error
+}
+
+// describe returns the description of the delivery of req.
+func (s *webhookState) describe(req *http.Request) *webhookDelivery {
+	webhook := &webhookDelivery{Provider: s.provider}
+	for _, name := range webhookEventHeaders {
+		if event := req.Header.Get(name); event != "" {
+			webhook.Event = event
+			break
+		}
+	}
+	if s.verified {
+		webhook.Verification = webhookVerified
+		if s.err != nil {
+			webhook.Verification = webhookFailed
+			webhook.VerificationError = errorMessage(s.err)
+		}
+	}
+	return webhook
+}
+
+func webhookFromContext(ctx context.Context) *webhookState {
+	state, _ := ctx.Value(webhookKey).(*webhookState)
+	return state
+}
+
+// WebhookHandler returns an http.Handler reporting the webhook deliveries of
+// provider, e.g. "stripe" or "github", served by next, like Middleware does.
+// Their records identify the provider and, if sent in a header, the type of
+// event delivered. The signatures of deliveries are verified by the
+// provider's verifier in WebhookVerifiers, if any; handlers verifying them
+// should report the outcome with WebhookVerified instead.
+func (a *Agent) WebhookHandler(provider string, next http.Handler) http.Handler {
+	if verifier := a.WebhookVerifiers[provider]; verifier != nil {
+		next = a.verifyWebhooks(verifier, next)
+	}
+	middleware := a.Middleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		state := &webhookState{provider: provider}
+		middleware.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), webhookKey, state)))
+	})
+}
+
+// verifyWebhooks returns an http.Handler verifying the signatures of the
+// deliveries served by next with verifier.
+func (a *Agent) verifyWebhooks(verifier WebhookVerifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body []byte
+		if req.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(req.Body); err != nil {
+				http.Error(w, "cannot read body", http.StatusBadRequest)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		err := verifier.VerifyWebhook(req, body)
+		WebhookVerified(req.Context(), err)
+		if err != nil && a.RejectInvalidWebhooks {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// WebhookVerified records the outcome of the verification of the signature
+// of the webhook delivery whose request has ctx, err being nil if the
+// signature is valid. It does nothing outside of WebhookHandler.
+func WebhookVerified(ctx context.Context, err error) {
+	if state := webhookFromContext(ctx); state != nil {
+		state.verified, state.err = true, err
+	}
+}
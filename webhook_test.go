@@ -0,0 +1,59 @@
+package bearer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_WebhookHandler(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	handler := agent.WebhookHandler("github", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Hub-Signature-256") != "sha256=valid" {
+			WebhookVerified(req.Context(), errors.New("signature mismatch"))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		WebhookVerified(req.Context(), nil)
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	deliver := func(signature string) ReportLog {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/webhooks/github", strings.NewReader(`{}`))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", signature)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return fake.next(t)
+	}
+
+	record := deliver("sha256=valid")
+	assert.Equal(t, recordTypeInboundRequestEnd, record.Type)
+	assert.Equal(t, &webhookDelivery{Provider: "github", Event: "push", Verification: "verified"}, record.Webhook)
+
+	record = deliver("sha256=forged")
+	assert.Equal(t, http.StatusUnauthorized, record.StatusCode)
+	assert.Equal(t, &webhookDelivery{Provider: "github", Event: "push", Verification: "failed", VerificationError: "signature mismatch"}, record.Webhook)
+
+	WebhookVerified(httptest.NewRequest(http.MethodGet, "/", nil).Context(), nil) // outside of WebhookHandler
+}
+
+func TestAgent_WebhookHandler_Unverified(t *testing.T) {
+	fake := newFakeBearer(`{}`)
+	agent := &Agent{SecretKey: "sk_test", Transport: fake}
+	ts := httptest.NewServer(agent.WebhookHandler("stripe", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(`{"type":"charge.succeeded"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, &webhookDelivery{Provider: "stripe"}, fake.next(t).Webhook)
+}
@@ -0,0 +1,150 @@
+package bearer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWebhookTolerance is the maximum age of the timestamps of signed
+// webhook deliveries if their verifier's Tolerance isn't set.
+const defaultWebhookTolerance = 5 * time.Minute
+
+var (
+	// errWebhookSignature is the error of deliveries with an invalid signature.
+	errWebhookSignature = errors.New("bearer: invalid webhook signature")
+	// errWebhookTimestamp is the error of deliveries signed too long ago,
+	// which may be replayed.
+	errWebhookTimestamp = errors.New("bearer: webhook timestamp outside of tolerance")
+)
+
+// WebhookVerifier verifies the signatures of webhook deliveries.
+type WebhookVerifier interface {
+	// VerifyWebhook returns an error if the signature of req, whose body is
+	// body, is missing or invalid.
+	VerifyWebhook(req *http.Request, body []byte) error
+}
+
+// WebhookVerifierFunc is an adapter allowing the use of ordinary functions as
+// WebhookVerifier.
+type WebhookVerifierFunc func(req *http.Request, body []byte) error
+
+// VerifyWebhook calls f(req, body).
+func (f WebhookVerifierFunc) VerifyWebhook(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// StripeWebhookVerifier verifies the Stripe-Signature header of Stripe's
+// webhook deliveries.
+type StripeWebhookVerifier struct {
+	// Secret is the signing secret of the endpoint, starting with "whsec_".
+	Secret string
+	// Tolerance is the maximum age of signatures, 5 minutes by default.
+	Tolerance time.Duration
+}
+
+// VerifyWebhook implements the WebhookVerifier interface.
+func (v StripeWebhookVerifier) VerifyWebhook(req *http.Request, body []byte) error {
+	header := req.Header.Get("Stripe-Signature")
+	if header == "" {
+		return errors.New("bearer: missing Stripe-Signature header")
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	if err := checkWebhookTimestamp(timestamp, v.Tolerance); err != nil {
+		return err
+	}
+	expected := webhookHMAC(v.Secret, timestamp+"."+string(body))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return errWebhookSignature
+}
+
+// GitHubWebhookVerifier verifies the X-Hub-Signature-256 header of GitHub's
+// webhook deliveries.
+type GitHubWebhookVerifier struct {
+	// Secret is the secret of the webhook.
+	Secret string
+}
+
+// VerifyWebhook implements the WebhookVerifier interface.
+func (v GitHubWebhookVerifier) VerifyWebhook(req *http.Request, body []byte) error {
+	header := req.Header.Get("X-Hub-Signature-256")
+	if header == "" {
+		return errors.New("bearer: missing X-Hub-Signature-256 header")
+	}
+	if !hmac.Equal([]byte(header), []byte("sha256="+webhookHMAC(v.Secret, string(body)))) {
+		return errWebhookSignature
+	}
+	return nil
+}
+
+// SlackWebhookVerifier verifies the X-Slack-Signature header of the requests
+// sent by Slack.
+type SlackWebhookVerifier struct {
+	// SigningSecret is the signing secret of the Slack app.
+	SigningSecret string
+	// Tolerance is the maximum age of signatures, 5 minutes by default.
+	Tolerance time.Duration
+}
+
+// VerifyWebhook implements the WebhookVerifier interface.
+func (v SlackWebhookVerifier) VerifyWebhook(req *http.Request, body []byte) error {
+	header := req.Header.Get("X-Slack-Signature")
+	if header == "" {
+		return errors.New("bearer: missing X-Slack-Signature header")
+	}
+	timestamp := req.Header.Get("X-Slack-Request-Timestamp")
+	if err := checkWebhookTimestamp(timestamp, v.Tolerance); err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(header), []byte("v0="+webhookHMAC(v.SigningSecret, "v0:"+timestamp+":"+string(body)))) {
+		return errWebhookSignature
+	}
+	return nil
+}
+
+// webhookHMAC returns the hex-encoded HMAC-SHA256 of payload with secret.
+func webhookHMAC(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkWebhookTimestamp returns an error unless timestamp, in seconds since
+// the epoch, is within tolerance of now.
+func checkWebhookTimestamp(timestamp string, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bearer: invalid webhook timestamp %q", timestamp)
+	}
+	if tolerance <= 0 {
+		tolerance = defaultWebhookTolerance
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return errWebhookTimestamp
+	}
+	return nil
+}
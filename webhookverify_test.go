@@ -0,0 +1,98 @@
+package bearer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripeWebhookVerifier(t *testing.T) {
+	verifier := StripeWebhookVerifier{Secret: "whsec_test"}
+	body := []byte(`{"type":"charge.succeeded"}`)
+	sign := func(at time.Time) *http.Request {
+		timestamp := strconv.FormatInt(at.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Stripe-Signature", "t="+timestamp+",v1=other,v1="+webhookHMAC("whsec_test", timestamp+"."+string(body)))
+		return req
+	}
+
+	assert.NoError(t, verifier.VerifyWebhook(sign(time.Now()), body))
+	assert.Equal(t, errWebhookSignature, verifier.VerifyWebhook(sign(time.Now()), []byte(`{}`)))
+	assert.Equal(t, errWebhookTimestamp, verifier.VerifyWebhook(sign(time.Now().Add(-time.Hour)), body))
+	assert.Error(t, verifier.VerifyWebhook(httptest.NewRequest(http.MethodPost, "/", nil), body))
+}
+
+func TestGitHubWebhookVerifier(t *testing.T) {
+	verifier := GitHubWebhookVerifier{Secret: "secret"}
+	body := []byte(`{"action":"opened"}`)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+webhookHMAC("secret", string(body)))
+
+	assert.NoError(t, verifier.VerifyWebhook(req, body))
+	assert.Equal(t, errWebhookSignature, GitHubWebhookVerifier{Secret: "other"}.VerifyWebhook(req, body))
+	assert.Error(t, verifier.VerifyWebhook(httptest.NewRequest(http.MethodPost, "/", nil), body))
+}
+
+func TestSlackWebhookVerifier(t *testing.T) {
+	verifier := SlackWebhookVerifier{SigningSecret: "secret", Tolerance: time.Minute}
+	body := []byte(`token=x&command=/deploy`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+webhookHMAC("secret", "v0:"+timestamp+":"+string(body)))
+
+	assert.NoError(t, verifier.VerifyWebhook(req, body))
+	assert.Equal(t, errWebhookSignature, verifier.VerifyWebhook(req, []byte(`token=y`)))
+	req.Header.Set("X-Slack-Request-Timestamp", "soon")
+	assert.Error(t, verifier.VerifyWebhook(req, body))
+}
+
+func TestAgent_WebhookVerifiers(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		fake := newFakeBearer(`{}`)
+		agent := &Agent{
+			SecretKey:             "sk_test",
+			Transport:             fake,
+			WebhookVerifiers:      map[string]WebhookVerifier{"github": GitHubWebhookVerifier{Secret: "secret"}},
+			RejectInvalidWebhooks: reject,
+		}
+		var handled []string
+		ts := httptest.NewServer(agent.WebhookHandler("github", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body := make([]byte, 64)
+			n, _ := req.Body.Read(body)
+			handled = append(handled, string(body[:n]))
+		})))
+
+		deliver := func(signature string) ReportLog {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{"action":"opened"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Hub-Signature-256", signature)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			return fake.next(t)
+		}
+
+		record := deliver("sha256=" + webhookHMAC("secret", `{"action":"opened"}`))
+		assert.Equal(t, "verified", record.Webhook.Verification)
+		assert.Equal(t, `{"action":"opened"}`, record.RequestBody)
+
+		record = deliver("sha256=forged")
+		assert.Equal(t, "failed", record.Webhook.Verification)
+		assert.Equal(t, errWebhookSignature.Error(), record.Webhook.VerificationError)
+		if reject {
+			assert.Equal(t, http.StatusUnauthorized, record.StatusCode)
+			assert.Equal(t, []string{`{"action":"opened"}`}, handled, "invalid deliveries aren't handled")
+		} else {
+			assert.Equal(t, http.StatusOK, record.StatusCode)
+			assert.Len(t, handled, 2)
+		}
+		ts.Close()
+	}
+}
@@ -0,0 +1,80 @@
+// Package zerologbearer writes the logs of the agent to a zerolog logger.
+// The agent logs with zap, so applications already using zap set
+// Agent.Logger directly, and those using github.com/rs/zerolog wrap their
+// logger:
+//
+//	agent.Logger = zerologbearer.NewLogger(log.Logger)
+package zerologbearer
+
+import (
+	"github.com/rs/zerolog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger returns a zap logger writing to logger, for Agent.Logger. The
+// entries below the level of logger are discarded.
+func NewLogger(logger zerolog.Logger) *zap.Logger {
+	return zap.New(&core{logger: logger})
+}
+
+// core is a zapcore.Core writing entries to a zerolog logger.
+type core struct {
+	logger zerolog.Logger
+	fields []zapcore.Field
+}
+
+// level returns the zerolog level of a zap level. Panic and fatal entries
+// are written with their level, zap panicking or exiting afterwards.
+func level(l zapcore.Level) zerolog.Level {
+	switch l {
+	case zapcore.DebugLevel:
+		return zerolog.DebugLevel
+	case zapcore.InfoLevel:
+		return zerolog.InfoLevel
+	case zapcore.WarnLevel:
+		return zerolog.WarnLevel
+	case zapcore.ErrorLevel, zapcore.DPanicLevel:
+		return zerolog.ErrorLevel
+	case zapcore.PanicLevel:
+		return zerolog.PanicLevel
+	case zapcore.FatalLevel:
+		return zerolog.FatalLevel
+	}
+	return zerolog.NoLevel
+}
+
+func (c *core) Enabled(l zapcore.Level) bool {
+	return level(l) >= c.logger.GetLevel() && level(l) >= zerolog.GlobalLevel()
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{logger: c.logger, fields: append(append([]zapcore.Field(nil), c.fields...), fields...)}
+}
+
+func (c *core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(encoder)
+	}
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	event := c.logger.WithLevel(level(entry.Level))
+	if entry.LoggerName != "" {
+		event = event.Str("logger", entry.LoggerName)
+	}
+	event.Fields(encoder.Fields).Msg(entry.Message)
+	return nil
+}
+
+func (c *core) Sync() error {
+	return nil
+}
@@ -0,0 +1,34 @@
+package zerologbearer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	logger.Debug("discarded")
+	logger.With(zap.String("host", "api.example.com")).Warn("log records", zap.Int("records", 3), zap.Error(errors.New("timeout")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1, "entries below the level are discarded")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"level":   "warn",
+		"message": "log records",
+		"host":    "api.example.com",
+		"records": float64(3),
+		"error":   "timeout",
+	}, entry)
+}